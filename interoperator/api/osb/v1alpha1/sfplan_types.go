@@ -31,11 +31,14 @@ const (
 	UnbindAction               = "unbind"
 	SourcesAction              = "sources"
 	ClusterLabelSelectorAction = "clusterSelector"
+	BackupAction               = "backup"
+	RestoreAction              = "restore"
+	MigrateAction              = "migrate"
 )
 
 // TemplateSpec is the specifcation of a template
 type TemplateSpec struct {
-	// +kubebuilder:validation:Enum=provision;status;bind;unbind;sources;clusterSelector
+	// +kubebuilder:validation:Enum=provision;status;bind;unbind;sources;clusterSelector;backup;restore;migrate
 	Action string `yaml:"action" json:"action"`
 
 	// +kubebuilder:validation:Enum=gotemplate;helm
@@ -146,3 +149,14 @@ func (sfPlan *SFPlan) GetTemplate(action string) (*TemplateSpec, error) {
 	}
 	return nil, errors.NewTemplateNotFound(action, sfPlan.Spec.ID, nil)
 }
+
+// IsMigratable returns true if the plan provides the backup and restore
+// templates required to move the data of its instances to another cluster
+func (sfPlan *SFPlan) IsMigratable() bool {
+	for _, action := range []string{BackupAction, RestoreAction} {
+		if _, err := sfPlan.GetTemplate(action); err != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -55,6 +55,9 @@ type SFServiceBindingStatus struct {
 	Response    BindingResponse      `yaml:"response,omitempty" json:"response,omitempty"`
 	AppliedSpec SFServiceBindingSpec `yaml:"appliedSpec,omitempty" json:"appliedSpec,omitempty"`
 	Resources   []Source             `yaml:"resources,omitempty" json:"resources,omitempty"`
+	// ObservedGeneration is the generation of the binding when the
+	// provisioner picked up the last operation
+	ObservedGeneration int64 `yaml:"observedGeneration,omitempty" json:"observedGeneration,omitempty"`
 }
 
 // BindingResponse defines the details of the binding response
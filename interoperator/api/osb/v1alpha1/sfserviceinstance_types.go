@@ -19,6 +19,7 @@ package v1alpha1
 import (
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
 
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -60,6 +61,76 @@ type SFServiceInstanceStatus struct {
 	UpdateRepeatable string                `yaml:"updateRepeatable,omitempty" json:"updateRepeatable,omitempty"`
 	AppliedSpec      SFServiceInstanceSpec `yaml:"appliedSpec,omitempty" json:"appliedSpec,omitempty"`
 	Resources        []Source              `yaml:"resources,omitempty" json:"resources,omitempty"`
+	Migration        *MigrationStatus      `yaml:"migration,omitempty" json:"migration,omitempty"`
+	Scheduling       *SchedulingStatus     `yaml:"scheduling,omitempty" json:"scheduling,omitempty"`
+	// Usage is the aggregate cpu and memory requests of the pods and the
+	// storage requests of the persistent volume claims of the instance
+	Usage corev1.ResourceList `yaml:"usage,omitempty" json:"usage,omitempty"`
+	// ObservedGeneration is the generation of the instance when the
+	// provisioner picked up the last operation
+	ObservedGeneration int64 `yaml:"observedGeneration,omitempty" json:"observedGeneration,omitempty"`
+}
+
+// Phases of the migration of a SFServiceInstance
+const (
+	MigrationPhasePending      = "Pending"
+	MigrationPhaseBackup       = "Backup"
+	MigrationPhaseProvisioning = "Provisioning"
+	MigrationPhaseRestore      = "Restore"
+	MigrationPhaseCutover      = "Cutover"
+	MigrationPhaseCleanup      = "Cleanup"
+	MigrationPhaseSucceeded    = "Succeeded"
+	MigrationPhaseFailed       = "Failed"
+)
+
+// MigrationStatus defines the observed state of the migration of a
+// SFServiceInstance from one cluster to another
+type MigrationStatus struct {
+	SourceClusterID string       `yaml:"sourceClusterId,omitempty" json:"sourceClusterId,omitempty"`
+	TargetClusterID string       `yaml:"targetClusterId,omitempty" json:"targetClusterId,omitempty"`
+	Phase           string       `yaml:"phase,omitempty" json:"phase,omitempty"`
+	Error           string       `yaml:"error,omitempty" json:"error,omitempty"`
+	StartTime       *metav1.Time `yaml:"startTime,omitempty" json:"startTime,omitempty"`
+	CompletionTime  *metav1.Time `yaml:"completionTime,omitempty" json:"completionTime,omitempty"`
+	// SourceCountReleased is set before the instance is removed from the
+	// ServiceInstanceCount of the source cluster
+	SourceCountReleased bool `yaml:"sourceCountReleased,omitempty" json:"sourceCountReleased,omitempty"`
+	// TargetCountAdded is set before the instance is added to the
+	// ServiceInstanceCount of the target cluster
+	TargetCountAdded bool `yaml:"targetCountAdded,omitempty" json:"targetCountAdded,omitempty"`
+	// InstanceCountMoved is set once the instance is moved from the
+	// ServiceInstanceCount of the source cluster to the target cluster
+	InstanceCountMoved bool `yaml:"instanceCountMoved,omitempty" json:"instanceCountMoved,omitempty"`
+}
+
+// SchedulingStatus records the last scheduling decision for a SFServiceInstance
+type SchedulingStatus struct {
+	// Profile is the scheduler profile used for the decision
+	Profile string `yaml:"profile,omitempty" json:"profile,omitempty"`
+	// LabelSelector is the rendered clusterSelector template of the plan
+	LabelSelector string `yaml:"labelSelector,omitempty" json:"labelSelector,omitempty"`
+	// SelectedCluster is the cluster chosen for the instance. It is empty if
+	// none of the clusters were feasible.
+	SelectedCluster string `yaml:"selectedCluster,omitempty" json:"selectedCluster,omitempty"`
+	// Message summarizes the decision
+	Message string `yaml:"message,omitempty" json:"message,omitempty"`
+	// Clusters are the evaluated candidate clusters
+	Clusters []ClusterSchedulingStatus `yaml:"clusters,omitempty" json:"clusters,omitempty"`
+	Time     *metav1.Time              `yaml:"time,omitempty" json:"time,omitempty"`
+}
+
+// ClusterSchedulingStatus records the evaluation of one candidate cluster
+type ClusterSchedulingStatus struct {
+	ClusterID string `yaml:"clusterId" json:"clusterId"`
+	Feasible  bool   `yaml:"feasible" json:"feasible"`
+	// Plugin is the filter plugin which filtered out the cluster
+	Plugin string `yaml:"plugin,omitempty" json:"plugin,omitempty"`
+	// Reason is the reason the cluster was filtered out
+	Reason string `yaml:"reason,omitempty" json:"reason,omitempty"`
+	// Scores are the weighted scores of the cluster by score plugin
+	Scores map[string]int64 `yaml:"scores,omitempty" json:"scores,omitempty"`
+	// Score is the total score of the cluster
+	Score int64 `yaml:"score,omitempty" json:"score,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -117,3 +188,16 @@ func (r *SFServiceInstance) GetClusterID() (string, error) {
 	}
 	return r.Spec.ClusterID, nil
 }
+
+// IsActive returns true if the migration is not yet completed
+func (migration *MigrationStatus) IsActive() bool {
+	if migration == nil {
+		return false
+	}
+	switch migration.Phase {
+	case MigrationPhasePending, MigrationPhaseBackup, MigrationPhaseProvisioning,
+		MigrationPhaseRestore, MigrationPhaseCutover, MigrationPhaseCleanup:
+		return true
+	}
+	return false
+}
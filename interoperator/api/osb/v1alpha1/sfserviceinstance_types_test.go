@@ -210,3 +210,34 @@ func TestSFServiceInstance_SetState(t *testing.T) {
 		})
 	}
 }
+
+func TestMigrationStatus_IsActive(t *testing.T) {
+	tests := []struct {
+		name      string
+		migration *MigrationStatus
+		want      bool
+	}{
+		{
+			name:      "return false if there is no migration",
+			migration: nil,
+			want:      false,
+		},
+		{
+			name:      "return true if the migration is in progress",
+			migration: &MigrationStatus{Phase: MigrationPhaseRestore},
+			want:      true,
+		},
+		{
+			name:      "return false if the migration is completed",
+			migration: &MigrationStatus{Phase: MigrationPhaseFailed},
+			want:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.migration.IsActive(); got != tt.want {
+				t.Errorf("MigrationStatus.IsActive() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -17,7 +17,10 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"math"
+
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 // ResourceListEqual return true if ResourceList x is equal to y. Otherwise returns false
@@ -104,3 +107,31 @@ func ResourceListSub(x, y corev1.ResourceList) {
 		}
 	}
 }
+
+// maxMilliScalable is the largest value whose milli value can be multiplied
+// by a percentage without overflowing int64
+const maxMilliScalable = math.MaxInt64 / 1000 / 100
+
+// ResourceListPercentage returns a new ResourceList with every quantity in
+// the ResourceList x scaled to the given percentage.
+// If x is nil it returns nil
+func ResourceListPercentage(x corev1.ResourceList, percentage int) corev1.ResourceList {
+	if x == nil {
+		return nil
+	}
+
+	result := make(corev1.ResourceList)
+	for key, quantity := range x {
+		value := quantity.Value()
+		if value < maxMilliScalable && value > -maxMilliScalable {
+			scaled := quantity.MilliValue() * int64(percentage) / 100
+			result[key] = *resource.NewMilliQuantity(scaled, quantity.Format)
+		} else {
+			// Large quantities are scaled in whole units so that the
+			// product does not overflow
+			scaled := value/100*int64(percentage) + value%100*int64(percentage)/100
+			result[key] = *resource.NewQuantity(scaled, quantity.Format)
+		}
+	}
+	return result
+}
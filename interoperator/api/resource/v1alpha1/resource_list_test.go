@@ -336,3 +336,84 @@ func TestResourceListSub(t *testing.T) {
 		})
 	}
 }
+
+func TestResourceListPercentage(t *testing.T) {
+	type args struct {
+		x          corev1.ResourceList
+		percentage int
+	}
+	tests := []struct {
+		name string
+		args args
+		want corev1.ResourceList
+	}{
+		{
+			name: "scale x to percentage",
+			args: args{
+				x: corev1.ResourceList{
+					corev1.ResourceCPU:    *resource.NewQuantity(2, resource.DecimalSI),
+					corev1.ResourceMemory: *resource.NewQuantity(2048, resource.BinarySI),
+				},
+				percentage: 50,
+			},
+			want: corev1.ResourceList{
+				corev1.ResourceCPU:    *resource.NewQuantity(1, resource.DecimalSI),
+				corev1.ResourceMemory: *resource.NewQuantity(1024, resource.BinarySI),
+			},
+		},
+		{
+			name: "scale x to fractional quantities",
+			args: args{
+				x: corev1.ResourceList{
+					corev1.ResourceCPU: *resource.NewQuantity(3, resource.DecimalSI),
+				},
+				percentage: 75,
+			},
+			want: corev1.ResourceList{
+				corev1.ResourceCPU: *resource.NewMilliQuantity(2250, resource.DecimalSI),
+			},
+		},
+		{
+			name: "return x unchanged for hundred percent",
+			args: args{
+				x: corev1.ResourceList{
+					corev1.ResourceCPU:    *resource.NewQuantity(2, resource.DecimalSI),
+					corev1.ResourceMemory: *resource.NewQuantity(2048, resource.BinarySI),
+				},
+				percentage: 100,
+			},
+			want: corev1.ResourceList{
+				corev1.ResourceCPU:    *resource.NewQuantity(2, resource.DecimalSI),
+				corev1.ResourceMemory: *resource.NewQuantity(2048, resource.BinarySI),
+			},
+		},
+		{
+			name: "scale x with large quantities",
+			args: args{
+				x: corev1.ResourceList{
+					corev1.ResourceEphemeralStorage: resource.MustParse("200Ti"),
+					corev1.ResourceMemory:           resource.MustParse("6Pi"),
+				},
+				percentage: 80,
+			},
+			want: corev1.ResourceList{
+				corev1.ResourceEphemeralStorage: resource.MustParse("160Ti"),
+				corev1.ResourceMemory:           *resource.NewQuantity(6*(1<<50)*4/5, resource.BinarySI),
+			},
+		},
+		{
+			name: "return nil if x nil",
+			args: args{
+				percentage: 50,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ResourceListPercentage(tt.args.x, tt.args.percentage)
+			if !ResourceListEqual(got, tt.want) {
+				t.Errorf("ResourceListPercentage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -18,6 +18,7 @@ package v1alpha1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -28,16 +29,42 @@ type SFClusterSpec struct {
 	// as the SFCluster and should have a "kubeconfig" key.
 	SecretRef string `yaml:"secretRef" json:"secretRef"`
 
+	// +kubebuilder:validation:Enum=push;pull
+	// Mode determines how the cluster is connected to the master cluster.
+	// In push mode the master cluster connects to the member cluster using
+	// the kubeconfig from SecretRef. In pull mode the agent in the member
+	// cluster connects to the master cluster and SecretRef is not used.
+	// Defaults to push.
+	Mode string `yaml:"mode,omitempty" json:"mode,omitempty"`
+
 	// TotalCapacity represents the total resources of a cluster.
 	// This should include the future capacity introduced by node autoscaler.
 	TotalCapacity corev1.ResourceList `yaml:"totalCapacity,omitempty" json:"totalCapacity,omitempty"`
 
+	// TotalStorageCapacity represents the total storage of a cluster per storage class.
+	// This should include the storage which can be provisioned dynamically.
+	TotalStorageCapacity map[string]resource.Quantity `yaml:"totalStorageCapacity,omitempty" json:"totalStorageCapacity,omitempty"`
+
 	// +kubebuilder:validation:Minimum=0
 	// +kubebuilder:validation:Maximum=100
 	// Determines the how filled the cluster becomes, before interoperator filters out the cluster as full.
 	SchedulingLimitPercentage int `yaml:"schedulingLimitPercentage,omitempty" json:"schedulingLimitPercentage,omitempty"`
+
+	// Unschedulable marks the cluster as not available for new service instances.
+	// The service instances already on the cluster are not affected.
+	Unschedulable bool `yaml:"unschedulable,omitempty" json:"unschedulable,omitempty"`
+
+	// Drain migrates the service instances on the cluster to other clusters.
+	// It is honored only if the cluster is also Unschedulable.
+	Drain bool `yaml:"drain,omitempty" json:"drain,omitempty"`
 }
 
+// Modes of connecting a SFCluster to the master cluster
+const (
+	ClusterModePush = "push"
+	ClusterModePull = "pull"
+)
+
 // SFClusterStatus defines the observed state of SFCluster
 type SFClusterStatus struct {
 	ServiceInstanceCount int `json:"serviceInstanceCount,omitempty"`
@@ -51,6 +78,213 @@ type SFClusterStatus struct {
 
 	// Requests represents the total resources requested by all the pods on the cluster
 	Requests corev1.ResourceList `yaml:"requests,omitempty" json:"requests,omitempty"`
+
+	// Storage represents the storage capacity and claims of the cluster per storage class
+	Storage []StorageClassUsage `yaml:"storage,omitempty" json:"storage,omitempty"`
+
+	// Conditions represent the latest observations of the state of the cluster
+	Conditions []SFClusterCondition `yaml:"conditions,omitempty" json:"conditions,omitempty"`
+}
+
+// Types of the conditions of a SFCluster
+const (
+	// ClusterReady is False if any of the conditions the readiness of the
+	// cluster depends on is False
+	ClusterReady = "Ready"
+	// ClusterReachable is True if the api server of the cluster is reachable
+	ClusterReachable = "Reachable"
+	// ClusterKubeconfigValid is True if a client for the cluster could be
+	// created from its kubeconfig secret
+	ClusterKubeconfigValid = "KubeconfigValid"
+	// ClusterPreflightSucceeded is True if the cluster passed the preflight
+	// checks run before onboarding it
+	ClusterPreflightSucceeded = "PreflightSucceeded"
+	// ClusterCRDsRegistered is True if the CRDs of interoperator are
+	// registered in the cluster
+	ClusterCRDsRegistered = "CRDsRegistered"
+	// ClusterWatchEstablished is True if the resources in the cluster are
+	// watched by the master cluster
+	ClusterWatchEstablished = "WatchEstablished"
+	// ClusterProvisionerDeployed is True if the provisioner and its
+	// prerequisites are deployed in the cluster
+	ClusterProvisionerDeployed = "ProvisionerDeployed"
+	// ClusterCapacityReported is True if the capacity of the cluster is
+	// reported in the status. It does not affect the readiness of the cluster.
+	ClusterCapacityReported = "CapacityReported"
+	// ClusterPrimary is True on the primary cluster. It is False on all the
+	// clusters labelled as primary if more than one cluster is labelled. It
+	// does not affect the readiness of the cluster.
+	ClusterPrimary = "Primary"
+	// ClusterMigrationSkipped is True on a drained cluster if some of its
+	// instances are not migrated as their plans can not move the data of
+	// the instances. It does not affect the readiness of the cluster.
+	ClusterMigrationSkipped = "MigrationSkipped"
+)
+
+// readinessConditions are the conditions the Ready condition depends on
+var readinessConditions = []string{
+	ClusterReachable,
+	ClusterKubeconfigValid,
+	ClusterPreflightSucceeded,
+	ClusterCRDsRegistered,
+	ClusterWatchEstablished,
+	ClusterProvisionerDeployed,
+}
+
+// SFClusterCondition is an observation of the state of a SFCluster. It has
+// the same fields as the Condition of apimachinery.
+type SFClusterCondition struct {
+	// Type of the condition, for example Ready
+	Type string `yaml:"type" json:"type"`
+	// Status of the condition, one of True, False or Unknown
+	Status metav1.ConditionStatus `yaml:"status" json:"status"`
+	// ObservedGeneration is the generation of the SFCluster the condition
+	// was set for
+	ObservedGeneration int64 `yaml:"observedGeneration,omitempty" json:"observedGeneration,omitempty"`
+	// LastTransitionTime is the last time the status of the condition changed
+	LastTransitionTime metav1.Time `yaml:"lastTransitionTime" json:"lastTransitionTime"`
+	// Reason is a CamelCase reason for the last transition of the condition
+	Reason string `yaml:"reason" json:"reason"`
+	// Message is a human readable message about the last transition
+	Message string `yaml:"message" json:"message"`
+}
+
+// StorageClassUsage represents the storage capacity and claims of a storage class
+type StorageClassUsage struct {
+	StorageClassName string `yaml:"storageClassName" json:"storageClassName"`
+
+	// Capacity represents the total capacity of the persistent volumes of the storage class
+	Capacity resource.Quantity `yaml:"capacity,omitempty" json:"capacity,omitempty"`
+
+	// TotalCapacity represents the total storage of the storage class from the spec
+	TotalCapacity *resource.Quantity `yaml:"totalCapacity,omitempty" json:"totalCapacity,omitempty"`
+
+	// Requests represents the total storage requested by the persistent volume claims of the storage class
+	Requests resource.Quantity `yaml:"requests,omitempty" json:"requests,omitempty"`
+}
+
+// GetStorage returns the usage of the storage class or nil if the cluster
+// does not have the storage class
+func (status *SFClusterStatus) GetStorage(storageClassName string) *StorageClassUsage {
+	for i := range status.Storage {
+		if status.Storage[i].StorageClassName == storageClassName {
+			return &status.Storage[i]
+		}
+	}
+	return nil
+}
+
+// GetCondition returns the condition of the type or nil if the condition
+// is not set
+func (status *SFClusterStatus) GetCondition(conditionType string) *SFClusterCondition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == conditionType {
+			return &status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds or updates the condition of the same type. The
+// LastTransitionTime is changed only if the status of the condition changes.
+// It returns true if the conditions were modified.
+func (status *SFClusterStatus) SetCondition(condition SFClusterCondition) bool {
+	existing := status.GetCondition(condition.Type)
+	if existing == nil {
+		if condition.LastTransitionTime.IsZero() {
+			condition.LastTransitionTime = metav1.Now()
+		}
+		status.Conditions = append(status.Conditions, condition)
+		return true
+	}
+
+	if existing.Status == condition.Status && existing.Reason == condition.Reason &&
+		existing.Message == condition.Message && existing.ObservedGeneration == condition.ObservedGeneration {
+		return false
+	}
+	if existing.Status != condition.Status {
+		existing.Status = condition.Status
+		existing.LastTransitionTime = condition.LastTransitionTime
+		if existing.LastTransitionTime.IsZero() {
+			existing.LastTransitionTime = metav1.Now()
+		}
+	}
+	existing.Reason = condition.Reason
+	existing.Message = condition.Message
+	existing.ObservedGeneration = condition.ObservedGeneration
+	return true
+}
+
+// RemoveCondition removes the condition of the type. It returns true if the
+// conditions were modified.
+func (status *SFClusterStatus) RemoveCondition(conditionType string) bool {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == conditionType {
+			status.Conditions = append(status.Conditions[:i], status.Conditions[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateReadyCondition sets the Ready condition to False if any of the
+// conditions the readiness depends on is False and to True otherwise. It
+// returns true if the conditions were modified.
+func (status *SFClusterStatus) UpdateReadyCondition(generation int64) bool {
+	ready := SFClusterCondition{
+		Type:               ClusterReady,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             "ClusterReady",
+		Message:            "cluster is ready",
+	}
+	for _, conditionType := range readinessConditions {
+		condition := status.GetCondition(conditionType)
+		if condition != nil && condition.Status == metav1.ConditionFalse {
+			ready.Status = metav1.ConditionFalse
+			ready.Reason = condition.Reason
+			ready.Message = condition.Type + ": " + condition.Message
+			break
+		}
+	}
+	return status.SetCondition(ready)
+}
+
+// StorageEqual returns true if the storage usages x and y are equal
+func StorageEqual(x, y []StorageClassUsage) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i].StorageClassName != y[i].StorageClassName ||
+			x[i].Capacity.Cmp(y[i].Capacity) != 0 ||
+			x[i].Requests.Cmp(y[i].Requests) != 0 ||
+			!quantityPtrEqual(x[i].TotalCapacity, y[i].TotalCapacity) {
+			return false
+		}
+	}
+	return true
+}
+
+// StorageCapacityEqual returns true if the storage capacities x and y are equal
+func StorageCapacityEqual(x, y map[string]resource.Quantity) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for key, quantity := range x {
+		quantity2, ok := y[key]
+		if !ok || quantity.Cmp(quantity2) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func quantityPtrEqual(x, y *resource.Quantity) bool {
+	if x == nil || y == nil {
+		return x == y
+	}
+	return x.Cmp(*y) == 0
 }
 
 // +kubebuilder:object:root=true
@@ -59,6 +293,8 @@ type SFClusterStatus struct {
 // SFCluster is the Schema for the sfclusters API
 // +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="numserviceinstance",type=integer,JSONPath=`.status.serviceInstanceCount`
+// +kubebuilder:printcolumn:name="unschedulable",type=boolean,JSONPath=`.spec.unschedulable`
+// +kubebuilder:printcolumn:name="ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
 type SFCluster struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -67,6 +303,19 @@ type SFCluster struct {
 	Status SFClusterStatus `json:"status,omitempty"`
 }
 
+// IsReady returns false if the Ready condition of the cluster is False.
+// Clusters without the Ready condition are considered ready.
+func (cluster *SFCluster) IsReady() bool {
+	condition := cluster.Status.GetCondition(ClusterReady)
+	return condition == nil || condition.Status != metav1.ConditionFalse
+}
+
+// IsPullMode returns true if the cluster is connected to the master cluster
+// by its agent
+func (cluster *SFCluster) IsPullMode() bool {
+	return cluster.Spec.Mode == ClusterModePull
+}
+
 // +kubebuilder:object:root=true
 
 // SFClusterList contains a list of SFCluster
@@ -20,10 +20,12 @@ import (
 	"context"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
 	"github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
@@ -155,3 +157,127 @@ func _getDummyCluster() *SFCluster {
 		},
 	}
 }
+
+func TestStorageEqual(t *testing.T) {
+	total := resource.MustParse("1Ti")
+	x := []StorageClassUsage{
+		{
+			StorageClassName: "premium",
+			Capacity:         resource.MustParse("1Gi"),
+			TotalCapacity:    &total,
+			Requests:         resource.MustParse("512Mi"),
+		},
+	}
+	y := []StorageClassUsage{*x[0].DeepCopy()}
+	if !StorageEqual(x, y) {
+		t.Errorf("StorageEqual() = false, want true")
+	}
+	y[0].Requests = resource.MustParse("1Gi")
+	if StorageEqual(x, y) {
+		t.Errorf("StorageEqual() = true, want false for different requests")
+	}
+	y = []StorageClassUsage{*x[0].DeepCopy()}
+	y[0].TotalCapacity = nil
+	if StorageEqual(x, y) {
+		t.Errorf("StorageEqual() = true, want false for missing total capacity")
+	}
+	if StorageEqual(x, nil) {
+		t.Errorf("StorageEqual() = true, want false for nil")
+	}
+}
+
+func TestStorageCapacityEqual(t *testing.T) {
+	x := map[string]resource.Quantity{"premium": resource.MustParse("1Ti")}
+	if !StorageCapacityEqual(x, map[string]resource.Quantity{"premium": resource.MustParse("1024Gi")}) {
+		t.Errorf("StorageCapacityEqual() = false, want true")
+	}
+	if StorageCapacityEqual(x, map[string]resource.Quantity{"standard": resource.MustParse("1Ti")}) {
+		t.Errorf("StorageCapacityEqual() = true, want false")
+	}
+	if !StorageCapacityEqual(nil, map[string]resource.Quantity{}) {
+		t.Errorf("StorageCapacityEqual() = false, want true for empty")
+	}
+}
+
+func TestSFClusterStatus_SetCondition(t *testing.T) {
+	status := &SFClusterStatus{}
+	cluster := &SFCluster{}
+	if !cluster.IsReady() {
+		t.Errorf("IsReady() = false, want true for cluster without conditions")
+	}
+
+	if !status.SetCondition(SFClusterCondition{Type: ClusterReady, Status: metav1.ConditionTrue, Reason: "ProbeSucceeded"}) {
+		t.Errorf("SetCondition() = false, want true for new condition")
+	}
+	ready := status.GetCondition(ClusterReady)
+	if ready == nil || ready.LastTransitionTime.IsZero() {
+		t.Fatalf("GetCondition() = %v, want condition with LastTransitionTime", ready)
+	}
+	transition := ready.LastTransitionTime
+
+	if status.SetCondition(SFClusterCondition{Type: ClusterReady, Status: metav1.ConditionTrue, Reason: "ProbeSucceeded"}) {
+		t.Errorf("SetCondition() = true, want false for unchanged condition")
+	}
+
+	changed := metav1.NewTime(transition.Add(time.Minute))
+	if !status.SetCondition(SFClusterCondition{Type: ClusterReady, Status: metav1.ConditionFalse, Reason: "ProbeFailed",
+		LastTransitionTime: changed}) {
+		t.Errorf("SetCondition() = false, want true for changed status")
+	}
+	if len(status.Conditions) != 1 || !status.Conditions[0].LastTransitionTime.Equal(&changed) {
+		t.Errorf("Conditions = %v, want one condition with transition %v", status.Conditions, changed)
+	}
+
+	cluster.Status = *status
+	if cluster.IsReady() {
+		t.Errorf("IsReady() = true, want false")
+	}
+}
+
+func TestSFClusterStatus_RemoveCondition(t *testing.T) {
+	status := &SFClusterStatus{}
+	status.SetCondition(SFClusterCondition{Type: ClusterReachable, Status: metav1.ConditionTrue, Reason: "ProbeSucceeded"})
+	status.SetCondition(SFClusterCondition{Type: ClusterPrimary, Status: metav1.ConditionTrue, Reason: ClusterPrimary})
+
+	if !status.RemoveCondition(ClusterPrimary) {
+		t.Errorf("RemoveCondition() = false, want true for existing condition")
+	}
+	if status.RemoveCondition(ClusterPrimary) {
+		t.Errorf("RemoveCondition() = true, want false for removed condition")
+	}
+	if len(status.Conditions) != 1 || status.GetCondition(ClusterReachable) == nil {
+		t.Errorf("Conditions = %v, want only Reachable condition", status.Conditions)
+	}
+}
+
+func TestSFClusterStatus_UpdateReadyCondition(t *testing.T) {
+	status := &SFClusterStatus{}
+	if !status.UpdateReadyCondition(1) {
+		t.Errorf("UpdateReadyCondition() = false, want true for new condition")
+	}
+	if ready := status.GetCondition(ClusterReady); ready.Status != metav1.ConditionTrue {
+		t.Errorf("Ready = %v, want True without conditions", ready)
+	}
+
+	status.SetCondition(SFClusterCondition{Type: ClusterCapacityReported, Status: metav1.ConditionFalse, Reason: "CapacityNotReported"})
+	if status.UpdateReadyCondition(1) {
+		t.Errorf("UpdateReadyCondition() = true, want false for informational condition")
+	}
+
+	status.SetCondition(SFClusterCondition{Type: ClusterCRDsRegistered, Status: metav1.ConditionFalse,
+		Reason: "CRDRegistrationFailed", Message: "forbidden"})
+	if !status.UpdateReadyCondition(2) {
+		t.Errorf("UpdateReadyCondition() = false, want true for failed condition")
+	}
+	ready := status.GetCondition(ClusterReady)
+	if ready.Status != metav1.ConditionFalse || ready.Reason != "CRDRegistrationFailed" ||
+		ready.Message != "CRDsRegistered: forbidden" || ready.ObservedGeneration != 2 {
+		t.Errorf("Ready = %v, want False with reason of CRDsRegistered", ready)
+	}
+
+	status.SetCondition(SFClusterCondition{Type: ClusterCRDsRegistered, Status: metav1.ConditionTrue, Reason: ClusterCRDsRegistered})
+	status.UpdateReadyCondition(2)
+	if ready := status.GetCondition(ClusterReady); ready.Status != metav1.ConditionTrue {
+		t.Errorf("Ready = %v, want True", ready)
+	}
+}
@@ -22,6 +22,7 @@ package v1alpha1
 
 import (
 	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -52,6 +53,22 @@ func (in *SFCluster) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SFClusterCondition) DeepCopyInto(out *SFClusterCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SFClusterCondition.
+func (in *SFClusterCondition) DeepCopy() *SFClusterCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(SFClusterCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SFClusterList) DeepCopyInto(out *SFClusterList) {
 	*out = *in
@@ -94,6 +111,13 @@ func (in *SFClusterSpec) DeepCopyInto(out *SFClusterSpec) {
 			(*out)[key] = val.DeepCopy()
 		}
 	}
+	if in.TotalStorageCapacity != nil {
+		in, out := &in.TotalStorageCapacity, &out.TotalStorageCapacity
+		*out = make(map[string]resource.Quantity, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SFClusterSpec.
@@ -130,6 +154,20 @@ func (in *SFClusterStatus) DeepCopyInto(out *SFClusterStatus) {
 			(*out)[key] = val.DeepCopy()
 		}
 	}
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		*out = make([]StorageClassUsage, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]SFClusterCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SFClusterStatus.
@@ -141,3 +179,25 @@ func (in *SFClusterStatus) DeepCopy() *SFClusterStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StorageClassUsage) DeepCopyInto(out *StorageClassUsage) {
+	*out = *in
+	out.Capacity = in.Capacity.DeepCopy()
+	if in.TotalCapacity != nil {
+		in, out := &in.TotalCapacity, &out.TotalCapacity
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	out.Requests = in.Requests.DeepCopy()
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StorageClassUsage.
+func (in *StorageClassUsage) DeepCopy() *StorageClassUsage {
+	if in == nil {
+		return nil
+	}
+	out := new(StorageClassUsage)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2018 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package heartbeat
+
+import (
+	"context"
+	"time"
+
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/watches"
+
+	"github.com/go-logr/logr"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// Heartbeat runs in the agent of a member cluster in pull mode. It creates
+// the SFCluster of the own cluster in the member cluster and periodically
+// records a heartbeat in the SFCluster in the master cluster. The master
+// cluster marks the cluster not reachable if the heartbeat is missing.
+type Heartbeat struct {
+	// MasterClient is the client of the master cluster
+	MasterClient client.Client
+	// TargetClient is the client of the own cluster
+	TargetClient client.Client
+	Log          logr.Logger
+	cfgManager   config.Config
+}
+
+// Reconcile records the heartbeat of the agent in the SFCluster in the
+// master cluster every ClusterHealthCheckInterval
+func (r *Heartbeat) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("sfcluster", req.NamespacedName)
+
+	interval := parseDuration(r.cfgManager.GetConfig().ClusterHealthCheckInterval,
+		constants.DefaultClusterHealthCheckInterval)
+
+	cluster := &resourcev1alpha1.SFCluster{}
+	err := r.MasterClient.Get(ctx, req.NamespacedName, cluster)
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			// The cluster may not be registered in the master cluster yet
+			log.Info("sfcluster not found in master cluster. Retrying", "after", interval)
+			return ctrl.Result{RequeueAfter: interval}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	if !cluster.GetDeletionTimestamp().IsZero() {
+		return ctrl.Result{}, nil
+	}
+	if !cluster.IsPullMode() {
+		log.Info("sfcluster is not in pull mode. Not sending heartbeat", "mode", cluster.Spec.Mode)
+		return ctrl.Result{RequeueAfter: interval}, nil
+	}
+
+	err = r.createReplica(cluster)
+	if err != nil {
+		log.Error(err, "Failed to create sfcluster in own cluster")
+		return ctrl.Result{}, err
+	}
+
+	patch := client.MergeFrom(cluster.DeepCopy())
+	annotations := cluster.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[constants.LastHeartbeatKey] = time.Now().UTC().Format(time.RFC3339)
+	cluster.SetAnnotations(annotations)
+	err = r.MasterClient.Patch(ctx, cluster, patch)
+	if err != nil {
+		log.Error(err, "Failed to send heartbeat to master cluster")
+		return ctrl.Result{}, err
+	}
+	log.V(1).Info("Sent heartbeat to master cluster")
+
+	// Send the heartbeats twice in an interval to tolerate a missed one
+	return ctrl.Result{RequeueAfter: interval / 2}, nil
+}
+
+// createReplica creates the SFCluster in the own cluster if it does not
+// exist. The spec and status are synced by the cluster replicator afterwards.
+func (r *Heartbeat) createReplica(cluster *resourcev1alpha1.SFCluster) error {
+	ctx := context.Background()
+	replica := &resourcev1alpha1.SFCluster{}
+	err := r.TargetClient.Get(ctx, client.ObjectKey{
+		Name:      cluster.GetName(),
+		Namespace: cluster.GetNamespace(),
+	}, replica)
+	if err == nil || !apiErrors.IsNotFound(err) {
+		return err
+	}
+
+	replica = &resourcev1alpha1.SFCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cluster.GetName(),
+			Namespace: cluster.GetNamespace(),
+			Labels:    cluster.GetLabels(),
+		},
+		Spec: *cluster.Spec.DeepCopy(),
+	}
+	err = r.TargetClient.Create(ctx, replica)
+	if err != nil && !apiErrors.IsAlreadyExists(err) {
+		return err
+	}
+	r.Log.Info("Created sfcluster in own cluster", "clusterID", cluster.GetName())
+	return nil
+}
+
+func parseDuration(value, defaultValue string) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		d, _ = time.ParseDuration(defaultValue)
+	}
+	return d
+}
+
+// SetupWithManager registers the heartbeat controller with manager. The
+// SFCluster of the own cluster is watched in the master cluster using
+// masterCache.
+func (r *Heartbeat) SetupWithManager(mgr ctrl.Manager, masterCache cache.Cache) error {
+	if r.Log == nil {
+		r.Log = ctrl.Log.WithName("agent").WithName("heartbeat")
+	}
+	if r.TargetClient == nil {
+		r.TargetClient = mgr.GetClient()
+	}
+	if r.cfgManager == nil {
+		cfgManager, err := config.New(mgr.GetConfig(), mgr.GetScheme(), mgr.GetRESTMapper())
+		if err != nil {
+			return err
+		}
+		r.cfgManager = cfgManager
+	}
+
+	masterClusters := &source.Kind{Type: &resourcev1alpha1.SFCluster{}}
+	err := masterClusters.InjectCache(masterCache)
+	if err != nil {
+		return err
+	}
+
+	// The heartbeats are sent periodically. The updates of the heartbeat
+	// annotation must not trigger another heartbeat. The SFCluster in the
+	// own cluster is watched to recreate it if deleted.
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("agent_heartbeat").
+		For(&resourcev1alpha1.SFCluster{}).
+		Watches(masterClusters, &handler.EnqueueRequestForObject{}).
+		WithEventFilter(watches.NamespaceFilter()).
+		WithEventFilter(predicate.GenerationChangedPredicate{}).
+		WithEventFilter(predicate.NewPredicateFuncs(func(meta metav1.Object, object runtime.Object) bool {
+			return meta.GetName() == constants.OwnClusterID
+		})).
+		Complete(r)
+}
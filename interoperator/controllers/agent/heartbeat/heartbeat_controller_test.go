@@ -0,0 +1,125 @@
+/*
+Copyright 2018 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package heartbeat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+
+	"github.com/onsi/gomega"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type fakeConfig struct {
+	cfg *config.InteroperatorConfig
+}
+
+func (f *fakeConfig) GetConfig() *config.InteroperatorConfig {
+	return f.cfg
+}
+
+func (f *fakeConfig) UpdateConfig(cfg *config.InteroperatorConfig) error {
+	f.cfg = cfg
+	return nil
+}
+
+func TestHeartbeat_Reconcile(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(resourcev1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	key := types.NamespacedName{Name: constants.OwnClusterID, Namespace: constants.InteroperatorNamespace}
+	newCluster := func(mode string) *resourcev1alpha1.SFCluster {
+		return &resourcev1alpha1.SFCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      key.Name,
+				Namespace: key.Namespace,
+			},
+			Spec: resourcev1alpha1.SFClusterSpec{
+				Mode:                      mode,
+				SchedulingLimitPercentage: 80,
+			},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		master        []runtime.Object
+		wantHeartbeat bool
+		wantRequeue   time.Duration
+	}{
+		{
+			name:          "send heartbeat and create sfcluster in own cluster",
+			master:        []runtime.Object{newCluster(resourcev1alpha1.ClusterModePull)},
+			wantHeartbeat: true,
+			wantRequeue:   30 * time.Second,
+		},
+		{
+			name:        "skip clusters not in pull mode",
+			master:      []runtime.Object{newCluster(resourcev1alpha1.ClusterModePush)},
+			wantRequeue: time.Minute,
+		},
+		{
+			name:        "retry if sfcluster is not registered in master",
+			wantRequeue: time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Heartbeat{
+				MasterClient: fake.NewFakeClientWithScheme(scheme, tt.master...),
+				TargetClient: fake.NewFakeClientWithScheme(scheme),
+				Log:          ctrl.Log.WithName("agent").WithName("heartbeat"),
+				cfgManager: &fakeConfig{
+					cfg: &config.InteroperatorConfig{
+						ClusterHealthCheckInterval: "1m",
+					},
+				},
+			}
+
+			result, err := r.Reconcile(ctrl.Request{NamespacedName: key})
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+			g.Expect(result.RequeueAfter).To(gomega.Equal(tt.wantRequeue))
+
+			replica := &resourcev1alpha1.SFCluster{}
+			err = r.TargetClient.Get(context.TODO(), key, replica)
+			if !tt.wantHeartbeat {
+				g.Expect(apiErrors.IsNotFound(err)).To(gomega.BeTrue())
+				return
+			}
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+			g.Expect(replica.Spec.SchedulingLimitPercentage).To(gomega.Equal(80))
+
+			cluster := &resourcev1alpha1.SFCluster{}
+			g.Expect(r.MasterClient.Get(context.TODO(), key, cluster)).To(gomega.Succeed())
+			lastHeartbeat, err := time.Parse(time.RFC3339, cluster.GetAnnotations()[constants.LastHeartbeatKey])
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+			g.Expect(lastHeartbeat).To(gomega.BeTemporally("~", time.Now(), 2*time.Second))
+		})
+	}
+}
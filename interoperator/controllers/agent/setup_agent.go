@@ -0,0 +1,130 @@
+// +build agent
+
+/*
+Copyright 2018 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/agent/heartbeat"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/multiclusterdeploy/sfclusterreplicator"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/multiclusterdeploy/sfservicebindingreplicator"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/multiclusterdeploy/sfserviceinstancereplicator"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SetupWithManager registers the agent of a member cluster in pull mode with
+// the manager. The agent connects to the master cluster with the kubeconfig
+// in the MasterKubeconfigSecretName secret and replicates the resources
+// assigned to the own cluster.
+func SetupWithManager(mgr ctrl.Manager) error {
+	var err error
+	setupLog := ctrl.Log.WithName("setup").WithName("agent")
+
+	masterCfg, err := getMasterConfig(mgr)
+	if err != nil {
+		setupLog.Error(err, "unable to get kubeconfig of master cluster")
+		return err
+	}
+	masterClient, err := client.New(masterCfg, client.Options{
+		Scheme: mgr.GetScheme(),
+	})
+	if err != nil {
+		setupLog.Error(err, "unable to create client for master cluster")
+		return err
+	}
+	masterCache, err := cache.New(masterCfg, cache.Options{
+		Scheme: mgr.GetScheme(),
+	})
+	if err != nil {
+		setupLog.Error(err, "unable to create cache for master cluster")
+		return err
+	}
+	// The cache of the master cluster is started and stopped with the manager
+	if err = mgr.Add(masterCache); err != nil {
+		setupLog.Error(err, "unable to add cache of master cluster to manager")
+		return err
+	}
+
+	if err = (&heartbeat.Heartbeat{
+		MasterClient: masterClient,
+		Log:          ctrl.Log.WithName("agent").WithName("heartbeat"),
+	}).SetupWithManager(mgr, masterCache); err != nil {
+		setupLog.Error(err, "unable to create heartbeat controller", "controller", "Heartbeat")
+		return err
+	}
+
+	if err = (&sfserviceinstancereplicator.InstanceReplicator{
+		Log: ctrl.Log.WithName("agent").WithName("replicator").WithName("instance"),
+	}).SetupAgentWithManager(mgr, masterClient, masterCache); err != nil {
+		setupLog.Error(err, "unable to create instance replicator", "controller", "InstanceReplicator")
+		return err
+	}
+
+	if err = (&sfservicebindingreplicator.BindingReplicator{
+		Log: ctrl.Log.WithName("agent").WithName("replicator").WithName("binding"),
+	}).SetupAgentWithManager(mgr, masterClient, masterCache); err != nil {
+		setupLog.Error(err, "unable to create binding replicator", "controller", "BindingReplicator")
+		return err
+	}
+
+	if err = (&sfclusterreplicator.SFClusterReplicator{
+		Log: ctrl.Log.WithName("agent").WithName("replicator").WithName("cluster"),
+	}).SetupAgentWithManager(mgr, masterClient, masterCache); err != nil {
+		setupLog.Error(err, "unable to create cluster replicator", "controller", "SFClusterReplicator")
+		return err
+	}
+
+	return nil
+}
+
+// getMasterConfig reads the kubeconfig of the master cluster. The cache of
+// the manager is not started yet, hence the secret is read directly.
+func getMasterConfig(mgr ctrl.Manager) (*rest.Config, error) {
+	c, err := client.New(mgr.GetConfig(), client.Options{
+		Scheme: mgr.GetScheme(),
+		Mapper: mgr.GetRESTMapper(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	secret := &corev1.Secret{}
+	err = c.Get(context.TODO(), types.NamespacedName{
+		Name:      constants.MasterKubeconfigSecretName,
+		Namespace: constants.InteroperatorNamespace,
+	}, secret)
+	if err != nil {
+		return nil, err
+	}
+	configBytes, ok := secret.Data["kubeconfig"]
+	if !ok {
+		return nil, errors.NewPreconditionError("getMasterConfig", fmt.Sprintf(
+			"key kubeconfig not found in secret %s", constants.MasterKubeconfigSecretName), nil)
+	}
+	return clientcmd.RESTConfigFromKubeConfig(configBytes)
+}
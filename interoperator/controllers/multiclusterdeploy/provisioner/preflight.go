@@ -0,0 +1,256 @@
+/*
+Copyright 2018 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Reasons of a failed PreflightSucceeded condition
+const (
+	PreflightFailed              = "PreflightFailed"
+	UnsupportedKubernetesVersion = "UnsupportedKubernetesVersion"
+	InsufficientPermissions      = "InsufficientPermissions"
+	StorageClassNotFound         = "StorageClassNotFound"
+	ConflictingCRDs              = "ConflictingCRDs"
+)
+
+// sfCRDNames are the CRDs of interoperator registered in each cluster
+var sfCRDNames = []string{
+	"sfplans.osb.servicefabrik.io",
+	"sfservices.osb.servicefabrik.io",
+	"sfserviceinstances.osb.servicefabrik.io",
+	"sfservicebindings.osb.servicefabrik.io",
+	"sfclusters.resource.servicefabrik.io",
+}
+
+// requiredPermissions are the permissions the kubeconfig of a cluster needs
+// for onboarding it
+var requiredPermissions = []authorizationv1.ResourceAttributes{
+	{Verb: "create", Resource: "namespaces"},
+	{Verb: "create", Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"},
+	{Verb: "update", Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"},
+	{Verb: "create", Group: "resource.servicefabrik.io", Resource: "sfclusters", Namespace: constants.InteroperatorNamespace},
+	{Verb: "update", Group: "resource.servicefabrik.io", Resource: "sfclusters", Namespace: constants.InteroperatorNamespace},
+	{Verb: "create", Resource: "secrets", Namespace: constants.InteroperatorNamespace},
+	{Verb: "update", Resource: "secrets", Namespace: constants.InteroperatorNamespace},
+	{Verb: "create", Group: "rbac.authorization.k8s.io", Resource: "clusterrolebindings"},
+	{Verb: "update", Group: "rbac.authorization.k8s.io", Resource: "clusterrolebindings"},
+	{Verb: "create", Group: "apps", Resource: "deployments", Namespace: constants.InteroperatorNamespace},
+	{Verb: "update", Group: "apps", Resource: "deployments", Namespace: constants.InteroperatorNamespace},
+}
+
+var getServerVersion = func(cfg *rest.Config) (*version.Info, error) {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return discoveryClient.ServerVersion()
+}
+
+var reviewAccess = func(targetClient client.Client, attributes authorizationv1.ResourceAttributes) (bool, error) {
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &attributes,
+		},
+	}
+	err := targetClient.Create(context.Background(), review)
+	if err != nil {
+		return false, err
+	}
+	return review.Status.Allowed, nil
+}
+
+// preflightError lists the failed preflight checks of a cluster. The reason
+// is the reason of the first failed check.
+type preflightError struct {
+	reason   string
+	failures []string
+}
+
+func (e *preflightError) add(reason, format string, args ...interface{}) {
+	if e.reason == "" {
+		e.reason = reason
+	}
+	e.failures = append(e.failures, fmt.Sprintf(format, args...))
+}
+
+func (e *preflightError) Error() string {
+	return strings.Join(e.failures, "; ")
+}
+
+// isOnboarded returns true if the provisioner was deployed in the cluster
+// once. The preflight checks are skipped for such clusters.
+func isOnboarded(cluster *resourcev1alpha1.SFCluster) bool {
+	condition := cluster.Status.GetCondition(resourcev1alpha1.ClusterProvisionerDeployed)
+	return condition != nil && condition.Status == metav1.ConditionTrue
+}
+
+// preflightChecks verifies that the cluster can be onboarded before anything
+// is created in it. It returns a *preflightError if any of the checks failed
+// and other errors if the checks could not be run.
+func (r *ReconcileProvisioner) preflightChecks(clusterID string, targetClient client.Client) error {
+	log := r.Log.WithValues("clusterID", clusterID)
+	result := &preflightError{}
+
+	checks := []func(string, client.Client, *preflightError) error{
+		r.checkKubernetesVersion,
+		r.checkPermissions,
+		r.checkStorageClasses,
+		r.checkCRDConflicts,
+	}
+	for _, check := range checks {
+		err := check(clusterID, targetClient, result)
+		if err != nil {
+			log.Error(err, "Failed to run preflight checks")
+			return err
+		}
+	}
+	if len(result.failures) > 0 {
+		log.Info("Preflight checks failed", "failures", result.Error())
+		return result
+	}
+	return nil
+}
+
+func (r *ReconcileProvisioner) checkKubernetesVersion(clusterID string, targetClient client.Client, result *preflightError) error {
+	minVersion, err := utilversion.ParseGeneric(r.cfgManager.GetConfig().MinKubernetesVersion)
+	if err != nil {
+		return err
+	}
+	cfg, err := r.clusterRegistry.GetConfig(clusterID)
+	if err != nil {
+		return err
+	}
+	info, err := getServerVersion(cfg)
+	if err != nil {
+		return err
+	}
+	serverVersion, err := utilversion.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return err
+	}
+	if serverVersion.LessThan(minVersion) {
+		result.add(UnsupportedKubernetesVersion, "kubernetes version %s is older than the minimum supported version %s",
+			info.GitVersion, minVersion)
+	}
+	return nil
+}
+
+func (r *ReconcileProvisioner) checkPermissions(clusterID string, targetClient client.Client, result *preflightError) error {
+	var denied []string
+	for _, attributes := range requiredPermissions {
+		allowed, err := reviewAccess(targetClient, attributes)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			permission := attributes.Verb + " " + attributes.Resource
+			if attributes.Group != "" {
+				permission = permission + "." + attributes.Group
+			}
+			if attributes.Namespace != "" {
+				permission = permission + " in " + attributes.Namespace
+			}
+			denied = append(denied, permission)
+		}
+	}
+	if len(denied) > 0 {
+		result.add(InsufficientPermissions, "kubeconfig is not allowed to %s", strings.Join(denied, ", "))
+	}
+	return nil
+}
+
+func (r *ReconcileProvisioner) checkStorageClasses(clusterID string, targetClient client.Client, result *preflightError) error {
+	ctx := context.Background()
+	var missing []string
+	for _, name := range r.cfgManager.GetConfig().RequiredStorageClasses {
+		storageClass := &storagev1.StorageClass{}
+		err := targetClient.Get(ctx, types.NamespacedName{Name: name}, storageClass)
+		if err != nil {
+			if apiErrors.IsNotFound(err) {
+				missing = append(missing, name)
+				continue
+			}
+			return err
+		}
+	}
+	if len(missing) > 0 {
+		result.add(StorageClassNotFound, "storage classes %s not found", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// checkCRDConflicts fails if a CRD of interoperator is already registered in
+// the cluster with a different scope or with stored versions unknown to the
+// master cluster. Updating such a CRD would break the existing resources.
+func (r *ReconcileProvisioner) checkCRDConflicts(clusterID string, targetClient client.Client, result *preflightError) error {
+	ctx := context.Background()
+	for _, name := range sfCRDNames {
+		targetCRD := &apiextensionsv1.CustomResourceDefinition{}
+		err := targetClient.Get(ctx, types.NamespacedName{Name: name}, targetCRD)
+		if err != nil {
+			if apiErrors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		masterCRD := &apiextensionsv1.CustomResourceDefinition{}
+		err = r.Get(ctx, types.NamespacedName{Name: name}, masterCRD)
+		if err != nil {
+			return err
+		}
+
+		if targetCRD.Spec.Scope != masterCRD.Spec.Scope {
+			result.add(ConflictingCRDs, "crd %s has scope %s instead of %s", name,
+				targetCRD.Spec.Scope, masterCRD.Spec.Scope)
+			continue
+		}
+		versions := make(map[string]bool)
+		for _, v := range masterCRD.Spec.Versions {
+			versions[v.Name] = true
+		}
+		var unknown []string
+		for _, v := range targetCRD.Status.StoredVersions {
+			if !versions[v] {
+				unknown = append(unknown, v)
+			}
+		}
+		if len(unknown) > 0 {
+			result.add(ConflictingCRDs, "crd %s has stored versions %s unknown to interoperator", name,
+				strings.Join(unknown, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2018 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provisioner
+
+import (
+	"testing"
+
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	mock_clusterRegistry "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/cluster/registry/mock_registry"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+
+	"github.com/golang/mock/gomock"
+	"github.com/onsi/gomega"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/rest"
+	ctrlrun "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type fakeConfig struct {
+	cfg *config.InteroperatorConfig
+}
+
+func (f *fakeConfig) GetConfig() *config.InteroperatorConfig {
+	return f.cfg
+}
+
+func (f *fakeConfig) UpdateConfig(cfg *config.InteroperatorConfig) error {
+	f.cfg = cfg
+	return nil
+}
+
+func TestReconcileProvisioner_preflightChecks(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	scheme := runtime.NewScheme()
+	g.Expect(storagev1.AddToScheme(scheme)).To(gomega.Succeed())
+	g.Expect(apiextensionsv1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	newCRD := func(scope apiextensionsv1.ResourceScope, versions ...string) *apiextensionsv1.CustomResourceDefinition {
+		crd := &apiextensionsv1.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "sfclusters.resource.servicefabrik.io"},
+			Spec:       apiextensionsv1.CustomResourceDefinitionSpec{Scope: scope},
+		}
+		for _, v := range versions {
+			crd.Spec.Versions = append(crd.Spec.Versions, apiextensionsv1.CustomResourceDefinitionVersion{Name: v})
+		}
+		crd.Status.StoredVersions = versions
+		return crd
+	}
+	masterClient := fake.NewFakeClientWithScheme(scheme, newCRD(apiextensionsv1.NamespaceScoped, "v1alpha1"))
+
+	mockClusterRegistry := mock_clusterRegistry.NewMockClusterRegistry(ctrl)
+	mockClusterRegistry.EXPECT().GetConfig("2").Return(&rest.Config{}, nil).AnyTimes()
+
+	_getServerVersion := getServerVersion
+	_reviewAccess := reviewAccess
+	defer func() {
+		getServerVersion = _getServerVersion
+		reviewAccess = _reviewAccess
+	}()
+
+	tests := []struct {
+		name          string
+		serverVersion string
+		denied        string
+		objects       []runtime.Object
+		wantReason    string
+		wantMessage   string
+	}{
+		{
+			name:          "succeed if all checks pass",
+			serverVersion: "v1.18.8",
+			objects: []runtime.Object{
+				&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+				newCRD(apiextensionsv1.NamespaceScoped, "v1alpha1"),
+			},
+		},
+		{
+			name:          "fail if kubernetes version is too old",
+			serverVersion: "v1.15.12-gke.2",
+			objects: []runtime.Object{
+				&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+			},
+			wantReason:  UnsupportedKubernetesVersion,
+			wantMessage: "kubernetes version v1.15.12-gke.2 is older than the minimum supported version 1.16.0",
+		},
+		{
+			name:          "fail if permissions are missing",
+			serverVersion: "v1.18.8",
+			denied:        "clusterrolebindings",
+			objects: []runtime.Object{
+				&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+			},
+			wantReason: InsufficientPermissions,
+			wantMessage: "kubeconfig is not allowed to create clusterrolebindings.rbac.authorization.k8s.io, " +
+				"update clusterrolebindings.rbac.authorization.k8s.io",
+		},
+		{
+			name:          "fail if storage class is missing",
+			serverVersion: "v1.18.8",
+			wantReason:    StorageClassNotFound,
+			wantMessage:   "storage classes default not found",
+		},
+		{
+			name:          "fail if crd has unknown stored versions",
+			serverVersion: "v1.18.8",
+			objects: []runtime.Object{
+				&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+				newCRD(apiextensionsv1.NamespaceScoped, "v1alpha1", "v1beta1"),
+			},
+			wantReason:  ConflictingCRDs,
+			wantMessage: "crd sfclusters.resource.servicefabrik.io has stored versions v1beta1 unknown to interoperator",
+		},
+		{
+			name:          "report all failed checks",
+			serverVersion: "v1.14.0",
+			objects: []runtime.Object{
+				newCRD(apiextensionsv1.ClusterScoped, "v1alpha1"),
+			},
+			wantReason: UnsupportedKubernetesVersion,
+			wantMessage: "kubernetes version v1.14.0 is older than the minimum supported version 1.16.0; " +
+				"storage classes default not found; " +
+				"crd sfclusters.resource.servicefabrik.io has scope Cluster instead of Namespaced",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getServerVersion = func(*rest.Config) (*version.Info, error) {
+				return &version.Info{GitVersion: tt.serverVersion}, nil
+			}
+			reviewAccess = func(c client.Client, attributes authorizationv1.ResourceAttributes) (bool, error) {
+				return attributes.Resource != tt.denied, nil
+			}
+			r := &ReconcileProvisioner{
+				Client:          masterClient,
+				Log:             ctrlrun.Log.WithName("mcd").WithName("provisioner"),
+				clusterRegistry: mockClusterRegistry,
+				cfgManager: &fakeConfig{
+					cfg: &config.InteroperatorConfig{
+						MinKubernetesVersion:   constants.DefaultMinKubernetesVersion,
+						RequiredStorageClasses: []string{"default"},
+					},
+				},
+			}
+			targetClient := fake.NewFakeClientWithScheme(scheme, tt.objects...)
+
+			err := r.preflightChecks("2", targetClient)
+			if tt.wantReason == "" {
+				g.Expect(err).NotTo(gomega.HaveOccurred())
+				return
+			}
+			g.Expect(err).To(gomega.HaveOccurred())
+			preflightErr, ok := err.(*preflightError)
+			g.Expect(ok).To(gomega.BeTrue())
+			g.Expect(preflightErr.reason).To(gomega.Equal(tt.wantReason))
+			g.Expect(preflightErr.Error()).To(gomega.Equal(tt.wantMessage))
+		})
+	}
+}
+
+func Test_isOnboarded(t *testing.T) {
+	cluster := &resourcev1alpha1.SFCluster{}
+	if isOnboarded(cluster) {
+		t.Errorf("isOnboarded() = true, want false for cluster without conditions")
+	}
+	cluster.Status.SetCondition(newCondition(resourcev1alpha1.ClusterProvisionerDeployed, "DeploymentFailed", 1, nil))
+	if !isOnboarded(cluster) {
+		t.Errorf("isOnboarded() = false, want true")
+	}
+}
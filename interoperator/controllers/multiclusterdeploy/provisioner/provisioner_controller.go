@@ -19,7 +19,8 @@ package provisioner
 import (
 	"context"
 	"fmt"
-	"os"
+	"sort"
+	"strings"
 	"time"
 
 	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
@@ -36,13 +37,16 @@ import (
 	v1 "k8s.io/api/rbac/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 var (
@@ -59,8 +63,12 @@ var (
 	)
 )
 
+// MultiplePrimaryClusters is the reason of a failed Primary condition
+const MultiplePrimaryClusters = "MultiplePrimaryClusters"
+
 var addClusterToWatch = watchmanager.AddCluster
 var removeClusterFromWatch = watchmanager.RemoveCluster
+var refreshClusterWatch = watchmanager.RefreshCluster
 
 // ReconcileProvisioner reconciles a SFCluster object
 type ReconcileProvisioner struct {
@@ -75,16 +83,18 @@ type ReconcileProvisioner struct {
 // and what is actual state of components deployed in the sister cluster
 /* Functions of this method
 1. Get target cluster client and reconcile primary cluster id in configmap
-2. Get deployment instance deployed in master cluster
-3. Register SF CRDs in target cluster (Must be done before registering watches)
-4. Add watches on resources in target sfcluster
-5. Namespace creation in target cluster
-6. SFCluster deploy in target cluster
-7. Kubeconfig secret in target cluster
-8. Create clusterrolebinding in target cluster
-9. Image pull secrets in target cluster
-10. Deploy provisioner in target cluster (for provisioner on master, primary cluster id
+2. Run preflight checks on target cluster (till the provisioner is deployed once)
+3. Get deployment instance deployed in master cluster
+4. Register SF CRDs in target cluster (Must be done before registering watches)
+5. Add watches on resources in target sfcluster
+6. Namespace creation in target cluster
+7. SFCluster deploy in target cluster
+8. Kubeconfig secret in target cluster
+9. Create clusterrolebinding in target cluster
+10. Image pull secrets in target cluster
+11. Deploy provisioner in target cluster (for provisioner on master, primary cluster id
 	should be injected in provisioner env)
+The outcome of the steps is recorded in the conditions of the SFCluster.
 */
 func (r *ReconcileProvisioner) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
@@ -109,9 +119,17 @@ func (r *ReconcileProvisioner) Reconcile(req ctrl.Request) (ctrl.Result, error)
 	clusterID := clusterInstance.GetName()
 	log.Info("reconciling cluster", "clusterID", clusterID)
 
-	// Setting the cluster state metric as Down.
-	// The cluster is ready when the reconcile completes.
-	clusterMetric.WithLabelValues(clusterID).Set(0)
+	// The conditions observed in the steps are written to the status on return
+	var conditions []resourcev1alpha1.SFClusterCondition
+	observe := func(conditionType, failedReason string, err error) {
+		conditions = append(conditions, newCondition(conditionType, failedReason,
+			clusterInstance.GetGeneration(), err))
+	}
+	defer func() {
+		if err := r.updateConditions(req.NamespacedName, conditions); err != nil {
+			log.Error(err, "Failed to update conditions of cluster", "clusterId", clusterID)
+		}
+	}()
 
 	//reconcile primaryClusterID in the configmap
 	err = r.reconcilePrimaryClusterIDConfig()
@@ -119,13 +137,54 @@ func (r *ReconcileProvisioner) Reconcile(req ctrl.Request) (ctrl.Result, error)
 		return ctrl.Result{}, err
 	}
 
+	// Clusters in pull mode are onboarded by their agent, which connects to
+	// the master cluster. Nothing is pushed to such clusters.
+	if clusterInstance.IsPullMode() {
+		clusterMetric.DeleteLabelValues(clusterID)
+		err = removeClusterFromWatch(clusterID)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		log.Info("cluster is in pull mode. Not deploying provisioner", "clusterID", clusterID)
+		return ctrl.Result{}, nil
+	}
+
+	// Setting the cluster state metric as Down.
+	// The cluster is ready when the reconcile completes.
+	clusterMetric.WithLabelValues(clusterID).Set(0)
+
 	// Get targetClient for targetCluster
 	targetClient, err := r.clusterRegistry.GetClient(clusterID)
+	observe(resourcev1alpha1.ClusterKubeconfigValid, "KubeconfigInvalid", err)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	// 2. Get deploment instance for provisioner
+	// Refresh the token in the kubeconfig before it expires. The current
+	// token is still used if the refresh fails.
+	tokenRefreshAfter, err := r.refreshToken(clusterInstance)
+	if err != nil {
+		log.Error(err, "Failed to refresh token in kubeconfig of cluster", "clusterId", clusterID)
+	}
+
+	// 2. Run preflight checks before creating anything in target cluster
+	if !isOnboarded(clusterInstance) {
+		err = r.preflightChecks(clusterID, targetClient)
+		if err != nil {
+			if preflightErr, ok := err.(*preflightError); ok {
+				observe(resourcev1alpha1.ClusterPreflightSucceeded, preflightErr.reason, err)
+				// Retry after the cluster setup is fixed
+				return ctrl.Result{
+					RequeueAfter: r.getRequeueAfter(tokenRefreshAfter),
+				}, nil
+			}
+			observe(resourcev1alpha1.ClusterPreflightSucceeded, PreflightFailed, err)
+			return ctrl.Result{}, err
+		}
+		observe(resourcev1alpha1.ClusterPreflightSucceeded, PreflightFailed, nil)
+	}
+
+	// 3. Get deploment instance for provisioner
 	deplomentInstance := &appsv1.Deployment{}
 	err = r.Get(ctx, types.NamespacedName{
 		Name:      constants.ProvisionerTemplateName,
@@ -133,37 +192,46 @@ func (r *ReconcileProvisioner) Reconcile(req ctrl.Request) (ctrl.Result, error)
 	}, deplomentInstance)
 	if err != nil {
 		log.Error(err, "Failed to get provisioner deployment from master cluster", "clusterId", clusterID)
+		observe(resourcev1alpha1.ClusterProvisionerDeployed, "ProvisionerTemplateNotFound", err)
 		return ctrl.Result{}, err
 	}
 
-	// 3. Register sf CRDs
+	// 4. Register sf CRDs
 	err = r.registerSFCrds(clusterID, targetClient)
+	observe(resourcev1alpha1.ClusterCRDsRegistered, "CRDRegistrationFailed", err)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	// 4. Add watches on resources in target sfcluster. Must be done after
+	// 5. Add watches on resources in target sfcluster. Must be done after
 	// registering sf crds, since we are trying to watch on sfserviceinstance
 	// and sfservicebinding.
 	err = addClusterToWatch(clusterID)
+	if err == nil {
+		// Restart the watch if the kubeconfig of the cluster was rotated
+		err = refreshClusterWatch(clusterID)
+	}
+	observe(resourcev1alpha1.ClusterWatchEstablished, "WatchFailed", err)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	// 5. Create/Update Namespace in target cluster for provisioner
+	// 6. Create/Update Namespace in target cluster for provisioner
 	namespace := deplomentInstance.GetNamespace()
 	err = r.reconcileNamespace(namespace, clusterID, targetClient)
 	if err != nil {
+		observe(resourcev1alpha1.ClusterProvisionerDeployed, "NamespaceFailed", err)
 		return ctrl.Result{}, err
 	}
 
-	// 6. Creating/Updating sfcluster in target cluster
+	// 7. Creating/Updating sfcluster in target cluster
 	err = r.reconcileSfClusterCrd(clusterInstance, clusterID, targetClient)
 	if err != nil {
+		observe(resourcev1alpha1.ClusterProvisionerDeployed, "SFClusterReplicationFailed", err)
 		return ctrl.Result{}, err
 	}
 
-	// 7. Creating/Updating kubeconfig secret for sfcluster in target cluster
+	// 8. Creating/Updating kubeconfig secret for sfcluster in target cluster
 	// Fetch current primary cluster id from configmap
 	interoperatorCfg := r.cfgManager.GetConfig()
 	currPrimaryClusterID := interoperatorCfg.PrimaryClusterID
@@ -172,28 +240,32 @@ func (r *ReconcileProvisioner) Reconcile(req ctrl.Request) (ctrl.Result, error)
 	if err != nil {
 		// Skip if secret not found for leader cluster
 		if !(apiErrors.IsNotFound(err) && clusterID == currPrimaryClusterID) {
+			observe(resourcev1alpha1.ClusterProvisionerDeployed, "KubeconfigSecretFailed", err)
 			return ctrl.Result{}, err
 		}
 		log.Info("Ignoring secret not found error for leader cluster", "clusterId", clusterID,
 			"secretRef", clusterInstance.Spec.SecretRef)
 	}
 
-	// 8. Deploy cluster rolebinding
+	// 9. Deploy cluster rolebinding
 	err = r.reconcileClusterRoleBinding(namespace, clusterID, targetClient)
 	if err != nil {
+		observe(resourcev1alpha1.ClusterProvisionerDeployed, "ClusterRoleBindingFailed", err)
 		return ctrl.Result{}, err
 	}
 
-	// 9. Creating/Updating imagepull secrets for provisioner deployment in target cluster
+	// 10. Creating/Updating imagepull secrets for provisioner deployment in target cluster
 	for _, secretRef := range deplomentInstance.Spec.Template.Spec.ImagePullSecrets {
 		err = r.reconcileSecret(namespace, secretRef.Name, clusterID, targetClient)
 		if err != nil {
+			observe(resourcev1alpha1.ClusterProvisionerDeployed, "ImagePullSecretFailed", err)
 			return ctrl.Result{}, err
 		}
 	}
 
-	// 10. Create Deployment in target cluster for provisioner
+	// 11. Create Deployment in target cluster for provisioner
 	err = r.reconcileDeployment(deplomentInstance, clusterID, targetClient)
+	observe(resourcev1alpha1.ClusterProvisionerDeployed, "DeploymentFailed", err)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
@@ -201,17 +273,94 @@ func (r *ReconcileProvisioner) Reconcile(req ctrl.Request) (ctrl.Result, error)
 	// Reconcile completed. Mark cluster as up
 	clusterMetric.WithLabelValues(clusterID).Set(1)
 
+	return ctrl.Result{
+		RequeueAfter: r.getRequeueAfter(tokenRefreshAfter),
+	}, nil
+}
+
+// getRequeueAfter returns the ClusterReconcileInterval or tokenRefreshAfter
+// if the token in the kubeconfig is to be refreshed earlier
+func (r *ReconcileProvisioner) getRequeueAfter(tokenRefreshAfter time.Duration) time.Duration {
+	requeueAfter := r.getReconcileInterval()
+	if tokenRefreshAfter > 0 && tokenRefreshAfter < requeueAfter {
+		return tokenRefreshAfter
+	}
+	return requeueAfter
+}
+
+func (r *ReconcileProvisioner) getReconcileInterval() time.Duration {
+	interoperatorCfg := r.cfgManager.GetConfig()
 	requeueAfter, err := time.ParseDuration(interoperatorCfg.ClusterReconcileInterval)
 	if err != nil {
-		log.Error(err, "Failed to parse ClusterReconcileInterval",
+		r.Log.Error(err, "Failed to parse ClusterReconcileInterval",
 			"ClusterReconcileInterval", interoperatorCfg.ClusterReconcileInterval)
 		requeueAfter, _ = time.ParseDuration(constants.DefaultClusterReconcileInterval)
 	}
-	return ctrl.Result{
-		RequeueAfter: requeueAfter,
-	}, nil
+	return requeueAfter
 }
 
+// newCondition returns a True condition with the type as reason if err is nil
+// and a False condition with failedReason and the error as message otherwise
+func newCondition(conditionType, failedReason string, generation int64, err error) resourcev1alpha1.SFClusterCondition {
+	condition := resourcev1alpha1.SFClusterCondition{
+		Type:               conditionType,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             conditionType,
+	}
+	if err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = failedReason
+		condition.Message = err.Error()
+	}
+	return condition
+}
+
+// updateConditions writes the conditions observed while reconciling the
+// cluster to its status. The CapacityReported and Ready conditions are
+// updated too and the Primary condition is removed if the cluster is not
+// labelled as primary.
+func (r *ReconcileProvisioner) updateConditions(key types.NamespacedName, conditions []resourcev1alpha1.SFClusterCondition) error {
+	ctx := context.Background()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cluster := &resourcev1alpha1.SFCluster{}
+		err := r.Get(ctx, key, cluster)
+		if err != nil {
+			if apiErrors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+
+		changed := false
+		for _, condition := range conditions {
+			changed = cluster.Status.SetCondition(condition) || changed
+		}
+		if cluster.GetLabels()[constants.PrimaryClusterKey] != "true" {
+			changed = cluster.Status.RemoveCondition(resourcev1alpha1.ClusterPrimary) || changed
+		}
+
+		var capacityErr error
+		if len(cluster.Status.CurrentCapacity) == 0 {
+			capacityErr = fmt.Errorf("capacity of the cluster is not reported yet")
+		}
+		changed = cluster.Status.SetCondition(newCondition(resourcev1alpha1.ClusterCapacityReported,
+			"CapacityNotReported", cluster.GetGeneration(), capacityErr)) || changed
+		changed = cluster.Status.UpdateReadyCondition(cluster.GetGeneration()) || changed
+		if !changed {
+			return nil
+		}
+		return r.Status().Update(ctx, cluster)
+	})
+}
+
+// reconcilePrimaryClusterIDConfig updates the primary cluster id in the
+// interoperator config to the SFCluster labelled with PrimaryClusterKey. The
+// primary cluster is switched by moving the label to another SFCluster. The
+// clients of the primary cluster use the in cluster config, so the watches on
+// the previous and the new primary cluster are restarted. If more than one
+// SFCluster is labelled, the primary cluster is not changed and the Primary
+// condition of the labelled clusters is set to False.
 func (r *ReconcileProvisioner) reconcilePrimaryClusterIDConfig() error {
 	ctx := context.Background()
 	log := r.Log.WithName("PrimaryClusterID reconciler")
@@ -221,21 +370,60 @@ func (r *ReconcileProvisioner) reconcilePrimaryClusterIDConfig() error {
 		log.Error(err, "Failed to reconcile PrimaryClusterID config. Failed to fetch sfcluster list")
 		return err
 	}
+	if len(sfClustersList.Items) == 0 {
+		return nil
+	}
+
+	interoperatorCfg := r.cfgManager.GetConfig()
+	currPrimaryClusterID := interoperatorCfg.PrimaryClusterID
+
+	var conflictErr error
 	if len(sfClustersList.Items) == 1 {
-		//update interoperator  configmap
-		interoperatorCfg := r.cfgManager.GetConfig()
-		interoperatorCfg.PrimaryClusterID = sfClustersList.Items[0].GetName()
-		err = r.cfgManager.UpdateConfig(interoperatorCfg)
+		primaryClusterID := sfClustersList.Items[0].GetName()
+		if primaryClusterID != currPrimaryClusterID {
+			//update interoperator  configmap
+			interoperatorCfg.PrimaryClusterID = primaryClusterID
+			err = r.cfgManager.UpdateConfig(interoperatorCfg)
+			if err != nil {
+				log.Error(err, "Failed to reconcile PrimaryClusterID config. Updating configmap failed")
+				return err
+			}
+			log.Info("Updated primary cluster id in configmap", "primaryClusterId", primaryClusterID,
+				"previousPrimaryClusterId", currPrimaryClusterID)
+
+			// The watches are refreshed again when the clusters are reconciled
+			for _, clusterID := range []string{currPrimaryClusterID, primaryClusterID} {
+				err = refreshClusterWatch(clusterID)
+				if err != nil {
+					log.Error(err, "Failed to restart watch on cluster after changing primary cluster",
+						"clusterId", clusterID)
+				}
+			}
+		}
+		constants.OwnClusterID = primaryClusterID // keep OwnClusterID up-to-date
+	} else {
+		//more than one sfcluster has primary cluster label
+		var names []string
+		for _, cluster := range sfClustersList.Items {
+			names = append(names, cluster.GetName())
+		}
+		sort.Strings(names)
+		conflictErr = fmt.Errorf("sfclusters %s are labelled with %s. primary cluster remains %s",
+			strings.Join(names, ", "), constants.PrimaryClusterKey, currPrimaryClusterID)
+		log.Error(conflictErr, "More than one sfcluster CR with label: "+constants.PrimaryClusterKey)
+	}
+
+	for _, cluster := range sfClustersList.Items {
+		condition := newCondition(resourcev1alpha1.ClusterPrimary, MultiplePrimaryClusters,
+			cluster.GetGeneration(), conflictErr)
+		err = r.updateConditions(types.NamespacedName{
+			Name:      cluster.GetName(),
+			Namespace: cluster.GetNamespace(),
+		}, []resourcev1alpha1.SFClusterCondition{condition})
 		if err != nil {
-			log.Error(err, "Failed to reconcile PrimaryClusterID config. Updating configmap failed")
+			log.Error(err, "Failed to update Primary condition of cluster", "clusterId", cluster.GetName())
 			return err
 		}
-		constants.OwnClusterID = sfClustersList.Items[0].GetName() // keep OwnClusterID up-to-date
-		log.Info("Updated primary cluster id in configmap", "primaryClusterId", sfClustersList.Items[0].GetName())
-	} else if len(sfClustersList.Items) > 1 {
-		//more than one sfcluster has primary cluster label
-		log.Error(fmt.Errorf("more than one primary cluster"), "More than one sfcluster CR with label: "+constants.PrimaryClusterKey)
-		os.Exit(1)
 	}
 	return nil
 }
@@ -244,14 +432,7 @@ func (r *ReconcileProvisioner) registerSFCrds(clusterID string, targetClient cli
 	ctx := context.Background()
 	log := r.Log.WithValues("clusterID", clusterID)
 
-	SFCrdNames := []string{
-		"sfplans.osb.servicefabrik.io",
-		"sfservices.osb.servicefabrik.io",
-		"sfserviceinstances.osb.servicefabrik.io",
-		"sfservicebindings.osb.servicefabrik.io",
-		"sfclusters.resource.servicefabrik.io",
-	}
-	for _, sfcrdname := range SFCrdNames {
+	for _, sfcrdname := range sfCRDNames {
 		// Get crd registered in master cluster
 		sfCRDInstance := &apiextensionsv1.CustomResourceDefinition{}
 
@@ -578,6 +759,12 @@ func (r *ReconcileProvisioner) SetupWithManager(mgr ctrl.Manager) error {
 			MaxConcurrentReconciles: interoperatorCfg.ProvisionerWorkerCount,
 		}).
 		For(&resourcev1alpha1.SFCluster{}).
+		// Kubeconfig secrets are owned by the SFClusters
+		Watches(&source.Kind{Type: &corev1.Secret{}},
+			&handler.EnqueueRequestForOwner{
+				IsController: false,
+				OwnerType:    &resourcev1alpha1.SFCluster{},
+			}).
 		WithEventFilter(watches.NamespaceFilter())
 
 	return builder.Complete(r)
@@ -36,9 +36,11 @@ import (
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrlrun "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
@@ -132,6 +134,14 @@ func TestReconcile(t *testing.T) {
 		return nil
 	}
 
+	_refreshClusterWatch := refreshClusterWatch
+	defer func() {
+		refreshClusterWatch = _refreshClusterWatch
+	}()
+	refreshClusterWatch = func(string) error {
+		return nil
+	}
+
 	_removeClusterFromWatch := removeClusterFromWatch
 	defer func() {
 		removeClusterFromWatch = _removeClusterFromWatch
@@ -154,6 +164,7 @@ func TestReconcile(t *testing.T) {
 	g.Expect(c.Create(context.TODO(), deploymentInstance)).NotTo(gomega.HaveOccurred())
 
 	mockClusterRegistry.EXPECT().GetClient("2").Return(targetReconciler, nil).AnyTimes()
+	mockClusterRegistry.EXPECT().GetConfig("2").Return(cfg2, nil).AnyTimes()
 
 	g.Expect(controller.SetupWithManager(mgr)).NotTo(gomega.HaveOccurred())
 	stopMgr, mgrStopped := StartTestManager(mgr, g)
@@ -183,6 +194,32 @@ func TestReconcile(t *testing.T) {
 	interoperatorClusterUp := testutil.ToFloat64(clusterMetric.WithLabelValues(clusterID))
 	g.Expect(interoperatorClusterUp).To(gomega.Equal(float64(1)))
 
+	// Check if the conditions of the steps are recorded
+	g.Eventually(func() error {
+		cluster := &resourcev1alpha1.SFCluster{}
+		err := c.Get(context.TODO(), types.NamespacedName{
+			Name:      clusterInstance.GetName(),
+			Namespace: clusterInstance.GetNamespace(),
+		}, cluster)
+		if err != nil {
+			return err
+		}
+		for _, conditionType := range []string{
+			resourcev1alpha1.ClusterKubeconfigValid,
+			resourcev1alpha1.ClusterPreflightSucceeded,
+			resourcev1alpha1.ClusterCRDsRegistered,
+			resourcev1alpha1.ClusterWatchEstablished,
+			resourcev1alpha1.ClusterProvisionerDeployed,
+			resourcev1alpha1.ClusterReady,
+		} {
+			condition := cluster.Status.GetCondition(conditionType)
+			if condition == nil || condition.Status != metav1.ConditionTrue {
+				return fmt.Errorf("condition %s not true: %v", conditionType, condition)
+			}
+		}
+		return nil
+	}, timeout).Should(gomega.Succeed())
+
 	// Delete SFCluster
 	g.Expect(c.Delete(context.TODO(), clusterInstance)).NotTo(gomega.HaveOccurred())
 	g.Eventually(func() error {
@@ -381,6 +418,105 @@ instanceContollerWatchList:
 	g.Expect(interoperatorCfg.PrimaryClusterID).To(gomega.Equal("primary"))
 }
 
+func TestReconcileProvisioner_primaryClusterFailover(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(resourcev1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	newCluster := func(name string, primary bool) *resourcev1alpha1.SFCluster {
+		cluster := &resourcev1alpha1.SFCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: constants.InteroperatorNamespace,
+			},
+		}
+		if primary {
+			cluster.SetLabels(map[string]string{constants.PrimaryClusterKey: "true"})
+		}
+		return cluster
+	}
+
+	_ownClusterID := constants.OwnClusterID
+	_refreshClusterWatch := refreshClusterWatch
+	defer func() {
+		constants.OwnClusterID = _ownClusterID
+		refreshClusterWatch = _refreshClusterWatch
+	}()
+	var refreshed []string
+	refreshClusterWatch = func(clusterID string) error {
+		refreshed = append(refreshed, clusterID)
+		return nil
+	}
+
+	tests := []struct {
+		name          string
+		clusters      []runtime.Object
+		wantPrimary   string
+		wantRefreshed []string
+		wantCondition map[string]metav1.ConditionStatus
+	}{
+		{
+			name:          "keep primary cluster",
+			clusters:      []runtime.Object{newCluster("1", true), newCluster("2", false)},
+			wantPrimary:   "1",
+			wantCondition: map[string]metav1.ConditionStatus{"1": metav1.ConditionTrue},
+		},
+		{
+			name:          "switch primary cluster",
+			clusters:      []runtime.Object{newCluster("1", false), newCluster("2", true)},
+			wantPrimary:   "2",
+			wantRefreshed: []string{"1", "2"},
+			wantCondition: map[string]metav1.ConditionStatus{"2": metav1.ConditionTrue},
+		},
+		{
+			name:        "keep primary cluster if more than one cluster is labelled",
+			clusters:    []runtime.Object{newCluster("1", true), newCluster("2", true)},
+			wantPrimary: "1",
+			wantCondition: map[string]metav1.ConditionStatus{
+				"1": metav1.ConditionFalse,
+				"2": metav1.ConditionFalse,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refreshed = nil
+			constants.OwnClusterID = "1"
+			r := &ReconcileProvisioner{
+				Client:     fake.NewFakeClientWithScheme(scheme, tt.clusters...),
+				Log:        ctrlrun.Log.WithName("mcd").WithName("provisioner"),
+				cfgManager: &fakeConfig{cfg: &config.InteroperatorConfig{PrimaryClusterID: "1"}},
+			}
+			g.Expect(r.reconcilePrimaryClusterIDConfig()).To(gomega.Succeed())
+			g.Expect(r.cfgManager.GetConfig().PrimaryClusterID).To(gomega.Equal(tt.wantPrimary))
+			g.Expect(constants.OwnClusterID).To(gomega.Equal(tt.wantPrimary))
+			g.Expect(refreshed).To(gomega.Equal(tt.wantRefreshed))
+
+			for _, name := range []string{"1", "2"} {
+				cluster := &resourcev1alpha1.SFCluster{}
+				g.Expect(r.Get(context.TODO(), types.NamespacedName{
+					Name:      name,
+					Namespace: constants.InteroperatorNamespace,
+				}, cluster)).To(gomega.Succeed())
+				condition := cluster.Status.GetCondition(resourcev1alpha1.ClusterPrimary)
+				wantStatus, ok := tt.wantCondition[name]
+				if !ok {
+					g.Expect(condition).To(gomega.BeNil())
+					continue
+				}
+				g.Expect(condition).NotTo(gomega.BeNil())
+				g.Expect(condition.Status).To(gomega.Equal(wantStatus))
+				if wantStatus == metav1.ConditionFalse {
+					g.Expect(condition.Reason).To(gomega.Equal(MultiplePrimaryClusters))
+					g.Expect(condition.Message).To(gomega.Equal("sfclusters 1, 2 are labelled with " +
+						constants.PrimaryClusterKey + ". primary cluster remains 1"))
+				}
+			}
+		})
+	}
+}
+
 func TestReconcileProvisioner_reconcileNamespace(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
 	ctrl := gomock.NewController(t)
@@ -780,3 +916,94 @@ func TestReconcileProvisioner_reconcileClusterRoleBinding(t *testing.T) {
 		}, timeout).Should(gomega.Succeed())
 	}
 }
+
+func TestReconcileProvisioner_updateConditions(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(resourcev1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	cluster := &resourcev1alpha1.SFCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "3",
+			Namespace:  constants.InteroperatorNamespace,
+			Generation: 4,
+		},
+	}
+	key := types.NamespacedName{Name: cluster.GetName(), Namespace: cluster.GetNamespace()}
+	r := &ReconcileProvisioner{
+		Client: fake.NewFakeClientWithScheme(scheme, cluster),
+		Log:    ctrlrun.Log.WithName("mcd").WithName("provisioner"),
+	}
+
+	conditions := []resourcev1alpha1.SFClusterCondition{
+		newCondition(resourcev1alpha1.ClusterKubeconfigValid, "KubeconfigInvalid", 4, nil),
+		newCondition(resourcev1alpha1.ClusterCRDsRegistered, "CRDRegistrationFailed", 4, fmt.Errorf("forbidden")),
+	}
+	g.Expect(r.updateConditions(key, conditions)).To(gomega.Succeed())
+
+	got := &resourcev1alpha1.SFCluster{}
+	g.Expect(r.Get(context.TODO(), key, got)).To(gomega.Succeed())
+	g.Expect(got.Status.GetCondition(resourcev1alpha1.ClusterKubeconfigValid).Status).To(gomega.Equal(metav1.ConditionTrue))
+	crds := got.Status.GetCondition(resourcev1alpha1.ClusterCRDsRegistered)
+	g.Expect(crds.Status).To(gomega.Equal(metav1.ConditionFalse))
+	g.Expect(crds.Reason).To(gomega.Equal("CRDRegistrationFailed"))
+	g.Expect(crds.Message).To(gomega.Equal("forbidden"))
+	g.Expect(crds.ObservedGeneration).To(gomega.Equal(int64(4)))
+	g.Expect(got.Status.GetCondition(resourcev1alpha1.ClusterCapacityReported).Status).To(gomega.Equal(metav1.ConditionFalse))
+	ready := got.Status.GetCondition(resourcev1alpha1.ClusterReady)
+	g.Expect(ready.Status).To(gomega.Equal(metav1.ConditionFalse))
+	g.Expect(ready.Reason).To(gomega.Equal("CRDRegistrationFailed"))
+	g.Expect(got.IsReady()).To(gomega.BeFalse())
+
+	conditions = []resourcev1alpha1.SFClusterCondition{
+		newCondition(resourcev1alpha1.ClusterCRDsRegistered, "CRDRegistrationFailed", 4, nil),
+	}
+	g.Expect(r.updateConditions(key, conditions)).To(gomega.Succeed())
+	g.Expect(r.Get(context.TODO(), key, got)).To(gomega.Succeed())
+	g.Expect(got.IsReady()).To(gomega.BeTrue())
+}
+
+func TestReconcileProvisioner_pullMode(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	scheme := runtime.NewScheme()
+	g.Expect(resourcev1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	cluster := &resourcev1alpha1.SFCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "4",
+			Namespace: constants.InteroperatorNamespace,
+		},
+		Spec: resourcev1alpha1.SFClusterSpec{
+			Mode: resourcev1alpha1.ClusterModePull,
+		},
+	}
+
+	var removed []string
+	_removeClusterFromWatch := removeClusterFromWatch
+	defer func() {
+		removeClusterFromWatch = _removeClusterFromWatch
+	}()
+	removeClusterFromWatch = func(clusterID string) error {
+		removed = append(removed, clusterID)
+		return nil
+	}
+
+	// Nothing is pushed to the cluster, so the registry must not be used
+	r := &ReconcileProvisioner{
+		Client:          fake.NewFakeClientWithScheme(scheme, cluster),
+		Log:             ctrlrun.Log.WithName("mcd").WithName("provisioner"),
+		clusterRegistry: mock_clusterRegistry.NewMockClusterRegistry(ctrl),
+		cfgManager:      &fakeConfig{cfg: &config.InteroperatorConfig{}},
+	}
+	result, err := r.Reconcile(ctrlrun.Request{NamespacedName: types.NamespacedName{
+		Name:      cluster.GetName(),
+		Namespace: cluster.GetNamespace(),
+	}})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result).To(gomega.Equal(ctrlrun.Result{}))
+	g.Expect(removed).To(gomega.Equal([]string{"4"}))
+}
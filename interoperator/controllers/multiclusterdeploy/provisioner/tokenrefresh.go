@@ -0,0 +1,164 @@
+/*
+Copyright 2018 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// tokenRefreshThreshold is the fraction of the lifetime of a token after
+// which it is refreshed
+const tokenRefreshThreshold = 0.8
+
+const serviceAccountUsernamePrefix = "system:serviceaccount:"
+
+var createToken = func(cfg *rest.Config, namespace, name string, expirationSeconds int64) (string, error) {
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return "", err
+	}
+	tokenRequest := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			ExpirationSeconds: &expirationSeconds,
+		},
+	}
+	result, err := clientset.CoreV1().ServiceAccounts(namespace).CreateToken(context.Background(),
+		name, tokenRequest, metav1.CreateOptions{})
+	if err != nil {
+		return "", err
+	}
+	return result.Status.Token, nil
+}
+
+// tokenClaims are the claims of a service account token
+type tokenClaims struct {
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// parseTokenClaims decodes the claims of a JWT without verifying it
+func parseTokenClaims(token string) (*tokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	claims := &tokenClaims{}
+	err = json.Unmarshal(payload, claims)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// refreshToken renews the service account token in the kubeconfig secret of
+// the cluster once tokenRefreshThreshold of its lifetime has passed. The
+// update of the secret restarts the watches on the cluster. It returns the
+// time after which the token must be refreshed next, zero if the kubeconfig
+// does not use an expiring service account token.
+func (r *ReconcileProvisioner) refreshToken(cluster *resourcev1alpha1.SFCluster) (time.Duration, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("clusterID", cluster.GetName(), "secretRef", cluster.Spec.SecretRef)
+
+	if cluster.Spec.SecretRef == "" {
+		return 0, nil
+	}
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{
+		Name:      cluster.Spec.SecretRef,
+		Namespace: cluster.GetNamespace(),
+	}, secret)
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	kubeconfig, err := clientcmd.Load(secret.Data["kubeconfig"])
+	if err != nil {
+		return 0, err
+	}
+	kubeContext, ok := kubeconfig.Contexts[kubeconfig.CurrentContext]
+	if !ok {
+		return 0, nil
+	}
+	authInfo, ok := kubeconfig.AuthInfos[kubeContext.AuthInfo]
+	if !ok || authInfo.Token == "" {
+		return 0, nil
+	}
+	claims, err := parseTokenClaims(authInfo.Token)
+	if err != nil || claims.ExpiresAt == 0 || claims.IssuedAt == 0 ||
+		!strings.HasPrefix(claims.Subject, serviceAccountUsernamePrefix) {
+		// Not an expiring service account token
+		return 0, nil
+	}
+	serviceAccount := strings.Split(strings.TrimPrefix(claims.Subject, serviceAccountUsernamePrefix), ":")
+	if len(serviceAccount) != 2 {
+		return 0, nil
+	}
+
+	lifetime := time.Duration(claims.ExpiresAt-claims.IssuedAt) * time.Second
+	refreshAfter := time.Duration(float64(lifetime) * tokenRefreshThreshold)
+	expiresAt := time.Unix(claims.ExpiresAt, 0)
+	now := time.Now()
+	if wait := time.Unix(claims.IssuedAt, 0).Add(refreshAfter).Sub(now); wait > 0 {
+		return wait, nil
+	}
+	if !now.Before(expiresAt) {
+		return 0, fmt.Errorf("service account token in kubeconfig expired at %s", expiresAt)
+	}
+
+	cfg, err := clientcmd.RESTConfigFromKubeConfig(secret.Data["kubeconfig"])
+	if err != nil {
+		return 0, err
+	}
+	token, err := createToken(cfg, serviceAccount[0], serviceAccount[1], int64(lifetime.Seconds()))
+	if err != nil {
+		return 0, err
+	}
+	// Only the token is replaced to keep the rest of the kubeconfig as is
+	secret.Data["kubeconfig"] = bytes.ReplaceAll(secret.Data["kubeconfig"], []byte(authInfo.Token), []byte(token))
+	err = r.Update(ctx, secret)
+	if err != nil {
+		return 0, err
+	}
+	log.Info("Refreshed service account token in kubeconfig", "serviceAccount", claims.Subject,
+		"previousExpiry", expiresAt)
+	return refreshAfter, nil
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2018 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provisioner
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrlrun "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func _getDummyToken(subject string, issuedAt, expiresAt time.Time) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"%s","iat":%d,"exp":%d}`,
+		subject, issuedAt.Unix(), expiresAt.Unix())))
+	return header + "." + payload + ".c2lnbmF0dXJl"
+}
+
+func _getDummyKubeconfig(token string) []byte {
+	return []byte(fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: https://10.0.0.1
+  name: test
+users:
+- name: test
+  user:
+    token: %s
+contexts:
+- context:
+    cluster: test
+    user: test
+  name: test
+current-context: test`, token))
+}
+
+func TestReconcileProvisioner_refreshToken(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(gomega.Succeed())
+	g.Expect(resourcev1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	cluster := &resourcev1alpha1.SFCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "2",
+			Namespace: constants.InteroperatorNamespace,
+		},
+		Spec: resourcev1alpha1.SFClusterSpec{
+			SecretRef: "2-kubeconfig",
+		},
+	}
+	secretKey := types.NamespacedName{Name: "2-kubeconfig", Namespace: constants.InteroperatorNamespace}
+
+	var tokenRequests []string
+	_createToken := createToken
+	defer func() {
+		createToken = _createToken
+	}()
+	createToken = func(cfg *rest.Config, namespace, name string, expirationSeconds int64) (string, error) {
+		tokenRequests = append(tokenRequests, fmt.Sprintf("%s/%s/%d", namespace, name, expirationSeconds))
+		return "new-token", nil
+	}
+
+	now := time.Now()
+	subject := "system:serviceaccount:kube-system:interoperator"
+	tests := []struct {
+		name             string
+		token            string
+		wantRefreshAfter time.Duration
+		wantToken        string
+		wantErr          bool
+	}{
+		{
+			name:      "ignore static tokens",
+			token:     "static-token",
+			wantToken: "static-token",
+		},
+		{
+			name:      "ignore tokens of users",
+			token:     _getDummyToken("admin", now.Add(-time.Hour), now.Add(time.Minute)),
+			wantToken: _getDummyToken("admin", now.Add(-time.Hour), now.Add(time.Minute)),
+		},
+		{
+			name:             "wait till token is due for refresh",
+			token:            _getDummyToken(subject, now.Add(-time.Hour), now.Add(9*time.Hour)),
+			wantRefreshAfter: 7 * time.Hour,
+			wantToken:        _getDummyToken(subject, now.Add(-time.Hour), now.Add(9*time.Hour)),
+		},
+		{
+			name:             "refresh token before it expires",
+			token:            _getDummyToken(subject, now.Add(-9*time.Hour), now.Add(time.Hour)),
+			wantRefreshAfter: 8 * time.Hour,
+			wantToken:        "new-token",
+		},
+		{
+			name:      "fail if token is expired",
+			token:     _getDummyToken(subject, now.Add(-10*time.Hour), now.Add(-time.Minute)),
+			wantToken: _getDummyToken(subject, now.Add(-10*time.Hour), now.Add(-time.Minute)),
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenRequests = nil
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      secretKey.Name,
+					Namespace: secretKey.Namespace,
+				},
+				Data: map[string][]byte{
+					"kubeconfig": _getDummyKubeconfig(tt.token),
+				},
+			}
+			r := &ReconcileProvisioner{
+				Client: fake.NewFakeClientWithScheme(scheme, cluster, secret),
+				Log:    ctrlrun.Log.WithName("mcd").WithName("provisioner"),
+			}
+
+			refreshAfter, err := r.refreshToken(cluster)
+			if tt.wantErr {
+				g.Expect(err).To(gomega.HaveOccurred())
+			} else {
+				g.Expect(err).NotTo(gomega.HaveOccurred())
+			}
+			g.Expect(refreshAfter).To(gomega.BeNumerically("~", tt.wantRefreshAfter, time.Minute))
+
+			got := &corev1.Secret{}
+			g.Expect(r.Get(context.TODO(), secretKey, got)).To(gomega.Succeed())
+			kubeconfig, err := clientcmd.Load(got.Data["kubeconfig"])
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+			g.Expect(kubeconfig.AuthInfos["test"].Token).To(gomega.Equal(tt.wantToken))
+			if tt.wantToken == "new-token" {
+				g.Expect(tokenRequests).To(gomega.Equal([]string{"kube-system/interoperator/36000"}))
+			} else {
+				g.Expect(tokenRequests).To(gomega.BeEmpty())
+			}
+		})
+	}
+}
@@ -0,0 +1,328 @@
+/*
+Copyright 2018 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package replicaauditor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/utils"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Resources audited
+const (
+	InstanceResource = "sfserviceinstances"
+	BindingResource  = "sfservicebindings"
+)
+
+// Kinds of divergence between an object in the master cluster and its
+// replica in the member cluster
+const (
+	// ReplicaMissing is reported if the replica of a provisioned object
+	// does not exist in the member cluster
+	ReplicaMissing = "Missing"
+	// ReplicaOrphaned is reported if the replica exists in the member
+	// cluster but the object in the master cluster does not
+	ReplicaOrphaned = "Orphaned"
+	// SpecMismatch is reported if the spec of the replica is outdated
+	SpecMismatch = "SpecMismatch"
+	// StateMismatch is reported if the state of the replica differs
+	StateMismatch = "StateMismatch"
+	// FinalizerMismatch is reported if the replica is not protected by the
+	// finalizer of the provisioner or is deleted without the master object
+	FinalizerMismatch = "FinalizerMismatch"
+)
+
+// Divergence is a replica which does not match its object in the master
+// cluster
+type Divergence struct {
+	Resource  string `json:"resource"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Message   string `json:"message"`
+	// Repaired is set if the divergence was repaired by the auditor
+	Repaired bool `json:"repaired,omitempty"`
+}
+
+// Report is the result of the audit of the replicas in a cluster
+type Report struct {
+	ClusterID string      `json:"clusterId"`
+	AuditedAt metav1.Time `json:"auditedAt"`
+	// Instances and Bindings are the number of objects compared
+	Instances   int          `json:"instances"`
+	Bindings    int          `json:"bindings"`
+	Divergences []Divergence `json:"divergences"`
+}
+
+// Count returns the number of divergences of the given resource and kind
+func (r *Report) Count(resource, kind string) int {
+	count := 0
+	for _, d := range r.Divergences {
+		if d.Resource == resource && d.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+func (r *Report) add(resource string, obj metav1.Object, kind, format string, args ...interface{}) {
+	r.Divergences = append(r.Divergences, Divergence{
+		Resource:  resource,
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+		Kind:      kind,
+		Message:   fmt.Sprintf(format, args...),
+	})
+}
+
+// Audit compares the SFServiceInstances and SFServiceBindings assigned to the
+// cluster in the master cluster with their replicas in the cluster. Only the
+// objects whose last operation is completed are compared, as the replicas of
+// the objects with an operation in progress are updated by the replicators.
+// The instances with an active migration are skipped.
+func (r *ReplicaAuditor) Audit(clusterID string) (*Report, error) {
+	ctx := context.Background()
+
+	cluster, err := r.clusterRegistry.GetCluster(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	if !cluster.GetDeletionTimestamp().IsZero() {
+		return nil, errors.NewPreconditionError("Audit", "cluster is being deleted", nil)
+	}
+	if clusterID == r.cfgManager.GetConfig().PrimaryClusterID {
+		return nil, errors.NewPreconditionError("Audit",
+			"objects are not replicated to the primary cluster", nil)
+	}
+	targetClient, err := r.clusterRegistry.GetClient(clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The replicas are listed first. A replica is only created after its
+	// object in the master cluster, so objects created between the two
+	// listings are never reported as orphaned.
+	replicaInstances, err := listInstances(ctx, targetClient)
+	if err != nil {
+		return nil, err
+	}
+	replicaBindings, err := listBindings(ctx, targetClient)
+	if err != nil {
+		return nil, err
+	}
+	instances, err := listInstances(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	bindings, err := listBindings(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		ClusterID:   clusterID,
+		AuditedAt:   metav1.Now(),
+		Divergences: make([]Divergence, 0),
+	}
+
+	assigned := make(map[types.NamespacedName]*osbv1alpha1.SFServiceInstance)
+	migrating := make(map[types.NamespacedName]bool)
+	for key, instance := range instances {
+		if instance.Status.Migration.IsActive() {
+			migrating[key] = true
+			continue
+		}
+		if instance.Spec.ClusterID == clusterID {
+			assigned[key] = instance
+		}
+	}
+
+	for key, instance := range assigned {
+		report.Instances++
+		auditInstance(report, instance, replicaInstances[key])
+	}
+	for key, replica := range replicaInstances {
+		if _, ok := assigned[key]; ok || migrating[key] {
+			continue
+		}
+		if replica.GetDeletionTimestamp().IsZero() {
+			report.add(InstanceResource, replica, ReplicaOrphaned,
+				"sfserviceinstance does not exist in master cluster or is assigned to another cluster")
+		}
+	}
+
+	assignedBindings := make(map[types.NamespacedName]*osbv1alpha1.SFServiceBinding)
+	migratingBindings := make(map[types.NamespacedName]bool)
+	for key, binding := range bindings {
+		instanceKey := types.NamespacedName{
+			Name:      binding.Spec.InstanceID,
+			Namespace: binding.GetNamespace(),
+		}
+		if migrating[instanceKey] {
+			migratingBindings[key] = true
+			continue
+		}
+		if _, ok := assigned[instanceKey]; ok {
+			assignedBindings[key] = binding
+		}
+	}
+
+	for key, binding := range assignedBindings {
+		report.Bindings++
+		auditBinding(report, binding, replicaBindings[key])
+	}
+	for key, replica := range replicaBindings {
+		if _, ok := assignedBindings[key]; ok || migratingBindings[key] {
+			continue
+		}
+		if replica.GetDeletionTimestamp().IsZero() {
+			report.add(BindingResource, replica, ReplicaOrphaned,
+				"sfservicebinding does not exist in master cluster or its instance is assigned to another cluster")
+		}
+	}
+
+	sort.Slice(report.Divergences, func(i, j int) bool {
+		a, b := report.Divergences[i], report.Divergences[j]
+		if a.Resource != b.Resource {
+			return a.Resource > b.Resource
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Kind < b.Kind
+	})
+	return report, nil
+}
+
+// auditInstance compares the instance in the master cluster with its replica.
+// replica is nil if it does not exist.
+func auditInstance(report *Report, instance, replica *osbv1alpha1.SFServiceInstance) {
+	state := instance.GetState()
+	if !isCompleted(state) || !instance.GetDeletionTimestamp().IsZero() {
+		return
+	}
+	if replica == nil {
+		report.add(InstanceResource, instance, ReplicaMissing,
+			"replica of sfserviceinstance in state %s does not exist", state)
+		return
+	}
+	if !apiequality.Semantic.DeepEqual(instance.Spec, replica.Spec) {
+		report.add(InstanceResource, instance, SpecMismatch,
+			"spec of replica differs from sfserviceinstance")
+	}
+	if replica.GetState() != state {
+		report.add(InstanceResource, instance, StateMismatch,
+			"replica is in state %s while sfserviceinstance is in state %s", replica.GetState(), state)
+	}
+	if msg := checkFinalizers(replica); msg != "" {
+		report.add(InstanceResource, instance, FinalizerMismatch, msg)
+	}
+}
+
+// auditBinding compares the binding in the master cluster with its replica.
+// replica is nil if it does not exist.
+func auditBinding(report *Report, binding, replica *osbv1alpha1.SFServiceBinding) {
+	state := binding.GetState()
+	if !isCompleted(state) || !binding.GetDeletionTimestamp().IsZero() {
+		return
+	}
+	if replica == nil {
+		report.add(BindingResource, binding, ReplicaMissing,
+			"replica of sfservicebinding in state %s does not exist", state)
+		return
+	}
+	if !apiequality.Semantic.DeepEqual(binding.Spec, replica.Spec) {
+		report.add(BindingResource, binding, SpecMismatch,
+			"spec of replica differs from sfservicebinding")
+	}
+	if replica.GetState() != state {
+		report.add(BindingResource, binding, StateMismatch,
+			"replica is in state %s while sfservicebinding is in state %s", replica.GetState(), state)
+	}
+	if msg := checkFinalizers(replica); msg != "" {
+		report.add(BindingResource, binding, FinalizerMismatch, msg)
+	}
+}
+
+// checkFinalizers returns the finalizer divergence of the replica of an
+// object which is not being deleted in the master cluster
+func checkFinalizers(replica metav1.Object) string {
+	if !replica.GetDeletionTimestamp().IsZero() {
+		return fmt.Sprintf("replica is being deleted with finalizers %s",
+			strings.Join(replica.GetFinalizers(), ", "))
+	}
+	if !utils.ContainsString(replica.GetFinalizers(), constants.FinalizerName) {
+		return fmt.Sprintf("replica does not have finalizer %s", constants.FinalizerName)
+	}
+	return ""
+}
+
+// isCompleted returns true if the last operation on the object is completed
+func isCompleted(state string) bool {
+	return state == "succeeded" || state == "failed"
+}
+
+func keyOf(obj metav1.Object) types.NamespacedName {
+	return types.NamespacedName{
+		Name:      obj.GetName(),
+		Namespace: obj.GetNamespace(),
+	}
+}
+
+func listInstances(ctx context.Context, c client.Reader) (map[types.NamespacedName]*osbv1alpha1.SFServiceInstance, error) {
+	instances := make(map[types.NamespacedName]*osbv1alpha1.SFServiceInstance)
+	list := &osbv1alpha1.SFServiceInstanceList{}
+	for more := true; more; more = (list.Continue != "") {
+		err := c.List(ctx, list, client.Limit(constants.ListPaginationLimit), client.Continue(list.Continue))
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			instances[keyOf(&list.Items[i])] = list.Items[i].DeepCopy()
+		}
+	}
+	return instances, nil
+}
+
+func listBindings(ctx context.Context, c client.Reader) (map[types.NamespacedName]*osbv1alpha1.SFServiceBinding, error) {
+	bindings := make(map[types.NamespacedName]*osbv1alpha1.SFServiceBinding)
+	list := &osbv1alpha1.SFServiceBindingList{}
+	for more := true; more; more = (list.Continue != "") {
+		err := c.List(ctx, list, client.Limit(constants.ListPaginationLimit), client.Continue(list.Continue))
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			bindings[keyOf(&list.Items[i])] = list.Items[i].DeepCopy()
+		}
+	}
+	return bindings, nil
+}
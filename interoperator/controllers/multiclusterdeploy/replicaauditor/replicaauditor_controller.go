@@ -0,0 +1,317 @@
+/*
+Copyright 2018 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package replicaauditor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/cluster/registry"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/watches"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// Reasons of the events recorded by the auditor
+const (
+	ReplicaDiverged = "ReplicaDiverged"
+	ReplicaRepaired = "ReplicaRepaired"
+)
+
+var (
+	divergencesMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "replica_divergences",
+			Namespace: "interoperator",
+			Subsystem: "cluster",
+			Help:      "Number of replicas in the cluster not matching the master cluster in the last audit",
+		},
+		[]string{
+			// Which cluster?
+			"cluster",
+			// sfserviceinstances or sfservicebindings
+			"resource",
+			// Kind of divergence
+			"kind",
+		},
+	)
+	repairsMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "replica_repairs_total",
+			Namespace: "interoperator",
+			Subsystem: "cluster",
+			Help:      "Number of replicas repaired by the auditor partitioned by cluster",
+		},
+		[]string{
+			// Which cluster?
+			"cluster",
+		},
+	)
+)
+
+var divergenceKinds = []string{ReplicaMissing, ReplicaOrphaned, SpecMismatch, StateMismatch, FinalizerMismatch}
+
+// ReplicaAuditor periodically compares the SFServiceInstances and
+// SFServiceBindings in the master cluster with their replicas in each member
+// cluster. The replicators only act on events, so a replica may go missing or
+// stay outdated if an event is lost. The divergences are reported as metrics
+// and events. If ReplicaAuditRepair is enabled, the missing and outdated
+// replicas of the instances are repaired.
+type ReplicaAuditor struct {
+	client.Client
+	Log             logr.Logger
+	Scheme          *runtime.Scheme
+	clusterRegistry registry.ClusterRegistry
+	cfgManager      config.Config
+	recorder        record.EventRecorder
+}
+
+// NewAuditor returns a ReplicaAuditor which is not registered with a manager.
+// It is used to audit the replicas of a cluster on demand.
+func NewAuditor(kubeConfig *rest.Config, scheme *runtime.Scheme, mapper meta.RESTMapper) (*ReplicaAuditor, error) {
+	if kubeConfig == nil {
+		return nil, errors.NewInputError("NewAuditor", "kubeConfig", nil)
+	}
+	if scheme == nil {
+		return nil, errors.NewInputError("NewAuditor", "scheme", nil)
+	}
+
+	c, err := client.New(kubeConfig, client.Options{
+		Scheme: scheme,
+		Mapper: mapper,
+	})
+	if err != nil {
+		return nil, err
+	}
+	clusterRegistry, err := registry.New(kubeConfig, scheme, mapper)
+	if err != nil {
+		return nil, err
+	}
+	cfgManager, err := config.New(kubeConfig, scheme, mapper)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReplicaAuditor{
+		Client:          c,
+		Log:             ctrl.Log.WithName("mcd").WithName("auditor").WithName("replica"),
+		Scheme:          scheme,
+		clusterRegistry: clusterRegistry,
+		cfgManager:      cfgManager,
+	}, nil
+}
+
+// Reconcile audits the replicas in the cluster every ReplicaAuditInterval.
+// The primary cluster and the clusters in pull mode are not audited.
+func (r *ReplicaAuditor) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("sfcluster", req.NamespacedName)
+
+	cluster := &resourcev1alpha1.SFCluster{}
+	err := r.Get(ctx, req.NamespacedName, cluster)
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			// Object not found, return.
+			deleteMetrics(req.Name)
+			return ctrl.Result{}, nil
+		}
+		// Error reading the object - requeue the request.
+		return ctrl.Result{}, err
+	}
+	if !cluster.GetDeletionTimestamp().IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	clusterID := cluster.GetName()
+	interoperatorCfg := r.cfgManager.GetConfig()
+	interval := parseDuration(interoperatorCfg.ReplicaAuditInterval, constants.DefaultReplicaAuditInterval)
+	if clusterID == interoperatorCfg.PrimaryClusterID || cluster.IsPullMode() {
+		// The primary cluster has no replicas. The replicas in a cluster in
+		// pull mode are managed by its agent.
+		deleteMetrics(clusterID)
+		return ctrl.Result{RequeueAfter: interval}, nil
+	}
+
+	report, err := r.Audit(clusterID)
+	if err != nil {
+		if errors.ClusterNotManaged(err) {
+			deleteMetrics(clusterID)
+			return ctrl.Result{RequeueAfter: interval}, nil
+		}
+		log.Error(err, "Failed to audit replicas of cluster")
+		return ctrl.Result{}, err
+	}
+
+	if interoperatorCfg.ReplicaAuditRepair {
+		r.repair(report)
+	}
+
+	for _, resource := range []string{InstanceResource, BindingResource} {
+		for _, kind := range divergenceKinds {
+			divergencesMetric.WithLabelValues(clusterID, resource, kind).Set(float64(report.Count(resource, kind)))
+		}
+	}
+	for _, d := range report.Divergences {
+		r.recordEvent(cluster, d)
+	}
+	if len(report.Divergences) > 0 {
+		log.Info("Replicas of cluster diverge from master cluster", "instances", report.Instances,
+			"bindings", report.Bindings, "divergences", len(report.Divergences))
+	} else {
+		log.V(1).Info("Replicas of cluster match master cluster", "instances", report.Instances,
+			"bindings", report.Bindings)
+	}
+	return ctrl.Result{RequeueAfter: interval}, nil
+}
+
+// repair triggers the update of the instances whose replica is missing or
+// has an outdated spec. The instance replicator then copies the instance to
+// the member cluster and the provisioner applies it again. The other
+// divergences need manual intervention and are only reported. In particular
+// orphaned replicas are never deleted, as the deletion deprovisions the
+// service.
+func (r *ReplicaAuditor) repair(report *Report) {
+	for i := range report.Divergences {
+		d := &report.Divergences[i]
+		if d.Resource != InstanceResource || (d.Kind != ReplicaMissing && d.Kind != SpecMismatch) {
+			continue
+		}
+		err := r.triggerUpdate(types.NamespacedName{Name: d.Name, Namespace: d.Namespace})
+		if err != nil {
+			r.Log.Error(err, "Failed to repair replica", "clusterID", report.ClusterID,
+				"namespace", d.Namespace, "name", d.Name, "kind", d.Kind)
+			continue
+		}
+		d.Repaired = true
+		repairsMetric.WithLabelValues(report.ClusterID).Inc()
+		r.Log.Info("Triggered update of instance to repair replica", "clusterID", report.ClusterID,
+			"namespace", d.Namespace, "name", d.Name, "kind", d.Kind)
+	}
+}
+
+// triggerUpdate sets the state of the instance to update if its last
+// operation is still completed
+func (r *ReplicaAuditor) triggerUpdate(key types.NamespacedName) error {
+	ctx := context.Background()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		instance := &osbv1alpha1.SFServiceInstance{}
+		err := r.Get(ctx, key, instance)
+		if err != nil {
+			return err
+		}
+		if !isCompleted(instance.GetState()) || !instance.GetDeletionTimestamp().IsZero() {
+			return errors.NewOperationInProgress(key.Name, nil)
+		}
+		instance.SetState("update")
+		return r.Update(ctx, instance)
+	})
+}
+
+// recordEvent records the divergence on the object in the master cluster.
+// Orphaned replicas are recorded on the SFCluster.
+func (r *ReplicaAuditor) recordEvent(cluster *resourcev1alpha1.SFCluster, d Divergence) {
+	if r.recorder == nil {
+		return
+	}
+	reason, eventType := ReplicaDiverged, corev1.EventTypeWarning
+	if d.Repaired {
+		reason, eventType = ReplicaRepaired, corev1.EventTypeNormal
+	}
+	if d.Kind == ReplicaOrphaned {
+		r.recorder.Event(cluster, eventType, reason, fmt.Sprintf("%s %s %s/%s: %s",
+			d.Kind, d.Resource, d.Namespace, d.Name, d.Message))
+		return
+	}
+
+	var object runtime.Object = &osbv1alpha1.SFServiceInstance{}
+	if d.Resource == BindingResource {
+		object = &osbv1alpha1.SFServiceBinding{}
+	}
+	err := r.Get(context.Background(), types.NamespacedName{Name: d.Name, Namespace: d.Namespace}, object)
+	if err != nil {
+		return
+	}
+	r.recorder.Event(object, eventType, reason, fmt.Sprintf("%s: %s", d.Kind, d.Message))
+}
+
+func deleteMetrics(clusterID string) {
+	for _, resource := range []string{InstanceResource, BindingResource} {
+		for _, kind := range divergenceKinds {
+			divergencesMetric.DeleteLabelValues(clusterID, resource, kind)
+		}
+	}
+}
+
+func parseDuration(value, defaultValue string) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		d, _ = time.ParseDuration(defaultValue)
+	}
+	return d
+}
+
+// SetupWithManager registers the replica auditor with manager
+// and setups the watches.
+func (r *ReplicaAuditor) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Log == nil {
+		r.Log = ctrl.Log.WithName("mcd").WithName("auditor").WithName("replica")
+	}
+	if r.clusterRegistry == nil {
+		clusterRegistry, err := registry.New(mgr.GetConfig(), mgr.GetScheme(), mgr.GetRESTMapper())
+		if err != nil {
+			return err
+		}
+		r.clusterRegistry = clusterRegistry
+	}
+	if r.cfgManager == nil {
+		cfgManager, err := config.New(mgr.GetConfig(), mgr.GetScheme(), mgr.GetRESTMapper())
+		if err != nil {
+			return err
+		}
+		r.cfgManager = cfgManager
+	}
+	r.recorder = mgr.GetEventRecorderFor("mcd_auditor_replica")
+	metrics.Registry.MustRegister(divergencesMetric, repairsMetric)
+
+	// The replicas are audited periodically. The status updates of the
+	// clusters need not trigger an audit.
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("mcd_auditor_replica").
+		For(&resourcev1alpha1.SFCluster{}).
+		WithEventFilter(watches.NamespaceFilter()).
+		WithEventFilter(predicate.GenerationChangedPredicate{}).
+		Complete(r)
+}
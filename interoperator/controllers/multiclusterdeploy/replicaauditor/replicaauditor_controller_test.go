@@ -0,0 +1,249 @@
+/*
+Copyright 2018 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package replicaauditor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	mock_clusterRegistry "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/cluster/registry/mock_registry"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+
+	"github.com/golang/mock/gomock"
+	"github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlrun "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type fakeConfig struct {
+	cfg *config.InteroperatorConfig
+}
+
+func (f *fakeConfig) GetConfig() *config.InteroperatorConfig {
+	return f.cfg
+}
+
+func (f *fakeConfig) UpdateConfig(cfg *config.InteroperatorConfig) error {
+	f.cfg = cfg
+	return nil
+}
+
+func newInstance(name, clusterID, planID, state string) *osbv1alpha1.SFServiceInstance {
+	return &osbv1alpha1.SFServiceInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       name,
+			Namespace:  "sf-" + name,
+			Finalizers: []string{constants.FinalizerName},
+		},
+		Spec: osbv1alpha1.SFServiceInstanceSpec{
+			InstanceID: name,
+			PlanID:     planID,
+			ClusterID:  clusterID,
+		},
+		Status: osbv1alpha1.SFServiceInstanceStatus{
+			State: state,
+		},
+	}
+}
+
+func newBinding(name, instanceID, state string) *osbv1alpha1.SFServiceBinding {
+	return &osbv1alpha1.SFServiceBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       name,
+			Namespace:  "sf-" + instanceID,
+			Finalizers: []string{constants.FinalizerName},
+		},
+		Spec: osbv1alpha1.SFServiceBindingSpec{
+			ID:         name,
+			InstanceID: instanceID,
+		},
+		Status: osbv1alpha1.SFServiceBindingStatus{
+			State: state,
+		},
+	}
+}
+
+func setupAuditor(t *testing.T, master, replicas []runtime.Object, repair bool) (*ReplicaAuditor, client.Client, func()) {
+	g := gomega.NewGomegaWithT(t)
+	mockCtrl := gomock.NewController(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(osbv1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+	g.Expect(resourcev1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	for _, clusterID := range []string{"1", "2"} {
+		master = append(master, &resourcev1alpha1.SFCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      clusterID,
+				Namespace: constants.InteroperatorNamespace,
+			},
+		})
+	}
+	masterClient := fake.NewFakeClientWithScheme(scheme, master...)
+	targetClient := fake.NewFakeClientWithScheme(scheme, replicas...)
+
+	mockClusterRegistry := mock_clusterRegistry.NewMockClusterRegistry(mockCtrl)
+	mockClusterRegistry.EXPECT().GetCluster(gomock.Any()).DoAndReturn(
+		func(clusterID string) (resourcev1alpha1.SFClusterInterface, error) {
+			cluster := &resourcev1alpha1.SFCluster{}
+			err := masterClient.Get(context.TODO(), types.NamespacedName{
+				Name:      clusterID,
+				Namespace: constants.InteroperatorNamespace,
+			}, cluster)
+			return cluster, err
+		}).AnyTimes()
+	mockClusterRegistry.EXPECT().GetClient("2").Return(targetClient, nil).AnyTimes()
+
+	r := &ReplicaAuditor{
+		Client:          masterClient,
+		Log:             ctrlrun.Log.WithName("mcd").WithName("auditor").WithName("replica"),
+		Scheme:          scheme,
+		clusterRegistry: mockClusterRegistry,
+		cfgManager: &fakeConfig{
+			cfg: &config.InteroperatorConfig{
+				PrimaryClusterID:     "1",
+				ReplicaAuditInterval: "5m",
+				ReplicaAuditRepair:   repair,
+			},
+		},
+	}
+	return r, targetClient, mockCtrl.Finish
+}
+
+func TestReplicaAuditor_Audit(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	outdated := newInstance("outdated", "2", "plan-1", "succeeded")
+	migrating := newInstance("migrating", "3", "plan-1", "succeeded")
+	migrating.Status.Migration = &osbv1alpha1.MigrationStatus{
+		SourceClusterID: "2",
+		TargetClusterID: "3",
+		Phase:           osbv1alpha1.MigrationPhaseCleanup,
+	}
+	deleting := newInstance("deleting", "2", "plan-1", "succeeded")
+	now := metav1.Now()
+	deleting.SetDeletionTimestamp(&now)
+	unprotected := newBinding("unprotected", "in-sync", "succeeded")
+	unprotected.SetFinalizers(nil)
+
+	master := []runtime.Object{
+		newInstance("in-sync", "2", "plan-1", "succeeded"),
+		newInstance("missing", "2", "plan-1", "failed"),
+		newInstance("outdated", "2", "plan-2", "succeeded"),
+		newInstance("state", "2", "plan-1", "succeeded"),
+		newInstance("in-progress", "2", "plan-1", "in progress"),
+		newInstance("other-cluster", "3", "plan-1", "succeeded"),
+		migrating,
+		newBinding("in-sync", "in-sync", "succeeded"),
+		newBinding("missing", "in-sync", "succeeded"),
+		newBinding("unprotected", "in-sync", "succeeded"),
+	}
+	replicas := []runtime.Object{
+		newInstance("in-sync", "2", "plan-1", "succeeded"),
+		outdated,
+		newInstance("state", "2", "plan-1", "in progress"),
+		deleting,
+		newInstance("orphan", "2", "plan-1", "succeeded"),
+		migrating.DeepCopy(),
+		newBinding("in-sync", "in-sync", "succeeded"),
+		unprotected,
+		newBinding("orphan", "orphan", "succeeded"),
+	}
+	r, _, finish := setupAuditor(t, master, replicas, false)
+	defer finish()
+
+	report, err := r.Audit("2")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(report.ClusterID).To(gomega.Equal("2"))
+	g.Expect(report.Instances).To(gomega.Equal(5))
+	g.Expect(report.Bindings).To(gomega.Equal(3))
+
+	type divergence struct {
+		resource, name, kind string
+	}
+	var got []divergence
+	for _, d := range report.Divergences {
+		got = append(got, divergence{d.Resource, d.Name, d.Kind})
+	}
+	g.Expect(got).To(gomega.Equal([]divergence{
+		{InstanceResource, "missing", ReplicaMissing},
+		{InstanceResource, "orphan", ReplicaOrphaned},
+		{InstanceResource, "outdated", SpecMismatch},
+		{InstanceResource, "state", StateMismatch},
+		{BindingResource, "missing", ReplicaMissing},
+		{BindingResource, "unprotected", FinalizerMismatch},
+		{BindingResource, "orphan", ReplicaOrphaned},
+	}))
+
+	_, err = r.Audit("1")
+	g.Expect(err).To(gomega.HaveOccurred())
+}
+
+func TestReplicaAuditor_Reconcile(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	master := []runtime.Object{
+		newInstance("missing", "2", "plan-1", "succeeded"),
+		newInstance("outdated", "2", "plan-2", "succeeded"),
+		newInstance("in-sync", "2", "plan-1", "succeeded"),
+	}
+	replicas := []runtime.Object{
+		newInstance("outdated", "2", "plan-1", "succeeded"),
+		newInstance("in-sync", "2", "plan-1", "succeeded"),
+		newInstance("orphan", "2", "plan-1", "succeeded"),
+	}
+	r, _, finish := setupAuditor(t, master, replicas, true)
+	defer finish()
+
+	result, err := r.Reconcile(ctrlrun.Request{NamespacedName: types.NamespacedName{
+		Name:      "2",
+		Namespace: constants.InteroperatorNamespace,
+	}})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result.RequeueAfter).To(gomega.Equal(5 * time.Minute))
+
+	g.Expect(testutil.ToFloat64(divergencesMetric.WithLabelValues("2", InstanceResource, ReplicaMissing))).To(gomega.Equal(float64(1)))
+	g.Expect(testutil.ToFloat64(divergencesMetric.WithLabelValues("2", InstanceResource, SpecMismatch))).To(gomega.Equal(float64(1)))
+	g.Expect(testutil.ToFloat64(divergencesMetric.WithLabelValues("2", InstanceResource, ReplicaOrphaned))).To(gomega.Equal(float64(1)))
+	g.Expect(testutil.ToFloat64(repairsMetric.WithLabelValues("2"))).To(gomega.Equal(float64(2)))
+
+	// The missing and outdated replicas are repaired by an update of the
+	// instance. The orphaned replica is only reported.
+	for name, state := range map[string]string{"missing": "update", "outdated": "update", "in-sync": "succeeded"} {
+		instance := &osbv1alpha1.SFServiceInstance{}
+		g.Expect(r.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: "sf-" + name}, instance)).To(gomega.Succeed())
+		g.Expect(instance.GetState()).To(gomega.Equal(state), name)
+	}
+
+	// The primary cluster is not audited
+	result, err = r.Reconcile(ctrlrun.Request{NamespacedName: types.NamespacedName{
+		Name:      "1",
+		Namespace: constants.InteroperatorNamespace,
+	}})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result.RequeueAfter).To(gomega.Equal(5 * time.Minute))
+	g.Expect(testutil.ToFloat64(divergencesMetric.WithLabelValues("1", InstanceResource, ReplicaMissing))).To(gomega.Equal(float64(0)))
+}
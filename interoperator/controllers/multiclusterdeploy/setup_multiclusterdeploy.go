@@ -21,6 +21,8 @@ package multiclusterdeploy
 import (
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/multiclusterdeploy/offboarding"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/multiclusterdeploy/provisioner"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/multiclusterdeploy/replicaauditor"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/multiclusterdeploy/sfclusterhealth"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/multiclusterdeploy/sfclusterreplicator"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/multiclusterdeploy/sfservicebindingreplicator"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/multiclusterdeploy/sfserviceinstancereplicator"
@@ -79,6 +81,15 @@ func SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 
+	if err = (&sfclusterhealth.SFClusterHealthProber{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("mcd").WithName("health").WithName("cluster"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create cluster health prober", "controller", "SFClusterHealthProber")
+		return err
+	}
+
 	if err = (&offboarding.SFClusterOffboarding{
 		Client: mgr.GetClient(),
 		Log:    ctrl.Log.WithName("mcd").WithName("offboarding").WithName("cluster"),
@@ -88,5 +99,14 @@ func SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 
+	if err = (&replicaauditor.ReplicaAuditor{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("mcd").WithName("auditor").WithName("replica"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create replica auditor", "controller", "ReplicaAuditor")
+		return err
+	}
+
 	return nil
 }
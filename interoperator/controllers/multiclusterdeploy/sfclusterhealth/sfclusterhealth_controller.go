@@ -0,0 +1,285 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfclusterhealth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/cluster/registry"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/watches"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// Reasons of the Reachable condition
+const (
+	ProbeSucceeded    = "ProbeSucceeded"
+	ProbeFailed       = "ProbeFailed"
+	HeartbeatReceived = "HeartbeatReceived"
+	HeartbeatMissing  = "HeartbeatMissing"
+)
+
+var (
+	readyMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "ready",
+			Namespace: "interoperator",
+			Subsystem: "cluster",
+			Help:      "Readiness of the api server of the cluster. 0 - not ready, 1 - ready",
+		},
+		[]string{
+			// Which cluster?
+			"cluster",
+		},
+	)
+	probeLatencyMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "probe_latency_seconds",
+			Namespace: "interoperator",
+			Subsystem: "cluster",
+			Help:      "Latency of the last successful probe of the api server partitioned by cluster",
+		},
+		[]string{
+			// Which cluster?
+			"cluster",
+		},
+	)
+)
+
+// SFClusterHealthProber periodically probes the api server of each SFCluster
+// and records the result in the Reachable condition of the SFCluster. A
+// cluster which is not reachable is not ready and the schedulers do not
+// place new instances on it. For clusters in pull mode the heartbeat of the
+// agent is checked instead.
+type SFClusterHealthProber struct {
+	client.Client
+	Log             logr.Logger
+	Scheme          *runtime.Scheme
+	clusterRegistry registry.ClusterRegistry
+	cfgManager      config.Config
+
+	mu       sync.Mutex
+	failures map[string]int
+}
+
+// Reconcile probes the api server of the cluster. The cluster is marked not
+// reachable after ClusterHealthFailureThreshold consecutive failed probes
+// and reachable again after the first successful probe. The cluster is
+// probed every ClusterHealthCheckInterval.
+func (r *SFClusterHealthProber) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("sfcluster", req.NamespacedName)
+
+	cluster := &resourcev1alpha1.SFCluster{}
+	err := r.Get(ctx, req.NamespacedName, cluster)
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			// Object not found, return.
+			r.resetFailures(req.Name)
+			readyMetric.DeleteLabelValues(req.Name)
+			probeLatencyMetric.DeleteLabelValues(req.Name)
+			return ctrl.Result{}, nil
+		}
+		// Error reading the object - requeue the request.
+		return ctrl.Result{}, err
+	}
+	if !cluster.GetDeletionTimestamp().IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	clusterID := cluster.GetName()
+	interoperatorCfg := r.cfgManager.GetConfig()
+	interval := parseDuration(interoperatorCfg.ClusterHealthCheckInterval, constants.DefaultClusterHealthCheckInterval)
+	timeout := parseDuration(interoperatorCfg.ClusterHealthCheckTimeout, constants.DefaultClusterHealthCheckTimeout)
+
+	var latency time.Duration
+	var probeErr error
+	if cluster.IsPullMode() {
+		// The api server of a cluster in pull mode is not reachable from
+		// the master cluster. Its agent reports a heartbeat instead.
+		probeErr = checkHeartbeat(cluster, interval+timeout)
+	} else {
+		latency, probeErr = r.probe(clusterID, timeout)
+	}
+
+	condition := resourcev1alpha1.SFClusterCondition{
+		Type:               resourcev1alpha1.ClusterReachable,
+		ObservedGeneration: cluster.GetGeneration(),
+	}
+	if probeErr == nil {
+		r.resetFailures(clusterID)
+		readyMetric.WithLabelValues(clusterID).Set(1)
+		condition.Status = metav1.ConditionTrue
+		if cluster.IsPullMode() {
+			condition.Reason = HeartbeatReceived
+			condition.Message = "agent of the cluster is connected"
+		} else {
+			probeLatencyMetric.WithLabelValues(clusterID).Set(latency.Seconds())
+			condition.Reason = ProbeSucceeded
+			condition.Message = "api server of the cluster is reachable"
+		}
+	} else {
+		failures := r.addFailure(clusterID)
+		log.Error(probeErr, "Failed to probe cluster", "failures", failures)
+		if failures < interoperatorCfg.ClusterHealthFailureThreshold {
+			// Tolerate transient failures
+			return ctrl.Result{RequeueAfter: interval}, nil
+		}
+		readyMetric.WithLabelValues(clusterID).Set(0)
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = ProbeFailed
+		if cluster.IsPullMode() {
+			condition.Reason = HeartbeatMissing
+		}
+		condition.Message = fmt.Sprintf("%d consecutive probes failed: %s", failures, probeErr.Error())
+	}
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		err := r.Get(ctx, req.NamespacedName, cluster)
+		if err != nil {
+			return err
+		}
+		wasReady := cluster.IsReady()
+		changed := cluster.Status.SetCondition(condition)
+		changed = cluster.Status.UpdateReadyCondition(cluster.GetGeneration()) || changed
+		if !changed {
+			return nil
+		}
+		err = r.Status().Update(ctx, cluster)
+		if err != nil {
+			return err
+		}
+		if wasReady != cluster.IsReady() {
+			log.Info("Updated readiness of cluster", "ready", cluster.IsReady(), "message", condition.Message)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error(err, "Failed to update Reachable condition of cluster")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: interval}, nil
+}
+
+// probe lists the namespaces of the cluster and returns the latency of the
+// api server. The probe fails if the request takes longer than timeout.
+func (r *SFClusterHealthProber) probe(clusterID string, timeout time.Duration) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	targetClient, err := r.clusterRegistry.GetClient(clusterID)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	namespaces := &corev1.NamespaceList{}
+	err = targetClient.List(ctx, namespaces, client.Limit(1))
+	if err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
+// checkHeartbeat fails if the agent of the cluster did not report a
+// heartbeat within maxAge
+func checkHeartbeat(cluster *resourcev1alpha1.SFCluster, maxAge time.Duration) error {
+	value, ok := cluster.GetAnnotations()[constants.LastHeartbeatKey]
+	if !ok {
+		return fmt.Errorf("no heartbeat received from agent")
+	}
+	lastHeartbeat, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return fmt.Errorf("invalid heartbeat %s of agent: %v", value, err)
+	}
+	age := time.Since(lastHeartbeat)
+	if age > maxAge {
+		return fmt.Errorf("last heartbeat received from agent %s ago", age.Round(time.Second))
+	}
+	return nil
+}
+
+func (r *SFClusterHealthProber) addFailure(clusterID string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failures == nil {
+		r.failures = make(map[string]int)
+	}
+	r.failures[clusterID]++
+	return r.failures[clusterID]
+}
+
+func (r *SFClusterHealthProber) resetFailures(clusterID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.failures, clusterID)
+}
+
+func parseDuration(value, defaultValue string) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		d, _ = time.ParseDuration(defaultValue)
+	}
+	return d
+}
+
+// SetupWithManager registers the SFCluster health prober with manager
+// and setups the watches.
+func (r *SFClusterHealthProber) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Log == nil {
+		r.Log = ctrl.Log.WithName("mcd").WithName("health").WithName("cluster")
+	}
+	if r.clusterRegistry == nil {
+		clusterRegistry, err := registry.New(mgr.GetConfig(), mgr.GetScheme(), mgr.GetRESTMapper())
+		if err != nil {
+			return err
+		}
+		r.clusterRegistry = clusterRegistry
+	}
+	if r.cfgManager == nil {
+		cfgManager, err := config.New(mgr.GetConfig(), mgr.GetScheme(), mgr.GetRESTMapper())
+		if err != nil {
+			return err
+		}
+		r.cfgManager = cfgManager
+	}
+	metrics.Registry.MustRegister(readyMetric, probeLatencyMetric)
+
+	// The clusters are probed periodically. The status updates of the
+	// clusters need not trigger a probe.
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("mcd_health_cluster").
+		For(&resourcev1alpha1.SFCluster{}).
+		WithEventFilter(watches.NamespaceFilter()).
+		WithEventFilter(predicate.GenerationChangedPredicate{}).
+		Complete(r)
+}
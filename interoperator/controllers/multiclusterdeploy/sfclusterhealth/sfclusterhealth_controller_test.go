@@ -0,0 +1,215 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfclusterhealth
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	mock_clusterRegistry "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/cluster/registry/mock_registry"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+
+	"github.com/golang/mock/gomock"
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlrun "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type fakeConfig struct {
+	cfg *config.InteroperatorConfig
+}
+
+func (f *fakeConfig) GetConfig() *config.InteroperatorConfig {
+	return f.cfg
+}
+
+func (f *fakeConfig) UpdateConfig(cfg *config.InteroperatorConfig) error {
+	f.cfg = cfg
+	return nil
+}
+
+func TestSFClusterHealthProber_Reconcile(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(gomega.Succeed())
+	g.Expect(resourcev1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	key := types.NamespacedName{Name: "2", Namespace: constants.InteroperatorNamespace}
+	cluster := &resourcev1alpha1.SFCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      key.Name,
+			Namespace: key.Namespace,
+		},
+		Spec: resourcev1alpha1.SFClusterSpec{
+			SecretRef: "2",
+		},
+	}
+	masterClient := fake.NewFakeClientWithScheme(scheme, cluster)
+	targetClient := fake.NewFakeClientWithScheme(scheme)
+
+	reachable := true
+	mockClusterRegistry := mock_clusterRegistry.NewMockClusterRegistry(ctrl)
+	mockClusterRegistry.EXPECT().GetClient("2").DoAndReturn(func(clusterID string) (client.Client, error) {
+		if !reachable {
+			return nil, fmt.Errorf("connection refused")
+		}
+		return targetClient, nil
+	}).AnyTimes()
+
+	r := &SFClusterHealthProber{
+		Client:          masterClient,
+		Log:             ctrlrun.Log.WithName("mcd").WithName("health").WithName("cluster"),
+		Scheme:          scheme,
+		clusterRegistry: mockClusterRegistry,
+		cfgManager: &fakeConfig{
+			cfg: &config.InteroperatorConfig{
+				ClusterHealthCheckInterval:    "30s",
+				ClusterHealthCheckTimeout:     "5s",
+				ClusterHealthFailureThreshold: 2,
+			},
+		},
+	}
+
+	getCondition := func(conditionType string) *resourcev1alpha1.SFClusterCondition {
+		cluster := &resourcev1alpha1.SFCluster{}
+		g.Expect(masterClient.Get(context.TODO(), key, cluster)).To(gomega.Succeed())
+		return cluster.Status.GetCondition(conditionType)
+	}
+	reconcile := func() {
+		result, err := r.Reconcile(ctrlrun.Request{NamespacedName: key})
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(result.RequeueAfter).To(gomega.Equal(30 * time.Second))
+	}
+
+	reconcile()
+	condition := getCondition(resourcev1alpha1.ClusterReachable)
+	g.Expect(condition).NotTo(gomega.BeNil())
+	g.Expect(condition.Status).To(gomega.Equal(metav1.ConditionTrue))
+	g.Expect(condition.Reason).To(gomega.Equal(ProbeSucceeded))
+	g.Expect(getCondition(resourcev1alpha1.ClusterReady).Status).To(gomega.Equal(metav1.ConditionTrue))
+
+	// A single failure is tolerated
+	reachable = false
+	reconcile()
+	g.Expect(getCondition(resourcev1alpha1.ClusterReachable).Status).To(gomega.Equal(metav1.ConditionTrue))
+
+	reconcile()
+	condition = getCondition(resourcev1alpha1.ClusterReachable)
+	g.Expect(condition.Status).To(gomega.Equal(metav1.ConditionFalse))
+	g.Expect(condition.Reason).To(gomega.Equal(ProbeFailed))
+	g.Expect(condition.Message).To(gomega.ContainSubstring("connection refused"))
+	ready := getCondition(resourcev1alpha1.ClusterReady)
+	g.Expect(ready.Status).To(gomega.Equal(metav1.ConditionFalse))
+	g.Expect(ready.Reason).To(gomega.Equal(ProbeFailed))
+
+	cluster = &resourcev1alpha1.SFCluster{}
+	g.Expect(masterClient.Get(context.TODO(), key, cluster)).To(gomega.Succeed())
+	g.Expect(cluster.IsReady()).To(gomega.BeFalse())
+
+	reachable = true
+	reconcile()
+	g.Expect(getCondition(resourcev1alpha1.ClusterReady).Status).To(gomega.Equal(metav1.ConditionTrue))
+}
+
+func TestSFClusterHealthProber_ReconcilePullMode(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	scheme := runtime.NewScheme()
+	g.Expect(resourcev1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	key := types.NamespacedName{Name: "3", Namespace: constants.InteroperatorNamespace}
+	cluster := &resourcev1alpha1.SFCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      key.Name,
+			Namespace: key.Namespace,
+			Annotations: map[string]string{
+				constants.LastHeartbeatKey: time.Now().Format(time.RFC3339),
+			},
+		},
+		Spec: resourcev1alpha1.SFClusterSpec{
+			Mode: resourcev1alpha1.ClusterModePull,
+		},
+	}
+	masterClient := fake.NewFakeClientWithScheme(scheme, cluster)
+
+	// The api server of the cluster must not be probed
+	r := &SFClusterHealthProber{
+		Client:          masterClient,
+		Log:             ctrlrun.Log.WithName("mcd").WithName("health").WithName("cluster"),
+		Scheme:          scheme,
+		clusterRegistry: mock_clusterRegistry.NewMockClusterRegistry(ctrl),
+		cfgManager: &fakeConfig{
+			cfg: &config.InteroperatorConfig{
+				ClusterHealthCheckInterval:    "30s",
+				ClusterHealthCheckTimeout:     "5s",
+				ClusterHealthFailureThreshold: 1,
+			},
+		},
+	}
+
+	getCondition := func() *resourcev1alpha1.SFClusterCondition {
+		cluster := &resourcev1alpha1.SFCluster{}
+		g.Expect(masterClient.Get(context.TODO(), key, cluster)).To(gomega.Succeed())
+		return cluster.Status.GetCondition(resourcev1alpha1.ClusterReachable)
+	}
+
+	_, err := r.Reconcile(ctrlrun.Request{NamespacedName: key})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	condition := getCondition()
+	g.Expect(condition.Status).To(gomega.Equal(metav1.ConditionTrue))
+	g.Expect(condition.Reason).To(gomega.Equal(HeartbeatReceived))
+
+	g.Expect(masterClient.Get(context.TODO(), key, cluster)).To(gomega.Succeed())
+	cluster.GetAnnotations()[constants.LastHeartbeatKey] = time.Now().Add(-time.Minute).Format(time.RFC3339)
+	g.Expect(masterClient.Update(context.TODO(), cluster)).To(gomega.Succeed())
+
+	_, err = r.Reconcile(ctrlrun.Request{NamespacedName: key})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	condition = getCondition()
+	g.Expect(condition.Status).To(gomega.Equal(metav1.ConditionFalse))
+	g.Expect(condition.Reason).To(gomega.Equal(HeartbeatMissing))
+	g.Expect(condition.Message).To(gomega.ContainSubstring("last heartbeat received from agent"))
+}
+
+func Test_checkHeartbeat(t *testing.T) {
+	cluster := &resourcev1alpha1.SFCluster{}
+	if err := checkHeartbeat(cluster, time.Minute); err == nil {
+		t.Errorf("checkHeartbeat() = nil, want error for cluster without heartbeat")
+	}
+	cluster.SetAnnotations(map[string]string{constants.LastHeartbeatKey: "yesterday"})
+	if err := checkHeartbeat(cluster, time.Minute); err == nil {
+		t.Errorf("checkHeartbeat() = nil, want error for invalid heartbeat")
+	}
+	cluster.SetAnnotations(map[string]string{constants.LastHeartbeatKey: time.Now().Format(time.RFC3339)})
+	if err := checkHeartbeat(cluster, time.Minute); err != nil {
+		t.Errorf("checkHeartbeat() = %v, want nil", err)
+	}
+}
@@ -23,18 +23,24 @@ import (
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/multiclusterdeploy/watchmanager"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/cluster/registry"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/watches"
 
 	"github.com/go-logr/logr"
 	"github.com/prometheus/client_golang/prometheus"
 	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
@@ -122,6 +128,11 @@ func (r *SFClusterReplicator) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 
 	targetClient, err := r.clusterRegistry.GetClient(clusterID)
 	if err != nil {
+		if errors.ClusterNotManaged(err) {
+			// Replicated by the agent of the cluster or by the master cluster
+			log.V(1).Info("cluster not managed by this interoperator. Not replicating sfcluster", "clusterID", clusterID)
+			return ctrl.Result{}, nil
+		}
 		return ctrl.Result{}, err
 	}
 	err = targetClient.Get(ctx, req.NamespacedName, replica)
@@ -164,11 +175,29 @@ func (r *SFClusterReplicator) reconcileSpec(targetClient client.Client, cluster,
 			replica.Spec.TotalCapacity = cluster.Spec.TotalCapacity.DeepCopy()
 		}
 
+		if !resourcev1alpha1.StorageCapacityEqual(cluster.Spec.TotalStorageCapacity, replica.Spec.TotalStorageCapacity) {
+			updateRequired = true
+			replica.Spec.TotalStorageCapacity = make(map[string]resource.Quantity, len(cluster.Spec.TotalStorageCapacity))
+			for key, quantity := range cluster.Spec.TotalStorageCapacity {
+				replica.Spec.TotalStorageCapacity[key] = quantity.DeepCopy()
+			}
+		}
+
 		if cluster.Spec.SecretRef != replica.Spec.SecretRef {
 			updateRequired = true
 			replica.Spec.SecretRef = cluster.Spec.SecretRef
 		}
 
+		if cluster.Spec.Unschedulable != replica.Spec.Unschedulable {
+			updateRequired = true
+			replica.Spec.Unschedulable = cluster.Spec.Unschedulable
+		}
+
+		if cluster.Spec.Drain != replica.Spec.Drain {
+			updateRequired = true
+			replica.Spec.Drain = cluster.Spec.Drain
+		}
+
 		if updateRequired {
 			err := targetClient.Update(ctx, replica)
 			if err != nil {
@@ -210,6 +239,13 @@ func (r *SFClusterReplicator) reconcileStatus(targetClient client.Client, cluste
 			updateRequired = true
 			cluster.Status.Requests = replica.Status.Requests.DeepCopy()
 		}
+		if !resourcev1alpha1.StorageEqual(cluster.Status.Storage, replica.Status.Storage) {
+			updateRequired = true
+			cluster.Status.Storage = make([]resourcev1alpha1.StorageClassUsage, len(replica.Status.Storage))
+			for i := range replica.Status.Storage {
+				replica.Status.Storage[i].DeepCopyInto(&cluster.Status.Storage[i])
+			}
+		}
 
 		if updateRequired {
 			err := r.Status().Update(ctx, cluster)
@@ -270,3 +306,49 @@ func (r *SFClusterReplicator) SetupWithManager(mgr ctrl.Manager) error {
 
 	return builder.Complete(r)
 }
+
+// SetupAgentWithManager registers the cluster replicator in the agent of a
+// member cluster in pull mode. The SFCluster of the own cluster is read from
+// and updated in the master cluster with masterClient and is watched using
+// masterCache.
+func (r *SFClusterReplicator) SetupAgentWithManager(mgr ctrl.Manager, masterClient client.Client, masterCache cache.Cache) error {
+	r.Client = masterClient
+	r.Scheme = mgr.GetScheme()
+
+	if r.Log == nil {
+		r.Log = ctrl.Log.WithName("agent").WithName("replicator").WithName("cluster")
+	}
+	if r.clusterRegistry == nil {
+		clusterRegistry, err := registry.NewLocal(mgr.GetClient(), mgr.GetConfig())
+		if err != nil {
+			return err
+		}
+		r.clusterRegistry = clusterRegistry
+	}
+
+	cfgManager, err := config.New(mgr.GetConfig(), mgr.GetScheme(), mgr.GetRESTMapper())
+	if err != nil {
+		return err
+	}
+	r.cfgManager = cfgManager
+
+	// Watch for changes to SFCluster in master cluster
+	masterClusters := &source.Kind{Type: &resourcev1alpha1.SFCluster{}}
+	err = masterClusters.InjectCache(masterCache)
+	if err != nil {
+		return err
+	}
+
+	metrics.Registry.MustRegister(allocatableMetric, instancesMetric)
+
+	builder := ctrl.NewControllerManagedBy(mgr).
+		Named("agent_replicator_cluster").
+		For(&resourcev1alpha1.SFCluster{}).
+		Watches(masterClusters, &handler.EnqueueRequestForObject{}).
+		WithEventFilter(watches.NamespaceFilter()).
+		WithEventFilter(predicate.NewPredicateFuncs(func(meta metav1.Object, object runtime.Object) bool {
+			return meta.GetName() == constants.OwnClusterID
+		}))
+
+	return builder.Complete(r)
+}
@@ -105,6 +105,9 @@ var _ = Describe("SFClusterReplicator", func() {
 			sfcluster2.Spec.SchedulingLimitPercentage = 80
 			sfcluster2.Spec.TotalCapacity = make(v1.ResourceList)
 			sfcluster2.Spec.TotalCapacity[v1.ResourceMemory] = *resource.NewQuantity(1024, resource.BinarySI)
+			sfcluster2.Spec.TotalStorageCapacity = map[string]resource.Quantity{
+				"premium": resource.MustParse("1Ti"),
+			}
 			Expect(k8sClient.Update(context.TODO(), sfcluster2)).Should(Succeed())
 			Eventually(func() error {
 				err := k8sClient2.Get(context.TODO(), clusterKey2, replica2)
@@ -114,6 +117,9 @@ var _ = Describe("SFClusterReplicator", func() {
 				if replica2.Spec.SecretRef != "new-secret-ref" {
 					return fmt.Errorf("sfcluster spec not replicated")
 				}
+				if !resourcev1alpha1.StorageCapacityEqual(replica2.Spec.TotalStorageCapacity, sfcluster2.Spec.TotalStorageCapacity) {
+					return fmt.Errorf("sfcluster storage capacity not replicated")
+				}
 				return nil
 			}, timeout).Should(Succeed())
 			close(done)
@@ -126,6 +132,13 @@ var _ = Describe("SFClusterReplicator", func() {
 			replica2.Status.CurrentCapacity[v1.ResourceCPU] = *resource.NewQuantity(1, resource.DecimalSI)
 			replica2.Status.TotalCapacity = make(v1.ResourceList)
 			replica2.Status.TotalCapacity[v1.ResourceCPU] = *resource.NewQuantity(1, resource.DecimalSI)
+			replica2.Status.Storage = []resourcev1alpha1.StorageClassUsage{
+				{
+					StorageClassName: "premium",
+					Capacity:         resource.MustParse("10Gi"),
+					Requests:         resource.MustParse("5Gi"),
+				},
+			}
 			Expect(k8sClient2.Status().Update(context.TODO(), replica2)).Should(Succeed())
 
 			// Trigger watch
@@ -143,6 +156,9 @@ var _ = Describe("SFClusterReplicator", func() {
 				if !sfcluster2.Status.Requests.Cpu().Equal(*resource.NewQuantity(1, resource.DecimalSI)) {
 					return fmt.Errorf("sfcluster status not replicated")
 				}
+				if !resourcev1alpha1.StorageEqual(sfcluster2.Status.Storage, replica2.Status.Storage) {
+					return fmt.Errorf("sfcluster storage not replicated")
+				}
 				return nil
 			}, timeout).Should(Succeed())
 			close(done)
@@ -18,12 +18,14 @@ package sfservicebindingreplicator
 
 import (
 	"context"
+	"strconv"
 
 	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/multiclusterdeploy/watchmanager"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/cluster/registry"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/utils"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/watches"
 
@@ -35,6 +37,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
@@ -127,6 +130,11 @@ func (r *BindingReplicator) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 
 	targetClient, err := r.clusterRegistry.GetClient(clusterID)
 	if err != nil {
+		if errors.ClusterNotManaged(err) {
+			// Replicated by the agent of the cluster or by the master cluster
+			log.V(1).Info("cluster not managed by this interoperator. Not replicating sfservicebinding", "clusterID", clusterID)
+			return ctrl.Result{}, nil
+		}
 		return ctrl.Result{}, err
 	}
 
@@ -168,8 +176,9 @@ func (r *BindingReplicator) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 				return ctrl.Result{}, err
 			}
 		} else {
+			patch := client.MergeFromWithOptions(replica.DeepCopy(), client.MergeFromWithOptimisticLock{})
 			replicateSFServiceBindingResourceData(binding, replica)
-			err = targetClient.Update(ctx, replica)
+			err = targetClient.Patch(ctx, replica, patch)
 			if err != nil {
 				log.Error(err, "Error occurred while updating SFServiceBinding to cluster ",
 					"clusterID", clusterID, "bindingID", bindingID, "state", state)
@@ -178,7 +187,7 @@ func (r *BindingReplicator) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		}
 
 		err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
-			return r.setInProgress(binding)
+			return r.setInProgress(binding, replica.GetGeneration())
 		})
 		if err != nil {
 			log.Error(err, "Error occurred while setting SFServiceBinding to in progress on master cluster ",
@@ -195,6 +204,7 @@ func (r *BindingReplicator) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		var replicaState, replicaLastOperation string
 		log.Info("Trying to obtain binding replica from sister cluster",
 			"clusterID", clusterID, "bindingID", bindingID, "state", state)
+		patch := client.MergeFromWithOptions(binding.DeepCopy(), client.MergeFromWithOptimisticLock{})
 		err = targetClient.Get(ctx, req.NamespacedName, replica)
 		if err != nil {
 			if apiErrors.IsNotFound(err) && !binding.GetDeletionTimestamp().IsZero() {
@@ -214,10 +224,14 @@ func (r *BindingReplicator) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 			log.Info("replica in in_queue or delete state, not replicating it to master cluster",
 				"clusterID", clusterID, "bindingID", bindingID, "state", state)
 			return ctrl.Result{}, nil
+		} else if !replicaObserved(binding, replica) {
+			// status of the replica is from an earlier operation
+			log.Info("replica has not yet observed the last operation, not replicating it to master cluster",
+				"clusterID", clusterID, "bindingID", bindingID, "state", state,
+				"observedGeneration", replica.Status.ObservedGeneration)
+			return ctrl.Result{}, nil
 		} else {
-			replica.Status.DeepCopyInto(&binding.Status)
-			binding.SetLabels(replica.GetLabels())
-			binding.SetAnnotations(replica.GetAnnotations())
+			replicateSFServiceBindingStatus(replica, binding)
 			replicaLabels = replica.GetLabels()
 			replicaState = replica.GetState()
 		}
@@ -304,7 +318,7 @@ func (r *BindingReplicator) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 				}
 			}
 		}
-		err = r.Update(ctx, binding)
+		err = r.Patch(ctx, binding, patch)
 		if err != nil {
 			log.Error(err, "Failed to update SFServiceBinding in master cluster", "binding", bindingID,
 				"clusterID ", clusterID, "state ", state)
@@ -316,7 +330,10 @@ func (r *BindingReplicator) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	return ctrl.Result{}, nil
 }
 
-func (r *BindingReplicator) setInProgress(binding *osbv1alpha1.SFServiceBinding) error {
+// setInProgress sets the state of the binding to in progress once the
+// operation is replicated. The generation of the replica is recorded to
+// identify the status of the replica for the operation.
+func (r *BindingReplicator) setInProgress(binding *osbv1alpha1.SFServiceBinding, replicaGeneration int64) error {
 	bindingID := binding.GetName()
 	state := binding.GetState()
 
@@ -334,6 +351,7 @@ func (r *BindingReplicator) setInProgress(binding *osbv1alpha1.SFServiceBinding)
 	}
 
 	state = binding.GetState()
+	patch := client.MergeFromWithOptions(binding.DeepCopy(), client.MergeFromWithOptimisticLock{})
 	binding.SetState("in progress")
 	labels := binding.GetLabels()
 	if labels == nil {
@@ -341,8 +359,18 @@ func (r *BindingReplicator) setInProgress(binding *osbv1alpha1.SFServiceBinding)
 	}
 	labels[constants.LastOperationKey] = state
 	binding.SetLabels(labels)
+	annotations := binding.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	if replicaGeneration > 0 {
+		annotations[constants.ReplicaGenerationKey] = strconv.FormatInt(replicaGeneration, 10)
+	} else {
+		delete(annotations, constants.ReplicaGenerationKey)
+	}
+	binding.SetAnnotations(annotations)
 	log.Info("Trying to update binding ", "bindingID", bindingID, "state", binding.GetState())
-	err = r.Update(ctx, binding)
+	err = r.Patch(ctx, binding, patch)
 	if err != nil {
 		log.Error(err, "Updating status to in progress failed", "operation", state, "bindingId ", bindingID)
 		return err
@@ -351,13 +379,57 @@ func (r *BindingReplicator) setInProgress(binding *osbv1alpha1.SFServiceBinding)
 	return nil
 }
 
+// replicateSFServiceBindingResourceData copies the fields of the binding owned
+// by the master cluster to the replica. The master owns the labels,
+// annotations and spec and requests an operation by setting the state. The
+// rest of the status is owned by the provisioner in the member cluster.
 func replicateSFServiceBindingResourceData(source *osbv1alpha1.SFServiceBinding, dest *osbv1alpha1.SFServiceBinding) {
 	dest.SetName(source.GetName())
 	dest.SetNamespace(source.GetNamespace())
-	dest.SetLabels(source.GetLabels())
-	dest.SetAnnotations(source.GetAnnotations())
+
+	labels := make(map[string]string)
+	for key, val := range source.GetLabels() {
+		labels[key] = val
+	}
+	// The error count is maintained by the provisioner
+	if count, ok := dest.GetLabels()[constants.ErrorCountKey]; ok {
+		labels[constants.ErrorCountKey] = count
+	} else {
+		delete(labels, constants.ErrorCountKey)
+	}
+	dest.SetLabels(labels)
+
+	annotations := make(map[string]string)
+	for key, val := range source.GetAnnotations() {
+		annotations[key] = val
+	}
+	delete(annotations, constants.ReplicaGenerationKey)
+	dest.SetAnnotations(annotations)
+
 	source.Spec.DeepCopyInto(&dest.Spec)
-	source.Status.DeepCopyInto(&dest.Status)
+	dest.SetState(source.GetState())
+}
+
+// replicateSFServiceBindingStatus copies the status of the replica owned by
+// the provisioner in the member cluster to the binding in the master cluster
+func replicateSFServiceBindingStatus(source *osbv1alpha1.SFServiceBinding, dest *osbv1alpha1.SFServiceBinding) {
+	dest.Status.State = source.Status.State
+	dest.Status.Error = source.Status.Error
+	dest.Status.Response = source.Status.Response
+	source.Status.AppliedSpec.DeepCopyInto(&dest.Status.AppliedSpec)
+	dest.Status.Resources = make([]osbv1alpha1.Source, len(source.Status.Resources))
+	copy(dest.Status.Resources, source.Status.Resources)
+}
+
+// replicaObserved returns true if the status of the replica is for the last
+// operation replicated to it. Replicas of provisioners not reporting the
+// observed generation are always considered up to date.
+func replicaObserved(binding, replica *osbv1alpha1.SFServiceBinding) bool {
+	generation, err := strconv.ParseInt(binding.GetAnnotations()[constants.ReplicaGenerationKey], 10, 64)
+	if err != nil || replica.Status.ObservedGeneration == 0 {
+		return true
+	}
+	return replica.Status.ObservedGeneration >= generation
 }
 
 // SetupWithManager registers the MCD Binding replicator with manager
@@ -401,3 +473,51 @@ func (r *BindingReplicator) SetupWithManager(mgr ctrl.Manager) error {
 
 	return builder.Complete(r)
 }
+
+// SetupAgentWithManager registers the binding replicator in the agent of a
+// member cluster in pull mode. The SFServiceBindings are read from and
+// updated in the master cluster with masterClient and are watched using
+// masterCache. Only the bindings of the instances assigned to the own
+// cluster are replicated.
+func (r *BindingReplicator) SetupAgentWithManager(mgr ctrl.Manager, masterClient client.Client, masterCache cache.Cache) error {
+	r.Client = masterClient
+	r.scheme = mgr.GetScheme()
+
+	if r.Log == nil {
+		r.Log = ctrl.Log.WithName("agent").WithName("replicator").WithName("binding")
+	}
+	if r.clusterRegistry == nil {
+		clusterRegistry, err := registry.NewLocal(mgr.GetClient(), mgr.GetConfig())
+		if err != nil {
+			return err
+		}
+		r.clusterRegistry = clusterRegistry
+	}
+
+	cfgManager, err := config.New(mgr.GetConfig(), mgr.GetScheme(), mgr.GetRESTMapper())
+	if err != nil {
+		return err
+	}
+	interoperatorCfg := cfgManager.GetConfig()
+	r.cfgManager = cfgManager
+
+	// Watch for changes to SFServiceBinding in master cluster
+	masterBindings := &source.Kind{Type: &osbv1alpha1.SFServiceBinding{}}
+	err = masterBindings.InjectCache(masterCache)
+	if err != nil {
+		return err
+	}
+
+	metrics.Registry.MustRegister(bindingsMetric)
+
+	builder := ctrl.NewControllerManagedBy(mgr).
+		Named("agent_replicator_binding").
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: interoperatorCfg.BindingWorkerCount,
+		}).
+		For(&osbv1alpha1.SFServiceBinding{}).
+		Watches(masterBindings, &handler.EnqueueRequestForObject{}).
+		WithEventFilter(watches.NamespaceLabelFilter())
+
+	return builder.Complete(r)
+}
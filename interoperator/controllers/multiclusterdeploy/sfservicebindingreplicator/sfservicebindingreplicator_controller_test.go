@@ -446,3 +446,63 @@ func TestReconcileMultiClusterUnbind(t *testing.T) {
 	defer c.Delete(context.TODO(), bindingSecret)
 	defer c2.Delete(context.TODO(), replica)
 }
+
+func TestReplicateSFServiceBindingOwnedFields(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	master := &osbv1alpha1.SFServiceBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "owned-binding",
+			Namespace: "sf-instance-id",
+			Labels: map[string]string{
+				constants.LastOperationKey: "in_queue",
+			},
+			Annotations: map[string]string{
+				constants.ReplicaGenerationKey: "4",
+			},
+		},
+		Spec: osbv1alpha1.SFServiceBindingSpec{
+			ID:         "owned-binding",
+			InstanceID: "instance-id",
+		},
+		Status: osbv1alpha1.SFServiceBindingStatus{
+			State: "in_queue",
+		},
+	}
+	replica := &osbv1alpha1.SFServiceBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{
+				constants.ErrorCountKey: "1",
+			},
+		},
+		Status: osbv1alpha1.SFServiceBindingStatus{
+			State:              "succeeded",
+			Error:              "old error",
+			ObservedGeneration: 3,
+		},
+	}
+
+	// Only the spec, metadata and state are replicated to the member cluster
+	replicateSFServiceBindingResourceData(master, replica)
+	g.Expect(replica.GetName()).To(gomega.Equal("owned-binding"))
+	g.Expect(replica.Spec).To(gomega.Equal(master.Spec))
+	g.Expect(replica.GetState()).To(gomega.Equal("in_queue"))
+	g.Expect(replica.Status.Error).To(gomega.Equal("old error"))
+	g.Expect(replica.GetLabels()).To(gomega.HaveKeyWithValue(constants.ErrorCountKey, "1"))
+	g.Expect(replica.GetLabels()).To(gomega.HaveKeyWithValue(constants.LastOperationKey, "in_queue"))
+	g.Expect(replica.GetAnnotations()).NotTo(gomega.HaveKey(constants.ReplicaGenerationKey))
+
+	// Status of an earlier operation is not observed
+	g.Expect(replicaObserved(master, replica)).To(gomega.BeFalse())
+	replica.Status.ObservedGeneration = 4
+	g.Expect(replicaObserved(master, replica)).To(gomega.BeTrue())
+	replica.Status.ObservedGeneration = 0
+	g.Expect(replicaObserved(master, replica)).To(gomega.BeTrue())
+
+	replica.Status.State = "succeeded"
+	replica.Status.Response.SecretRef = "sf-owned-binding"
+	replicateSFServiceBindingStatus(replica, master)
+	g.Expect(master.GetState()).To(gomega.Equal("succeeded"))
+	g.Expect(master.Status.Response.SecretRef).To(gomega.Equal("sf-owned-binding"))
+	g.Expect(master.GetLabels()).NotTo(gomega.HaveKey(constants.ErrorCountKey))
+}
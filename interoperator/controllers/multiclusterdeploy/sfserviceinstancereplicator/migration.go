@@ -0,0 +1,778 @@
+/*
+Copyright 2018 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfserviceinstancereplicator
+
+import (
+	"context"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/utils"
+
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// isMigration returns true if the current operation on the instance is a
+// migration
+func isMigration(state, lastOperation string) bool {
+	return state == "migrate" || (state == "in progress" && lastOperation == "migrate")
+}
+
+// isTargetProvisioned returns true if the instance may be present on the
+// target cluster of an unfinished migration
+func isTargetProvisioned(migration *osbv1alpha1.MigrationStatus) bool {
+	if migration.TargetClusterID == "" {
+		return false
+	}
+	switch migration.Phase {
+	case osbv1alpha1.MigrationPhaseProvisioning, osbv1alpha1.MigrationPhaseRestore,
+		osbv1alpha1.MigrationPhaseCutover:
+		return true
+	}
+	return false
+}
+
+// reconcileMigration moves the instance from the source cluster of the
+// migration to the target cluster. In the Backup phase the backup template of
+// the plan is run on the source cluster. The instance is then provisioned on
+// the target cluster in the Provisioning phase. The restore and migrate
+// templates of the plan are run on the target cluster in the Restore and
+// Cutover phases. The migration fails if the plan does not provide the backup
+// or restore template. The Cutover phase is skipped if the plan does not
+// provide the migrate template. The ClusterID of the instance is switched to
+// the target cluster only after the Cutover phase succeeds. The instance on
+// the source cluster is deprovisioned in the Cleanup phase.
+func (r *InstanceReplicator) reconcileMigration(instance *osbv1alpha1.SFServiceInstance) (ctrl.Result, error) {
+	migration := instance.Status.Migration
+	if migration == nil || migration.TargetClusterID == "" {
+		// Target cluster not yet selected by the scheduler
+		return ctrl.Result{}, nil
+	}
+
+	// Clusters in pull mode are replicated by their agents and
+	// can not be accessed for the migration
+	if migration.Phase != osbv1alpha1.MigrationPhaseCleanup {
+		for _, clusterID := range []string{migration.SourceClusterID, migration.TargetClusterID} {
+			_, err := r.clusterRegistry.GetClient(clusterID)
+			if errors.ClusterNotManaged(err) {
+				return ctrl.Result{}, r.failMigration(types.NamespacedName{
+					Name:      instance.GetName(),
+					Namespace: instance.GetNamespace(),
+				}, migration.Phase, "Migration is not supported. "+err.Error())
+			}
+		}
+	}
+
+	switch migration.Phase {
+	case osbv1alpha1.MigrationPhaseBackup:
+		return ctrl.Result{}, r.reconcileMigrationAction(instance, migration.SourceClusterID, osbv1alpha1.BackupAction)
+	case osbv1alpha1.MigrationPhaseProvisioning:
+		return ctrl.Result{}, r.reconcileMigrationTarget(instance)
+	case osbv1alpha1.MigrationPhaseRestore:
+		return ctrl.Result{}, r.reconcileMigrationAction(instance, migration.TargetClusterID, osbv1alpha1.RestoreAction)
+	case osbv1alpha1.MigrationPhaseCutover:
+		return ctrl.Result{}, r.reconcileMigrationAction(instance, migration.TargetClusterID, osbv1alpha1.MigrateAction)
+	case osbv1alpha1.MigrationPhaseCleanup:
+		return ctrl.Result{}, r.reconcileMigrationSource(instance)
+	}
+	return ctrl.Result{}, nil
+}
+
+// nextMigrationPhase returns the phase following the given phase
+func nextMigrationPhase(phase string) string {
+	switch phase {
+	case osbv1alpha1.MigrationPhaseBackup:
+		return osbv1alpha1.MigrationPhaseProvisioning
+	case osbv1alpha1.MigrationPhaseProvisioning:
+		return osbv1alpha1.MigrationPhaseRestore
+	case osbv1alpha1.MigrationPhaseRestore:
+		return osbv1alpha1.MigrationPhaseCutover
+	}
+	return osbv1alpha1.MigrationPhaseCleanup
+}
+
+// reconcileMigrationAction runs the template of the plan for the action on
+// the instance in the given cluster and moves the migration to the next phase
+// once the action succeeds. If the plan does not provide a template for the
+// action, the migrate action is skipped and the migration fails for the
+// other actions.
+func (r *InstanceReplicator) reconcileMigrationAction(instance *osbv1alpha1.SFServiceInstance, clusterID, action string) error {
+	ctx := context.Background()
+	migration := instance.Status.Migration
+	phase := migration.Phase
+	namespacedName := types.NamespacedName{
+		Name:      instance.GetName(),
+		Namespace: instance.GetNamespace(),
+	}
+	state := instance.GetState()
+	log := r.Log.WithValues("instance", namespacedName, "clusterID", clusterID, "action", action,
+		"phase", phase, "state", state)
+
+	if state == "migrate" {
+		plan := &osbv1alpha1.SFPlan{}
+		err := r.Get(ctx, types.NamespacedName{
+			Name:      instance.Spec.PlanID,
+			Namespace: constants.InteroperatorNamespace,
+		}, plan)
+		if err != nil {
+			log.Error(err, "Failed to get SFPlan")
+			return err
+		}
+		if _, err := plan.GetTemplate(action); err != nil {
+			if action == osbv1alpha1.MigrateAction {
+				log.Info("Plan does not have template for action. Skipping")
+				return r.advanceMigration(namespacedName, phase)
+			}
+			log.Info("Plan does not have template for action. Failing migration")
+			return r.abortMigration(instance, "Plan "+instance.Spec.PlanID+" does not provide template for action "+action)
+		}
+	}
+
+	targetClient, err := r.clusterRegistry.GetClient(clusterID)
+	if err != nil {
+		return err
+	}
+
+	replica := &osbv1alpha1.SFServiceInstance{}
+	err = targetClient.Get(ctx, namespacedName, replica)
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			log.Info("SFServiceInstance not found on cluster. Failing migration")
+			return r.abortMigration(instance, "Service instance not found on cluster "+clusterID)
+		}
+		log.Error(err, "Failed to fetch SFServiceInstance from cluster")
+		return err
+	}
+
+	if state == "migrate" {
+		patch := client.MergeFromWithOptions(replica.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		replica.SetState(action)
+		replica.Status.Error = ""
+		err = targetClient.Patch(ctx, replica, patch)
+		if err != nil {
+			log.Error(err, "Failed to trigger action on cluster")
+			return err
+		}
+		log.Info("Triggered action on cluster")
+
+		return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			return r.setInProgress(instance, state, replica.GetGeneration())
+		})
+	}
+
+	if !replicaObserved(instance, replica) {
+		log.Info("action not yet picked up on cluster", "observedGeneration", replica.Status.ObservedGeneration)
+		return nil
+	}
+	replicaState := replica.GetState()
+	switch replicaState {
+	case "succeeded":
+		return r.advanceMigration(namespacedName, phase)
+	case "failed":
+		log.Info("Action failed on cluster. Failing migration", "error", replica.Status.Error)
+		return r.abortMigration(instance, "Action "+action+" on cluster "+clusterID+" failed. "+replica.Status.Error)
+	}
+	log.Info("action not yet completed on cluster", "replicaState", replicaState)
+	return nil
+}
+
+// advanceMigration moves the migration of the instance from the given phase
+// to the next phase. The ClusterID of the instance is switched to the target
+// cluster when moving to the Cleanup phase.
+func (r *InstanceReplicator) advanceMigration(namespacedName types.NamespacedName, phase string) error {
+	nextPhase := nextMigrationPhase(phase)
+	if nextPhase == osbv1alpha1.MigrationPhaseCleanup {
+		return r.switchCluster(namespacedName, phase)
+	}
+
+	ctx := context.Background()
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		instance := &osbv1alpha1.SFServiceInstance{}
+		err := r.Get(ctx, namespacedName, instance)
+		if err != nil {
+			return err
+		}
+		migration := instance.Status.Migration
+		if !isMigration(instance.GetState(), instance.GetLabels()[constants.LastOperationKey]) ||
+			migration == nil || migration.Phase != phase {
+			return nil
+		}
+		migration.Phase = nextPhase
+		instance.SetState("migrate")
+		return r.Update(ctx, instance)
+	})
+	if err != nil {
+		r.Log.Error(err, "Failed to update migration phase", "instance", namespacedName, "phase", phase,
+			"nextPhase", nextPhase)
+		return err
+	}
+	r.Log.Info("Migration phase completed", "instance", namespacedName, "phase", phase, "nextPhase", nextPhase)
+	return nil
+}
+
+// abortMigration fails the migration of the instance. The instance is
+// removed from the target cluster if it was already provisioned there.
+func (r *InstanceReplicator) abortMigration(instance *osbv1alpha1.SFServiceInstance, msg string) error {
+	migration := instance.Status.Migration
+	if isTargetProvisioned(migration) {
+		err := r.deleteMigrationTarget(instance)
+		if err != nil {
+			return err
+		}
+	}
+	if migration.Phase == osbv1alpha1.MigrationPhaseBackup {
+		err := r.resetMigrationSource(instance)
+		if err != nil {
+			return err
+		}
+	}
+	return r.failMigration(types.NamespacedName{
+		Name:      instance.GetName(),
+		Namespace: instance.GetNamespace(),
+	}, migration.Phase, msg)
+}
+
+// interruptMigration ends the migration of an instance whose state was
+// replaced by another operation, e.g. an update from the broker. Before the
+// Cleanup phase the migration fails and the instance is removed from the
+// target cluster. In the Cleanup phase the instance is already switched to
+// the target cluster, so the migration succeeds and the instance is removed
+// from the source cluster. The state of the instance is not changed.
+func (r *InstanceReplicator) interruptMigration(instance *osbv1alpha1.SFServiceInstance) error {
+	ctx := context.Background()
+	migration := instance.Status.Migration
+	currentPhase := migration.Phase
+	namespacedName := types.NamespacedName{
+		Name:      instance.GetName(),
+		Namespace: instance.GetNamespace(),
+	}
+	state := instance.GetState()
+	log := r.Log.WithValues("instance", namespacedName, "phase", currentPhase, "state", state)
+
+	phase := osbv1alpha1.MigrationPhaseFailed
+	msg := "Migration interrupted by " + state + " operation"
+	if currentPhase == osbv1alpha1.MigrationPhaseCleanup {
+		err := r.moveInstanceCount(instance)
+		if err != nil {
+			return err
+		}
+		sourceClient, err := r.clusterRegistry.GetClient(migration.SourceClusterID)
+		if err != nil {
+			return err
+		}
+		replica := &osbv1alpha1.SFServiceInstance{}
+		err = sourceClient.Get(ctx, namespacedName, replica)
+		if err != nil && !apiErrors.IsNotFound(err) {
+			log.Error(err, "Failed to fetch SFServiceInstance from source cluster")
+			return err
+		}
+		if err == nil && replica.GetDeletionTimestamp().IsZero() {
+			err = r.deleteReplica(sourceClient, replica)
+			if err != nil {
+				return err
+			}
+		}
+		phase = osbv1alpha1.MigrationPhaseSucceeded
+		msg = ""
+	} else if isTargetProvisioned(migration) {
+		err := r.deleteMigrationTarget(instance)
+		if err != nil {
+			log.Error(err, "Failed to delete SFServiceInstance from target cluster")
+			return err
+		}
+	}
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		instance := &osbv1alpha1.SFServiceInstance{}
+		err := r.Get(ctx, namespacedName, instance)
+		if err != nil {
+			return err
+		}
+		migration := instance.Status.Migration
+		if isMigration(instance.GetState(), instance.GetLabels()[constants.LastOperationKey]) ||
+			migration == nil || migration.Phase != currentPhase {
+			return nil
+		}
+		now := metav1.Now()
+		migration.Phase = phase
+		migration.Error = msg
+		migration.CompletionTime = &now
+		return r.Update(ctx, instance)
+	})
+	if err != nil {
+		log.Error(err, "Failed to update migration status", "newPhase", phase)
+		return err
+	}
+	log.Info("Migration interrupted", "newPhase", phase)
+	return nil
+}
+
+// resetMigrationSource sets the state of the instance on the source cluster
+// back to succeeded after a failed backup
+func (r *InstanceReplicator) resetMigrationSource(instance *osbv1alpha1.SFServiceInstance) error {
+	ctx := context.Background()
+	sourceClient, err := r.clusterRegistry.GetClient(instance.Status.Migration.SourceClusterID)
+	if err != nil {
+		return err
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		replica := &osbv1alpha1.SFServiceInstance{}
+		err := sourceClient.Get(ctx, types.NamespacedName{
+			Name:      instance.GetName(),
+			Namespace: instance.GetNamespace(),
+		}, replica)
+		if err != nil {
+			if apiErrors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+		if replica.GetState() != "failed" {
+			return nil
+		}
+		replica.SetState("succeeded")
+		return sourceClient.Update(ctx, replica)
+	})
+}
+
+// reconcileMigrationTarget provisions the instance on the target cluster and
+// switches the instance to the target cluster once the provisioning succeeds
+func (r *InstanceReplicator) reconcileMigrationTarget(instance *osbv1alpha1.SFServiceInstance) error {
+	ctx := context.Background()
+	migration := instance.Status.Migration
+	targetClusterID := migration.TargetClusterID
+	namespacedName := types.NamespacedName{
+		Name:      instance.GetName(),
+		Namespace: instance.GetNamespace(),
+	}
+	state := instance.GetState()
+	log := r.Log.WithValues("instance", namespacedName, "sourceClusterID", migration.SourceClusterID,
+		"targetClusterID", targetClusterID, "state", state)
+
+	targetClient, err := r.clusterRegistry.GetClient(targetClusterID)
+	if err != nil {
+		return err
+	}
+
+	replica := &osbv1alpha1.SFServiceInstance{}
+	if state == "migrate" {
+		err = r.reconcileNamespace(targetClient, instance.GetNamespace(), targetClusterID, false)
+		if err != nil {
+			return err
+		}
+		err = r.reconcileServicePlan(targetClient, instance, targetClusterID)
+		if err != nil {
+			return err
+		}
+
+		err = targetClient.Get(ctx, namespacedName, replica)
+		if err != nil {
+			if !apiErrors.IsNotFound(err) {
+				log.Error(err, "Failed to fetch SFServiceInstance from target cluster")
+				return err
+			}
+			copyMigrationObject(instance, replica, targetClusterID)
+			err = targetClient.Create(ctx, replica)
+		} else {
+			patch := client.MergeFromWithOptions(replica.DeepCopy(), client.MergeFromWithOptimisticLock{})
+			copyMigrationObject(instance, replica, targetClusterID)
+			err = targetClient.Patch(ctx, replica, patch)
+		}
+		if err != nil {
+			log.Error(err, "Error occurred while provisioning SFServiceInstance on target cluster")
+			return err
+		}
+		log.Info("Triggered provisioning of sfserviceinstance on target cluster")
+
+		return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			return r.setInProgress(instance, state, replica.GetGeneration())
+		})
+	}
+
+	err = targetClient.Get(ctx, namespacedName, replica)
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			log.Info("SFServiceInstance not found on target cluster. Failing migration")
+			return r.failMigration(namespacedName, migration.Phase, "Service instance not found on target cluster "+
+				targetClusterID)
+		}
+		log.Error(err, "Failed to fetch SFServiceInstance from target cluster")
+		return err
+	}
+
+	if !replicaObserved(instance, replica) {
+		log.Info("replica not yet picked up on target cluster", "observedGeneration", replica.Status.ObservedGeneration)
+		return nil
+	}
+	replicaState := replica.GetState()
+	switch replicaState {
+	case "succeeded":
+		return r.advanceMigration(namespacedName, migration.Phase)
+	case "failed":
+		log.Info("Provisioning on target cluster failed. Failing migration", "error", replica.Status.Error)
+		return r.abortMigration(instance, "Provisioning on target cluster "+targetClusterID+
+			" failed. "+replica.Status.Error)
+	}
+	log.Info("replica not yet provisioned on target cluster", "replicaState", replicaState)
+	return nil
+}
+
+// reconcileMigrationSource deprovisions the instance on the source cluster
+// and completes the migration once the instance is removed from the source
+// cluster
+func (r *InstanceReplicator) reconcileMigrationSource(instance *osbv1alpha1.SFServiceInstance) error {
+	ctx := context.Background()
+	migration := instance.Status.Migration
+	sourceClusterID := migration.SourceClusterID
+	namespacedName := types.NamespacedName{
+		Name:      instance.GetName(),
+		Namespace: instance.GetNamespace(),
+	}
+	log := r.Log.WithValues("instance", namespacedName, "sourceClusterID", sourceClusterID,
+		"targetClusterID", migration.TargetClusterID)
+
+	err := r.moveInstanceCount(instance)
+	if err != nil {
+		return err
+	}
+
+	sourceClient, err := r.clusterRegistry.GetClient(sourceClusterID)
+	if err != nil {
+		return err
+	}
+
+	replica := &osbv1alpha1.SFServiceInstance{}
+	err = sourceClient.Get(ctx, namespacedName, replica)
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			log.Info("SFServiceInstance removed from source cluster")
+			return r.completeMigration(namespacedName, "")
+		}
+		log.Error(err, "Failed to fetch SFServiceInstance from source cluster")
+		return err
+	}
+
+	if replica.GetDeletionTimestamp().IsZero() {
+		return r.deleteReplica(sourceClient, replica)
+	}
+	if replica.GetState() == "failed" {
+		log.Info("Deprovisioning on source cluster failed", "error", replica.Status.Error)
+		return r.completeMigration(namespacedName, "Deprovisioning on source cluster "+sourceClusterID+
+			" failed. "+replica.Status.Error)
+	}
+	log.Info("replica not yet deprovisioned on source cluster", "replicaState", replica.GetState())
+	return nil
+}
+
+// switchCluster sets the ClusterID of the instance to the target cluster and
+// copies the status of the instance from the target cluster
+func (r *InstanceReplicator) switchCluster(namespacedName types.NamespacedName, phase string) error {
+	ctx := context.Background()
+	instance := &osbv1alpha1.SFServiceInstance{}
+	err := r.Get(ctx, namespacedName, instance)
+	if err != nil {
+		return err
+	}
+	if instance.Status.Migration == nil {
+		return nil
+	}
+	targetClient, err := r.clusterRegistry.GetClient(instance.Status.Migration.TargetClusterID)
+	if err != nil {
+		return err
+	}
+	replica := &osbv1alpha1.SFServiceInstance{}
+	err = targetClient.Get(ctx, namespacedName, replica)
+	if err != nil {
+		r.Log.Error(err, "Failed to fetch SFServiceInstance from target cluster", "instance", namespacedName)
+		return err
+	}
+
+	switched := false
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		err := r.Get(ctx, namespacedName, instance)
+		if err != nil {
+			return err
+		}
+		migration := instance.Status.Migration
+		if !isMigration(instance.GetState(), instance.GetLabels()[constants.LastOperationKey]) ||
+			migration == nil || migration.Phase != phase {
+			return nil
+		}
+		instance.Spec.ClusterID = migration.TargetClusterID
+		instance.Status.DashboardURL = replica.Status.DashboardURL
+		instance.Status.InstanceUsable = replica.Status.InstanceUsable
+		instance.Status.UpdateRepeatable = replica.Status.UpdateRepeatable
+		instance.Status.Resources = make([]osbv1alpha1.Source, len(replica.Status.Resources))
+		copy(instance.Status.Resources, replica.Status.Resources)
+		migration.Phase = osbv1alpha1.MigrationPhaseCleanup
+		labels := instance.GetLabels()
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[constants.LastOperationKey] = "migrate"
+		instance.SetLabels(labels)
+		instance.SetState("in progress")
+		err = r.Update(ctx, instance)
+		if err != nil {
+			return err
+		}
+		switched = true
+		return nil
+	})
+	if err != nil {
+		r.Log.Error(err, "Failed to switch SFServiceInstance to target cluster", "instance", namespacedName)
+		return err
+	}
+	if !switched {
+		return nil
+	}
+	migration := instance.Status.Migration
+	r.Log.Info("Switched SFServiceInstance to target cluster", "instance", namespacedName,
+		"sourceClusterID", migration.SourceClusterID, "targetClusterID", migration.TargetClusterID)
+	return nil
+}
+
+// moveInstanceCount moves the instance from the ServiceInstanceCount of the
+// source cluster to the target cluster. The instance is counted only once by
+// the counter, so the count is moved here. Each step is recorded on the
+// migration before the count is updated, so that a retry never updates a
+// count twice. The step is reset if the count update fails. A count lost
+// otherwise is corrected by the SFClusterRecounter.
+func (r *InstanceReplicator) moveInstanceCount(instance *osbv1alpha1.SFServiceInstance) error {
+	migration := instance.Status.Migration
+	if migration.InstanceCountMoved ||
+		!utils.ContainsString(instance.GetFinalizers(), constants.SFServiceInstanceCounterFinalizerName) {
+		return nil
+	}
+	currentPhase := migration.Phase
+
+	steps := []struct {
+		clusterID string
+		delta     int
+		done      func(*osbv1alpha1.MigrationStatus) *bool
+	}{
+		{
+			clusterID: migration.SourceClusterID,
+			delta:     -1,
+			done: func(migration *osbv1alpha1.MigrationStatus) *bool {
+				return &migration.SourceCountReleased
+			},
+		},
+		{
+			clusterID: migration.TargetClusterID,
+			delta:     1,
+			done: func(migration *osbv1alpha1.MigrationStatus) *bool {
+				return &migration.TargetCountAdded
+			},
+		},
+	}
+	for _, step := range steps {
+		recorded, err := r.recordCountMove(instance, currentPhase, step.done, true)
+		if err != nil {
+			return err
+		}
+		if !recorded {
+			continue
+		}
+		err = r.updateInstanceCount(step.clusterID, step.delta)
+		if err != nil {
+			_, _ = r.recordCountMove(instance, currentPhase, step.done, false)
+			return err
+		}
+	}
+
+	_, err := r.recordCountMove(instance, currentPhase, func(migration *osbv1alpha1.MigrationStatus) *bool {
+		return &migration.InstanceCountMoved
+	}, true)
+	return err
+}
+
+// recordCountMove sets the flag of the migration returned by field to value
+// and returns true if the flag is changed. Nothing is recorded if the
+// migration has moved on from currentPhase meanwhile.
+func (r *InstanceReplicator) recordCountMove(instance *osbv1alpha1.SFServiceInstance, currentPhase string,
+	field func(*osbv1alpha1.MigrationStatus) *bool, value bool) (bool, error) {
+	ctx := context.Background()
+	namespacedName := types.NamespacedName{
+		Name:      instance.GetName(),
+		Namespace: instance.GetNamespace(),
+	}
+
+	recorded := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		recorded = false
+		err := r.Get(ctx, namespacedName, instance)
+		if err != nil {
+			return err
+		}
+		migration := instance.Status.Migration
+		if migration == nil || migration.Phase != currentPhase || *field(migration) == value {
+			return nil
+		}
+		*field(migration) = value
+		err = r.Update(ctx, instance)
+		if err != nil {
+			return err
+		}
+		recorded = true
+		return nil
+	})
+	if err != nil {
+		r.Log.Error(err, "Failed to record move of service instance count", "instance", namespacedName)
+		return false, err
+	}
+	return recorded, nil
+}
+
+// completeMigration sets the state of the instance to succeeded
+// after the cleanup of the source cluster
+func (r *InstanceReplicator) completeMigration(namespacedName types.NamespacedName, msg string) error {
+	return r.finishMigration(namespacedName, osbv1alpha1.MigrationPhaseCleanup, osbv1alpha1.MigrationPhaseSucceeded, msg)
+}
+
+// failMigration sets the state of the instance to succeeded and leaves it on
+// the source cluster
+func (r *InstanceReplicator) failMigration(namespacedName types.NamespacedName, currentPhase, msg string) error {
+	return r.finishMigration(namespacedName, currentPhase, osbv1alpha1.MigrationPhaseFailed, msg)
+}
+
+func (r *InstanceReplicator) finishMigration(namespacedName types.NamespacedName, currentPhase, phase, msg string) error {
+	ctx := context.Background()
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		instance := &osbv1alpha1.SFServiceInstance{}
+		err := r.Get(ctx, namespacedName, instance)
+		if err != nil {
+			return err
+		}
+		migration := instance.Status.Migration
+		if !isMigration(instance.GetState(), instance.GetLabels()[constants.LastOperationKey]) ||
+			migration == nil || migration.Phase != currentPhase {
+			return nil
+		}
+		now := metav1.Now()
+		migration.Phase = phase
+		migration.Error = msg
+		migration.CompletionTime = &now
+		instance.SetState("succeeded")
+		return r.Update(ctx, instance)
+	})
+	if err != nil {
+		r.Log.Error(err, "Failed to update migration status", "instance", namespacedName, "phase", phase)
+		return err
+	}
+	r.Log.Info("Migration finished", "instance", namespacedName, "phase", phase, "error", msg)
+	return nil
+}
+
+// deleteReplica triggers the deprovisioning of the instance on a sister cluster
+func (r *InstanceReplicator) deleteReplica(targetClient client.Client, replica *osbv1alpha1.SFServiceInstance) error {
+	ctx := context.Background()
+	if replica.GetState() != "delete" {
+		replica.SetState("delete")
+		err := targetClient.Update(ctx, replica)
+		if err != nil {
+			return err
+		}
+	}
+	err := targetClient.Delete(ctx, replica)
+	if err != nil && !apiErrors.IsNotFound(err) {
+		return err
+	}
+	r.Log.Info("Triggered delete of sfserviceinstance from sister cluster", "instance", replica.GetName())
+	return nil
+}
+
+// deleteMigrationTarget deletes the instance from the target cluster
+// of a migration which did not complete
+func (r *InstanceReplicator) deleteMigrationTarget(instance *osbv1alpha1.SFServiceInstance) error {
+	targetClient, err := r.clusterRegistry.GetClient(instance.Status.Migration.TargetClusterID)
+	if err != nil {
+		return err
+	}
+	replica := &osbv1alpha1.SFServiceInstance{}
+	err = targetClient.Get(context.Background(), types.NamespacedName{
+		Name:      instance.GetName(),
+		Namespace: instance.GetNamespace(),
+	}, replica)
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if !replica.GetDeletionTimestamp().IsZero() {
+		return nil
+	}
+	return r.deleteReplica(targetClient, replica)
+}
+
+// updateInstanceCount adds delta to the ServiceInstanceCount of the cluster
+func (r *InstanceReplicator) updateInstanceCount(clusterID string, delta int) error {
+	ctx := context.Background()
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cluster := &resourcev1alpha1.SFCluster{}
+		err := r.Get(ctx, types.NamespacedName{
+			Name:      clusterID,
+			Namespace: constants.InteroperatorNamespace,
+		}, cluster)
+		if err != nil {
+			return err
+		}
+		cluster.Status.ServiceInstanceCount += delta
+		return r.Status().Update(ctx, cluster)
+	})
+	if err != nil {
+		r.Log.Error(err, "Failed to update service instance count", "clusterID", clusterID, "delta", delta)
+		return err
+	}
+	return nil
+}
+
+// copyMigrationObject copies the instance to the target cluster of the
+// migration as a new instance to be provisioned
+func copyMigrationObject(source, destination *osbv1alpha1.SFServiceInstance, targetClusterID string) {
+	replicateSpec(source, destination)
+
+	labels := make(map[string]string)
+	for key, val := range source.GetLabels() {
+		labels[key] = val
+	}
+	delete(labels, constants.LastOperationKey)
+	delete(labels, constants.ErrorCountKey)
+	destination.SetLabels(labels)
+
+	// The source cluster is available to the templates of the plan
+	annotations := make(map[string]string)
+	for key, val := range destination.GetAnnotations() {
+		annotations[key] = val
+	}
+	annotations[constants.MigrationSourceKey] = source.Spec.ClusterID
+	destination.SetAnnotations(annotations)
+
+	destination.Spec.ClusterID = targetClusterID
+	destination.SetState("in_queue")
+	destination.Status.Error = ""
+	destination.Status.Description = ""
+	destination.Status.Migration = nil
+}
@@ -0,0 +1,628 @@
+/*
+Copyright 2018 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfserviceinstancereplicator
+
+import (
+	"context"
+	"testing"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	mock_clusterRegistry "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/cluster/registry/mock_registry"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	"github.com/golang/mock/gomock"
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlrun "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type fakeConfig struct {
+	cfg *config.InteroperatorConfig
+}
+
+func (f *fakeConfig) GetConfig() *config.InteroperatorConfig {
+	return f.cfg
+}
+
+func (f *fakeConfig) UpdateConfig(cfg *config.InteroperatorConfig) error {
+	f.cfg = cfg
+	return nil
+}
+
+func TestInstanceReplicator_reconcileMigration(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(gomega.Succeed())
+	g.Expect(osbv1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+	g.Expect(resourcev1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	key := types.NamespacedName{Name: "migrated-instance", Namespace: "sf-migrated-instance"}
+	now := metav1.Now()
+	master := &osbv1alpha1.SFServiceInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            key.Name,
+			Namespace:       key.Namespace,
+			ResourceVersion: "1",
+			Finalizers:      []string{constants.SFServiceInstanceCounterFinalizerName},
+		},
+		Spec: osbv1alpha1.SFServiceInstanceSpec{
+			ServiceID: "service-id",
+			PlanID:    "plan-id",
+			ClusterID: "2",
+		},
+		Status: osbv1alpha1.SFServiceInstanceStatus{
+			State: "migrate",
+			Migration: &osbv1alpha1.MigrationStatus{
+				SourceClusterID: "2",
+				TargetClusterID: "3",
+				Phase:           osbv1alpha1.MigrationPhaseBackup,
+				StartTime:       &now,
+			},
+		},
+	}
+	source := master.DeepCopy()
+	source.Status = osbv1alpha1.SFServiceInstanceStatus{State: "succeeded"}
+	clusters := []runtime.Object{
+		&resourcev1alpha1.SFCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "2", Namespace: constants.InteroperatorNamespace},
+			Status:     resourcev1alpha1.SFClusterStatus{ServiceInstanceCount: 1},
+		},
+		&resourcev1alpha1.SFCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "3", Namespace: constants.InteroperatorNamespace},
+		},
+	}
+
+	migrationPlan := plan.DeepCopy()
+	migrationPlan.Spec.Templates = append(migrationPlan.Spec.Templates, osbv1alpha1.TemplateSpec{
+		Action:  osbv1alpha1.BackupAction,
+		Type:    "gotemplate",
+		Content: "backup",
+	}, osbv1alpha1.TemplateSpec{
+		Action:  osbv1alpha1.RestoreAction,
+		Type:    "gotemplate",
+		Content: "restore",
+	})
+
+	masterClient := fake.NewFakeClientWithScheme(scheme, append(clusters, master, service.DeepCopy(), migrationPlan)...)
+	sourceClient := fake.NewFakeClientWithScheme(scheme, source)
+	targetClient := fake.NewFakeClientWithScheme(scheme)
+
+	mockClusterRegistry := mock_clusterRegistry.NewMockClusterRegistry(ctrl)
+	mockClusterRegistry.EXPECT().GetClient("2").Return(sourceClient, nil).AnyTimes()
+	mockClusterRegistry.EXPECT().GetClient("3").Return(targetClient, nil).AnyTimes()
+
+	r := &InstanceReplicator{
+		Client:          masterClient,
+		Log:             ctrlrun.Log.WithName("mcd").WithName("replicator").WithName("instance"),
+		scheme:          scheme,
+		clusterRegistry: mockClusterRegistry,
+	}
+
+	reconcile := func() *osbv1alpha1.SFServiceInstance {
+		instance := &osbv1alpha1.SFServiceInstance{}
+		g.Expect(masterClient.Get(context.TODO(), key, instance)).To(gomega.Succeed())
+		_, err := r.reconcileMigration(instance)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(masterClient.Get(context.TODO(), key, instance)).To(gomega.Succeed())
+		return instance
+	}
+	getCount := func(clusterID string) int {
+		cluster := &resourcev1alpha1.SFCluster{}
+		g.Expect(masterClient.Get(context.TODO(), types.NamespacedName{
+			Name:      clusterID,
+			Namespace: constants.InteroperatorNamespace,
+		}, cluster)).To(gomega.Succeed())
+		return cluster.Status.ServiceInstanceCount
+	}
+
+	// Backup is triggered on the source cluster
+	instance := reconcile()
+	g.Expect(instance.GetState()).To(gomega.Equal("in progress"))
+	g.Expect(sourceClient.Get(context.TODO(), key, source)).To(gomega.Succeed())
+	g.Expect(source.GetState()).To(gomega.Equal(osbv1alpha1.BackupAction))
+
+	source.SetState("succeeded")
+	g.Expect(sourceClient.Update(context.TODO(), source)).To(gomega.Succeed())
+	instance = reconcile()
+	g.Expect(instance.GetState()).To(gomega.Equal("migrate"))
+	g.Expect(instance.Status.Migration.Phase).To(gomega.Equal(osbv1alpha1.MigrationPhaseProvisioning))
+
+	// Instance is provisioned on the target cluster
+	instance = reconcile()
+	g.Expect(instance.GetState()).To(gomega.Equal("in progress"))
+	g.Expect(instance.GetLabels()[constants.LastOperationKey]).To(gomega.Equal("migrate"))
+	replica := &osbv1alpha1.SFServiceInstance{}
+	g.Expect(targetClient.Get(context.TODO(), key, replica)).To(gomega.Succeed())
+	g.Expect(replica.Spec.ClusterID).To(gomega.Equal("3"))
+	g.Expect(replica.GetState()).To(gomega.Equal("in_queue"))
+	g.Expect(replica.Status.Migration).To(gomega.BeNil())
+	g.Expect(replica.GetAnnotations()[constants.MigrationSourceKey]).To(gomega.Equal("2"))
+	g.Expect(targetClient.Get(context.TODO(), planKey, &osbv1alpha1.SFPlan{})).To(gomega.Succeed())
+
+	// ClusterID is not switched till the target succeeds
+	instance = reconcile()
+	g.Expect(instance.Spec.ClusterID).To(gomega.Equal("2"))
+
+	replica.SetState("succeeded")
+	replica.Status.DashboardURL = "https://dashboard"
+	g.Expect(targetClient.Update(context.TODO(), replica)).To(gomega.Succeed())
+	instance = reconcile()
+	g.Expect(instance.Spec.ClusterID).To(gomega.Equal("2"))
+	g.Expect(instance.Status.Migration.Phase).To(gomega.Equal(osbv1alpha1.MigrationPhaseRestore))
+
+	// Restore is triggered on the target cluster
+	instance = reconcile()
+	g.Expect(instance.GetState()).To(gomega.Equal("in progress"))
+	g.Expect(targetClient.Get(context.TODO(), key, replica)).To(gomega.Succeed())
+	g.Expect(replica.GetState()).To(gomega.Equal(osbv1alpha1.RestoreAction))
+
+	replica.SetState("succeeded")
+	g.Expect(targetClient.Update(context.TODO(), replica)).To(gomega.Succeed())
+	instance = reconcile()
+	g.Expect(instance.Status.Migration.Phase).To(gomega.Equal(osbv1alpha1.MigrationPhaseCutover))
+
+	// Cutover is skipped as the plan has no template for it
+	instance = reconcile()
+	g.Expect(instance.Spec.ClusterID).To(gomega.Equal("3"))
+	g.Expect(instance.Status.DashboardURL).To(gomega.Equal("https://dashboard"))
+	g.Expect(instance.Status.Migration.Phase).To(gomega.Equal(osbv1alpha1.MigrationPhaseCleanup))
+	g.Expect(getCount("2")).To(gomega.Equal(1))
+	g.Expect(getCount("3")).To(gomega.Equal(0))
+
+	// Count is moved to the target cluster and instance is removed from the source cluster
+	instance = reconcile()
+	g.Expect(instance.Status.Migration.InstanceCountMoved).To(gomega.BeTrue())
+	g.Expect(getCount("2")).To(gomega.Equal(0))
+	g.Expect(getCount("3")).To(gomega.Equal(1))
+	err := sourceClient.Get(context.TODO(), key, &osbv1alpha1.SFServiceInstance{})
+	g.Expect(apierrors.IsNotFound(err)).To(gomega.BeTrue())
+
+	// Count is moved only once
+	instance = reconcile()
+	g.Expect(getCount("2")).To(gomega.Equal(0))
+	g.Expect(getCount("3")).To(gomega.Equal(1))
+	g.Expect(instance.GetState()).To(gomega.Equal("succeeded"))
+	g.Expect(instance.Status.Migration.Phase).To(gomega.Equal(osbv1alpha1.MigrationPhaseSucceeded))
+	g.Expect(instance.Status.Migration.CompletionTime).NotTo(gomega.BeNil())
+}
+
+func TestInstanceReplicator_reconcileMigration_failed(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	scheme := runtime.NewScheme()
+	g.Expect(osbv1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	key := types.NamespacedName{Name: "failed-instance", Namespace: "sf-failed-instance"}
+	master := &osbv1alpha1.SFServiceInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            key.Name,
+			Namespace:       key.Namespace,
+			ResourceVersion: "1",
+			Labels: map[string]string{
+				constants.LastOperationKey: "migrate",
+			},
+		},
+		Spec: osbv1alpha1.SFServiceInstanceSpec{
+			ServiceID: "service-id",
+			PlanID:    "plan-id",
+			ClusterID: "2",
+		},
+		Status: osbv1alpha1.SFServiceInstanceStatus{
+			State: "in progress",
+			Migration: &osbv1alpha1.MigrationStatus{
+				SourceClusterID: "2",
+				TargetClusterID: "3",
+				Phase:           osbv1alpha1.MigrationPhaseProvisioning,
+			},
+		},
+	}
+	replica := master.DeepCopy()
+	replica.Spec.ClusterID = "3"
+	replica.Status = osbv1alpha1.SFServiceInstanceStatus{
+		State: "failed",
+		Error: "no storage",
+	}
+
+	masterClient := fake.NewFakeClientWithScheme(scheme, master)
+	var targetClient client.Client = fake.NewFakeClientWithScheme(scheme, replica)
+
+	mockClusterRegistry := mock_clusterRegistry.NewMockClusterRegistry(ctrl)
+	mockClusterRegistry.EXPECT().GetClient("2").Return(fake.NewFakeClientWithScheme(scheme), nil).AnyTimes()
+	mockClusterRegistry.EXPECT().GetClient("3").Return(targetClient, nil).AnyTimes()
+
+	r := &InstanceReplicator{
+		Client:          masterClient,
+		Log:             ctrlrun.Log.WithName("mcd").WithName("replicator").WithName("instance"),
+		scheme:          scheme,
+		clusterRegistry: mockClusterRegistry,
+	}
+
+	_, err := r.reconcileMigration(master)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	instance := &osbv1alpha1.SFServiceInstance{}
+	g.Expect(masterClient.Get(context.TODO(), key, instance)).To(gomega.Succeed())
+	g.Expect(instance.Spec.ClusterID).To(gomega.Equal("2"))
+	g.Expect(instance.GetState()).To(gomega.Equal("succeeded"))
+	g.Expect(instance.Status.Migration.Phase).To(gomega.Equal(osbv1alpha1.MigrationPhaseFailed))
+	g.Expect(instance.Status.Migration.Error).To(gomega.ContainSubstring("no storage"))
+	err = targetClient.Get(context.TODO(), key, &osbv1alpha1.SFServiceInstance{})
+	g.Expect(apierrors.IsNotFound(err)).To(gomega.BeTrue())
+}
+
+func TestInstanceReplicator_reconcileMigration_pullMode(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	scheme := runtime.NewScheme()
+	g.Expect(osbv1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	key := types.NamespacedName{Name: "pull-mode-instance", Namespace: "sf-pull-mode-instance"}
+	master := &osbv1alpha1.SFServiceInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            key.Name,
+			Namespace:       key.Namespace,
+			ResourceVersion: "1",
+		},
+		Spec: osbv1alpha1.SFServiceInstanceSpec{
+			ServiceID: "service-id",
+			PlanID:    "plan-id",
+			ClusterID: "2",
+		},
+		Status: osbv1alpha1.SFServiceInstanceStatus{
+			State: "migrate",
+			Migration: &osbv1alpha1.MigrationStatus{
+				SourceClusterID: "2",
+				TargetClusterID: "3",
+				Phase:           osbv1alpha1.MigrationPhaseBackup,
+			},
+		},
+	}
+
+	masterClient := fake.NewFakeClientWithScheme(scheme, master)
+	mockClusterRegistry := mock_clusterRegistry.NewMockClusterRegistry(ctrl)
+	mockClusterRegistry.EXPECT().GetClient("2").Return(fake.NewFakeClientWithScheme(scheme), nil).AnyTimes()
+	mockClusterRegistry.EXPECT().GetClient("3").Return(nil,
+		errors.NewClusterNotManaged("3", "cluster is in pull mode and is managed by its agent", nil)).AnyTimes()
+
+	r := &InstanceReplicator{
+		Client:          masterClient,
+		Log:             ctrlrun.Log.WithName("mcd").WithName("replicator").WithName("instance"),
+		scheme:          scheme,
+		clusterRegistry: mockClusterRegistry,
+	}
+
+	_, err := r.reconcileMigration(master)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	instance := &osbv1alpha1.SFServiceInstance{}
+	g.Expect(masterClient.Get(context.TODO(), key, instance)).To(gomega.Succeed())
+	g.Expect(instance.Spec.ClusterID).To(gomega.Equal("2"))
+	g.Expect(instance.GetState()).To(gomega.Equal("succeeded"))
+	g.Expect(instance.Status.Migration.Phase).To(gomega.Equal(osbv1alpha1.MigrationPhaseFailed))
+	g.Expect(instance.Status.Migration.Error).To(gomega.ContainSubstring("pull mode"))
+}
+
+func TestInstanceReplicator_reconcileMigration_missingTemplate(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	scheme := runtime.NewScheme()
+	g.Expect(osbv1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	key := types.NamespacedName{Name: "restore-instance", Namespace: "sf-restore-instance"}
+	master := &osbv1alpha1.SFServiceInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            key.Name,
+			Namespace:       key.Namespace,
+			ResourceVersion: "1",
+		},
+		Spec: osbv1alpha1.SFServiceInstanceSpec{
+			ServiceID: "service-id",
+			PlanID:    "plan-id",
+			ClusterID: "2",
+		},
+		Status: osbv1alpha1.SFServiceInstanceStatus{
+			State: "migrate",
+			Migration: &osbv1alpha1.MigrationStatus{
+				SourceClusterID: "2",
+				TargetClusterID: "3",
+				Phase:           osbv1alpha1.MigrationPhaseRestore,
+			},
+		},
+	}
+	replica := master.DeepCopy()
+	replica.Spec.ClusterID = "3"
+	replica.Status = osbv1alpha1.SFServiceInstanceStatus{State: "succeeded"}
+
+	masterClient := fake.NewFakeClientWithScheme(scheme, master, plan.DeepCopy())
+	targetClient := fake.NewFakeClientWithScheme(scheme, replica)
+
+	mockClusterRegistry := mock_clusterRegistry.NewMockClusterRegistry(ctrl)
+	mockClusterRegistry.EXPECT().GetClient("2").Return(fake.NewFakeClientWithScheme(scheme), nil).AnyTimes()
+	mockClusterRegistry.EXPECT().GetClient("3").Return(targetClient, nil).AnyTimes()
+
+	r := &InstanceReplicator{
+		Client:          masterClient,
+		Log:             ctrlrun.Log.WithName("mcd").WithName("replicator").WithName("instance"),
+		scheme:          scheme,
+		clusterRegistry: mockClusterRegistry,
+	}
+
+	// Migration fails as the plan has no restore template
+	_, err := r.reconcileMigration(master)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	instance := &osbv1alpha1.SFServiceInstance{}
+	g.Expect(masterClient.Get(context.TODO(), key, instance)).To(gomega.Succeed())
+	g.Expect(instance.Spec.ClusterID).To(gomega.Equal("2"))
+	g.Expect(instance.GetState()).To(gomega.Equal("succeeded"))
+	g.Expect(instance.Status.Migration.Phase).To(gomega.Equal(osbv1alpha1.MigrationPhaseFailed))
+	g.Expect(instance.Status.Migration.Error).To(gomega.ContainSubstring(osbv1alpha1.RestoreAction))
+	err = targetClient.Get(context.TODO(), key, &osbv1alpha1.SFServiceInstance{})
+	g.Expect(apierrors.IsNotFound(err)).To(gomega.BeTrue())
+}
+
+func TestInstanceReplicator_interruptMigration(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	scheme := runtime.NewScheme()
+	g.Expect(osbv1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	key := types.NamespacedName{Name: "interrupted-instance", Namespace: "sf-interrupted-instance"}
+	getInstance := func(clusterID, state, phase string) *osbv1alpha1.SFServiceInstance {
+		return &osbv1alpha1.SFServiceInstance{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            key.Name,
+				Namespace:       key.Namespace,
+				ResourceVersion: "1",
+				Labels: map[string]string{
+					constants.LastOperationKey: "migrate",
+				},
+			},
+			Spec: osbv1alpha1.SFServiceInstanceSpec{
+				ServiceID: "service-id",
+				PlanID:    "plan-id",
+				ClusterID: clusterID,
+			},
+			Status: osbv1alpha1.SFServiceInstanceStatus{
+				State: state,
+				Migration: &osbv1alpha1.MigrationStatus{
+					SourceClusterID: "2",
+					TargetClusterID: "3",
+					Phase:           phase,
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		clusterID     string
+		phase         string
+		wantPhase     string
+		removedClient string
+	}{
+		{
+			name:          "fail migration and remove instance from target cluster",
+			clusterID:     "2",
+			phase:         osbv1alpha1.MigrationPhaseRestore,
+			wantPhase:     osbv1alpha1.MigrationPhaseFailed,
+			removedClient: "3",
+		},
+		{
+			name:          "complete migration and remove instance from source cluster in cleanup",
+			clusterID:     "3",
+			phase:         osbv1alpha1.MigrationPhaseCleanup,
+			wantPhase:     osbv1alpha1.MigrationPhaseSucceeded,
+			removedClient: "2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The broker replaced the state of the migration with update
+			master := getInstance(tt.clusterID, "update", tt.phase)
+			source := getInstance("2", "succeeded", "")
+			source.Status.Migration = nil
+			target := getInstance("3", "succeeded", "")
+			target.Status.Migration = nil
+
+			masterClient := fake.NewFakeClientWithScheme(scheme, master)
+			clients := map[string]client.Client{
+				"2": fake.NewFakeClientWithScheme(scheme, source),
+				"3": fake.NewFakeClientWithScheme(scheme, target),
+			}
+			mockClusterRegistry := mock_clusterRegistry.NewMockClusterRegistry(ctrl)
+			mockClusterRegistry.EXPECT().GetClient("2").Return(clients["2"], nil).AnyTimes()
+			mockClusterRegistry.EXPECT().GetClient("3").Return(clients["3"], nil).AnyTimes()
+
+			r := &InstanceReplicator{
+				Client:          masterClient,
+				Log:             ctrlrun.Log.WithName("mcd").WithName("replicator").WithName("instance"),
+				scheme:          scheme,
+				clusterRegistry: mockClusterRegistry,
+				cfgManager: &fakeConfig{
+					cfg: &config.InteroperatorConfig{PrimaryClusterID: "1"},
+				},
+			}
+
+			g.Expect(master.Status.Migration.IsActive()).To(gomega.BeTrue())
+			_, err := r.Reconcile(ctrlrun.Request{NamespacedName: key})
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+
+			instance := &osbv1alpha1.SFServiceInstance{}
+			g.Expect(masterClient.Get(context.TODO(), key, instance)).To(gomega.Succeed())
+			g.Expect(instance.GetState()).To(gomega.Equal("update"))
+			g.Expect(instance.Spec.ClusterID).To(gomega.Equal(tt.clusterID))
+			g.Expect(instance.Status.Migration.Phase).To(gomega.Equal(tt.wantPhase))
+			g.Expect(instance.Status.Migration.CompletionTime).NotTo(gomega.BeNil())
+			g.Expect(instance.Status.Migration.IsActive()).To(gomega.BeFalse())
+
+			err = clients[tt.removedClient].Get(context.TODO(), key, &osbv1alpha1.SFServiceInstance{})
+			g.Expect(apierrors.IsNotFound(err)).To(gomega.BeTrue())
+			g.Expect(clients[tt.clusterID].Get(context.TODO(), key, &osbv1alpha1.SFServiceInstance{})).To(gomega.Succeed())
+		})
+	}
+}
+
+func TestInstanceReplicator_moveInstanceCount(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(osbv1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+	g.Expect(resourcev1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	key := types.NamespacedName{Name: "moved-instance", Namespace: "sf-moved-instance"}
+	master := &osbv1alpha1.SFServiceInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            key.Name,
+			Namespace:       key.Namespace,
+			ResourceVersion: "1",
+			Finalizers:      []string{constants.SFServiceInstanceCounterFinalizerName},
+		},
+		Spec: osbv1alpha1.SFServiceInstanceSpec{
+			ServiceID: "service-id",
+			PlanID:    "plan-id",
+			ClusterID: "3",
+		},
+		Status: osbv1alpha1.SFServiceInstanceStatus{
+			State: "in progress",
+			Migration: &osbv1alpha1.MigrationStatus{
+				SourceClusterID: "2",
+				TargetClusterID: "3",
+				Phase:           osbv1alpha1.MigrationPhaseCleanup,
+			},
+		},
+	}
+	source := &resourcev1alpha1.SFCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "2", Namespace: constants.InteroperatorNamespace},
+		Status:     resourcev1alpha1.SFClusterStatus{ServiceInstanceCount: 1},
+	}
+	target := &resourcev1alpha1.SFCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "3", Namespace: constants.InteroperatorNamespace},
+	}
+
+	// The target cluster is not found the first time
+	masterClient := fake.NewFakeClientWithScheme(scheme, master, source)
+	r := &InstanceReplicator{
+		Client: masterClient,
+		Log:    ctrlrun.Log.WithName("mcd").WithName("replicator").WithName("instance"),
+		scheme: scheme,
+	}
+
+	getCount := func(clusterID string) int {
+		cluster := &resourcev1alpha1.SFCluster{}
+		g.Expect(masterClient.Get(context.TODO(), types.NamespacedName{
+			Name:      clusterID,
+			Namespace: constants.InteroperatorNamespace,
+		}, cluster)).To(gomega.Succeed())
+		return cluster.Status.ServiceInstanceCount
+	}
+	moveInstanceCount := func() (*osbv1alpha1.SFServiceInstance, error) {
+		instance := &osbv1alpha1.SFServiceInstance{}
+		g.Expect(masterClient.Get(context.TODO(), key, instance)).To(gomega.Succeed())
+		err := r.moveInstanceCount(instance)
+		g.Expect(masterClient.Get(context.TODO(), key, instance)).To(gomega.Succeed())
+		return instance, err
+	}
+
+	instance, err := moveInstanceCount()
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(instance.Status.Migration.SourceCountReleased).To(gomega.BeTrue())
+	g.Expect(instance.Status.Migration.TargetCountAdded).To(gomega.BeFalse())
+	g.Expect(instance.Status.Migration.InstanceCountMoved).To(gomega.BeFalse())
+	g.Expect(getCount("2")).To(gomega.Equal(0))
+
+	// The source cluster is not released again on retry
+	g.Expect(masterClient.Create(context.TODO(), target)).To(gomega.Succeed())
+	instance, err = moveInstanceCount()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(instance.Status.Migration.TargetCountAdded).To(gomega.BeTrue())
+	g.Expect(instance.Status.Migration.InstanceCountMoved).To(gomega.BeTrue())
+	g.Expect(getCount("2")).To(gomega.Equal(0))
+	g.Expect(getCount("3")).To(gomega.Equal(1))
+
+	_, err = moveInstanceCount()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(getCount("2")).To(gomega.Equal(0))
+	g.Expect(getCount("3")).To(gomega.Equal(1))
+}
+
+func TestInstanceReplicator_reconcileUsage(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(osbv1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	key := types.NamespacedName{Name: "usage-instance", Namespace: "sf-usage-instance"}
+	master := &osbv1alpha1.SFServiceInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            key.Name,
+			Namespace:       key.Namespace,
+			ResourceVersion: "1",
+		},
+		Spec: osbv1alpha1.SFServiceInstanceSpec{
+			ClusterID: "2",
+		},
+		Status: osbv1alpha1.SFServiceInstanceStatus{
+			State: "succeeded",
+		},
+	}
+	replica := master.DeepCopy()
+	replica.Status.Usage = corev1.ResourceList{
+		corev1.ResourceCPU:     resource.MustParse("500m"),
+		corev1.ResourceMemory:  resource.MustParse("1Gi"),
+		corev1.ResourceStorage: resource.MustParse("10Gi"),
+	}
+
+	masterClient := fake.NewFakeClientWithScheme(scheme, master)
+	targetClient := fake.NewFakeClientWithScheme(scheme, replica)
+
+	r := &InstanceReplicator{
+		Client: masterClient,
+		Log:    ctrlrun.Log.WithName("mcd").WithName("replicator").WithName("instance"),
+		scheme: scheme,
+	}
+
+	instance := &osbv1alpha1.SFServiceInstance{}
+	g.Expect(masterClient.Get(context.TODO(), key, instance)).To(gomega.Succeed())
+	g.Expect(r.reconcileUsage(targetClient, instance)).To(gomega.Succeed())
+	g.Expect(masterClient.Get(context.TODO(), key, instance)).To(gomega.Succeed())
+	g.Expect(resourcev1alpha1.ResourceListEqual(instance.Status.Usage, replica.Status.Usage)).To(gomega.BeTrue())
+
+	// Missing replica is ignored
+	g.Expect(r.reconcileUsage(fake.NewFakeClientWithScheme(scheme), instance)).To(gomega.Succeed())
+}
@@ -18,12 +18,15 @@ package sfserviceinstancereplicator
 
 import (
 	"context"
+	"strconv"
 
 	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/multiclusterdeploy/watchmanager"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/cluster/registry"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/utils"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/watches"
 
@@ -31,14 +34,17 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	corev1 "k8s.io/api/core/v1"
 	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
@@ -131,8 +137,26 @@ func (r *InstanceReplicator) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 
 	log = log.WithValues("instance", instanceID, "clusterID", clusterID)
 
+	if isMigration(state, lastOperation) {
+		return r.reconcileMigration(instance)
+	}
+
+	// Another operation replaced the state of an ongoing migration
+	if instance.Status.Migration.IsActive() {
+		err = r.interruptMigration(instance)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{Requeue: true}, nil
+	}
+
 	targetClient, err := r.clusterRegistry.GetClient(clusterID)
 	if err != nil {
+		if errors.ClusterNotManaged(err) {
+			// Replicated by the agent of the cluster or by the master cluster
+			log.V(1).Info("cluster not managed by this interoperator. Not replicating sfserviceinstance", "clusterID", clusterID)
+			return ctrl.Result{}, nil
+		}
 		return ctrl.Result{}, err
 	}
 
@@ -157,13 +181,24 @@ func (r *InstanceReplicator) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 			}
 		}
 		log.Info("Triggered delete of sfserviceinstance from target cluster", "state", state, "lastOperation", lastOperation)
+
+		// Delete the instance from the target cluster of an unfinished migration
+		migration := instance.Status.Migration
+		if migration != nil && isTargetProvisioned(migration) && migration.TargetClusterID != clusterID {
+			err = r.deleteMigrationTarget(instance)
+			if err != nil {
+				log.Error(err, "Failed to delete SFServiceInstance from migration target cluster", "state", state,
+					"lastOperation", lastOperation, "targetClusterID", migration.TargetClusterID)
+				return ctrl.Result{}, err
+			}
+		}
 	}
 
 	if state == "in_queue" || state == "update" || state == "delete" {
 		err = targetClient.Get(ctx, req.NamespacedName, replica)
 		if err != nil {
 			if apiErrors.IsNotFound(err) && state != "delete" {
-				copyObject(instance, replica, true)
+				replicateSpec(instance, replica)
 				err = targetClient.Create(ctx, replica)
 				if err != nil {
 					log.Error(err, "Error occurred while replicating SFServiceInstance to cluster ",
@@ -177,8 +212,9 @@ func (r *InstanceReplicator) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 				return ctrl.Result{}, err
 			}
 		} else {
-			copyObject(instance, replica, true)
-			err = targetClient.Update(ctx, replica)
+			patch := client.MergeFromWithOptions(replica.DeepCopy(), client.MergeFromWithOptimisticLock{})
+			replicateSpec(instance, replica)
+			err = targetClient.Patch(ctx, replica, patch)
 			if err != nil {
 				log.Error(err, "Error occurred while replicating SFServiceInstance to cluster ",
 					"state", state, "lastOperation", lastOperation)
@@ -188,7 +224,7 @@ func (r *InstanceReplicator) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		}
 
 		err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
-			return r.setInProgress(instance, state)
+			return r.setInProgress(instance, state, replica.GetGeneration())
 		})
 		if err != nil {
 			return ctrl.Result{}, err
@@ -209,6 +245,7 @@ func (r *InstanceReplicator) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 			replicaLastOperation string
 		)
 
+		patch := client.MergeFromWithOptions(instance.DeepCopy(), client.MergeFromWithOptimisticLock{})
 		err = targetClient.Get(ctx, req.NamespacedName, replica)
 		if err != nil {
 			if apiErrors.IsNotFound(err) && lastOperation == "delete" {
@@ -238,12 +275,19 @@ func (r *InstanceReplicator) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 					"replicaState", replicaState, "replicaLastOperation", replicaLastOperation)
 				return ctrl.Result{}, nil
 			}
-			copyObject(replica, instance, false)
-			log.Info("copying sfserviceinstance from target cluster to master", "state", state, "lastOperation", lastOperation,
+			if !replicaObserved(instance, replica) {
+				// status of the replica is from an earlier operation
+				log.Info("replica has not yet observed the last operation", "state", state, "lastOperation", lastOperation,
+					"replicaState", replicaState, "replicaLastOperation", replicaLastOperation,
+					"observedGeneration", replica.Status.ObservedGeneration)
+				return ctrl.Result{}, nil
+			}
+			replicateStatus(replica, instance)
+			log.Info("copying status of sfserviceinstance from target cluster to master", "state", state, "lastOperation", lastOperation,
 				"replicaState", replicaState, "replicaLastOperation", replicaLastOperation)
 		}
 
-		err = r.Update(ctx, instance)
+		err = r.Patch(ctx, instance, patch)
 		if err != nil {
 			log.Error(err, "Failed to update SFServiceInstance in master cluster", "state", state, "lastOperation", lastOperation,
 				"replicaState", replicaState, "replicaLastOperation", replicaLastOperation)
@@ -254,6 +298,13 @@ func (r *InstanceReplicator) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 			"replicaState", replicaState, "replicaLastOperation", replicaLastOperation)
 	}
 
+	if state == "succeeded" || state == "failed" {
+		err = r.reconcileUsage(targetClient, instance)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
 	if lastErr != nil {
 		// re que if service/plan replication failed
 		return ctrl.Result{}, err
@@ -262,6 +313,40 @@ func (r *InstanceReplicator) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	return ctrl.Result{}, nil
 }
 
+// reconcileUsage copies the resource usage computed in the target cluster
+// to the master. The status of the replica is otherwise copied only while
+// an operation is in progress.
+func (r *InstanceReplicator) reconcileUsage(targetClient client.Client, instance *osbv1alpha1.SFServiceInstance) error {
+	ctx := context.Background()
+	log := r.Log.WithValues("instance", instance.GetName())
+
+	replica := &osbv1alpha1.SFServiceInstance{}
+	err := targetClient.Get(ctx, types.NamespacedName{
+		Name:      instance.GetName(),
+		Namespace: instance.GetNamespace(),
+	}, replica)
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			return nil
+		}
+		log.Error(err, "Failed to fetch SFServiceInstance from target cluster")
+		return err
+	}
+
+	if resourcev1alpha1.ResourceListEqual(replica.Status.Usage, instance.Status.Usage) {
+		return nil
+	}
+	patch := client.MergeFromWithOptions(instance.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	instance.Status.Usage = replica.Status.Usage.DeepCopy()
+	err = r.Patch(ctx, instance, patch)
+	if err != nil {
+		log.Error(err, "Failed to update usage of SFServiceInstance in master cluster")
+		return err
+	}
+	log.V(1).Info("Updated usage of sfserviceinstance in master", "usage", instance.Status.Usage)
+	return nil
+}
+
 func (r *InstanceReplicator) reconcileNamespace(targetClient client.Client, namespace, clusterID string, delete bool) error {
 	ctx := context.Background()
 	log := r.Log.WithValues("clusterID", clusterID, "namespace", namespace, "deleteNamespace", delete)
@@ -425,7 +510,10 @@ func (r *InstanceReplicator) reconcileServicePlan(targetClient client.Client, in
 	return lastErr
 }
 
-func (r *InstanceReplicator) setInProgress(instance *osbv1alpha1.SFServiceInstance, state string) error {
+// setInProgress sets the state of the instance to in progress once the
+// operation is replicated. The generation of the replica is recorded to
+// identify the status of the replica for the operation.
+func (r *InstanceReplicator) setInProgress(instance *osbv1alpha1.SFServiceInstance, state string, replicaGeneration int64) error {
 	instanceID := instance.GetName()
 	clusterID, _ := instance.GetClusterID()
 	labels := instance.GetLabels()
@@ -457,6 +545,7 @@ func (r *InstanceReplicator) setInProgress(instance *osbv1alpha1.SFServiceInstan
 		// Will get requeued since a change has happened
 		return nil
 	}
+	patch := client.MergeFromWithOptions(instance.DeepCopy(), client.MergeFromWithOptimisticLock{})
 	instance.SetState("in progress")
 	labels = instance.GetLabels()
 	if labels == nil {
@@ -464,7 +553,17 @@ func (r *InstanceReplicator) setInProgress(instance *osbv1alpha1.SFServiceInstan
 	}
 	labels[constants.LastOperationKey] = state
 	instance.SetLabels(labels)
-	err = r.Update(ctx, instance)
+	annotations := instance.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	if replicaGeneration > 0 {
+		annotations[constants.ReplicaGenerationKey] = strconv.FormatInt(replicaGeneration, 10)
+	} else {
+		delete(annotations, constants.ReplicaGenerationKey)
+	}
+	instance.SetAnnotations(annotations)
+	err = r.Patch(ctx, instance, patch)
 	if err != nil {
 		log.Error(err, "Updating status to in progress failed", "state", state,
 			"lastOperation", lastOperation, "newLastOperation", state)
@@ -475,22 +574,64 @@ func (r *InstanceReplicator) setInProgress(instance *osbv1alpha1.SFServiceInstan
 	return nil
 }
 
-func copyObject(source, destination *osbv1alpha1.SFServiceInstance, preserveResources bool) {
+// replicateSpec copies the fields of the instance owned by the master cluster
+// to the replica. The master owns the labels, annotations and spec and
+// requests an operation by setting the state. The rest of the status is owned
+// by the provisioner in the member cluster and is not overwritten.
+func replicateSpec(source, destination *osbv1alpha1.SFServiceInstance) {
 	destination.SetName(source.GetName())
 	destination.SetNamespace(source.GetNamespace())
-	destination.SetLabels(source.GetLabels())
-	destination.SetAnnotations(source.GetAnnotations())
-	source.Spec.DeepCopyInto(&destination.Spec)
 
-	// Do not overwrite resources array in sister cluster
-	if preserveResources {
-		resources := make([]osbv1alpha1.Source, len(destination.Status.Resources))
-		copy(resources, destination.Status.Resources)
-		source.Status.DeepCopyInto(&destination.Status)
-		destination.Status.Resources = resources
+	labels := make(map[string]string)
+	for key, val := range source.GetLabels() {
+		labels[key] = val
+	}
+	// The error count is maintained by the provisioner
+	if count, ok := destination.GetLabels()[constants.ErrorCountKey]; ok {
+		labels[constants.ErrorCountKey] = count
 	} else {
-		source.Status.DeepCopyInto(&destination.Status)
+		delete(labels, constants.ErrorCountKey)
+	}
+	destination.SetLabels(labels)
+
+	annotations := make(map[string]string)
+	for key, val := range source.GetAnnotations() {
+		annotations[key] = val
 	}
+	delete(annotations, constants.ReplicaGenerationKey)
+	destination.SetAnnotations(annotations)
+
+	source.Spec.DeepCopyInto(&destination.Spec)
+	destination.SetState(source.GetState())
+}
+
+// replicateStatus copies the status of the replica owned by the provisioner
+// in the member cluster to the instance in the master cluster. The migration
+// and scheduling status are owned by the master cluster.
+func replicateStatus(source, destination *osbv1alpha1.SFServiceInstance) {
+	destination.Status.State = source.Status.State
+	destination.Status.Error = source.Status.Error
+	destination.Status.Description = source.Status.Description
+	destination.Status.DashboardURL = source.Status.DashboardURL
+	destination.Status.InstanceUsable = source.Status.InstanceUsable
+	destination.Status.UpdateRepeatable = source.Status.UpdateRepeatable
+	source.Status.AppliedSpec.DeepCopyInto(&destination.Status.AppliedSpec)
+	destination.Status.Resources = make([]osbv1alpha1.Source, len(source.Status.Resources))
+	copy(destination.Status.Resources, source.Status.Resources)
+	destination.Status.Usage = source.Status.Usage.DeepCopy()
+}
+
+// replicaObserved returns true if the status of the replica is for the last
+// operation replicated to it, i.e. the provisioner picked up the operation
+// at or after the generation recorded in setInProgress. Replicas of
+// provisioners not reporting the observed generation are always considered
+// up to date.
+func replicaObserved(instance, replica *osbv1alpha1.SFServiceInstance) bool {
+	generation, err := strconv.ParseInt(instance.GetAnnotations()[constants.ReplicaGenerationKey], 10, 64)
+	if err != nil || replica.Status.ObservedGeneration == 0 {
+		return true
+	}
+	return replica.Status.ObservedGeneration >= generation
 }
 
 func replicateSFServiceResourceData(source *osbv1alpha1.SFService, dest *osbv1alpha1.SFService) {
@@ -549,3 +690,54 @@ func (r *InstanceReplicator) SetupWithManager(mgr ctrl.Manager) error {
 
 	return builder.Complete(r)
 }
+
+// SetupAgentWithManager registers the instance replicator in the agent of a
+// member cluster in pull mode. The SFServiceInstances assigned to the own
+// cluster are read from and updated in the master cluster with masterClient
+// and are watched using masterCache.
+func (r *InstanceReplicator) SetupAgentWithManager(mgr ctrl.Manager, masterClient client.Client, masterCache cache.Cache) error {
+	r.Client = masterClient
+	r.scheme = mgr.GetScheme()
+
+	if r.Log == nil {
+		r.Log = ctrl.Log.WithName("agent").WithName("replicator").WithName("instance")
+	}
+	if r.clusterRegistry == nil {
+		clusterRegistry, err := registry.NewLocal(mgr.GetClient(), mgr.GetConfig())
+		if err != nil {
+			return err
+		}
+		r.clusterRegistry = clusterRegistry
+	}
+
+	cfgManager, err := config.New(mgr.GetConfig(), mgr.GetScheme(), mgr.GetRESTMapper())
+	if err != nil {
+		return err
+	}
+	interoperatorCfg := cfgManager.GetConfig()
+	r.cfgManager = cfgManager
+
+	// Watch for changes to SFServiceInstance in master cluster
+	masterInstances := &source.Kind{Type: &osbv1alpha1.SFServiceInstance{}}
+	err = masterInstances.InjectCache(masterCache)
+	if err != nil {
+		return err
+	}
+
+	metrics.Registry.MustRegister(instancesMetric)
+
+	builder := ctrl.NewControllerManagedBy(mgr).
+		Named("agent_replicator_instance").
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: interoperatorCfg.InstanceWorkerCount,
+		}).
+		For(&osbv1alpha1.SFServiceInstance{}).
+		Watches(masterInstances, &handler.EnqueueRequestForObject{}).
+		WithEventFilter(watches.NamespaceLabelFilter()).
+		WithEventFilter(predicate.NewPredicateFuncs(func(meta metav1.Object, object runtime.Object) bool {
+			instance, ok := object.(*osbv1alpha1.SFServiceInstance)
+			return ok && instance.Spec.ClusterID == constants.OwnClusterID
+		}))
+
+	return builder.Complete(r)
+}
@@ -23,6 +23,7 @@ import (
 	"time"
 
 	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
 	mock_clusterRegistry "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/cluster/registry/mock_registry"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
 
@@ -31,10 +32,12 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/util/retry"
 	ctrlrun "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -421,8 +424,9 @@ func TestInstanceReplicator_setInProgress(t *testing.T) {
 		clusterRegistry: nil,
 	}
 	type args struct {
-		instance *osbv1alpha1.SFServiceInstance
-		state    string
+		instance          *osbv1alpha1.SFServiceInstance
+		state             string
+		replicaGeneration int64
 	}
 	tests := []struct {
 		name    string
@@ -434,8 +438,9 @@ func TestInstanceReplicator_setInProgress(t *testing.T) {
 		{
 			name: "Set the state to in progress",
 			args: args{
-				instance: instance,
-				state:    "in_queue",
+				instance:          instance,
+				state:             "in_queue",
+				replicaGeneration: 3,
 			},
 			setup: func() {
 				instance.SetResourceVersion("")
@@ -448,6 +453,7 @@ func TestInstanceReplicator_setInProgress(t *testing.T) {
 				g.Expect(c.Get(context.TODO(), instanceKey, instance)).NotTo(gomega.HaveOccurred())
 				g.Expect(instance.GetState()).To(gomega.Equal("in progress"))
 				g.Expect(instance.GetLabels()).To(gomega.HaveKeyWithValue(constants.LastOperationKey, "in_queue"))
+				g.Expect(instance.GetAnnotations()).To(gomega.HaveKeyWithValue(constants.ReplicaGenerationKey, "3"))
 				g.Expect(c.Delete(context.TODO(), instance)).NotTo(gomega.HaveOccurred())
 				g.Eventually(func() error {
 					err := c.Get(context.TODO(), instanceKey, instance)
@@ -520,9 +526,121 @@ func TestInstanceReplicator_setInProgress(t *testing.T) {
 			if tt.cleanup != nil {
 				defer tt.cleanup()
 			}
-			if err := r.setInProgress(tt.args.instance, tt.args.state); (err != nil) != tt.wantErr {
+			if err := r.setInProgress(tt.args.instance, tt.args.state, tt.args.replicaGeneration); (err != nil) != tt.wantErr {
 				t.Errorf("InstanceReplicator.setInProgress() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
+
+func TestInstanceReplicator_Reconcile_ownership(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(gomega.Succeed())
+	g.Expect(osbv1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	key := types.NamespacedName{Name: "owned-instance", Namespace: "sf-owned-instance"}
+	master := &osbv1alpha1.SFServiceInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            key.Name,
+			Namespace:       key.Namespace,
+			ResourceVersion: "1",
+			Labels: map[string]string{
+				constants.LastOperationKey: "in_queue",
+				"owner":                    "master",
+			},
+		},
+		Spec: osbv1alpha1.SFServiceInstanceSpec{
+			ServiceID: "service-id",
+			PlanID:    "plan-2",
+			ClusterID: "2",
+		},
+		Status: osbv1alpha1.SFServiceInstanceStatus{
+			State: "update",
+		},
+	}
+	replica := &osbv1alpha1.SFServiceInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            key.Name,
+			Namespace:       key.Namespace,
+			ResourceVersion: "1",
+			Labels: map[string]string{
+				constants.LastOperationKey: "in_queue",
+				constants.ErrorCountKey:    "2",
+			},
+		},
+		Spec: osbv1alpha1.SFServiceInstanceSpec{
+			ServiceID: "service-id",
+			PlanID:    "plan-1",
+			ClusterID: "2",
+		},
+		Status: osbv1alpha1.SFServiceInstanceStatus{
+			State:              "succeeded",
+			Description:        "provisioned",
+			ObservedGeneration: 5,
+			Resources: []osbv1alpha1.Source{
+				{APIVersion: "v1", Kind: "Secret", Name: "secret", Namespace: key.Namespace},
+			},
+		},
+	}
+
+	masterClient := fake.NewFakeClientWithScheme(scheme, master, service.DeepCopy(), plan.DeepCopy())
+	targetClient := fake.NewFakeClientWithScheme(scheme, replica)
+
+	mockClusterRegistry := mock_clusterRegistry.NewMockClusterRegistry(ctrl)
+	mockClusterRegistry.EXPECT().GetClient("2").Return(targetClient, nil).AnyTimes()
+
+	r := &InstanceReplicator{
+		Client:          masterClient,
+		Log:             ctrlrun.Log.WithName("mcd").WithName("replicator").WithName("instance"),
+		scheme:          scheme,
+		clusterRegistry: mockClusterRegistry,
+		cfgManager: &fakeConfig{
+			cfg: &config.InteroperatorConfig{PrimaryClusterID: "1"},
+		},
+	}
+	reconcile := func() *osbv1alpha1.SFServiceInstance {
+		_, err := r.Reconcile(ctrlrun.Request{NamespacedName: key})
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		instance := &osbv1alpha1.SFServiceInstance{}
+		g.Expect(masterClient.Get(context.TODO(), key, instance)).To(gomega.Succeed())
+		g.Expect(targetClient.Get(context.TODO(), key, replica)).To(gomega.Succeed())
+		return instance
+	}
+
+	// Only the spec, metadata and state are replicated to the member cluster
+	instance := reconcile()
+	g.Expect(instance.GetState()).To(gomega.Equal("in progress"))
+	g.Expect(instance.GetLabels()).To(gomega.HaveKeyWithValue(constants.LastOperationKey, "update"))
+	g.Expect(replica.GetState()).To(gomega.Equal("update"))
+	g.Expect(replica.Spec.PlanID).To(gomega.Equal("plan-2"))
+	g.Expect(replica.GetLabels()).To(gomega.HaveKeyWithValue("owner", "master"))
+	g.Expect(replica.GetLabels()).To(gomega.HaveKeyWithValue(constants.ErrorCountKey, "2"))
+	g.Expect(replica.Status.Description).To(gomega.Equal("provisioned"))
+	g.Expect(replica.Status.Resources).To(gomega.HaveLen(1))
+
+	// Status of an earlier operation is not copied to the master cluster
+	annotations := map[string]string{constants.ReplicaGenerationKey: "6"}
+	instance.SetAnnotations(annotations)
+	g.Expect(masterClient.Update(context.TODO(), instance)).To(gomega.Succeed())
+	replica.SetState("succeeded")
+	g.Expect(targetClient.Update(context.TODO(), replica)).To(gomega.Succeed())
+	instance = reconcile()
+	g.Expect(instance.GetState()).To(gomega.Equal("in progress"))
+	g.Expect(instance.Status.Description).To(gomega.BeEmpty())
+
+	// Status of the replica is copied once the operation is observed
+	replica.Status.ObservedGeneration = 6
+	replica.Status.Description = "updated"
+	replica.SetLabels(nil)
+	g.Expect(targetClient.Update(context.TODO(), replica)).To(gomega.Succeed())
+	instance = reconcile()
+	g.Expect(instance.GetState()).To(gomega.Equal("succeeded"))
+	g.Expect(instance.Status.Description).To(gomega.Equal("updated"))
+	g.Expect(instance.Status.Resources).To(gomega.HaveLen(1))
+	g.Expect(instance.GetLabels()).To(gomega.HaveKeyWithValue("owner", "master"))
+	g.Expect(instance.GetLabels()).To(gomega.HaveKeyWithValue(constants.LastOperationKey, "update"))
+}
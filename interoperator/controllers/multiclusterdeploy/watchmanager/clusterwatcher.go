@@ -2,20 +2,64 @@ package watchmanager
 
 import (
 	"context"
+	"time"
 
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/client/clientset/versioned"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 )
 
+var (
+	watchHealthMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "watch_healthy",
+			Namespace: "interoperator",
+			Subsystem: "cluster",
+			Help:      "State of the watch on a resource of the cluster. 0 - failing, 1 - healthy",
+		},
+		[]string{
+			// Which cluster?
+			"cluster",
+			// Which resource?
+			"resource",
+		},
+	)
+	watchErrorsMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "watch_errors_total",
+			Namespace: "interoperator",
+			Subsystem: "cluster",
+			Help:      "Number of failed list and watch calls on a resource of the cluster",
+		},
+		[]string{
+			// Which cluster?
+			"cluster",
+			// Which resource?
+			"resource",
+		},
+	)
+)
+
+// watchedResources are the resources watched on each cluster
+var watchedResources = []string{"sfserviceinstances", "sfservicebindings", "sfclusters"}
+
 type clusterWatcher struct {
 	clusterID      string
 	cfg            *rest.Config
 	timeoutSeconds int64
+	resyncPeriod   time.Duration
+	// version of the credentials in cfg
+	version string
 
 	instanceEvents chan event.GenericEvent
 	bindingEvents  chan event.GenericEvent
@@ -25,14 +69,18 @@ type clusterWatcher struct {
 	stop chan struct{}
 }
 
+// start runs an informer for each of the watched resources of the cluster.
+// The informers resume watching from the last seen resourceVersion, relist
+// with backoff on failures and resync all the objects every resyncPeriod.
+// It fails if the resources of the cluster can not be listed.
 func (cw *clusterWatcher) start() error {
 	ctx := context.Background()
-	opts := metav1.ListOptions{}
 	if cw.timeoutSeconds == 0 {
 		cw.timeoutSeconds = constants.MultiClusterWatchTimeout
 	}
-
-	opts.TimeoutSeconds = &cw.timeoutSeconds
+	if cw.resyncPeriod == 0 {
+		cw.resyncPeriod = constants.MultiClusterWatchResyncPeriod
+	}
 
 	clientset, err := versioned.NewForConfig(cw.cfg)
 	if err != nil {
@@ -44,110 +92,133 @@ func (cw *clusterWatcher) start() error {
 	bindingClient := clientset.OsbV1alpha1().SFServiceBindings("")
 	clusterClient := clientset.ResourceV1alpha1().SFClusters(constants.InteroperatorNamespace)
 
-	instanceWatch, err := instanceClient.Watch(ctx, opts)
-	if err != nil {
-		log.Error(err, "failed to establish watch for sfserviceinstance",
-			"clusterID", cw.clusterID)
-		return err
+	informers := []struct {
+		resource string
+		lw       *cache.ListWatch
+		object   runtime.Object
+		events   chan<- event.GenericEvent
+	}{
+		{
+			resource: "sfserviceinstances",
+			lw: &cache.ListWatch{
+				ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+					return instanceClient.List(ctx, options)
+				},
+				WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+					return instanceClient.Watch(ctx, options)
+				},
+			},
+			object: &osbv1alpha1.SFServiceInstance{},
+			events: cw.instanceEvents,
+		},
+		{
+			resource: "sfservicebindings",
+			lw: &cache.ListWatch{
+				ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+					return bindingClient.List(ctx, options)
+				},
+				WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+					return bindingClient.Watch(ctx, options)
+				},
+			},
+			object: &osbv1alpha1.SFServiceBinding{},
+			events: cw.bindingEvents,
+		},
+		{
+			resource: "sfclusters",
+			lw: &cache.ListWatch{
+				ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+					return clusterClient.List(ctx, options)
+				},
+				WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+					return clusterClient.Watch(ctx, options)
+				},
+			},
+			object: &resourcev1alpha1.SFCluster{},
+			events: cw.clusterEvents,
+		},
 	}
 
-	bindingWatch, err := bindingClient.Watch(ctx, opts)
-	if err != nil {
-		log.Error(err, "failed to establish watch for sfservicebinding",
-			"clusterID", cw.clusterID)
-		return err
+	// Fail early if the cluster is not reachable or the resources can not be
+	// listed. Later failures are retried by the informers.
+	for _, i := range informers {
+		_, err := i.lw.List(metav1.ListOptions{Limit: 1})
+		cw.observe(i.resource, err)
+		if err != nil {
+			log.Error(err, "failed to list "+i.resource, "clusterID", cw.clusterID)
+			return err
+		}
 	}
 
-	clusterWatch, err := clusterClient.Watch(ctx, opts)
-	if err != nil {
-		log.Error(err, "failed to establish watch for sfcluster", "clusterID", cw.clusterID)
-		return err
+	for _, i := range informers {
+		informer := cache.NewSharedIndexInformer(cw.instrument(i.resource, i.lw), i.object,
+			cw.resyncPeriod, cache.Indexers{})
+		informer.AddEventHandler(cw.eventHandler(i.resource, i.events))
+		go informer.Run(cw.stop)
 	}
+	log.Info("informers started", "clusterID", cw.clusterID)
+	return nil
+}
 
-	log.Info("watch channels created", "clusterID", cw.clusterID)
-	go func() {
-		for {
-			select {
-			case instanceEvent, ok := <-instanceWatch.ResultChan():
-				if !ok {
-					instanceWatch, err = instanceClient.Watch(ctx, opts)
-					if err != nil {
-						log.Error(err, "failed to re-establish watch for sfserviceinstance", "clusterID", cw.clusterID)
-						_ = RemoveCluster(cw.clusterID)
-						return
-					}
-					log.V(1).Info("watch refreshed for sfserviceinstance", "clusterID", cw.clusterID)
-				}
-				if instanceEvent.Object == nil {
-					continue
-				}
-				metaObject, err := meta.Accessor(instanceEvent.Object)
-				if err != nil {
-					log.Error(err, "failed to process watch event for sfserviceinstance", "clusterID",
-						cw.clusterID, "instanceEvent", instanceEvent)
-					continue
-				}
-				cw.instanceEvents <- event.GenericEvent{
-					Meta:   metaObject,
-					Object: instanceEvent.Object,
-				}
-			case bindingEvent, ok := <-bindingWatch.ResultChan():
-				if !ok {
-					bindingWatch, err = bindingClient.Watch(ctx, opts)
-					if err != nil {
-						log.Error(err, "failed to re-establish watch for sfservicebinding", "clusterID", cw.clusterID)
-						_ = RemoveCluster(cw.clusterID)
-						return
-					}
-					log.V(1).Info("watch refreshed for sfservicebinding", "clusterID", cw.clusterID)
-				}
-				if bindingEvent.Object == nil {
-					continue
-				}
-				metaObject, err := meta.Accessor(bindingEvent.Object)
-				if err != nil {
-					log.Error(err, "failed to process watch event for sfservicebinding", "clusterID",
-						cw.clusterID, "bindingEvent", bindingEvent)
-					continue
-				}
-				cw.bindingEvents <- event.GenericEvent{
-					Meta:   metaObject,
-					Object: bindingEvent.Object,
-				}
-			case clusterEvent, ok := <-clusterWatch.ResultChan():
-				if !ok {
-					clusterWatch, err = clusterClient.Watch(ctx, opts)
-					if err != nil {
-						log.Error(err, "failed to re-establish watch for sfcluster", "clusterID", cw.clusterID)
-						_ = RemoveCluster(cw.clusterID)
-						return
-					}
-					log.V(1).Info("watch refreshed for sfcluster", "clusterID", cw.clusterID)
-				}
-				if clusterEvent.Object == nil {
-					continue
-				}
-				metaObject, err := meta.Accessor(clusterEvent.Object)
-				if err != nil {
-					log.Error(err, "failed to process watch event for sfcluster", "clusterID",
-						cw.clusterID, "clusterEvent", clusterEvent)
-					continue
-				}
-				cw.clusterEvents <- event.GenericEvent{
-					Meta:   metaObject,
-					Object: clusterEvent.Object,
-				}
-			case _, ok := <-cw.stop:
-				if !ok {
-					log.V(1).Info("stop called for cluster watch. forcefully closing", "clusterID",
-						cw.clusterID)
-					instanceWatch.Stop()
-					bindingWatch.Stop()
-					clusterWatch.Stop()
-					return
-				}
+// instrument records the outcome of the list and watch calls of lw in the
+// watch health metrics. It also sets the timeout of the watch calls.
+func (cw *clusterWatcher) instrument(resource string, lw *cache.ListWatch) *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			obj, err := lw.ListFunc(options)
+			cw.observe(resource, err)
+			return obj, err
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.TimeoutSeconds = &cw.timeoutSeconds
+			w, err := lw.WatchFunc(options)
+			cw.observe(resource, err)
+			if err == nil {
+				log.V(1).Info("watch refreshed for "+resource, "clusterID", cw.clusterID,
+					"resourceVersion", options.ResourceVersion)
 			}
+			return w, err
+		},
+	}
+}
+
+func (cw *clusterWatcher) observe(resource string, err error) {
+	if err != nil {
+		log.Error(err, "list or watch failed for "+resource, "clusterID", cw.clusterID)
+		watchErrorsMetric.WithLabelValues(cw.clusterID, resource).Inc()
+		watchHealthMetric.WithLabelValues(cw.clusterID, resource).Set(0)
+		return
+	}
+	watchHealthMetric.WithLabelValues(cw.clusterID, resource).Set(1)
+}
+
+// eventHandler forwards the add, update and delete events of the informer
+// of resource to events
+func (cw *clusterWatcher) eventHandler(resource string, events chan<- event.GenericEvent) cache.ResourceEventHandler {
+	send := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
 		}
-	}()
-	return nil
+		object, ok := obj.(runtime.Object)
+		if !ok {
+			return
+		}
+		metaObject, err := meta.Accessor(object)
+		if err != nil {
+			log.Error(err, "failed to process watch event for "+resource, "clusterID",
+				cw.clusterID, "object", obj)
+			return
+		}
+		events <- event.GenericEvent{
+			Meta:   metaObject,
+			Object: object,
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: send,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			send(newObj)
+		},
+		DeleteFunc: send,
+	}
 }
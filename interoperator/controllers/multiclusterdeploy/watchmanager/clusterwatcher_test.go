@@ -2,11 +2,17 @@ package watchmanager
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 )
 
@@ -175,6 +181,83 @@ func Test_clusterWatcher_start(t *testing.T) {
 	}
 }
 
+func Test_clusterWatcher_instrument(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	cw := &clusterWatcher{
+		clusterID:      "instrumented",
+		timeoutSeconds: 3,
+	}
+	defer watchHealthMetric.DeleteLabelValues("instrumented", "sfserviceinstances")
+	defer watchErrorsMetric.DeleteLabelValues("instrumented", "sfserviceinstances")
+
+	var listErr, watchErr error
+	var watchOptions metav1.ListOptions
+	lw := cw.instrument("sfserviceinstances", &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return nil, listErr
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			watchOptions = options
+			return watch.NewFake(), watchErr
+		},
+	})
+	healthy := func() float64 {
+		return testutil.ToFloat64(watchHealthMetric.WithLabelValues("instrumented", "sfserviceinstances"))
+	}
+	errorCount := func() float64 {
+		return testutil.ToFloat64(watchErrorsMetric.WithLabelValues("instrumented", "sfserviceinstances"))
+	}
+
+	_, err := lw.List(metav1.ListOptions{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(healthy()).To(gomega.Equal(float64(1)))
+	g.Expect(errorCount()).To(gomega.BeZero())
+
+	watchErr = errors.New("connection refused")
+	_, err = lw.Watch(metav1.ListOptions{ResourceVersion: "10"})
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(watchOptions.ResourceVersion).To(gomega.Equal("10"))
+	g.Expect(*watchOptions.TimeoutSeconds).To(gomega.Equal(int64(3)))
+	g.Expect(healthy()).To(gomega.BeZero())
+	g.Expect(errorCount()).To(gomega.Equal(float64(1)))
+
+	watchErr = nil
+	_, err = lw.Watch(metav1.ListOptions{ResourceVersion: "10"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(healthy()).To(gomega.Equal(float64(1)))
+	g.Expect(errorCount()).To(gomega.Equal(float64(1)))
+}
+
+func Test_clusterWatcher_eventHandler(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	events := make(chan event.GenericEvent, 10)
+	cw := &clusterWatcher{
+		clusterID: "clusterID",
+	}
+	handler := cw.eventHandler("sfserviceinstances", events)
+
+	instance := _getDummyInstance()
+	handler.OnAdd(instance)
+	handler.OnUpdate(instance, instance)
+	handler.OnDelete(instance)
+	handler.OnDelete(cache.DeletedFinalStateUnknown{
+		Key: "default/instance-id",
+		Obj: instance,
+	})
+	handler.OnDelete(cache.DeletedFinalStateUnknown{
+		Key: "default/instance-id",
+	})
+
+	g.Expect(events).To(gomega.HaveLen(4))
+	for i := 0; i < 4; i++ {
+		e := <-events
+		g.Expect(e.Object).To(gomega.Equal(instance))
+		g.Expect(e.Meta.GetName()).To(gomega.Equal(instance.GetName()))
+	}
+}
+
 // drainAllEvents reads from the events channel until no new events comes
 // for remainingTime duration. Returns the number of events drained
 func drainAllEvents(events <-chan event.GenericEvent, remainingTime time.Duration) int {
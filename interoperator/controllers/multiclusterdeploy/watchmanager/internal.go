@@ -1,6 +1,8 @@
 package watchmanager
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"sync"
 
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
@@ -20,6 +22,7 @@ type watchManager struct {
 
 	clusterWatchers []*clusterWatcher
 	mux             sync.Mutex // Locking clusterWatchers array
+	opsMux          sync.Mutex // Serializes adding, refreshing and removing clusters
 
 	instanceEvents chan event.GenericEvent
 	bindingEvents  chan event.GenericEvent
@@ -51,15 +54,64 @@ func (wm *watchManager) getWatchChannel(resource string) (<-chan event.GenericEv
 }
 
 func (wm *watchManager) addCluster(clusterID string) error {
+	wm.opsMux.Lock()
+	defer wm.opsMux.Unlock()
 	if wm.isWatchingOnCluster(clusterID) {
 		// already watching on cluster
 		log.Info("Already watching on cluster", "clusterID", clusterID)
 		return nil
 	}
+	cfg, err := wm.getClusterConfig(clusterID)
+	if err != nil {
+		return err
+	}
+	return wm.startClusterWatcher(clusterID, cfg)
+}
+
+// refreshCluster restarts the watcher of the cluster if the credentials in
+// the kubeconfig of the cluster have changed. The new watcher is started
+// before the old one is stopped, so the old watcher is kept if it fails.
+func (wm *watchManager) refreshCluster(clusterID string) error {
+	wm.opsMux.Lock()
+	defer wm.opsMux.Unlock()
+	cw := wm.getClusterWatcher(clusterID)
+	if cw == nil {
+		// not watching on cluster
+		return nil
+	}
+	cfg, err := wm.getClusterConfig(clusterID)
+	if err != nil {
+		return err
+	}
+	if getConfigVersion(cfg) == cw.version {
+		return nil
+	}
+	log.Info("Kubeconfig of cluster changed. Restarting cluster watcher", "clusterID", clusterID)
+	newCw, err := wm.newClusterWatcher(clusterID, cfg)
+	if err != nil {
+		return err
+	}
+
+	wm.mux.Lock()
+	defer wm.mux.Unlock()
+	for i := range wm.clusterWatchers {
+		if wm.clusterWatchers[i] == cw {
+			wm.clusterWatchers[i] = newCw
+			close(cw.stop)
+			log.Info("Restarted cluster watcher", "clusterID", clusterID)
+			return nil
+		}
+	}
+	// Not expected as removeCluster is serialized with refreshCluster
+	close(newCw.stop)
+	return nil
+}
+
+func (wm *watchManager) getClusterConfig(clusterID string) (*rest.Config, error) {
 	cluster, err := wm.clusterRegistry.GetCluster(clusterID)
 	if err != nil {
 		log.Error(err, "unable to fetch sfcluster", "clusterID", clusterID)
-		return err
+		return nil, err
 	}
 
 	var cfg *rest.Config
@@ -75,39 +127,58 @@ func (wm *watchManager) addCluster(clusterID string) error {
 	}
 	if err != nil {
 		log.Error(err, "unable to get sfcluster config", "clusterID", clusterID)
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (wm *watchManager) startClusterWatcher(clusterID string, cfg *rest.Config) error {
+	cw, err := wm.newClusterWatcher(clusterID, cfg)
+	if err != nil {
 		return err
 	}
 
+	wm.mux.Lock()
+	defer wm.mux.Unlock()
+	wm.clusterWatchers = append(wm.clusterWatchers, cw)
+	log.Info("Added cluster to watch manager", "clusterID", clusterID)
+	return nil
+}
+
+// newClusterWatcher creates and starts a watcher on the cluster
+func (wm *watchManager) newClusterWatcher(clusterID string, cfg *rest.Config) (*clusterWatcher, error) {
 	stopCh := make(chan struct{})
 
 	cw := &clusterWatcher{
 		clusterID:      clusterID,
 		cfg:            cfg,
+		version:        getConfigVersion(cfg),
 		instanceEvents: wm.instanceEvents,
 		bindingEvents:  wm.bindingEvents,
 		clusterEvents:  wm.clusterEvents,
 		stop:           stopCh,
 	}
-	err = cw.start()
+	err := cw.start()
 	if err != nil {
 		log.Error(err, "unable to start cluster watcher", "clusterID", clusterID)
-		return err
+		return nil, err
 	}
-
-	wm.mux.Lock()
-	defer wm.mux.Unlock()
-	wm.clusterWatchers = append(wm.clusterWatchers, cw)
-	log.Info("Added cluster to watch manager", "clusterID", clusterID)
-	return nil
+	return cw, nil
 }
 
 func (wm *watchManager) removeCluster(clusterID string) {
+	wm.opsMux.Lock()
+	defer wm.opsMux.Unlock()
 	wm.mux.Lock()
 	defer wm.mux.Unlock()
 	l := len(wm.clusterWatchers)
 	for i, cw := range wm.clusterWatchers {
 		if cw.clusterID == clusterID {
 			close(cw.stop)
+			for _, resource := range watchedResources {
+				watchHealthMetric.DeleteLabelValues(clusterID, resource)
+				watchErrorsMetric.DeleteLabelValues(clusterID, resource)
+			}
 			wm.clusterWatchers[i] = wm.clusterWatchers[l-1]
 			wm.clusterWatchers = wm.clusterWatchers[:l-1]
 			log.Info("Removed cluster from watch manager", "clusterID", clusterID)
@@ -120,12 +191,35 @@ func (wm *watchManager) removeCluster(clusterID string) {
 }
 
 func (wm *watchManager) isWatchingOnCluster(clusterID string) bool {
+	return wm.getClusterWatcher(clusterID) != nil
+}
+
+func (wm *watchManager) getClusterWatcher(clusterID string) *clusterWatcher {
 	wm.mux.Lock()
 	defer wm.mux.Unlock()
 	for _, cw := range wm.clusterWatchers {
 		if cw.clusterID == clusterID {
-			return true
+			return cw
 		}
 	}
-	return false
+	return nil
+}
+
+// getConfigVersion returns a hash of the server and the credentials in cfg
+func getConfigVersion(cfg *rest.Config) string {
+	hash := sha256.New()
+	for _, value := range [][]byte{
+		[]byte(cfg.Host),
+		[]byte(cfg.BearerToken),
+		[]byte(cfg.BearerTokenFile),
+		[]byte(cfg.Username),
+		[]byte(cfg.Password),
+		cfg.TLSClientConfig.CertData,
+		cfg.TLSClientConfig.KeyData,
+		cfg.TLSClientConfig.CAData,
+	} {
+		hash.Write(value)
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
 }
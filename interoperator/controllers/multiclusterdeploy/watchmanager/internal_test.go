@@ -13,6 +13,7 @@ import (
 
 	gomock "github.com/golang/mock/gomock"
 	"github.com/onsi/gomega"
+	"k8s.io/client-go/rest"
 	kubernetes "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 )
@@ -257,6 +258,85 @@ func Test_watchManager_addCluster(t *testing.T) {
 	}
 }
 
+func Test_watchManager_refreshCluster(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	setupClients(g)
+	setupCfgManager(g)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClusterRegistry := mock_clusterRegistry.NewMockClusterRegistry(ctrl)
+	mockCluster := mock_v1alpha1.NewMockSFClusterInterface(ctrl)
+	mockClusterRegistry.EXPECT().GetCluster("bar").Return(mockCluster, nil).AnyTimes()
+
+	wm := &watchManager{
+		defaultCluster:  c1,
+		clusterRegistry: mockClusterRegistry,
+		clusterWatchers: []*clusterWatcher{},
+		cfgManager:      cfgManager,
+	}
+
+	// Not watching on cluster
+	g.Expect(wm.refreshCluster("foo")).To(gomega.Succeed())
+
+	mockCluster.EXPECT().GetKubeConfig(c1).Return(cfg2, nil).Times(1)
+	g.Expect(wm.addCluster("bar")).To(gomega.Succeed())
+	cw := wm.getClusterWatcher("bar")
+	g.Expect(cw).NotTo(gomega.BeNil())
+	defer func() {
+		wm.removeCluster("bar")
+	}()
+
+	// Kubeconfig not changed
+	mockCluster.EXPECT().GetKubeConfig(c1).Return(cfg2, nil).Times(1)
+	g.Expect(wm.refreshCluster("bar")).To(gomega.Succeed())
+	g.Expect(wm.getClusterWatcher("bar")).To(gomega.BeIdenticalTo(cw))
+
+	// Kubeconfig changed
+	rotated := rest.CopyConfig(cfg2)
+	rotated.BearerToken = "rotated"
+	mockCluster.EXPECT().GetKubeConfig(c1).Return(rotated, nil).Times(1)
+	g.Expect(wm.refreshCluster("bar")).To(gomega.Succeed())
+	g.Expect(wm.clusterWatchers).To(gomega.HaveLen(1))
+	g.Expect(wm.getClusterWatcher("bar")).NotTo(gomega.BeIdenticalTo(cw))
+	g.Expect(wm.getClusterWatcher("bar").version).To(gomega.Equal(getConfigVersion(rotated)))
+
+	// Failure to read the kubeconfig keeps the watch
+	mockCluster.EXPECT().GetKubeConfig(c1).Return(nil, fmt.Errorf("bar")).Times(1)
+	g.Expect(wm.refreshCluster("bar")).NotTo(gomega.Succeed())
+	g.Expect(wm.clusterWatchers).To(gomega.HaveLen(1))
+
+	// Failure to start the new watcher keeps the old watch
+	cw = wm.getClusterWatcher("bar")
+	unreachable := rest.CopyConfig(cfg2)
+	unreachable.Host = "https://127.0.0.1:1"
+	mockCluster.EXPECT().GetKubeConfig(c1).Return(unreachable, nil).Times(1)
+	g.Expect(wm.refreshCluster("bar")).NotTo(gomega.Succeed())
+	g.Expect(wm.clusterWatchers).To(gomega.HaveLen(1))
+	g.Expect(wm.getClusterWatcher("bar")).To(gomega.BeIdenticalTo(cw))
+}
+
+func Test_getConfigVersion(t *testing.T) {
+	cfg := &rest.Config{
+		Host:        "https://10.0.0.1",
+		BearerToken: "token",
+	}
+	version := getConfigVersion(cfg)
+	if getConfigVersion(rest.CopyConfig(cfg)) != version {
+		t.Errorf("getConfigVersion() changed for same config")
+	}
+	cfg.BearerToken = "rotated"
+	if getConfigVersion(cfg) == version {
+		t.Errorf("getConfigVersion() not changed for rotated token")
+	}
+	cfg.BearerToken = "token"
+	cfg.TLSClientConfig.CertData = []byte("cert")
+	if getConfigVersion(cfg) == version {
+		t.Errorf("getConfigVersion() not changed for client certificate")
+	}
+}
+
 func Test_watchManager_removeCluster(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
 	//var ctrl *gomock.Controller
@@ -1,6 +1,8 @@
 package watchmanager
 
 import (
+	"sync"
+
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/cluster/registry"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
@@ -11,6 +13,7 @@ import (
 	kubernetes "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
 var log = logf.Log.WithName("watchmanager.mcd")
@@ -18,11 +21,14 @@ var log = logf.Log.WithName("watchmanager.mcd")
 // Manager is the Instance of watch managerObject
 var managerObject watchManagerInterface
 
+var registerMetrics sync.Once
+
 // watchManager manages multi cluster watch
 //go:generate mockgen -source manager.go -destination ./mock_manager.go -package watchmanager
 type watchManagerInterface interface {
 	getWatchChannel(resource string) (<-chan event.GenericEvent, error)
 	addCluster(clusterID string) error
+	refreshCluster(clusterID string) error
 	removeCluster(clusterID string)
 }
 
@@ -85,6 +91,10 @@ func Initialize(kubeConfig *rest.Config, scheme *runtime.Scheme, mapper meta.RES
 		stop:            stopCh,
 	}
 
+	registerMetrics.Do(func() {
+		metrics.Registry.MustRegister(watchHealthMetric, watchErrorsMetric)
+	})
+
 	managerObject = wm
 	log.Info("Watch Manager initialized")
 	return nil
@@ -113,3 +123,12 @@ func RemoveCluster(clusterID string) error {
 	go managerObject.removeCluster(clusterID)
 	return nil
 }
+
+// RefreshCluster restarts the watch on a cluster if its kubeconfig has
+// changed since the watch was started
+func RefreshCluster(clusterID string) error {
+	if managerObject == nil {
+		return errors.NewPreconditionError("RefreshCluster", "watch manager not setup", nil)
+	}
+	return managerObject.refreshCluster(clusterID)
+}
@@ -203,6 +203,58 @@ func TestAddCluster(t *testing.T) {
 	}
 }
 
+func TestRefreshCluster(t *testing.T) {
+	var ctrl *gomock.Controller
+	type args struct {
+		clusterID string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+		setup   func()
+		cleanup func()
+	}{
+		{
+			name: "should fail if manager is not setup",
+			args: args{
+				clusterID: "foo",
+			},
+			wantErr: true,
+		},
+		{
+			name: "should call manager refreshCluster",
+			args: args{
+				clusterID: "foo",
+			},
+			wantErr: false,
+			setup: func() {
+				ctrl = gomock.NewController(t)
+				mockwatchManager := NewMockwatchManagerInterface(ctrl)
+				managerObject = mockwatchManager
+				mockwatchManager.EXPECT().refreshCluster("foo").Return(nil).Times(1)
+			},
+			cleanup: func() {
+				managerObject = nil
+				defer ctrl.Finish()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.setup != nil {
+				tt.setup()
+			}
+			if tt.cleanup != nil {
+				defer tt.cleanup()
+			}
+			if err := RefreshCluster(tt.args.clusterID); (err != nil) != tt.wantErr {
+				t.Errorf("RefreshCluster() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestRemoveCluster(t *testing.T) {
 	var ctrl *gomock.Controller
 	type args struct {
@@ -62,6 +62,20 @@ func (mr *MockwatchManagerInterfaceMockRecorder) addCluster(clusterID interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "addCluster", reflect.TypeOf((*MockwatchManagerInterface)(nil).addCluster), clusterID)
 }
 
+// refreshCluster mocks base method
+func (m *MockwatchManagerInterface) refreshCluster(clusterID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "refreshCluster", clusterID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// refreshCluster indicates an expected call of refreshCluster
+func (mr *MockwatchManagerInterfaceMockRecorder) refreshCluster(clusterID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "refreshCluster", reflect.TypeOf((*MockwatchManagerInterface)(nil).refreshCluster), clusterID)
+}
+
 // removeCluster mocks base method
 func (m *MockwatchManagerInterface) removeCluster(clusterID string) {
 	m.ctrl.T.Helper()
@@ -84,14 +84,24 @@ func SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 
-	if err = (&sfclusterusage.Reconciler{
+	usageReconciler := &sfclusterusage.Reconciler{
 		Client: mgr.GetClient(),
 		Log:    ctrl.Log.WithName("scheduler-helper").WithName("sfclusterusage"),
 		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+	}
+	if err = usageReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "SFClusterUsageReconciler")
 		return err
 	}
 
+	if err = (&sfclusterusage.InstanceReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("scheduler-helper").WithName("sfserviceinstanceusage"),
+		Usage:  usageReconciler,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "SFServiceInstanceUsageReconciler")
+		return err
+	}
+
 	return nil
 }
@@ -0,0 +1,164 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfclusterusage
+
+import (
+	"context"
+	"os"
+	"sort"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// InstanceReconciler computes the resource usage of the SFServiceInstances
+// of the own cluster
+type InstanceReconciler struct {
+	client.Client
+	Log logr.Logger
+
+	// Usage provides the requests of the pods per namespace
+	Usage *Reconciler
+}
+
+// Reconcile writes the cpu and memory requests of the pods and the storage
+// requests of the persistent volume claims in the namespaces of the
+// instance and its resources to the instance status. The usage is
+// recomputed every InstanceUsageUpdateInterval.
+func (r *InstanceReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("sfserviceinstance", req.NamespacedName)
+
+	instance := &osbv1alpha1.SFServiceInstance{}
+	err := r.Get(ctx, req.NamespacedName, instance)
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			// Object not found, return.
+			return ctrl.Result{}, nil
+		}
+		// Error reading the object - requeue the request.
+		return ctrl.Result{}, err
+	}
+
+	clusterID, _ := instance.GetClusterID()
+	if clusterID != constants.OwnClusterID || !instance.GetDeletionTimestamp().IsZero() {
+		// Resources of the instance are only in the own cluster
+		return ctrl.Result{}, nil
+	}
+
+	usage, err := r.getInstanceUsage(ctx, instance)
+	if err != nil {
+		log.Error(err, "error while computing instance usage")
+		return ctrl.Result{}, err
+	}
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if resourcev1alpha1.ResourceListEqual(usage, instance.Status.Usage) {
+			return nil
+		}
+		log.V(1).Info("updating instance usage", "currentUsage", instance.Status.Usage, "newUsage", usage)
+		instance.Status.Usage = usage.DeepCopy()
+		err := r.Update(ctx, instance)
+		if err != nil {
+			if apiErrors.IsConflict(err) {
+				// Fetch the SFServiceInstance again
+				_ = r.Get(ctx, req.NamespacedName, instance)
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error(err, "failed to update instance usage")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: constants.InstanceUsageUpdateInterval}, nil
+}
+
+// getInstanceUsage sums the requests of the pods and the persistent volume
+// claims in the namespaces of the instance. The interoperator namespace is
+// shared and hence not included.
+func (r *InstanceReconciler) getInstanceUsage(ctx context.Context, instance *osbv1alpha1.SFServiceInstance) (corev1.ResourceList, error) {
+	usage := make(corev1.ResourceList)
+	for _, namespace := range getInstanceNamespaces(instance) {
+		requests := r.Usage.NamespaceUsage(namespace)
+		for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			if quantity, ok := requests[name]; ok {
+				resourcev1alpha1.ResourceListAdd(usage, corev1.ResourceList{name: quantity})
+			}
+		}
+
+		pvcs := &corev1.PersistentVolumeClaimList{}
+		for more := true; more; more = (pvcs.Continue != "") {
+			err := r.List(ctx, pvcs, client.InNamespace(namespace), client.Limit(constants.ListPaginationLimit),
+				client.Continue(pvcs.Continue))
+			if err != nil {
+				return nil, err
+			}
+			for _, pvc := range pvcs.Items {
+				if quantity, ok := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+					resourcev1alpha1.ResourceListAdd(usage, corev1.ResourceList{corev1.ResourceStorage: quantity})
+				}
+			}
+		}
+	}
+	return usage, nil
+}
+
+func getInstanceNamespaces(instance *osbv1alpha1.SFServiceInstance) []string {
+	namespaces := map[string]bool{
+		instance.GetNamespace(): true,
+	}
+	for _, resource := range instance.Status.Resources {
+		if resource.Namespace != "" {
+			namespaces[resource.Namespace] = true
+		}
+	}
+	delete(namespaces, constants.InteroperatorNamespace)
+
+	result := make([]string, 0, len(namespaces))
+	for namespace := range namespaces {
+		result = append(result, namespace)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// SetupWithManager registers the SFServiceInstance Usage controller with
+// manager and setups the watches.
+func (r *InstanceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Do not start the controller if it is not a k8s deployment
+	// When it is a k8s deploymen, POD_NAMESPACE env is set
+	_, ok := os.LookupEnv(constants.NamespaceEnvKey)
+	if !ok {
+		return nil
+	}
+
+	builder := ctrl.NewControllerManagedBy(mgr).
+		Named("scheduler_helper_sfserviceinstanceusage").
+		For(&osbv1alpha1.SFServiceInstance{})
+
+	return builder.Complete(r)
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfclusterusage
+
+import (
+	"context"
+	"testing"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestInstanceReconciler_Reconcile(t *testing.T) {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := osbv1alpha1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	key := types.NamespacedName{Name: "inst1", Namespace: "sf-inst1"}
+	instance := &osbv1alpha1.SFServiceInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      key.Name,
+			Namespace: key.Namespace,
+		},
+		Spec: osbv1alpha1.SFServiceInstanceSpec{
+			ClusterID: constants.OwnClusterID,
+		},
+		Status: osbv1alpha1.SFServiceInstanceStatus{
+			State: "succeeded",
+			Resources: []osbv1alpha1.Source{
+				{Kind: "StatefulSet", Name: "inst1", Namespace: "sf-inst1"},
+				{Kind: "StatefulSet", Name: "inst1-data", Namespace: "sf-inst1-data"},
+				{Kind: "ConfigMap", Name: "inst1", Namespace: constants.InteroperatorNamespace},
+			},
+		},
+	}
+	other := instance.DeepCopy()
+	other.SetName("inst2")
+	other.Spec.ClusterID = "2"
+	other.Status.Resources = nil
+
+	pvc1 := _getPVC("inst1", nil, "10Gi")
+	pvc2 := _getPVC("inst1-data", nil, "5Gi")
+	pvc3 := _getPVC("shared", nil, "100Gi")
+	pvc3.SetNamespace(constants.InteroperatorNamespace)
+
+	usage := &Reconciler{tally: newUsageTally()}
+	pod := _getTallyPod("pod1", "sf-inst1", 1)
+	pod.Spec.Containers[0].Resources.Requests[corev1.ResourceMemory] = resource.MustParse("1Gi")
+	usage.tally.setPod(pod)
+	usage.tally.setPod(_getTallyPod("pod2", "sf-inst1-data", 2))
+	usage.tally.setPod(_getTallyPod("pod3", constants.InteroperatorNamespace, 4))
+
+	c := fake.NewFakeClientWithScheme(s, instance, other, pvc1, pvc2, pvc3)
+	r := &InstanceReconciler{
+		Client: c,
+		Log:    ctrl.Log.WithName("scheduler-helper").WithName("sfserviceinstanceusage"),
+		Usage:  usage,
+	}
+
+	result, err := r.Reconcile(ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if result.RequeueAfter != constants.InstanceUsageUpdateInterval {
+		t.Errorf("Reconcile() RequeueAfter = %v, want %v", result.RequeueAfter, constants.InstanceUsageUpdateInterval)
+	}
+
+	got := &osbv1alpha1.SFServiceInstance{}
+	if err := c.Get(context.TODO(), key, got); err != nil {
+		t.Fatal(err)
+	}
+	want := corev1.ResourceList{
+		corev1.ResourceCPU:     resource.MustParse("3"),
+		corev1.ResourceMemory:  resource.MustParse("1Gi"),
+		corev1.ResourceStorage: resource.MustParse("15Gi"),
+	}
+	if !resourcev1alpha1.ResourceListEqual(got.Status.Usage, want) {
+		t.Errorf("Status.Usage = %v, want %v", got.Status.Usage, want)
+	}
+
+	// Instances of other clusters are ignored
+	otherKey := types.NamespacedName{Name: "inst2", Namespace: "sf-inst1"}
+	if _, err := r.Reconcile(ctrl.Request{NamespacedName: otherKey}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	got = &osbv1alpha1.SFServiceInstance{}
+	if err := c.Get(context.TODO(), otherKey, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status.Usage != nil {
+		t.Errorf("Status.Usage = %v, want nil", got.Status.Usage)
+	}
+}
@@ -19,6 +19,7 @@ package sfclusterusage
 import (
 	"context"
 	"os"
+	"time"
 
 	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
@@ -30,8 +31,11 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlbuilder "sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
@@ -42,10 +46,14 @@ type Reconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+
+	tally      *usageTally
+	lastUpdate time.Time
 }
 
-// Reconcile iterates through all nodes and computes requested resources
-// and update it in sfcluster status
+// Reconcile writes the capacity and requests tallied from the node and pod
+// events and the storage of the cluster to the sfcluster status. The status
+// is updated at most once every ClusterUsageUpdateInterval.
 func (r *Reconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
 	log := r.Log.WithValues("SFCluster", req.NamespacedName)
@@ -67,46 +75,33 @@ func (r *Reconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		return ctrl.Result{}, nil
 	}
 
-	nodes := &corev1.NodeList{}
-	currentCapacity := make(corev1.ResourceList)
-	// TODO: Verify pagination works
-	for more := true; more; more = (nodes.Continue != "") {
-		err = r.List(ctx, nodes, client.Limit(constants.ListPaginationLimit), client.Continue(nodes.Continue))
-		if err != nil {
-			log.Error(err, "error while fetching nodes")
-			return ctrl.Result{}, err
-		}
-		for _, node := range nodes.Items {
-			// Allocatable is the capacity after kubelet
-			resourcev1alpha1.ResourceListAdd(currentCapacity, node.Status.Allocatable)
-		}
+	if wait := time.Until(r.lastUpdate.Add(constants.ClusterUsageUpdateInterval)); wait > 0 {
+		// Bound the rate of status updates. The changes till then are
+		// written together.
+		return ctrl.Result{RequeueAfter: wait}, nil
 	}
 
-	requests := make(corev1.ResourceList)
-	pods := &corev1.PodList{}
+	currentCapacity, requests := r.tally.clusterUsage()
 
-	// TODO: Verify pagination works
-	for more := true; more; more = (pods.Continue != "") {
-		err = r.List(ctx, pods, client.Limit(constants.ListPaginationLimit), client.Continue(pods.Continue))
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		storage, err := r.getStorageUsage(ctx, cluster)
 		if err != nil {
-			log.Error(err, "error while fetching pods")
-			return ctrl.Result{}, err
-		}
-		for _, pod := range pods.Items {
-			resourcev1alpha1.ResourceListAdd(requests, getResourceRequest(&pod))
+			log.Error(err, "error while computing storage usage")
+			return err
 		}
-	}
 
-	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
 		if !resourcev1alpha1.ResourceListEqual(requests, cluster.Status.Requests) ||
 			!resourcev1alpha1.ResourceListEqual(currentCapacity, cluster.Status.CurrentCapacity) ||
-			!resourcev1alpha1.ResourceListEqual(cluster.Spec.TotalCapacity, cluster.Status.TotalCapacity) {
+			!resourcev1alpha1.ResourceListEqual(cluster.Spec.TotalCapacity, cluster.Status.TotalCapacity) ||
+			!resourcev1alpha1.StorageEqual(storage, cluster.Status.Storage) {
 
 			log.Info("updating cluster status", "currentRequests", cluster.Status.Requests, "newRequests",
-				requests, "currentCapacity", cluster.Status.CurrentCapacity, "newCapacity", currentCapacity)
+				requests, "currentCapacity", cluster.Status.CurrentCapacity, "newCapacity", currentCapacity,
+				"currentStorage", cluster.Status.Storage, "newStorage", storage)
 			cluster.Status.Requests = requests.DeepCopy()
 			cluster.Status.CurrentCapacity = currentCapacity.DeepCopy()
 			cluster.Status.TotalCapacity = cluster.Spec.TotalCapacity.DeepCopy()
+			cluster.Status.Storage = storage
 			err = r.Status().Update(ctx, cluster)
 			if err != nil {
 				if apiErrors.IsConflict(err) {
@@ -116,6 +111,7 @@ func (r *Reconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 				return err
 			}
 			log.Info("updated cluster status")
+			r.lastUpdate = time.Now()
 		}
 		return nil
 	})
@@ -136,25 +132,89 @@ func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return nil
 	}
 
+	r.tally = newUsageTally()
+
 	watchMapper := &handler.EnqueueRequestsFromMapFunc{
 		ToRequests: handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
-			return []reconcile.Request{
-				{NamespacedName: types.NamespacedName{
-					Name:      constants.OwnClusterID,
-					Namespace: constants.InteroperatorNamespace,
-				}},
-			}
+			return []reconcile.Request{ownClusterRequest()}
 		}),
 	}
 	builder := ctrl.NewControllerManagedBy(mgr).
 		Named("scheduler_helper_sfclusterusage").
-		For(&resourcev1alpha1.SFCluster{}).
-		Watches(&source.Kind{Type: &corev1.Node{}}, watchMapper).
-		WithEventFilter(watches.NamespaceFilter())
+		For(&resourcev1alpha1.SFCluster{}, ctrlbuilder.WithPredicates(watches.NamespaceFilter())).
+		Watches(&source.Kind{Type: &corev1.Node{}}, r.nodeHandler()).
+		Watches(&source.Kind{Type: &corev1.Pod{}}, r.podHandler()).
+		Watches(&source.Kind{Type: &corev1.PersistentVolume{}}, watchMapper)
 
 	return builder.Complete(r)
 }
 
+// NamespaceUsage returns the resources requested by the pods in the
+// namespace, for example the namespace of a service instance. It returns
+// nil if there are no pods in the namespace.
+func (r *Reconciler) NamespaceUsage(namespace string) corev1.ResourceList {
+	if r.tally == nil {
+		return nil
+	}
+	return r.tally.namespaceUsage(namespace)
+}
+
+// nodeHandler updates the tally on node events and enqueues the own cluster
+func (r *Reconciler) nodeHandler() handler.EventHandler {
+	return handler.Funcs{
+		CreateFunc: func(e event.CreateEvent, q workqueue.RateLimitingInterface) {
+			if node, ok := e.Object.(*corev1.Node); ok {
+				r.tally.setNode(node)
+				q.Add(ownClusterRequest())
+			}
+		},
+		UpdateFunc: func(e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+			if node, ok := e.ObjectNew.(*corev1.Node); ok {
+				r.tally.setNode(node)
+				q.Add(ownClusterRequest())
+			}
+		},
+		DeleteFunc: func(e event.DeleteEvent, q workqueue.RateLimitingInterface) {
+			r.tally.deleteNode(e.Meta.GetName())
+			q.Add(ownClusterRequest())
+		},
+	}
+}
+
+// podHandler updates the tally on pod events and enqueues the own cluster
+func (r *Reconciler) podHandler() handler.EventHandler {
+	return handler.Funcs{
+		CreateFunc: func(e event.CreateEvent, q workqueue.RateLimitingInterface) {
+			if pod, ok := e.Object.(*corev1.Pod); ok {
+				r.tally.setPod(pod)
+				q.Add(ownClusterRequest())
+			}
+		},
+		UpdateFunc: func(e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+			if pod, ok := e.ObjectNew.(*corev1.Pod); ok {
+				r.tally.setPod(pod)
+				q.Add(ownClusterRequest())
+			}
+		},
+		DeleteFunc: func(e event.DeleteEvent, q workqueue.RateLimitingInterface) {
+			r.tally.deletePod(types.NamespacedName{
+				Name:      e.Meta.GetName(),
+				Namespace: e.Meta.GetNamespace(),
+			})
+			q.Add(ownClusterRequest())
+		},
+	}
+}
+
+func ownClusterRequest() reconcile.Request {
+	return reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      constants.OwnClusterID,
+			Namespace: constants.InteroperatorNamespace,
+		},
+	}
+}
+
 func getResourceRequest(pod *corev1.Pod) corev1.ResourceList {
 	resources := make(corev1.ResourceList)
 	for _, container := range pod.Spec.Containers {
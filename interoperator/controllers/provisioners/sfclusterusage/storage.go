@@ -0,0 +1,121 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfclusterusage
+
+import (
+	"context"
+	"sort"
+
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// defaultStorageClassKey is the annotation marking the default storage class
+const defaultStorageClassKey = "storageclass.kubernetes.io/is-default-class"
+
+// getStorageUsage computes the capacity of the persistent volumes and the
+// requests of the persistent volume claims per storage class. Claims without
+// a storage class use the default storage class. The declared
+// TotalStorageCapacity of the cluster is added for each storage class.
+func (r *Reconciler) getStorageUsage(ctx context.Context, cluster *resourcev1alpha1.SFCluster) ([]resourcev1alpha1.StorageClassUsage, error) {
+	usage := make(map[string]*resourcev1alpha1.StorageClassUsage)
+	getUsage := func(storageClassName string) *resourcev1alpha1.StorageClassUsage {
+		u, ok := usage[storageClassName]
+		if !ok {
+			u = &resourcev1alpha1.StorageClassUsage{
+				StorageClassName: storageClassName,
+			}
+			usage[storageClassName] = u
+		}
+		return u
+	}
+
+	defaultStorageClass, err := r.getDefaultStorageClass(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pvs := &corev1.PersistentVolumeList{}
+	for more := true; more; more = (pvs.Continue != "") {
+		err = r.List(ctx, pvs, client.Limit(constants.ListPaginationLimit), client.Continue(pvs.Continue))
+		if err != nil {
+			return nil, err
+		}
+		for _, pv := range pvs.Items {
+			if pv.Spec.StorageClassName == "" {
+				continue
+			}
+			if quantity, ok := pv.Spec.Capacity[corev1.ResourceStorage]; ok {
+				getUsage(pv.Spec.StorageClassName).Capacity.Add(quantity)
+			}
+		}
+	}
+
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	for more := true; more; more = (pvcs.Continue != "") {
+		err = r.List(ctx, pvcs, client.Limit(constants.ListPaginationLimit), client.Continue(pvcs.Continue))
+		if err != nil {
+			return nil, err
+		}
+		for _, pvc := range pvcs.Items {
+			storageClassName := defaultStorageClass
+			if pvc.Spec.StorageClassName != nil {
+				storageClassName = *pvc.Spec.StorageClassName
+			}
+			if storageClassName == "" {
+				continue
+			}
+			if quantity, ok := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+				getUsage(storageClassName).Requests.Add(quantity)
+			}
+		}
+	}
+
+	for storageClassName, quantity := range cluster.Spec.TotalStorageCapacity {
+		totalCapacity := quantity.DeepCopy()
+		getUsage(storageClassName).TotalCapacity = &totalCapacity
+	}
+
+	storage := make([]resourcev1alpha1.StorageClassUsage, 0, len(usage))
+	for _, u := range usage {
+		storage = append(storage, *u)
+	}
+	sort.Slice(storage, func(i, j int) bool {
+		return storage[i].StorageClassName < storage[j].StorageClassName
+	})
+	return storage, nil
+}
+
+// getDefaultStorageClass returns the name of the default storage class
+// or empty string if there is none
+func (r *Reconciler) getDefaultStorageClass(ctx context.Context) (string, error) {
+	storageClasses := &storagev1.StorageClassList{}
+	err := r.List(ctx, storageClasses)
+	if err != nil {
+		return "", err
+	}
+	for _, storageClass := range storageClasses.Items {
+		if storageClass.GetAnnotations()[defaultStorageClassKey] == "true" {
+			return storageClass.GetName(), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfclusterusage
+
+import (
+	"context"
+	"testing"
+
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func _getPV(name, storageClassName, capacity string) *corev1.PersistentVolume {
+	return &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: corev1.PersistentVolumeSpec{
+			StorageClassName: storageClassName,
+			Capacity: corev1.ResourceList{
+				corev1.ResourceStorage: resource.MustParse(capacity),
+			},
+		},
+	}
+}
+
+func _getPVC(name string, storageClassName *string, request string) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "sf-" + name,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			StorageClassName: storageClassName,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: resource.MustParse(request),
+				},
+			},
+		},
+	}
+}
+
+func TestReconciler_getStorageUsage(t *testing.T) {
+	standard := "standard"
+	premium := "premium"
+	none := ""
+	defaultClass := &storagev1.StorageClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: standard,
+			Annotations: map[string]string{
+				defaultStorageClassKey: "true",
+			},
+		},
+	}
+	r := &Reconciler{
+		Client: fake.NewFakeClientWithScheme(scheme.Scheme,
+			defaultClass,
+			_getPV("pv1", standard, "10Gi"),
+			_getPV("pv2", standard, "20Gi"),
+			_getPV("pv3", premium, "5Gi"),
+			_getPV("pv4", "", "100Gi"),
+			_getPVC("pvc1", nil, "10Gi"),
+			_getPVC("pvc2", &standard, "15Gi"),
+			_getPVC("pvc3", &premium, "5Gi"),
+			_getPVC("pvc4", &none, "100Gi"),
+		),
+	}
+	cluster := _getDummySFCLuster("1")
+	cluster.Spec.TotalStorageCapacity = map[string]resource.Quantity{
+		premium: resource.MustParse("1Ti"),
+		"fast":  resource.MustParse("500Gi"),
+	}
+
+	got, err := r.getStorageUsage(context.TODO(), cluster)
+	if err != nil {
+		t.Fatalf("getStorageUsage() error = %v", err)
+	}
+
+	premiumTotal := resource.MustParse("1Ti")
+	fastTotal := resource.MustParse("500Gi")
+	want := []resourcev1alpha1.StorageClassUsage{
+		{
+			StorageClassName: "fast",
+			TotalCapacity:    &fastTotal,
+		},
+		{
+			StorageClassName: premium,
+			Capacity:         resource.MustParse("5Gi"),
+			TotalCapacity:    &premiumTotal,
+			Requests:         resource.MustParse("5Gi"),
+		},
+		{
+			StorageClassName: standard,
+			Capacity:         resource.MustParse("30Gi"),
+			Requests:         resource.MustParse("25Gi"),
+		},
+	}
+	if !resourcev1alpha1.StorageEqual(got, want) {
+		t.Errorf("getStorageUsage() = %v, want %v", got, want)
+	}
+}
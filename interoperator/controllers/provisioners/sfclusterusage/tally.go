@@ -0,0 +1,166 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfclusterusage
+
+import (
+	"sync"
+
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// usageTally keeps a running total of the allocatable resources of the
+// nodes and the requests of the pods of the cluster. The requests are also
+// totalled per namespace. It is updated from the node and pod events, so
+// that the cluster does not have to be listed for every change.
+type usageTally struct {
+	mu sync.Mutex
+
+	nodes    map[string]corev1.ResourceList
+	capacity corev1.ResourceList
+
+	pods       map[types.NamespacedName]corev1.ResourceList
+	requests   corev1.ResourceList
+	namespaces map[string]*namespaceUsage
+}
+
+type namespaceUsage struct {
+	pods     int
+	requests corev1.ResourceList
+}
+
+func newUsageTally() *usageTally {
+	return &usageTally{
+		nodes:      make(map[string]corev1.ResourceList),
+		capacity:   make(corev1.ResourceList),
+		pods:       make(map[types.NamespacedName]corev1.ResourceList),
+		requests:   make(corev1.ResourceList),
+		namespaces: make(map[string]*namespaceUsage),
+	}
+}
+
+// setNode adds or replaces the allocatable resources of the node
+func (t *usageTally) setNode(node *corev1.Node) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	name := node.GetName()
+	if old, ok := t.nodes[name]; ok {
+		resourcev1alpha1.ResourceListSub(t.capacity, old)
+	}
+	// Allocatable is the capacity after kubelet
+	allocatable := node.Status.Allocatable.DeepCopy()
+	if allocatable == nil {
+		allocatable = make(corev1.ResourceList)
+	}
+	t.nodes[name] = allocatable
+	resourcev1alpha1.ResourceListAdd(t.capacity, allocatable.DeepCopy())
+}
+
+// deleteNode removes the allocatable resources of the node
+func (t *usageTally) deleteNode(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if old, ok := t.nodes[name]; ok {
+		resourcev1alpha1.ResourceListSub(t.capacity, old)
+		delete(t.nodes, name)
+	}
+}
+
+// setPod adds or replaces the requests of the pod. Pods which have
+// terminated do not hold resources and are removed.
+func (t *usageTally) setPod(pod *corev1.Pod) {
+	key := types.NamespacedName{
+		Name:      pod.GetName(),
+		Namespace: pod.GetNamespace(),
+	}
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		t.deletePod(key)
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.removePod(key)
+	requests := getResourceRequest(pod).DeepCopy()
+	t.pods[key] = requests
+	resourcev1alpha1.ResourceListAdd(t.requests, requests.DeepCopy())
+
+	ns, ok := t.namespaces[key.Namespace]
+	if !ok {
+		ns = &namespaceUsage{
+			requests: make(corev1.ResourceList),
+		}
+		t.namespaces[key.Namespace] = ns
+	}
+	ns.pods++
+	resourcev1alpha1.ResourceListAdd(ns.requests, requests.DeepCopy())
+}
+
+// deletePod removes the requests of the pod
+func (t *usageTally) deletePod(key types.NamespacedName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.removePod(key)
+}
+
+// removePod removes the requests of the pod. It must be called with t.mu held.
+func (t *usageTally) removePod(key types.NamespacedName) {
+	old, ok := t.pods[key]
+	if !ok {
+		return
+	}
+	delete(t.pods, key)
+	resourcev1alpha1.ResourceListSub(t.requests, old)
+
+	ns, ok := t.namespaces[key.Namespace]
+	if !ok {
+		return
+	}
+	ns.pods--
+	if ns.pods <= 0 {
+		delete(t.namespaces, key.Namespace)
+		return
+	}
+	resourcev1alpha1.ResourceListSub(ns.requests, old)
+}
+
+// clusterUsage returns a copy of the capacity and requests of the cluster
+func (t *usageTally) clusterUsage() (corev1.ResourceList, corev1.ResourceList) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.capacity.DeepCopy(), t.requests.DeepCopy()
+}
+
+// namespaceUsage returns a copy of the requests of the pods in the
+// namespace or nil if there are no pods in the namespace
+func (t *usageTally) namespaceUsage(namespace string) corev1.ResourceList {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ns, ok := t.namespaces[namespace]
+	if !ok {
+		return nil
+	}
+	return ns.requests.DeepCopy()
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfclusterusage
+
+import (
+	"testing"
+
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func _getCPU(cpu int64) corev1.ResourceList {
+	return corev1.ResourceList{
+		corev1.ResourceCPU: *resource.NewQuantity(cpu, resource.DecimalSI),
+	}
+}
+
+func _getTallyNode(name string, cpu int64) *corev1.Node {
+	node := _getDummyNode(name)
+	node.Status.Allocatable = _getCPU(cpu)
+	return node
+}
+
+func _getTallyPod(name, namespace string, cpu int64) *corev1.Pod {
+	pod := _getDummyPod(name)
+	pod.SetNamespace(namespace)
+	pod.Spec.InitContainers = nil
+	pod.Spec.Containers[0].Resources.Requests = _getCPU(cpu)
+	return pod
+}
+
+func Test_usageTally(t *testing.T) {
+	tally := newUsageTally()
+
+	tally.setNode(_getTallyNode("node1", 4))
+	tally.setNode(_getTallyNode("node2", 4))
+	tally.setPod(_getTallyPod("pod1", "sf-1", 1))
+	tally.setPod(_getTallyPod("pod2", "sf-1", 2))
+	tally.setPod(_getTallyPod("pod3", "sf-2", 1))
+
+	checkUsage := func(step string, wantCapacity, wantRequests int64) {
+		t.Helper()
+		capacity, requests := tally.clusterUsage()
+		if !resourcev1alpha1.ResourceListEqual(capacity, _getCPU(wantCapacity)) {
+			t.Errorf("%s: capacity = %v, want cpu %d", step, capacity, wantCapacity)
+		}
+		if !resourcev1alpha1.ResourceListEqual(requests, _getCPU(wantRequests)) {
+			t.Errorf("%s: requests = %v, want cpu %d", step, requests, wantRequests)
+		}
+	}
+	checkNamespace := func(step, namespace string, want corev1.ResourceList) {
+		t.Helper()
+		got := tally.namespaceUsage(namespace)
+		if (got == nil) != (want == nil) || !resourcev1alpha1.ResourceListEqual(got, want) {
+			t.Errorf("%s: namespaceUsage(%s) = %v, want %v", step, namespace, got, want)
+		}
+	}
+
+	checkUsage("add", 8, 4)
+	checkNamespace("add", "sf-1", _getCPU(3))
+	checkNamespace("add", "sf-2", _getCPU(1))
+
+	tally.setNode(_getTallyNode("node2", 8))
+	tally.setPod(_getTallyPod("pod2", "sf-1", 3))
+	checkUsage("update", 12, 5)
+	checkNamespace("update", "sf-1", _getCPU(4))
+
+	completed := _getTallyPod("pod3", "sf-2", 1)
+	completed.Status.Phase = corev1.PodSucceeded
+	tally.setPod(completed)
+	checkUsage("completed", 12, 4)
+	checkNamespace("completed", "sf-2", nil)
+
+	tally.deleteNode("node1")
+	tally.deletePod(types.NamespacedName{Name: "pod1", Namespace: "sf-1"})
+	tally.deletePod(types.NamespacedName{Name: "unknown", Namespace: "sf-1"})
+	checkUsage("delete", 8, 3)
+	checkNamespace("delete", "sf-1", _getCPU(3))
+}
@@ -261,6 +261,7 @@ func (r *ReconcileSFServiceBinding) setInProgress(namespacedName types.Namespace
 			return err
 		}
 		binding.SetState("in progress")
+		binding.Status.ObservedGeneration = binding.GetGeneration()
 		labels := binding.GetLabels()
 		if labels == nil {
 			labels = make(map[string]string)
@@ -160,6 +160,28 @@ func (r *ReconcileSFServiceInstance) Reconcile(req ctrl.Request) (ctrl.Result, e
 		if err != nil {
 			return r.handleError(instance, ctrl.Result{}, err, state, 0)
 		}
+	} else if isMigrationAction(state) {
+		// The resources of the action are added to the resources of the
+		// instance so that they are removed on deprovision
+		expectedResources, err := r.resourceManager.ComputeExpectedResources(r, instanceID, bindingID, serviceID, planID, state, instance.GetNamespace())
+		if err != nil {
+			return r.handleError(instance, ctrl.Result{}, err, state, 0)
+		}
+
+		err = r.resourceManager.SetOwnerReference(instance, expectedResources, r.scheme)
+		if err != nil {
+			return r.handleError(instance, ctrl.Result{}, err, state, 0)
+		}
+
+		resourceRefs, err := r.resourceManager.ReconcileResources(r, expectedResources, nil, false)
+		if err != nil {
+			log.Error(err, "ReconcileResources failed", "action", state)
+			return r.handleError(instance, ctrl.Result{}, err, state, 0)
+		}
+		err = r.setInProgress(req.NamespacedName, state, mergeResources(instance.Status.Resources, resourceRefs), 0)
+		if err != nil {
+			return r.handleError(instance, ctrl.Result{}, err, state, 0)
+		}
 	}
 
 	err = r.Get(ctx, req.NamespacedName, instance)
@@ -183,6 +205,11 @@ func (r *ReconcileSFServiceInstance) Reconcile(req ctrl.Request) (ctrl.Result, e
 			if err != nil {
 				return r.handleError(instance, ctrl.Result{}, err, lastOperation, 0)
 			}
+		} else if isMigrationAction(lastOperation) {
+			err = r.updateActionStatus(instance, lastOperation, 0)
+			if err != nil {
+				return r.handleError(instance, ctrl.Result{}, err, lastOperation, 0)
+			}
 		}
 	}
 	return r.handleError(instance, ctrl.Result{}, nil, lastOperation, 0)
@@ -232,7 +259,7 @@ func (r *ReconcileSFServiceInstance) setInProgress(namespacedName types.Namespac
 	ctx := context.Background()
 	log := r.Log.WithValues("sfserviceinstance", namespacedName, "function", "setInProgress")
 
-	if state == "in_queue" || state == "update" || state == "delete" {
+	if state == "in_queue" || state == "update" || state == "delete" || isMigrationAction(state) {
 		instance := &osbv1alpha1.SFServiceInstance{}
 		err := r.Get(ctx, namespacedName, instance)
 		if err != nil {
@@ -260,6 +287,7 @@ func (r *ReconcileSFServiceInstance) setInProgress(namespacedName types.Namespac
 		if state == instance.GetState() {
 			instance.SetState("in progress")
 			instance.SetLabels(labels)
+			instance.Status.ObservedGeneration = instance.GetGeneration()
 		} else {
 			log.Info("Error while trying to set in progress. state mismatch", "state", state,
 				"currentState", instance.GetState(), "lastOperation", lastOperation)
@@ -461,6 +489,107 @@ func (r *ReconcileSFServiceInstance) updateStatus(instance *osbv1alpha1.SFServic
 	return nil
 }
 
+// updateActionStatus updates the status of the instance from the status
+// template for the backup, restore or migrate action. The instance remains
+// in progress till the status template provides the state for the action.
+func (r *ReconcileSFServiceInstance) updateActionStatus(instance *osbv1alpha1.SFServiceInstance, action string, retryCount int) error {
+	serviceID := instance.Spec.ServiceID
+	planID := instance.Spec.PlanID
+	instanceID := instance.GetName()
+	bindingID := ""
+	namespace := instance.GetNamespace()
+
+	ctx := context.Background()
+	log := r.Log.WithValues("instanceID", instanceID, "action", action)
+
+	computedStatus, err := r.resourceManager.ComputeStatus(r, instanceID, bindingID, serviceID, planID, action, namespace)
+	if err != nil {
+		log.Error(err, "Compute status failed")
+		return err
+	}
+
+	var actionStatus properties.GenericStatus
+	switch action {
+	case osbv1alpha1.BackupAction:
+		actionStatus = computedStatus.Backup
+	case osbv1alpha1.RestoreAction:
+		actionStatus = computedStatus.Restore
+	case osbv1alpha1.MigrateAction:
+		actionStatus = computedStatus.Migrate
+	}
+	if actionStatus.State == "" {
+		log.Info("State of action not yet provided by status template")
+		actionStatus.State = "in progress"
+	}
+
+	// Fetch object again before updating status
+	namespacedName := types.NamespacedName{
+		Name:      instanceID,
+		Namespace: namespace,
+	}
+	err = r.Get(ctx, namespacedName, instance)
+	if err != nil {
+		log.Error(err, "failed to fetch instance")
+		return err
+	}
+	state := instance.GetState()
+	if state != "in progress" {
+		err = errors.NewPreconditionError("updateActionStatus", "state not in progress", nil)
+		log.Error(err, "state changed while processing instance", "state", state)
+		return err
+	}
+
+	updatedStatus := instance.Status.DeepCopy()
+	updatedStatus.State = actionStatus.State
+	updatedStatus.Error = actionStatus.Error
+	updatedStatus.Description = actionStatus.Response
+
+	if !reflect.DeepEqual(&instance.Status, updatedStatus) {
+		updatedStatus.DeepCopyInto(&instance.Status)
+		newState := instance.GetState()
+		log.Info("Updating action status from template", "state", state, "newState", newState)
+		err = r.Update(ctx, instance)
+		if err != nil {
+			if retryCount < constants.ErrorThreshold {
+				log.Info("Retrying", "function", "updateActionStatus", "retryCount", retryCount+1)
+				return r.updateActionStatus(instance, action, retryCount+1)
+			}
+			log.Error(err, "failed to update status", "state", state, "newState", newState)
+			return err
+		}
+	}
+	return nil
+}
+
+// isMigrationAction returns true if the state is one of the actions
+// run on the instance while it is migrated between clusters
+func isMigrationAction(state string) bool {
+	switch state {
+	case osbv1alpha1.BackupAction, osbv1alpha1.RestoreAction, osbv1alpha1.MigrateAction:
+		return true
+	}
+	return false
+}
+
+// mergeResources appends the resources not already present in resources
+func mergeResources(resources, additional []osbv1alpha1.Source) []osbv1alpha1.Source {
+	merged := make([]osbv1alpha1.Source, 0, len(resources)+len(additional))
+	merged = append(merged, resources...)
+	for _, resource := range additional {
+		found := false
+		for _, existing := range resources {
+			if existing == resource {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, resource)
+		}
+	}
+	return merged
+}
+
 func (r *ReconcileSFServiceInstance) handleError(object *osbv1alpha1.SFServiceInstance, result ctrl.Result, inputErr error, lastOperation string, retryCount int) (ctrl.Result, error) {
 	objectID := object.GetName()
 	namespace := object.GetNamespace()
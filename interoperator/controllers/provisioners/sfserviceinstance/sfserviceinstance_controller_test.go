@@ -35,10 +35,12 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/util/retry"
 	ctrlrun "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
@@ -511,3 +513,176 @@ func TestReconcileSFServiceInstance_setInProgress(t *testing.T) {
 		})
 	}
 }
+
+func _getActionInstance(state string) *osbv1alpha1.SFServiceInstance {
+	actionInstance := instance.DeepCopy()
+	actionInstance.SetName("action-instance-id")
+	actionInstance.SetLabels(map[string]string{
+		"state":                    state,
+		constants.LastOperationKey: osbv1alpha1.RestoreAction,
+	})
+	actionInstance.Status = osbv1alpha1.SFServiceInstanceStatus{
+		State: state,
+		Resources: []osbv1alpha1.Source{
+			{APIVersion: "v1", Kind: "Secret", Name: "instance-secret", Namespace: constants.InteroperatorNamespace},
+		},
+	}
+	return actionInstance
+}
+
+func TestReconcileSFServiceInstance_updateActionStatus(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(osbv1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	tests := []struct {
+		name      string
+		status    properties.GenericStatus
+		wantState string
+		wantError string
+	}{
+		{
+			name:      "remain in progress if status template does not provide state",
+			status:    properties.GenericStatus{},
+			wantState: "in progress",
+		},
+		{
+			name:      "succeed if status template provides succeeded",
+			status:    properties.GenericStatus{State: "succeeded", Response: "restored"},
+			wantState: "succeeded",
+		},
+		{
+			name:      "fail if status template provides failed",
+			status:    properties.GenericStatus{State: "failed", Error: "restore failed"},
+			wantState: "failed",
+			wantError: "restore failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			actionInstance := _getActionInstance("in progress")
+			c := fake.NewFakeClientWithScheme(scheme, actionInstance)
+			mockResourceManager := mock_resources.NewMockResourceManager(ctrl)
+			mockResourceManager.EXPECT().ComputeStatus(gomock.Any(), "action-instance-id", "", "service-id", "plan-id",
+				osbv1alpha1.RestoreAction, constants.InteroperatorNamespace).Return(&properties.Status{
+				Restore: tt.status,
+			}, nil)
+
+			r := &ReconcileSFServiceInstance{
+				Client:          c,
+				uncachedClient:  c,
+				Log:             ctrlrun.Log.WithName("provisioners").WithName("instance"),
+				resourceManager: mockResourceManager,
+			}
+			err := r.updateActionStatus(actionInstance, osbv1alpha1.RestoreAction, 0)
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+
+			updated := &osbv1alpha1.SFServiceInstance{}
+			g.Expect(c.Get(context.TODO(), types.NamespacedName{
+				Name:      "action-instance-id",
+				Namespace: constants.InteroperatorNamespace,
+			}, updated)).To(gomega.Succeed())
+			g.Expect(updated.GetState()).To(gomega.Equal(tt.wantState))
+			g.Expect(updated.Status.Error).To(gomega.Equal(tt.wantError))
+		})
+	}
+}
+
+func TestReconcile_migrationAction(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	scheme := runtime.NewScheme()
+	g.Expect(osbv1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	actionInstance := _getActionInstance(osbv1alpha1.RestoreAction)
+	actionInstance.SetLabels(map[string]string{"state": osbv1alpha1.RestoreAction})
+	key := types.NamespacedName{Name: "action-instance-id", Namespace: constants.InteroperatorNamespace}
+	c := fake.NewFakeClientWithScheme(scheme, actionInstance)
+
+	expectedResources := []*unstructured.Unstructured{nil}
+	restoreResource := osbv1alpha1.Source{APIVersion: "batch/v1", Kind: "Job", Name: "restore-job",
+		Namespace: constants.InteroperatorNamespace}
+
+	mockResourceManager := mock_resources.NewMockResourceManager(ctrl)
+	mockResourceManager.EXPECT().ComputeExpectedResources(gomock.Any(), "action-instance-id", "", "service-id", "plan-id",
+		osbv1alpha1.RestoreAction, constants.InteroperatorNamespace).Return(expectedResources, nil)
+	mockResourceManager.EXPECT().SetOwnerReference(gomock.Any(), expectedResources, gomock.Any()).Return(nil)
+	// The resources of the action are reconciled independent of the resources of the instance
+	mockResourceManager.EXPECT().ReconcileResources(gomock.Any(), expectedResources, nil, false).
+		Return([]osbv1alpha1.Source{restoreResource}, nil)
+	gomock.InOrder(
+		mockResourceManager.EXPECT().ComputeStatus(gomock.Any(), "action-instance-id", "", "service-id", "plan-id",
+			osbv1alpha1.RestoreAction, constants.InteroperatorNamespace).Return(&properties.Status{}, nil),
+		mockResourceManager.EXPECT().ComputeStatus(gomock.Any(), "action-instance-id", "", "service-id", "plan-id",
+			osbv1alpha1.RestoreAction, constants.InteroperatorNamespace).Return(&properties.Status{
+			Restore: properties.GenericStatus{State: "succeeded"},
+		}, nil),
+	)
+
+	r := &ReconcileSFServiceInstance{
+		Client:          c,
+		uncachedClient:  c,
+		Log:             ctrlrun.Log.WithName("provisioners").WithName("instance"),
+		resourceManager: mockResourceManager,
+	}
+
+	// Action is triggered and remains in progress till the status template provides the state
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: key})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	updated := &osbv1alpha1.SFServiceInstance{}
+	g.Expect(c.Get(context.TODO(), key, updated)).To(gomega.Succeed())
+	g.Expect(updated.GetState()).To(gomega.Equal("in progress"))
+	g.Expect(updated.GetLabels()[constants.LastOperationKey]).To(gomega.Equal(osbv1alpha1.RestoreAction))
+	g.Expect(updated.Status.Resources).To(gomega.Equal(append(actionInstance.Status.Resources, restoreResource)))
+
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: key})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	updated = &osbv1alpha1.SFServiceInstance{}
+	g.Expect(c.Get(context.TODO(), key, updated)).To(gomega.Succeed())
+	g.Expect(updated.GetState()).To(gomega.Equal("succeeded"))
+	g.Expect(updated.Status.Resources).To(gomega.HaveLen(2))
+}
+
+func Test_mergeResources(t *testing.T) {
+	secret := osbv1alpha1.Source{APIVersion: "v1", Kind: "Secret", Name: "secret", Namespace: "default"}
+	job := osbv1alpha1.Source{APIVersion: "batch/v1", Kind: "Job", Name: "job", Namespace: "default"}
+	configMap := osbv1alpha1.Source{APIVersion: "v1", Kind: "ConfigMap", Name: "config", Namespace: "default"}
+	tests := []struct {
+		name       string
+		resources  []osbv1alpha1.Source
+		additional []osbv1alpha1.Source
+		want       []osbv1alpha1.Source
+	}{
+		{
+			name:       "append new resources",
+			resources:  []osbv1alpha1.Source{secret},
+			additional: []osbv1alpha1.Source{job, configMap},
+			want:       []osbv1alpha1.Source{secret, job, configMap},
+		},
+		{
+			name:       "skip existing resources",
+			resources:  []osbv1alpha1.Source{secret, job},
+			additional: []osbv1alpha1.Source{job, configMap},
+			want:       []osbv1alpha1.Source{secret, job, configMap},
+		},
+		{
+			name:       "no resources",
+			resources:  nil,
+			additional: nil,
+			want:       []osbv1alpha1.Source{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeResources(tt.resources, tt.additional); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeResources() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CapacityName is the name of the Capacity plugin
+const CapacityName = "Capacity"
+
+const capacityStateKey = CapacityName + "/maxAllocatable"
+
+// Capacity filters out the clusters which do not have enough allocatable
+// resources for the requests of the plan. As a score plugin it prefers the
+// clusters with more allocatable resources.
+type Capacity struct{}
+
+// NewCapacity returns a new Capacity plugin
+func NewCapacity(c client.Client) (Plugin, error) {
+	return &Capacity{}, nil
+}
+
+// Name returns the name of the plugin
+func (p *Capacity) Name() string {
+	return CapacityName
+}
+
+// Filter checks whether the requests fit in the allocatable resources of the cluster
+func (p *Capacity) Filter(sctx *SchedulingContext, cluster *resourcev1alpha1.SFCluster) *Status {
+	if len(sctx.Requests) == 0 {
+		return nil
+	}
+	capacity := getCapacity(cluster)
+	allocatable := getAllocatable(cluster)
+	for key, request := range sctx.Requests {
+		// Resources not reported by the cluster are not limited
+		if _, ok := capacity[key]; !ok {
+			continue
+		}
+		if request.Cmp(allocatable[key]) > 0 {
+			return NewStatus(Unschedulable, "cluster(s) with insufficient resources")
+		}
+	}
+	return nil
+}
+
+// PreScore computes the maximum allocatable value of the scored resources
+// across the clusters
+func (p *Capacity) PreScore(sctx *SchedulingContext, clusters []*resourcev1alpha1.SFCluster) error {
+	maxAllocatable := make(map[corev1.ResourceName]int64)
+	for _, cluster := range clusters {
+		allocatable := getAllocatable(cluster)
+		for _, key := range scoredResources(sctx.Requests) {
+			quantity, ok := allocatable[key]
+			if ok && quantity.MilliValue() > maxAllocatable[key] {
+				maxAllocatable[key] = quantity.MilliValue()
+			}
+		}
+	}
+	sctx.Write(capacityStateKey, maxAllocatable)
+	return nil
+}
+
+// Score returns the average of the allocatable resources of the cluster
+// relative to the maximum allocatable across the clusters
+func (p *Capacity) Score(sctx *SchedulingContext, cluster *resourcev1alpha1.SFCluster) (int64, error) {
+	val, ok := sctx.Read(capacityStateKey)
+	if !ok {
+		return 0, nil
+	}
+	maxAllocatable := val.(map[corev1.ResourceName]int64)
+	allocatable := getAllocatable(cluster)
+	keys := scoredResources(sctx.Requests)
+
+	var score int64
+	for _, key := range keys {
+		quantity, ok := allocatable[key]
+		if !ok || maxAllocatable[key] <= 0 || quantity.MilliValue() <= 0 {
+			continue
+		}
+		score += quantity.MilliValue() * MaxClusterScore / maxAllocatable[key]
+	}
+	return score / int64(len(keys)), nil
+}
+
+// scoredResources returns the resources considered for scoring.
+// These are the requested resources or cpu and memory if the plan
+// does not have requests.
+func scoredResources(requests corev1.ResourceList) []corev1.ResourceName {
+	if len(requests) == 0 {
+		return []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory}
+	}
+	keys := make([]corev1.ResourceName, 0, len(requests))
+	for key := range requests {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// getCapacity returns the part of the cluster capacity which can be used for
+// scheduling. TotalCapacity is used if set, else CurrentCapacity. Only
+// SchedulingLimitPercentage of the capacity is considered, if it is set.
+func getCapacity(cluster *resourcev1alpha1.SFCluster) corev1.ResourceList {
+	capacity := cluster.Status.TotalCapacity
+	if capacity == nil || len(capacity) == 0 {
+		capacity = cluster.Status.CurrentCapacity
+	}
+	limit := cluster.Spec.SchedulingLimitPercentage
+	if limit > 0 && limit < 100 {
+		return resourcev1alpha1.ResourceListPercentage(capacity, limit)
+	}
+	return capacity.DeepCopy()
+}
+
+// getAllocatable returns the resources which can still be allocated on the cluster
+func getAllocatable(cluster *resourcev1alpha1.SFCluster) corev1.ResourceList {
+	allocatable := getCapacity(cluster)
+	resourcev1alpha1.ResourceListSub(allocatable, cluster.Status.Requests)
+	return allocatable
+}
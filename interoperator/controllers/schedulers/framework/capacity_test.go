@@ -0,0 +1,85 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestCapacity_Filter(t *testing.T) {
+	tests := []struct {
+		name     string
+		requests corev1.ResourceList
+		capacity corev1.ResourceList
+		used     corev1.ResourceList
+		want     Code
+	}{
+		{
+			name:     "pass if plan has no requests",
+			requests: nil,
+			capacity: _getResources(4, 4096),
+			used:     _getResources(4, 4096),
+			want:     Success,
+		},
+		{
+			name:     "pass if the requests fit",
+			requests: _getResources(1, 1024),
+			capacity: _getResources(4, 4096),
+			used:     _getResources(2, 1024),
+			want:     Success,
+		},
+		{
+			name:     "pass if the requests fit exactly",
+			requests: _getResources(2, 3072),
+			capacity: _getResources(4, 4096),
+			used:     _getResources(2, 1024),
+			want:     Success,
+		},
+		{
+			name:     "fail if one of the requests does not fit",
+			requests: _getResources(1, 4096),
+			capacity: _getResources(4, 4096),
+			used:     _getResources(2, 1024),
+			want:     Unschedulable,
+		},
+		{
+			name: "ignore resources not reported by the cluster",
+			requests: corev1.ResourceList{
+				corev1.ResourceCPU:              *resource.NewQuantity(1, resource.DecimalSI),
+				corev1.ResourceEphemeralStorage: *resource.NewQuantity(1024, resource.BinarySI),
+			},
+			capacity: _getResources(4, 4096),
+			used:     _getResources(2, 1024),
+			want:     Success,
+		},
+	}
+	p := &Capacity{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sctx := &SchedulingContext{
+				Requests: tt.requests,
+			}
+			cluster := _getCluster("1", nil, 0, tt.capacity, tt.used)
+			if got := p.Filter(sctx, &cluster); got.Code() != tt.want {
+				t.Errorf("Filter() = %v, want %v", got.Code(), tt.want)
+			}
+		})
+	}
+}
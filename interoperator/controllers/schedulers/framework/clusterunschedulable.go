@@ -0,0 +1,56 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+)
+
+// ClusterUnschedulableName is the name of the ClusterUnschedulable plugin
+const ClusterUnschedulableName = "ClusterUnschedulable"
+
+// ClusterUnschedulable filters out the clusters marked unschedulable, the
+// clusters which are not ready and the clusters excluded for the instance,
+// including the clusters in pull mode if ExcludePullMode is set. It is run
+// by every profile before the filters of the profile and hence is not part
+// of the registry.
+type ClusterUnschedulable struct{}
+
+// Name returns the name of the plugin
+func (p *ClusterUnschedulable) Name() string {
+	return ClusterUnschedulableName
+}
+
+// Filter checks whether new instances can be scheduled on the cluster
+func (p *ClusterUnschedulable) Filter(sctx *SchedulingContext, cluster *resourcev1alpha1.SFCluster) *Status {
+	if cluster.Spec.Unschedulable {
+		return NewStatus(UnschedulableAndUnresolvable, "cluster(s) were unschedulable")
+	}
+	if !cluster.IsReady() {
+		// The cluster may become ready again
+		return NewStatus(Unschedulable, "cluster(s) were not ready")
+	}
+	if sctx.ExcludePullMode && cluster.IsPullMode() {
+		return NewStatus(UnschedulableAndUnresolvable, "cluster(s) were in pull mode")
+	}
+	for _, clusterID := range sctx.ExcludeClusters {
+		if cluster.GetName() == clusterID {
+			return NewStatus(UnschedulableAndUnresolvable, "cluster(s) were excluded")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CostName is the name of the Cost plugin
+const CostName = "Cost"
+
+const costStateKey = CostName + "/maxCost"
+
+// Cost prefers the clusters with lower cost. The cost of a cluster is read
+// from the constants.ClusterCostKey label of the SFCluster. Clusters without
+// a valid cost are considered the most expensive.
+type Cost struct{}
+
+// NewCost returns a new Cost plugin
+func NewCost(c client.Client) (Plugin, error) {
+	return &Cost{}, nil
+}
+
+// Name returns the name of the plugin
+func (p *Cost) Name() string {
+	return CostName
+}
+
+// PreScore computes the maximum cost across the clusters
+func (p *Cost) PreScore(sctx *SchedulingContext, clusters []*resourcev1alpha1.SFCluster) error {
+	var maxCost int64
+	for _, cluster := range clusters {
+		cost, ok := getCost(cluster)
+		if ok && cost > maxCost {
+			maxCost = cost
+		}
+	}
+	sctx.Write(costStateKey, maxCost)
+	return nil
+}
+
+// Score returns the negated cost of the cluster
+func (p *Cost) Score(sctx *SchedulingContext, cluster *resourcev1alpha1.SFCluster) (int64, error) {
+	cost, ok := getCost(cluster)
+	if !ok {
+		val, _ := sctx.Read(costStateKey)
+		maxCost, _ := val.(int64)
+		cost = maxCost + 1
+	}
+	return -cost, nil
+}
+
+// getCost returns the cost of the cluster in milli units
+func getCost(cluster *resourcev1alpha1.SFCluster) (int64, bool) {
+	val, ok := cluster.GetLabels()[constants.ClusterCostKey]
+	if !ok {
+		return 0, false
+	}
+	cost, err := resource.ParseQuantity(val)
+	if err != nil || cost.Sign() < 0 {
+		log.Info("Ignoring invalid cost of cluster", "cluster name", cluster.GetName(), "cost", val)
+		return 0, false
+	}
+	return cost.MilliValue(), true
+}
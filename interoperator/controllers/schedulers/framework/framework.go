@@ -0,0 +1,442 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/utils"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var log = logf.Log.WithName("scheduler.framework")
+
+// SchedulingContext holds the inputs of one scheduling cycle of a
+// SFServiceInstance. Plugins can share data within a cycle using
+// Read and Write.
+type SchedulingContext struct {
+	Instance *osbv1alpha1.SFServiceInstance
+	Plan     *osbv1alpha1.SFPlan
+
+	// LabelSelector is the rendered clusterSelector template of the plan
+	LabelSelector string
+
+	// Requests are the resources requested by the plan
+	Requests corev1.ResourceList
+
+	// StorageRequests are the storage requested by the plan per storage class
+	StorageRequests map[string]resource.Quantity
+
+	// PlacementRules are the rules for placing the instance
+	// relative to other instances
+	PlacementRules []PlacementRule
+
+	// ExcludeClusters are the clusters the instance must not be scheduled
+	// on, for example the source cluster of a migration
+	ExcludeClusters []string
+
+	// ExcludePullMode excludes the clusters in pull mode, for example for
+	// migrations which need access to the target cluster
+	ExcludePullMode bool
+
+	// Topology is the preferred region and zone of the instance
+	Topology *TopologyPreference
+
+	// Decision records the evaluation of the clusters by Schedule
+	Decision *osbv1alpha1.SchedulingStatus
+
+	state map[string]interface{}
+}
+
+// Read returns the data stored by a plugin for the key
+func (sctx *SchedulingContext) Read(key string) (interface{}, bool) {
+	if sctx.state == nil {
+		return nil, false
+	}
+	val, ok := sctx.state[key]
+	return val, ok
+}
+
+// Write stores data for the key
+func (sctx *SchedulingContext) Write(key string, val interface{}) {
+	if sctx.state == nil {
+		sctx.state = make(map[string]interface{})
+	}
+	sctx.state[key] = val
+}
+
+// Framework runs the plugins of a scheduler profile
+type Framework interface {
+	// ProfileName returns the name of the profile the framework runs
+	ProfileName() string
+
+	// Schedule returns the name of the cluster best suited for the instance
+	Schedule(sctx *SchedulingContext, clusters []resourcev1alpha1.SFCluster) (string, error)
+}
+
+type weightedScorePlugin struct {
+	ScorePlugin
+	weight int64
+}
+
+type framework struct {
+	profileName string
+	preFilters  []PreFilterPlugin
+	filters     []FilterPlugin
+	relaxables  []RelaxablePlugin
+	preScores   []PreScorePlugin
+	scores      []weightedScorePlugin
+}
+
+// New returns a Framework running the plugins of the profile. The
+// ClusterUnschedulable filter and the required filters not listed in the
+// profile are run before the filters of the profile.
+func New(profile *config.SchedulerProfile, c client.Client) (Framework, error) {
+	if profile == nil {
+		return nil, errors.NewInputError("framework.New", "profile", nil)
+	}
+
+	f := &framework{
+		profileName: profile.Name,
+		filters:     []FilterPlugin{&ClusterUnschedulable{}},
+	}
+
+	// Instantiate every plugin only once even if it is used
+	// both as filter and score plugin
+	plugins := make(map[string]Plugin)
+	var ordered []Plugin
+	getPlugin := func(name string) (Plugin, error) {
+		if p, ok := plugins[name]; ok {
+			return p, nil
+		}
+		factory, ok := registry[name]
+		if !ok {
+			return nil, errors.NewSchedulerFailed(profile.Name, "Unknown scheduler plugin "+name, nil)
+		}
+		p, err := factory(c)
+		if err != nil {
+			return nil, err
+		}
+		plugins[name] = p
+		ordered = append(ordered, p)
+		return p, nil
+	}
+
+	filterNames := make([]string, 0, len(requiredFilters)+len(profile.Filters))
+	for _, name := range requiredFilters {
+		if !utils.ContainsString(profile.Filters, name) {
+			filterNames = append(filterNames, name)
+		}
+	}
+	filterNames = append(filterNames, profile.Filters...)
+
+	for _, name := range filterNames {
+		p, err := getPlugin(name)
+		if err != nil {
+			return nil, err
+		}
+		filter, ok := p.(FilterPlugin)
+		if !ok {
+			return nil, errors.NewSchedulerFailed(profile.Name, "Plugin "+name+" is not a filter plugin", nil)
+		}
+		f.filters = append(f.filters, filter)
+		if relaxable, ok := p.(RelaxablePlugin); ok {
+			f.relaxables = append(f.relaxables, relaxable)
+		}
+	}
+
+	for _, pluginWeight := range profile.Scores {
+		p, err := getPlugin(pluginWeight.Name)
+		if err != nil {
+			return nil, err
+		}
+		score, ok := p.(ScorePlugin)
+		if !ok {
+			return nil, errors.NewSchedulerFailed(profile.Name, "Plugin "+pluginWeight.Name+" is not a score plugin", nil)
+		}
+		weight := pluginWeight.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		f.scores = append(f.scores, weightedScorePlugin{
+			ScorePlugin: score,
+			weight:      weight,
+		})
+	}
+
+	for _, p := range ordered {
+		if preFilter, ok := p.(PreFilterPlugin); ok {
+			f.preFilters = append(f.preFilters, preFilter)
+		}
+		if preScore, ok := p.(PreScorePlugin); ok {
+			f.preScores = append(f.preScores, preScore)
+		}
+	}
+
+	return f, nil
+}
+
+func (f *framework) ProfileName() string {
+	return f.profileName
+}
+
+// Schedule runs the filter plugins on all the clusters and returns the
+// feasible cluster with the highest weighted score. Ties are broken by the
+// order of the clusters. The evaluation of each cluster is recorded in
+// sctx.Decision.
+func (f *framework) Schedule(sctx *SchedulingContext, clusters []resourcev1alpha1.SFCluster) (string, error) {
+	log := log.WithValues("profile", f.profileName, "instance", sctx.Instance.GetName())
+
+	now := metav1.Now()
+	sctx.Decision = &osbv1alpha1.SchedulingStatus{
+		Profile:       f.profileName,
+		LabelSelector: sctx.LabelSelector,
+		Time:          &now,
+	}
+
+	for _, p := range f.preFilters {
+		err := p.PreFilter(sctx, clusters)
+		if err != nil {
+			sctx.Decision.Message = err.Error()
+			return "", err
+		}
+	}
+
+	feasible, statuses := f.runFilters(sctx, clusters)
+	log.Info("Filtered clusters", "clusters", len(clusters), "feasible", len(feasible))
+	var relaxed []string
+	for len(feasible) == 0 {
+		p := f.relax(sctx)
+		if p == nil {
+			break
+		}
+		relaxed = append(relaxed, p.Name())
+		sctx.Decision.Clusters = nil
+		feasible, statuses = f.runFilters(sctx, clusters)
+		log.Info("Filtered clusters after relaxing constraint", "plugin", p.Name(), "feasible", len(feasible))
+	}
+	if len(feasible) == 0 {
+		fitErr := &FitError{
+			NumClusters: len(clusters),
+			Statuses:    statuses,
+		}
+		sctx.Decision.Message = fitErr.Error()
+		msg := "No clusters found with matching criteria: " + sctx.LabelSelector
+		return "", errors.NewSchedulerFailed(f.profileName, msg, fitErr)
+	}
+
+	if len(feasible) == 1 || len(f.scores) == 0 {
+		log.Info("Selected cluster", "cluster name", feasible[0].GetName())
+		f.setSelected(sctx, feasible[0].GetName(), len(clusters), len(feasible), relaxed)
+		return feasible[0].GetName(), nil
+	}
+
+	totals, err := f.runScores(sctx, feasible)
+	if err != nil {
+		sctx.Decision.Message = err.Error()
+		return "", err
+	}
+
+	best := 0
+	for i := range feasible {
+		log.V(1).Info("Cluster score", "cluster name", feasible[i].GetName(), "score", totals[i])
+		if totals[i] > totals[best] {
+			best = i
+		}
+	}
+	log.Info("Selected cluster", "cluster name", feasible[best].GetName(), "score", totals[best])
+	f.setSelected(sctx, feasible[best].GetName(), len(clusters), len(feasible), relaxed)
+	return feasible[best].GetName(), nil
+}
+
+// relax relaxes the constraint of the first filter plugin which allows it.
+// It returns nil if no constraint can be relaxed.
+func (f *framework) relax(sctx *SchedulingContext) RelaxablePlugin {
+	for _, p := range f.relaxables {
+		if p.Relax(sctx) {
+			return p
+		}
+	}
+	return nil
+}
+
+// setSelected records the selected cluster in the decision
+func (f *framework) setSelected(sctx *SchedulingContext, clusterID string, numClusters, numFeasible int, relaxed []string) {
+	sctx.Decision.SelectedCluster = clusterID
+	sctx.Decision.Message = fmt.Sprintf("Selected cluster %s. %d/%d clusters are feasible.", clusterID,
+		numFeasible, numClusters)
+	if len(relaxed) != 0 {
+		sctx.Decision.Message += " Relaxed constraints: " + strings.Join(relaxed, ", ") + "."
+	}
+}
+
+// clusterDecision returns the record of the cluster in the decision
+func clusterDecision(sctx *SchedulingContext, clusterID string) *osbv1alpha1.ClusterSchedulingStatus {
+	for i := range sctx.Decision.Clusters {
+		if sctx.Decision.Clusters[i].ClusterID == clusterID {
+			return &sctx.Decision.Clusters[i]
+		}
+	}
+	return nil
+}
+
+// runFilters returns the feasible clusters and the failed statuses of the
+// other clusters
+func (f *framework) runFilters(sctx *SchedulingContext, clusters []resourcev1alpha1.SFCluster) ([]*resourcev1alpha1.SFCluster, map[string]*Status) {
+	feasible := make([]*resourcev1alpha1.SFCluster, 0, len(clusters))
+	statuses := make(map[string]*Status)
+	for i := range clusters {
+		cluster := &clusters[i]
+		record := osbv1alpha1.ClusterSchedulingStatus{
+			ClusterID: cluster.GetName(),
+		}
+		var status *Status
+		for _, p := range f.filters {
+			status = p.Filter(sctx, cluster)
+			if !status.IsSuccess() {
+				log.V(1).Info("Cluster filtered out", "plugin", p.Name(), "cluster name",
+					cluster.GetName(), "reason", status.Reason())
+				record.Plugin = p.Name()
+				record.Reason = status.Reason()
+				break
+			}
+		}
+		if status.IsSuccess() {
+			feasible = append(feasible, cluster)
+			record.Feasible = true
+		} else {
+			statuses[cluster.GetName()] = status
+		}
+		sctx.Decision.Clusters = append(sctx.Decision.Clusters, record)
+	}
+	return feasible, statuses
+}
+
+// runScores returns the total weighted score for each of the clusters
+func (f *framework) runScores(sctx *SchedulingContext, clusters []*resourcev1alpha1.SFCluster) ([]int64, error) {
+	for _, p := range f.preScores {
+		err := p.PreScore(sctx, clusters)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	totals := make([]int64, len(clusters))
+	scores := make([]int64, len(clusters))
+	for _, p := range f.scores {
+		for i, cluster := range clusters {
+			score, err := p.Score(sctx, cluster)
+			if err != nil {
+				return nil, err
+			}
+			scores[i] = score
+		}
+		normalizeScores(scores)
+		for i, cluster := range clusters {
+			totals[i] += scores[i] * p.weight
+			if record := clusterDecision(sctx, cluster.GetName()); record != nil {
+				if record.Scores == nil {
+					record.Scores = make(map[string]int64)
+				}
+				record.Scores[p.Name()] = scores[i] * p.weight
+				record.Score = totals[i]
+			}
+		}
+	}
+	return totals, nil
+}
+
+// normalizeScores scales the scores to [0, MaxClusterScore].
+// If all the scores are equal, all of them are set to MaxClusterScore.
+func normalizeScores(scores []int64) {
+	if len(scores) == 0 {
+		return
+	}
+	min, max := scores[0], scores[0]
+	for _, score := range scores {
+		if score < min {
+			min = score
+		}
+		if score > max {
+			max = score
+		}
+	}
+	for i := range scores {
+		if max == min {
+			scores[i] = MaxClusterScore
+		} else {
+			scores[i] = (scores[i] - min) * MaxClusterScore / (max - min)
+		}
+	}
+}
+
+// FitError describes why none of the clusters were feasible for an instance
+type FitError struct {
+	NumClusters int
+	Statuses    map[string]*Status
+}
+
+// Error returns a summary of the reasons the clusters were filtered out
+func (e *FitError) Error() string {
+	reasons := make(map[string]int)
+	for _, status := range e.Statuses {
+		reasons[status.Reason()]++
+	}
+	summary := make([]string, 0, len(reasons))
+	for reason, count := range reasons {
+		summary = append(summary, fmt.Sprintf("%d %s", count, reason))
+	}
+	sort.Strings(summary)
+	msg := fmt.Sprintf("0/%d clusters are available", e.NumClusters)
+	if len(summary) > 0 {
+		msg = msg + ": " + strings.Join(summary, ", ")
+	}
+	return msg + "."
+}
+
+// Resolvable returns true if at least one of the clusters might become
+// feasible later, for example when capacity is added
+func (e *FitError) Resolvable() bool {
+	for _, status := range e.Statuses {
+		if status.Code() == Unschedulable {
+			return true
+		}
+	}
+	return false
+}
+
+// IsResolvable returns true if the scheduling failed with a FitError
+// which is Resolvable
+func IsResolvable(err error) bool {
+	interoperatorErr, ok := err.(*errors.InteroperatorError)
+	if !ok {
+		return false
+	}
+	fitErr, ok := interoperatorErr.Err.(*FitError)
+	return ok && fitErr.Resolvable()
+}
@@ -0,0 +1,544 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	"testing"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func _getCluster(name string, labels map[string]string, count int, capacity, requests corev1.ResourceList) resourcev1alpha1.SFCluster {
+	return resourcev1alpha1.SFCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+		Status: resourcev1alpha1.SFClusterStatus{
+			ServiceInstanceCount: count,
+			TotalCapacity:        capacity,
+			Requests:             requests,
+		},
+	}
+}
+
+func _getResources(cpu, memory int64) corev1.ResourceList {
+	return corev1.ResourceList{
+		corev1.ResourceCPU:    *resource.NewQuantity(cpu, resource.DecimalSI),
+		corev1.ResourceMemory: *resource.NewQuantity(memory, resource.BinarySI),
+	}
+}
+
+func Test_framework_Schedule(t *testing.T) {
+	full := _getCluster("full", nil, 0, _getResources(10, 10240), _getResources(6, 1024))
+	full.Spec.SchedulingLimitPercentage = 50
+	cordoned := _getCluster("cordoned", nil, 0, nil, nil)
+	cordoned.Spec.Unschedulable = true
+	notReady := _getCluster("notready", nil, 0, nil, nil)
+	notReady.Status.SetCondition(resourcev1alpha1.SFClusterCondition{
+		Type:   resourcev1alpha1.ClusterReady,
+		Status: metav1.ConditionFalse,
+		Reason: "ProbeFailed",
+	})
+
+	type args struct {
+		profile       string
+		labelSelector string
+		requests      corev1.ResourceList
+		exclude       []string
+		pullMode      bool
+		clusters      []resourcev1alpha1.SFCluster
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "schedule on cluster with least instances",
+			args: args{
+				clusters: []resourcev1alpha1.SFCluster{
+					_getCluster("1", nil, 5, nil, nil),
+					_getCluster("2", nil, 2, nil, nil),
+					_getCluster("3", nil, 2, nil, nil),
+				},
+			},
+			want: "2",
+		},
+		{
+			name: "schedule only on clusters matching label selector",
+			args: args{
+				labelSelector: "plan=gold",
+				clusters: []resourcev1alpha1.SFCluster{
+					_getCluster("1", map[string]string{"plan": "silver"}, 0, nil, nil),
+					_getCluster("2", map[string]string{"plan": "gold"}, 4, nil, nil),
+					_getCluster("3", map[string]string{"plan": "gold"}, 3, nil, nil),
+				},
+			},
+			want: "3",
+		},
+		{
+			name: "fail if no cluster matches label selector",
+			args: args{
+				labelSelector: "plan=gold",
+				clusters: []resourcev1alpha1.SFCluster{
+					_getCluster("1", map[string]string{"plan": "silver"}, 0, nil, nil),
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail if label selector is invalid",
+			args: args{
+				labelSelector: "plan==gold=",
+				clusters: []resourcev1alpha1.SFCluster{
+					_getCluster("1", nil, 0, nil, nil),
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "skip clusters filled beyond scheduling limit",
+			args: args{
+				clusters: []resourcev1alpha1.SFCluster{
+					full,
+					_getCluster("2", nil, 10, nil, nil),
+				},
+			},
+			want: "2",
+		},
+		{
+			name: "skip unschedulable clusters",
+			args: args{
+				clusters: []resourcev1alpha1.SFCluster{
+					cordoned,
+					_getCluster("2", nil, 10, nil, nil),
+				},
+			},
+			want: "2",
+		},
+		{
+			name: "fail if all clusters are unschedulable",
+			args: args{
+				clusters: []resourcev1alpha1.SFCluster{
+					cordoned,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "skip clusters which are not ready",
+			args: args{
+				clusters: []resourcev1alpha1.SFCluster{
+					notReady,
+					_getCluster("2", nil, 10, nil, nil),
+				},
+			},
+			want: "2",
+		},
+		{
+			name: "skip excluded clusters",
+			args: args{
+				exclude: []string{"1", "2"},
+				clusters: []resourcev1alpha1.SFCluster{
+					_getCluster("1", nil, 0, nil, nil),
+					_getCluster("2", nil, 1, nil, nil),
+					_getCluster("3", nil, 5, nil, nil),
+				},
+			},
+			want: "3",
+		},
+		{
+			name: "schedule on cluster with max allocatable",
+			args: args{
+				requests: _getResources(1, 1024),
+				clusters: []resourcev1alpha1.SFCluster{
+					_getCluster("1", nil, 0, _getResources(4, 4096), _getResources(2, 1024)),
+					_getCluster("2", nil, 0, _getResources(8, 8192), _getResources(2, 1024)),
+					_getCluster("3", nil, 0, _getResources(8, 8192), _getResources(7, 1024)),
+				},
+			},
+			want: "2",
+		},
+		{
+			name: "schedule on fullest cluster which fits the requests",
+			args: args{
+				profile:  MostAllocatedProfile,
+				requests: _getResources(1, 1024),
+				clusters: []resourcev1alpha1.SFCluster{
+					_getCluster("1", nil, 0, _getResources(4, 4096), _getResources(2, 1024)),
+					_getCluster("2", nil, 0, _getResources(8, 8192), _getResources(2, 1024)),
+					_getCluster("3", nil, 0, _getResources(8, 8192), _getResources(8, 1024)),
+				},
+			},
+			want: "1",
+		},
+		{
+			name: "schedule on cluster with highest average utilization",
+			args: args{
+				profile:  MostAllocatedProfile,
+				requests: _getResources(1, 1024),
+				clusters: []resourcev1alpha1.SFCluster{
+					_getCluster("1", nil, 0, _getResources(10, 10240), _getResources(8, 0)),
+					_getCluster("2", nil, 0, _getResources(10, 10240), _getResources(4, 5120)),
+				},
+			},
+			want: "2",
+		},
+		{
+			name: "fail if no cluster has required resources",
+			args: args{
+				requests: _getResources(4, 1024),
+				clusters: []resourcev1alpha1.SFCluster{
+					_getCluster("1", nil, 0, _getResources(4, 4096), _getResources(2, 1024)),
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "schedule on cluster with least instances with requests",
+			args: args{
+				profile:  LeastInstanceCountProfile,
+				requests: _getResources(1, 1024),
+				clusters: []resourcev1alpha1.SFCluster{
+					_getCluster("1", nil, 3, _getResources(4, 4096), _getResources(2, 1024)),
+					_getCluster("2", nil, 5, _getResources(8, 8192), _getResources(2, 1024)),
+				},
+			},
+			want: "1",
+		},
+		{
+			name: "schedule on cheapest cluster",
+			args: args{
+				profile: "cheapest",
+				clusters: []resourcev1alpha1.SFCluster{
+					_getCluster("1", nil, 0, nil, nil),
+					_getCluster("2", map[string]string{constants.ClusterCostKey: "3"}, 0, nil, nil),
+					_getCluster("3", map[string]string{constants.ClusterCostKey: "0.5"}, 0, nil, nil),
+				},
+			},
+			want: "3",
+		},
+		{
+			name: "skip unschedulable cluster with profile from config",
+			args: args{
+				profile: "cheapest",
+				clusters: []resourcev1alpha1.SFCluster{
+					_getCluster("1", map[string]string{constants.ClusterCostKey: "3"}, 0, nil, nil),
+					func() resourcev1alpha1.SFCluster {
+						cluster := _getCluster("2", map[string]string{constants.ClusterCostKey: "0.5"}, 0, nil, nil)
+						cluster.Spec.Unschedulable = true
+						return cluster
+					}(),
+				},
+			},
+			want: "1",
+		},
+		{
+			name: "skip cluster in pull mode if excluded",
+			args: args{
+				profile:  "cheapest",
+				pullMode: true,
+				clusters: []resourcev1alpha1.SFCluster{
+					_getCluster("1", map[string]string{constants.ClusterCostKey: "3"}, 0, nil, nil),
+					func() resourcev1alpha1.SFCluster {
+						cluster := _getCluster("2", map[string]string{constants.ClusterCostKey: "0.5"}, 0, nil, nil)
+						cluster.Spec.Mode = resourcev1alpha1.ClusterModePull
+						return cluster
+					}(),
+				},
+			},
+			want: "1",
+		},
+		{
+			name: "fail if profile is not found",
+			args: args{
+				profile: "unknown",
+				clusters: []resourcev1alpha1.SFCluster{
+					_getCluster("1", nil, 0, nil, nil),
+				},
+			},
+			wantErr: true,
+		},
+	}
+	profiles := []config.SchedulerProfile{
+		{
+			Name:    "cheapest",
+			Filters: []string{LabelSelectorName},
+			Scores: []config.SchedulerPluginWeight{
+				{Name: CostName, Weight: 2},
+				{Name: SpreadName},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sctx := &SchedulingContext{
+				Instance:        &osbv1alpha1.SFServiceInstance{},
+				LabelSelector:   tt.args.labelSelector,
+				Requests:        tt.args.requests,
+				ExcludeClusters: tt.args.exclude,
+				ExcludePullMode: tt.args.pullMode,
+			}
+			profile, err := GetProfile(tt.args.profile, tt.args.requests, profiles)
+			if err != nil {
+				if !tt.wantErr || !errors.SchedulerFailed(err) {
+					t.Errorf("GetProfile() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			f, err := New(profile, nil)
+			if err != nil {
+				t.Errorf("New() error = %v", err)
+				return
+			}
+			got, err := f.Schedule(sctx, tt.args.clusters)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Schedule() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil && !errors.SchedulerFailed(err) {
+				t.Errorf("Schedule() error = %v, want SchedulerFailed", err)
+			}
+			if got != tt.want {
+				t.Errorf("Schedule() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_framework_Schedule_decision(t *testing.T) {
+	small := _getCluster("small", nil, 0, _getResources(8, 8192), _getResources(4, 1024))
+	large := _getCluster("large", nil, 0, _getResources(16, 16384), _getResources(2, 1024))
+	full := _getCluster("full", nil, 0, _getResources(2, 2048), _getResources(2, 2048))
+	requests := _getResources(1, 512)
+
+	profile, err := GetProfile("", requests, nil)
+	if err != nil {
+		t.Fatalf("GetProfile() error = %v", err)
+	}
+	f, err := New(profile, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	sctx := &SchedulingContext{
+		Instance: &osbv1alpha1.SFServiceInstance{},
+		Requests: requests,
+	}
+	got, err := f.Schedule(sctx, []resourcev1alpha1.SFCluster{small, large, full})
+	if err != nil {
+		t.Fatalf("Schedule() error = %v", err)
+	}
+
+	decision := sctx.Decision
+	if decision == nil {
+		t.Fatalf("Schedule() did not record the decision")
+	}
+	if decision.SelectedCluster != got || got != "large" {
+		t.Errorf("Decision.SelectedCluster = %v, Schedule() = %v, want large", decision.SelectedCluster, got)
+	}
+	if decision.Profile != profile.Name {
+		t.Errorf("Decision.Profile = %v, want %v", decision.Profile, profile.Name)
+	}
+	if len(decision.Clusters) != 3 {
+		t.Fatalf("len(Decision.Clusters) = %d, want 3", len(decision.Clusters))
+	}
+	for _, record := range decision.Clusters {
+		switch record.ClusterID {
+		case "full":
+			if record.Feasible || record.Plugin != CapacityName || record.Reason == "" {
+				t.Errorf("Decision for full = %+v, want filtered by %s", record, CapacityName)
+			}
+		case "large":
+			if !record.Feasible || record.Scores[CapacityName] != MaxClusterScore {
+				t.Errorf("Decision for large = %+v, want %s score %d", record, CapacityName, MaxClusterScore)
+			}
+		case "small":
+			if !record.Feasible || record.Scores[CapacityName] != 0 {
+				t.Errorf("Decision for small = %+v, want %s score 0", record, CapacityName)
+			}
+		}
+	}
+
+	// Reasons are recorded when no cluster is feasible
+	_, err = f.Schedule(sctx, []resourcev1alpha1.SFCluster{full})
+	if err == nil {
+		t.Fatalf("Schedule() expected error")
+	}
+	if sctx.Decision.SelectedCluster != "" || sctx.Decision.Message == "" || len(sctx.Decision.Clusters) != 1 {
+		t.Errorf("Decision = %+v, want failure recorded", sctx.Decision)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile *config.SchedulerProfile
+		wantErr bool
+	}{
+		{
+			name:    "fail on nil profile",
+			wantErr: true,
+		},
+		{
+			name: "fail on unknown plugin",
+			profile: &config.SchedulerProfile{
+				Name:    "test",
+				Filters: []string{"Unknown"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail if score plugin used as filter",
+			profile: &config.SchedulerProfile{
+				Name:    "test",
+				Filters: []string{SpreadName},
+			},
+			wantErr: true,
+		},
+		{
+			name: "create framework with same plugin as filter and score",
+			profile: &config.SchedulerProfile{
+				Name:    "test",
+				Filters: []string{CapacityName},
+				Scores: []config.SchedulerPluginWeight{
+					{Name: CapacityName},
+				},
+			},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.profile, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNew_requiredFilters(t *testing.T) {
+	profile := &config.SchedulerProfile{
+		Name: "cheapest",
+		Scores: []config.SchedulerPluginWeight{
+			{Name: CostName},
+		},
+	}
+	f, err := New(profile, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	cheapest := _getCluster("cheapest", map[string]string{"plan": "silver", constants.ClusterCostKey: "0.1"}, 0, nil, nil)
+	small := _getCluster("small", map[string]string{"plan": "gold", constants.ClusterCostKey: "0.2"}, 0,
+		_getResources(2, 2048), _getResources(2, 1024))
+	large := _getCluster("large", map[string]string{"plan": "gold", constants.ClusterCostKey: "0.5"}, 0,
+		_getResources(8, 8192), _getResources(2, 1024))
+	sctx := &SchedulingContext{
+		Instance:      &osbv1alpha1.SFServiceInstance{},
+		LabelSelector: "plan=gold",
+		Requests:      _getResources(1, 512),
+	}
+	got, err := f.Schedule(sctx, []resourcev1alpha1.SFCluster{cheapest, small, large})
+	if err != nil {
+		t.Fatalf("Schedule() error = %v", err)
+	}
+	if got != "large" {
+		t.Errorf("Schedule() = %v, want large", got)
+	}
+	for _, record := range sctx.Decision.Clusters {
+		switch record.ClusterID {
+		case "cheapest":
+			if record.Plugin != LabelSelectorName {
+				t.Errorf("Decision for cheapest = %+v, want filtered by %s", record, LabelSelectorName)
+			}
+		case "small":
+			if record.Plugin != CapacityName {
+				t.Errorf("Decision for small = %+v, want filtered by %s", record, CapacityName)
+			}
+		}
+	}
+}
+
+func Test_normalizeScores(t *testing.T) {
+	scores := []int64{-5, -2, -2, 1}
+	normalizeScores(scores)
+	want := []int64{0, 50, 50, 100}
+	for i := range scores {
+		if scores[i] != want[i] {
+			t.Errorf("normalizeScores() = %v, want %v", scores, want)
+			return
+		}
+	}
+
+	scores = []int64{3, 3}
+	normalizeScores(scores)
+	if scores[0] != MaxClusterScore || scores[1] != MaxClusterScore {
+		t.Errorf("normalizeScores() = %v, want all %d", scores, MaxClusterScore)
+	}
+}
+
+func TestIsResolvable(t *testing.T) {
+	tests := []struct {
+		name     string
+		requests corev1.ResourceList
+		cluster  resourcev1alpha1.SFCluster
+		want     bool
+	}{
+		{
+			name:     "resolvable if cluster has insufficient resources",
+			requests: _getResources(4, 1024),
+			cluster:  _getCluster("1", map[string]string{"plan": "gold"}, 0, _getResources(4, 4096), _getResources(2, 1024)),
+			want:     true,
+		},
+		{
+			name:     "unresolvable if cluster labels do not match",
+			requests: _getResources(1, 1024),
+			cluster:  _getCluster("1", map[string]string{"plan": "silver"}, 0, _getResources(4, 4096), nil),
+			want:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sctx := &SchedulingContext{
+				Instance:      &osbv1alpha1.SFServiceInstance{},
+				LabelSelector: "plan=gold",
+				Requests:      tt.requests,
+			}
+			profile, _ := GetProfile("", tt.requests, nil)
+			f, _ := New(profile, nil)
+			_, err := f.Schedule(sctx, []resourcev1alpha1.SFCluster{tt.cluster})
+			if err == nil {
+				t.Errorf("Schedule() expected error")
+				return
+			}
+			if got := IsResolvable(err); got != tt.want {
+				t.Errorf("IsResolvable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// MaxClusterScore is the maximum score a cluster can get from a score plugin
+// after normalization
+const MaxClusterScore int64 = 100
+
+// Code is the result of running a filter plugin against a cluster
+type Code int
+
+const (
+	// Success means the cluster is feasible for the instance
+	Success Code = iota
+	// Unschedulable means the cluster is not feasible for the instance now,
+	// but might become feasible later. For example when capacity is added.
+	Unschedulable
+	// UnschedulableAndUnresolvable means the cluster is not feasible for the
+	// instance and waiting will not change it. For example when the cluster
+	// labels do not match the clusterSelector.
+	UnschedulableAndUnresolvable
+)
+
+// Status is the result of running a filter plugin against a cluster.
+// A nil Status means Success.
+type Status struct {
+	code   Code
+	reason string
+}
+
+// NewStatus returns a Status with the given code and reason
+func NewStatus(code Code, reason string) *Status {
+	return &Status{
+		code:   code,
+		reason: reason,
+	}
+}
+
+// Code returns the code of the Status
+func (s *Status) Code() Code {
+	if s == nil {
+		return Success
+	}
+	return s.code
+}
+
+// Reason returns the reason of the Status
+func (s *Status) Reason() string {
+	if s == nil {
+		return ""
+	}
+	return s.reason
+}
+
+// IsSuccess returns true if the cluster is feasible
+func (s *Status) IsSuccess() bool {
+	return s.Code() == Success
+}
+
+// Plugin is the parent type of all scheduler plugins
+type Plugin interface {
+	Name() string
+}
+
+// PreFilterPlugin is called once per scheduling cycle with all the clusters
+// before filtering. It can be used to validate and preprocess the
+// SchedulingContext.
+type PreFilterPlugin interface {
+	Plugin
+	PreFilter(sctx *SchedulingContext, clusters []resourcev1alpha1.SFCluster) error
+}
+
+// FilterPlugin rules out clusters which are not feasible for the instance
+type FilterPlugin interface {
+	Plugin
+	Filter(sctx *SchedulingContext, cluster *resourcev1alpha1.SFCluster) *Status
+}
+
+// RelaxablePlugin is a filter plugin whose constraint can be relaxed when no
+// cluster is feasible. Relax returns false if the constraint can not be
+// relaxed further.
+type RelaxablePlugin interface {
+	FilterPlugin
+	Relax(sctx *SchedulingContext) bool
+}
+
+// PreScorePlugin is called once per scheduling cycle with all the feasible
+// clusters before scoring
+type PreScorePlugin interface {
+	Plugin
+	PreScore(sctx *SchedulingContext, clusters []*resourcev1alpha1.SFCluster) error
+}
+
+// ScorePlugin ranks the feasible clusters. Higher score is better. The raw
+// scores of a plugin are normalized to [0, MaxClusterScore] across the
+// feasible clusters before the weights are applied.
+type ScorePlugin interface {
+	Plugin
+	Score(sctx *SchedulingContext, cluster *resourcev1alpha1.SFCluster) (int64, error)
+}
+
+// PluginFactory creates a plugin. The client is passed for the plugins
+// which need to read other resources.
+type PluginFactory func(c client.Client) (Plugin, error)
@@ -0,0 +1,67 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// LabelSelectorName is the name of the LabelSelector plugin
+const LabelSelectorName = "LabelSelector"
+
+const labelSelectorStateKey = LabelSelectorName + "/selector"
+
+// LabelSelector filters out the clusters whose labels do not match the
+// clusterSelector of the plan
+type LabelSelector struct{}
+
+// NewLabelSelector returns a new LabelSelector plugin
+func NewLabelSelector(c client.Client) (Plugin, error) {
+	return &LabelSelector{}, nil
+}
+
+// Name returns the name of the plugin
+func (p *LabelSelector) Name() string {
+	return LabelSelectorName
+}
+
+// PreFilter parses the label selector of the SchedulingContext
+func (p *LabelSelector) PreFilter(sctx *SchedulingContext, clusters []resourcev1alpha1.SFCluster) error {
+	selector, err := labels.Parse(sctx.LabelSelector)
+	if err != nil {
+		return errors.NewSchedulerFailed("Label Based Scheduler", "Parsing failed for labelSelector: "+sctx.LabelSelector, err)
+	}
+	sctx.Write(labelSelectorStateKey, selector)
+	return nil
+}
+
+// Filter checks whether the cluster labels match the label selector
+func (p *LabelSelector) Filter(sctx *SchedulingContext, cluster *resourcev1alpha1.SFCluster) *Status {
+	val, ok := sctx.Read(labelSelectorStateKey)
+	if !ok {
+		return nil
+	}
+	selector := val.(labels.Selector)
+	if !selector.Matches(labels.Set(cluster.GetLabels())) {
+		return NewStatus(UnschedulableAndUnresolvable, "cluster(s) didn't match clusterSelector")
+	}
+	return nil
+}
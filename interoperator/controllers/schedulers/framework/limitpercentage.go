@@ -0,0 +1,65 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// LimitPercentageName is the name of the LimitPercentage plugin
+const LimitPercentageName = "LimitPercentage"
+
+// LimitPercentage filters out the clusters whose requests exceed the
+// SchedulingLimitPercentage of their capacity
+type LimitPercentage struct{}
+
+// NewLimitPercentage returns a new LimitPercentage plugin
+func NewLimitPercentage(c client.Client) (Plugin, error) {
+	return &LimitPercentage{}, nil
+}
+
+// Name returns the name of the plugin
+func (p *LimitPercentage) Name() string {
+	return LimitPercentageName
+}
+
+// Filter checks whether the cluster is filled beyond its scheduling limit
+func (p *LimitPercentage) Filter(sctx *SchedulingContext, cluster *resourcev1alpha1.SFCluster) *Status {
+	if isClusterFull(cluster) {
+		return NewStatus(Unschedulable, "cluster(s) filled beyond scheduling limit")
+	}
+	return nil
+}
+
+// isClusterFull returns true if the requests on the cluster exceed the
+// SchedulingLimitPercentage of the cluster capacity. Clusters without
+// SchedulingLimitPercentage or without a known capacity are never full.
+func isClusterFull(cluster *resourcev1alpha1.SFCluster) bool {
+	if cluster.Spec.SchedulingLimitPercentage <= 0 {
+		return false
+	}
+	capacity := getCapacity(cluster)
+	for key, limit := range capacity {
+		requested, ok := cluster.Status.Requests[key]
+		if ok && requested.Cmp(limit) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// MostAllocatedName is the name of the MostAllocated plugin
+const MostAllocatedName = "MostAllocated"
+
+// MostAllocated prefers the clusters with the highest utilization of the
+// scored resources after placing the instance, so that instances are packed
+// on fewer clusters. Each resource contributes the fraction of the capacity
+// of the cluster which would be requested, so resources with different units
+// are weighted equally.
+type MostAllocated struct{}
+
+// NewMostAllocated returns a new MostAllocated plugin
+func NewMostAllocated(c client.Client) (Plugin, error) {
+	return &MostAllocated{}, nil
+}
+
+// Name returns the name of the plugin
+func (p *MostAllocated) Name() string {
+	return MostAllocatedName
+}
+
+// Score returns the average utilization of the scored resources of the
+// cluster including the requests of the instance
+func (p *MostAllocated) Score(sctx *SchedulingContext, cluster *resourcev1alpha1.SFCluster) (int64, error) {
+	capacity := getCapacity(cluster)
+	keys := scoredResources(sctx.Requests)
+
+	var score int64
+	for _, key := range keys {
+		total, ok := capacity[key]
+		if !ok || total.MilliValue() <= 0 {
+			continue
+		}
+		var used int64
+		if quantity, ok := cluster.Status.Requests[key]; ok {
+			used += quantity.MilliValue()
+		}
+		if quantity, ok := sctx.Requests[key]; ok {
+			used += quantity.MilliValue()
+		}
+		if used > total.MilliValue() {
+			used = total.MilliValue()
+		}
+		score += used * MaxClusterScore / total.MilliValue()
+	}
+	return score / int64(len(keys)), nil
+}
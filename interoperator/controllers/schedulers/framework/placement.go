@@ -0,0 +1,313 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	"context"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Types of placement rules
+const (
+	// SpreadRule spreads the instances of the same scope across clusters
+	SpreadRule = "Spread"
+	// ColocateRule keeps the instances of the same scope on one cluster
+	ColocateRule = "Colocate"
+	// AntiAffinityRule avoids the clusters hosting any of the named instances
+	AntiAffinityRule = "AntiAffinity"
+)
+
+// Scopes of placement rules
+const (
+	OrganizationScope = "organization"
+	SpaceScope        = "space"
+)
+
+// PlacementRule is a rule for placing an instance relative to other
+// instances. It is provided in the context of the plan.
+type PlacementRule struct {
+	// Type is one of Spread, Colocate or AntiAffinity
+	Type string `yaml:"type" json:"type"`
+
+	// Scope is one of organization or space. The instances with the same
+	// organization or space as the scheduled instance are considered.
+	// Used by Spread and Colocate rules.
+	Scope string `yaml:"scope,omitempty" json:"scope,omitempty"`
+
+	// MaxSkew is the maximum allowed difference of the number of instances
+	// of the scope between the clusters. If not set, the spread is only
+	// preferred. Used by Spread rules.
+	MaxSkew int `yaml:"maxSkew,omitempty" json:"maxSkew,omitempty"`
+
+	// Instances are the ids of the instances whose clusters are avoided.
+	// Used by AntiAffinity rules.
+	Instances []string `yaml:"instances,omitempty" json:"instances,omitempty"`
+}
+
+const placementStateKey = "placement"
+
+// placementState holds the placement of the other instances
+// relevant to the placement rules
+type placementState struct {
+	// counts is the number of instances of a scope on each cluster
+	counts map[string]map[string]int
+
+	// minCounts is the least number of instances of a scope on any
+	// of the schedulable clusters matching the label selector
+	minCounts map[string]int
+
+	// avoid is the set of clusters hosting the instances of
+	// the AntiAffinity rules
+	avoid map[string]bool
+}
+
+// validatePlacementRules returns an error if any of the rules is invalid
+func validatePlacementRules(rules []PlacementRule) error {
+	for _, rule := range rules {
+		switch rule.Type {
+		case SpreadRule, ColocateRule:
+			if rule.Scope != OrganizationScope && rule.Scope != SpaceScope {
+				return errors.NewSchedulerFailed("Placement Rules", "Invalid scope "+rule.Scope+" for rule "+rule.Type, nil)
+			}
+		case AntiAffinityRule:
+		default:
+			return errors.NewSchedulerFailed("Placement Rules", "Invalid placement rule type "+rule.Type, nil)
+		}
+	}
+	return nil
+}
+
+// getScopeID returns the organization or space of the instance
+func getScopeID(instance *osbv1alpha1.SFServiceInstance, scope string) string {
+	switch scope {
+	case OrganizationScope:
+		return instance.Spec.OrganizationGUID
+	case SpaceScope:
+		return instance.Spec.SpaceGUID
+	}
+	return ""
+}
+
+// computePlacementState lists the instances and computes their placement.
+// It is computed only once per scheduling cycle and shared by the plugins.
+func computePlacementState(c client.Client, sctx *SchedulingContext, clusters []resourcev1alpha1.SFCluster) (*placementState, error) {
+	if val, ok := sctx.Read(placementStateKey); ok {
+		return val.(*placementState), nil
+	}
+
+	state := &placementState{
+		counts:    make(map[string]map[string]int),
+		minCounts: make(map[string]int),
+		avoid:     make(map[string]bool),
+	}
+	if len(sctx.PlacementRules) == 0 {
+		sctx.Write(placementStateKey, state)
+		return state, nil
+	}
+
+	err := validatePlacementRules(sctx.PlacementRules)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, errors.NewPreconditionError("computePlacementState", "client not set", nil)
+	}
+
+	avoidInstances := make(map[string]bool)
+	for _, rule := range sctx.PlacementRules {
+		if rule.Type == AntiAffinityRule {
+			for _, instanceID := range rule.Instances {
+				avoidInstances[instanceID] = true
+			}
+		} else {
+			state.counts[rule.Scope] = make(map[string]int)
+		}
+	}
+
+	instances := &osbv1alpha1.SFServiceInstanceList{}
+	err = c.List(context.Background(), instances)
+	if err != nil {
+		return nil, err
+	}
+	for _, instance := range instances.Items {
+		clusterID := instance.Spec.ClusterID
+		if clusterID == "" || !instance.GetDeletionTimestamp().IsZero() {
+			continue
+		}
+		if instance.GetName() == sctx.Instance.GetName() && instance.GetNamespace() == sctx.Instance.GetNamespace() {
+			continue
+		}
+		if avoidInstances[instance.GetName()] {
+			state.avoid[clusterID] = true
+		}
+		for scope, counts := range state.counts {
+			scopeID := getScopeID(sctx.Instance, scope)
+			if scopeID != "" && getScopeID(&instance, scope) == scopeID {
+				counts[clusterID]++
+			}
+		}
+	}
+
+	selector, err := labels.Parse(sctx.LabelSelector)
+	if err != nil {
+		selector = labels.Everything()
+	}
+	for scope, counts := range state.counts {
+		min := -1
+		for _, cluster := range clusters {
+			if cluster.Spec.Unschedulable || !selector.Matches(labels.Set(cluster.GetLabels())) {
+				continue
+			}
+			if min == -1 || counts[cluster.GetName()] < min {
+				min = counts[cluster.GetName()]
+			}
+		}
+		if min > 0 {
+			state.minCounts[scope] = min
+		}
+	}
+
+	sctx.Write(placementStateKey, state)
+	return state, nil
+}
+
+func readPlacementState(sctx *SchedulingContext) *placementState {
+	val, ok := sctx.Read(placementStateKey)
+	if !ok {
+		return nil
+	}
+	return val.(*placementState)
+}
+
+// InstanceSpreadName is the name of the InstanceSpread plugin
+const InstanceSpreadName = "InstanceSpread"
+
+// InstanceSpread evaluates the Spread placement rules of the plan.
+// As a filter plugin it filters out the clusters which would exceed the
+// MaxSkew of a rule. As a score plugin it prefers the clusters with less
+// instances of the same organization or space.
+type InstanceSpread struct {
+	client client.Client
+}
+
+// NewInstanceSpread returns a new InstanceSpread plugin
+func NewInstanceSpread(c client.Client) (Plugin, error) {
+	return &InstanceSpread{
+		client: c,
+	}, nil
+}
+
+// Name returns the name of the plugin
+func (p *InstanceSpread) Name() string {
+	return InstanceSpreadName
+}
+
+// PreFilter computes the placement of the other instances
+func (p *InstanceSpread) PreFilter(sctx *SchedulingContext, clusters []resourcev1alpha1.SFCluster) error {
+	_, err := computePlacementState(p.client, sctx, clusters)
+	return err
+}
+
+// Filter checks whether scheduling on the cluster would exceed the MaxSkew
+func (p *InstanceSpread) Filter(sctx *SchedulingContext, cluster *resourcev1alpha1.SFCluster) *Status {
+	state := readPlacementState(sctx)
+	if state == nil {
+		return nil
+	}
+	for _, rule := range sctx.PlacementRules {
+		if rule.Type != SpreadRule || rule.MaxSkew <= 0 {
+			continue
+		}
+		count := state.counts[rule.Scope][cluster.GetName()]
+		if count+1-state.minCounts[rule.Scope] > rule.MaxSkew {
+			return NewStatus(Unschedulable, "cluster(s) didn't match spread rule of "+rule.Scope)
+		}
+	}
+	return nil
+}
+
+// Score returns the negated number of instances of the same organization
+// or space on the cluster
+func (p *InstanceSpread) Score(sctx *SchedulingContext, cluster *resourcev1alpha1.SFCluster) (int64, error) {
+	state := readPlacementState(sctx)
+	if state == nil {
+		return 0, nil
+	}
+	var score int64
+	for _, rule := range sctx.PlacementRules {
+		if rule.Type == SpreadRule {
+			score -= int64(state.counts[rule.Scope][cluster.GetName()])
+		}
+	}
+	return score, nil
+}
+
+// InstanceAffinityName is the name of the InstanceAffinity plugin
+const InstanceAffinityName = "InstanceAffinity"
+
+// InstanceAffinity evaluates the Colocate and AntiAffinity placement rules
+// of the plan
+type InstanceAffinity struct {
+	client client.Client
+}
+
+// NewInstanceAffinity returns a new InstanceAffinity plugin
+func NewInstanceAffinity(c client.Client) (Plugin, error) {
+	return &InstanceAffinity{
+		client: c,
+	}, nil
+}
+
+// Name returns the name of the plugin
+func (p *InstanceAffinity) Name() string {
+	return InstanceAffinityName
+}
+
+// PreFilter computes the placement of the other instances
+func (p *InstanceAffinity) PreFilter(sctx *SchedulingContext, clusters []resourcev1alpha1.SFCluster) error {
+	_, err := computePlacementState(p.client, sctx, clusters)
+	return err
+}
+
+// Filter checks whether the cluster hosts the other instances of the same
+// organization or space for Colocate rules and whether the cluster hosts
+// any of the instances of AntiAffinity rules
+func (p *InstanceAffinity) Filter(sctx *SchedulingContext, cluster *resourcev1alpha1.SFCluster) *Status {
+	state := readPlacementState(sctx)
+	if state == nil {
+		return nil
+	}
+	if state.avoid[cluster.GetName()] {
+		return NewStatus(UnschedulableAndUnresolvable, "cluster(s) didn't match anti-affinity rule")
+	}
+	for _, rule := range sctx.PlacementRules {
+		if rule.Type != ColocateRule {
+			continue
+		}
+		counts := state.counts[rule.Scope]
+		if len(counts) > 0 && counts[cluster.GetName()] == 0 {
+			return NewStatus(UnschedulableAndUnresolvable, "cluster(s) didn't match colocate rule of "+rule.Scope)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	"testing"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func _getInstance(name, clusterID, org, space string) *osbv1alpha1.SFServiceInstance {
+	return &osbv1alpha1.SFServiceInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "sf-" + name,
+		},
+		Spec: osbv1alpha1.SFServiceInstanceSpec{
+			ClusterID:        clusterID,
+			OrganizationGUID: org,
+			SpaceGUID:        space,
+		},
+	}
+}
+
+func Test_PlacementRules(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := osbv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	c := fake.NewFakeClientWithScheme(scheme,
+		_getInstance("i1", "1", "org1", "space1"),
+		_getInstance("i2", "1", "org1", "space1"),
+		_getInstance("i3", "2", "org1", "space2"),
+		_getInstance("i4", "3", "org2", "space3"),
+		_getInstance("i5", "", "org1", "space1"),
+	)
+	clusters := []resourcev1alpha1.SFCluster{
+		_getCluster("1", nil, 0, nil, nil),
+		_getCluster("2", nil, 0, nil, nil),
+		_getCluster("3", nil, 0, nil, nil),
+	}
+
+	tests := []struct {
+		name    string
+		rules   []PlacementRule
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "spread instances of organization",
+			rules: []PlacementRule{
+				{Type: SpreadRule, Scope: OrganizationScope},
+			},
+			want: "3",
+		},
+		{
+			name: "spread instances of space with max skew",
+			rules: []PlacementRule{
+				{Type: SpreadRule, Scope: SpaceScope, MaxSkew: 1},
+				{Type: AntiAffinityRule, Instances: []string{"i3"}},
+			},
+			want: "3",
+		},
+		{
+			name: "colocate instances of space",
+			rules: []PlacementRule{
+				{Type: ColocateRule, Scope: SpaceScope},
+			},
+			want: "1",
+		},
+		{
+			name: "fail if colocated cluster is avoided",
+			rules: []PlacementRule{
+				{Type: ColocateRule, Scope: SpaceScope},
+				{Type: AntiAffinityRule, Instances: []string{"i2"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail on invalid rule",
+			rules: []PlacementRule{
+				{Type: SpreadRule, Scope: "region"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sctx := &SchedulingContext{
+				Instance:       _getInstance("new", "", "org1", "space1"),
+				PlacementRules: tt.rules,
+			}
+			profile, err := GetProfile(LeastInstanceCountProfile, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := New(profile, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := f.Schedule(sctx, clusters)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Schedule() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Schedule() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
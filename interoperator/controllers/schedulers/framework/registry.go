@@ -0,0 +1,127 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Names of the built-in scheduler profiles
+const (
+	// LeastInstanceCountProfile schedules on the cluster with the least
+	// number of service instances. It is the default for plans without
+	// requests.
+	LeastInstanceCountProfile = "least-instance-count"
+
+	// MaxAllocatableProfile schedules on the cluster with the maximum
+	// allocatable resources. It is the default for plans with requests.
+	MaxAllocatableProfile = "max-allocatable"
+
+	// MostAllocatedProfile schedules on the fullest cluster which still fits
+	// the requests of the plan, so that the other clusters can scale down
+	MostAllocatedProfile = "most-allocated"
+)
+
+// registry maps the plugin names to their factories
+var registry = map[string]PluginFactory{
+	LabelSelectorName:    NewLabelSelector,
+	LimitPercentageName:  NewLimitPercentage,
+	CapacityName:         NewCapacity,
+	SpreadName:           NewSpread,
+	CostName:             NewCost,
+	MostAllocatedName:    NewMostAllocated,
+	InstanceSpreadName:   NewInstanceSpread,
+	InstanceAffinityName: NewInstanceAffinity,
+	TopologyName:         NewTopology,
+	StorageName:          NewStorage,
+}
+
+// Register adds a plugin factory to the registry.
+// It must be called before the schedulers are started.
+func Register(name string, factory PluginFactory) error {
+	if _, ok := registry[name]; ok {
+		return errors.NewPreconditionError("Register", "plugin "+name+" already registered", nil)
+	}
+	registry[name] = factory
+	return nil
+}
+
+// requiredFilters enforce the clusterSelector, requests, storageRequests and
+// placementRules of the plan, the schedulingLimitPercentage of the clusters
+// and the preferred topology of the instance. They are run for every
+// profile, even if the profile does not list them.
+var requiredFilters = []string{
+	LabelSelectorName,
+	LimitPercentageName,
+	CapacityName,
+	StorageName,
+	InstanceAffinityName,
+	InstanceSpreadName,
+	TopologyName,
+}
+
+var builtinProfiles = []config.SchedulerProfile{
+	{
+		Name:    LeastInstanceCountProfile,
+		Filters: []string{LabelSelectorName, LimitPercentageName, StorageName, InstanceAffinityName, InstanceSpreadName, TopologyName},
+		Scores: []config.SchedulerPluginWeight{
+			{Name: SpreadName, Weight: 1},
+			{Name: InstanceSpreadName, Weight: 1},
+		},
+	},
+	{
+		Name:    MaxAllocatableProfile,
+		Filters: []string{LabelSelectorName, LimitPercentageName, CapacityName, StorageName, InstanceAffinityName, InstanceSpreadName, TopologyName},
+		Scores: []config.SchedulerPluginWeight{
+			{Name: CapacityName, Weight: 1},
+			{Name: InstanceSpreadName, Weight: 1},
+		},
+	},
+	{
+		Name:    MostAllocatedProfile,
+		Filters: []string{LabelSelectorName, LimitPercentageName, CapacityName, StorageName, InstanceAffinityName, InstanceSpreadName, TopologyName},
+		Scores: []config.SchedulerPluginWeight{
+			{Name: MostAllocatedName, Weight: 1},
+			{Name: InstanceSpreadName, Weight: 1},
+		},
+	},
+}
+
+// GetProfile returns the scheduler profile with the given name. Profiles
+// defined in the interoperator config take precedence over the built-in
+// profiles. If name is empty, the default profile is chosen based on
+// whether the plan has requests.
+func GetProfile(name string, requests corev1.ResourceList, profiles []config.SchedulerProfile) (*config.SchedulerProfile, error) {
+	if name == "" {
+		name = LeastInstanceCountProfile
+		if len(requests) != 0 {
+			name = MaxAllocatableProfile
+		}
+	}
+
+	for _, list := range [][]config.SchedulerProfile{profiles, builtinProfiles} {
+		for _, profile := range list {
+			if profile.Name == name {
+				return &profile, nil
+			}
+		}
+	}
+	return nil, errors.NewSchedulerFailed(name, "Scheduler profile "+name+" not found", nil)
+}
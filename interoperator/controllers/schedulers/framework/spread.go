@@ -0,0 +1,44 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SpreadName is the name of the Spread plugin
+const SpreadName = "Spread"
+
+// Spread prefers the clusters with less number of service instances
+type Spread struct{}
+
+// NewSpread returns a new Spread plugin
+func NewSpread(c client.Client) (Plugin, error) {
+	return &Spread{}, nil
+}
+
+// Name returns the name of the plugin
+func (p *Spread) Name() string {
+	return SpreadName
+}
+
+// Score returns the negated number of service instances on the cluster
+func (p *Spread) Score(sctx *SchedulingContext, cluster *resourcev1alpha1.SFCluster) (int64, error) {
+	return -int64(cluster.Status.ServiceInstanceCount), nil
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// StorageName is the name of the Storage plugin
+const StorageName = "Storage"
+
+// Storage filters out the clusters which do not have enough storage of the
+// requested storage classes for the storage requests of the plan
+type Storage struct{}
+
+// NewStorage returns a new Storage plugin
+func NewStorage(c client.Client) (Plugin, error) {
+	return &Storage{}, nil
+}
+
+// Name returns the name of the plugin
+func (p *Storage) Name() string {
+	return StorageName
+}
+
+// Filter checks whether the storage requests fit in the allocatable storage
+// of the cluster
+func (p *Storage) Filter(sctx *SchedulingContext, cluster *resourcev1alpha1.SFCluster) *Status {
+	for storageClassName, request := range sctx.StorageRequests {
+		usage := cluster.Status.GetStorage(storageClassName)
+		if usage == nil {
+			return NewStatus(UnschedulableAndUnresolvable, "cluster(s) without storage class "+storageClassName)
+		}
+		allocatable := getAllocatableStorage(cluster, usage)
+		if request.Cmp(allocatable) > 0 {
+			return NewStatus(Unschedulable, "cluster(s) with insufficient storage of class "+storageClassName)
+		}
+	}
+	return nil
+}
+
+// getAllocatableStorage returns the storage of the storage class which can
+// still be claimed on the cluster. The declared TotalCapacity is used if set,
+// else the capacity of the existing persistent volumes. Only
+// SchedulingLimitPercentage of the capacity is considered, if it is set.
+func getAllocatableStorage(cluster *resourcev1alpha1.SFCluster, usage *resourcev1alpha1.StorageClassUsage) resource.Quantity {
+	capacity := usage.Capacity.DeepCopy()
+	if usage.TotalCapacity != nil {
+		capacity = usage.TotalCapacity.DeepCopy()
+	}
+	limit := cluster.Spec.SchedulingLimitPercentage
+	if limit > 0 && limit < 100 {
+		capacity = *resource.NewQuantity(capacity.Value()*int64(limit)/100, capacity.Format)
+	}
+	capacity.Sub(usage.Requests)
+	return capacity
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	"testing"
+
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func _getStorageCluster(limit int, storage ...resourcev1alpha1.StorageClassUsage) *resourcev1alpha1.SFCluster {
+	cluster := _getCluster("1", nil, 0, nil, nil)
+	cluster.Spec.SchedulingLimitPercentage = limit
+	cluster.Status.Storage = storage
+	return &cluster
+}
+
+func _getStorageUsage(storageClassName, capacity, totalCapacity, requests string) resourcev1alpha1.StorageClassUsage {
+	usage := resourcev1alpha1.StorageClassUsage{
+		StorageClassName: storageClassName,
+		Capacity:         resource.MustParse(capacity),
+		Requests:         resource.MustParse(requests),
+	}
+	if totalCapacity != "" {
+		quantity := resource.MustParse(totalCapacity)
+		usage.TotalCapacity = &quantity
+	}
+	return usage
+}
+
+func TestStorage_Filter(t *testing.T) {
+	tests := []struct {
+		name     string
+		requests map[string]resource.Quantity
+		cluster  *resourcev1alpha1.SFCluster
+		want     Code
+	}{
+		{
+			name:     "pass if plan has no storage requests",
+			requests: nil,
+			cluster:  _getStorageCluster(0),
+			want:     Success,
+		},
+		{
+			name: "fail if cluster does not have the storage class",
+			requests: map[string]resource.Quantity{
+				"premium": resource.MustParse("10Gi"),
+			},
+			cluster: _getStorageCluster(0, _getStorageUsage("standard", "100Gi", "", "0")),
+			want:    UnschedulableAndUnresolvable,
+		},
+		{
+			name: "pass if the request fits in the total capacity",
+			requests: map[string]resource.Quantity{
+				"standard": resource.MustParse("10Gi"),
+			},
+			cluster: _getStorageCluster(0, _getStorageUsage("standard", "20Gi", "100Gi", "20Gi")),
+			want:    Success,
+		},
+		{
+			name: "fail if the request exceeds the total capacity",
+			requests: map[string]resource.Quantity{
+				"standard": resource.MustParse("10Gi"),
+			},
+			cluster: _getStorageCluster(0, _getStorageUsage("standard", "100Gi", "30Gi", "25Gi")),
+			want:    Unschedulable,
+		},
+		{
+			name: "use capacity of the volumes if total capacity is not set",
+			requests: map[string]resource.Quantity{
+				"standard": resource.MustParse("10Gi"),
+			},
+			cluster: _getStorageCluster(0, _getStorageUsage("standard", "100Gi", "", "80Gi")),
+			want:    Success,
+		},
+		{
+			name: "fail if the request exceeds the scheduling limit",
+			requests: map[string]resource.Quantity{
+				"standard": resource.MustParse("10Gi"),
+			},
+			cluster: _getStorageCluster(50, _getStorageUsage("standard", "0", "100Gi", "45Gi")),
+			want:    Unschedulable,
+		},
+	}
+	p := &Storage{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sctx := &SchedulingContext{
+				StorageRequests: tt.requests,
+			}
+			if got := p.Filter(sctx, tt.cluster); got.Code() != tt.want {
+				t.Errorf("Filter() = %v, want %v", got.Code(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	"encoding/json"
+	"strings"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// TopologyName is the name of the Topology plugin
+const TopologyName = "Topology"
+
+// Fallbacks of the topology config
+const (
+	// TopologyFallbackNone schedules only in the preferred zone and region
+	TopologyFallbackNone = "None"
+	// TopologyFallbackOtherZones schedules in the other zones of the
+	// preferred region if no cluster in the preferred zone is feasible
+	TopologyFallbackOtherZones = "OtherZones"
+	// TopologyFallbackOtherRegions additionally schedules in the other
+	// regions if no cluster in the preferred region is feasible
+	TopologyFallbackOtherRegions = "OtherRegions"
+)
+
+// TopologyPreference is the preferred location of an instance
+type TopologyPreference struct {
+	Region   string
+	Zone     string
+	Fallback string
+}
+
+// topology levels, each level relaxes one more constraint
+const (
+	topologyLevelZone = iota
+	topologyLevelRegion
+	topologyLevelAny
+)
+
+const topologyLevelKey = TopologyName + "/level"
+
+// GetTopologyPreference reads the preferred region and zone of the instance from its
+// context. It returns nil if no topology is configured or the context does
+// not contain the configured keys.
+func GetTopologyPreference(instance *osbv1alpha1.SFServiceInstance, cfg *config.TopologyConfig) (*TopologyPreference, error) {
+	if cfg == nil || instance == nil || instance.Spec.RawContext == nil {
+		return nil, nil
+	}
+	switch cfg.Fallback {
+	case "", TopologyFallbackNone, TopologyFallbackOtherZones, TopologyFallbackOtherRegions:
+	default:
+		return nil, errors.NewInputError("GetTopologyPreference", "topology.fallback "+cfg.Fallback, nil)
+	}
+
+	var context map[string]interface{}
+	err := json.Unmarshal(instance.Spec.RawContext.Raw, &context)
+	if err != nil {
+		return nil, errors.NewMarshalError("Failed to read context of instance "+instance.GetName(), err)
+	}
+
+	t := &TopologyPreference{
+		Region:   contextValue(context, cfg.RegionContextKey),
+		Zone:     contextValue(context, cfg.ZoneContextKey),
+		Fallback: cfg.Fallback,
+	}
+	if t.Region == "" && t.Zone == "" {
+		return nil, nil
+	}
+	if t.Fallback == "" {
+		t.Fallback = TopologyFallbackNone
+	}
+	return t, nil
+}
+
+// contextValue returns the string at the dot separated path in the context
+func contextValue(context map[string]interface{}, path string) string {
+	if path == "" {
+		return ""
+	}
+	keys := strings.Split(path, ".")
+	var val interface{} = context
+	for _, key := range keys {
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		val = m[key]
+	}
+	str, _ := val.(string)
+	return str
+}
+
+// Topology filters out the clusters whose topology labels do not match the
+// preferred region and zone of the instance. If no cluster is feasible, the
+// zone and then the region constraint is relaxed as allowed by the fallback.
+type Topology struct{}
+
+// NewTopology returns a new Topology plugin
+func NewTopology(c client.Client) (Plugin, error) {
+	return &Topology{}, nil
+}
+
+// Name returns the name of the plugin
+func (p *Topology) Name() string {
+	return TopologyName
+}
+
+// level returns the topology level of the current scheduling cycle
+func (p *Topology) level(sctx *SchedulingContext) int {
+	val, ok := sctx.Read(topologyLevelKey)
+	if !ok {
+		return topologyLevelZone
+	}
+	return val.(int)
+}
+
+// Filter checks the topology labels of the cluster against the preference
+// of the instance at the current level
+func (p *Topology) Filter(sctx *SchedulingContext, cluster *resourcev1alpha1.SFCluster) *Status {
+	t := sctx.Topology
+	if t == nil {
+		return nil
+	}
+	level := p.level(sctx)
+	labels := cluster.GetLabels()
+	if t.Region != "" && level < topologyLevelAny && labels[constants.TopologyRegionKey] != t.Region {
+		return NewStatus(UnschedulableAndUnresolvable, "cluster not in region "+t.Region)
+	}
+	if t.Zone != "" && level < topologyLevelRegion && labels[constants.TopologyZoneKey] != t.Zone {
+		return NewStatus(UnschedulableAndUnresolvable, "cluster not in zone "+t.Zone)
+	}
+	return nil
+}
+
+// Relax moves to the next level allowed by the fallback. Levels which
+// would not change the result, like the zone level when no zone is
+// preferred, are skipped.
+func (p *Topology) Relax(sctx *SchedulingContext) bool {
+	t := sctx.Topology
+	if t == nil {
+		return false
+	}
+	maxLevel := topologyLevelZone
+	switch t.Fallback {
+	case TopologyFallbackOtherZones:
+		maxLevel = topologyLevelRegion
+	case TopologyFallbackOtherRegions:
+		maxLevel = topologyLevelAny
+	}
+
+	level := p.level(sctx)
+	for level < maxLevel {
+		level++
+		if level == topologyLevelRegion && t.Zone == "" {
+			continue
+		}
+		if level == topologyLevelAny && t.Region == "" {
+			continue
+		}
+		sctx.Write(topologyLevelKey, level)
+		return true
+	}
+	return false
+}
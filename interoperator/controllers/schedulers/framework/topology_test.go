@@ -0,0 +1,222 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	"reflect"
+	"testing"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func _getTopologyCluster(name, region, zone string, cpu int64) resourcev1alpha1.SFCluster {
+	labels := map[string]string{
+		constants.TopologyRegionKey: region,
+		constants.TopologyZoneKey:   zone,
+	}
+	return _getCluster(name, labels, 0, _getResources(4, 4096), _getResources(cpu, 0))
+}
+
+func TestGetTopologyPreference(t *testing.T) {
+	instance := &osbv1alpha1.SFServiceInstance{}
+	instance.Spec.RawContext = &runtime.RawExtension{
+		Raw: []byte(`{"platform":"cloudfoundry","landscape":{"region":"eu10","zone":"eu10-a"}}`),
+	}
+	tests := []struct {
+		name    string
+		cfg     *config.TopologyConfig
+		want    *TopologyPreference
+		wantErr bool
+	}{
+		{
+			name: "return nil if topology is not configured",
+			cfg:  nil,
+			want: nil,
+		},
+		{
+			name: "read region and zone from context",
+			cfg: &config.TopologyConfig{
+				RegionContextKey: "landscape.region",
+				ZoneContextKey:   "landscape.zone",
+				Fallback:         TopologyFallbackOtherZones,
+			},
+			want: &TopologyPreference{
+				Region:   "eu10",
+				Zone:     "eu10-a",
+				Fallback: TopologyFallbackOtherZones,
+			},
+		},
+		{
+			name: "default fallback to None",
+			cfg: &config.TopologyConfig{
+				RegionContextKey: "landscape.region",
+			},
+			want: &TopologyPreference{
+				Region:   "eu10",
+				Fallback: TopologyFallbackNone,
+			},
+		},
+		{
+			name: "return nil if the keys are not in the context",
+			cfg: &config.TopologyConfig{
+				RegionContextKey: "region",
+				ZoneContextKey:   "platform.zone",
+			},
+			want: nil,
+		},
+		{
+			name: "fail for invalid fallback",
+			cfg: &config.TopologyConfig{
+				RegionContextKey: "landscape.region",
+				Fallback:         "Anywhere",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetTopologyPreference(instance, tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetTopologyPreference() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetTopologyPreference() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Topology(t *testing.T) {
+	tests := []struct {
+		name     string
+		topology *TopologyPreference
+		clusters []resourcev1alpha1.SFCluster
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "schedule on any cluster without topology",
+			topology: nil,
+			clusters: []resourcev1alpha1.SFCluster{
+				_getTopologyCluster("1", "eu10", "eu10-a", 3),
+				_getTopologyCluster("2", "us10", "us10-a", 0),
+			},
+			want: "2",
+		},
+		{
+			name: "schedule in preferred zone",
+			topology: &TopologyPreference{
+				Region:   "eu10",
+				Zone:     "eu10-a",
+				Fallback: TopologyFallbackOtherRegions,
+			},
+			clusters: []resourcev1alpha1.SFCluster{
+				_getTopologyCluster("1", "eu10", "eu10-a", 2),
+				_getTopologyCluster("2", "eu10", "eu10-b", 0),
+				_getTopologyCluster("3", "us10", "us10-a", 0),
+			},
+			want: "1",
+		},
+		{
+			name: "fail if preferred zone is full and fallback is None",
+			topology: &TopologyPreference{
+				Region:   "eu10",
+				Zone:     "eu10-a",
+				Fallback: TopologyFallbackNone,
+			},
+			clusters: []resourcev1alpha1.SFCluster{
+				_getTopologyCluster("1", "eu10", "eu10-a", 4),
+				_getTopologyCluster("2", "eu10", "eu10-b", 0),
+			},
+			wantErr: true,
+		},
+		{
+			name: "fall back to other zone of the region",
+			topology: &TopologyPreference{
+				Region:   "eu10",
+				Zone:     "eu10-a",
+				Fallback: TopologyFallbackOtherZones,
+			},
+			clusters: []resourcev1alpha1.SFCluster{
+				_getTopologyCluster("1", "eu10", "eu10-a", 4),
+				_getTopologyCluster("2", "eu10", "eu10-b", 2),
+				_getTopologyCluster("3", "us10", "us10-a", 0),
+			},
+			want: "2",
+		},
+		{
+			name: "fail if preferred region is full and fallback is OtherZones",
+			topology: &TopologyPreference{
+				Region:   "eu10",
+				Zone:     "eu10-a",
+				Fallback: TopologyFallbackOtherZones,
+			},
+			clusters: []resourcev1alpha1.SFCluster{
+				_getTopologyCluster("1", "eu10", "eu10-a", 4),
+				_getTopologyCluster("2", "eu10", "eu10-b", 4),
+				_getTopologyCluster("3", "us10", "us10-a", 0),
+			},
+			wantErr: true,
+		},
+		{
+			name: "fall back to other region",
+			topology: &TopologyPreference{
+				Region:   "eu10",
+				Fallback: TopologyFallbackOtherRegions,
+			},
+			clusters: []resourcev1alpha1.SFCluster{
+				_getTopologyCluster("1", "eu10", "eu10-a", 4),
+				_getTopologyCluster("2", "us10", "us10-a", 2),
+			},
+			want: "2",
+		},
+	}
+	profile, err := GetProfile(MaxAllocatableProfile, nil, nil)
+	if err != nil {
+		t.Fatalf("GetProfile() error = %v", err)
+	}
+	f, err := New(profile, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sctx := &SchedulingContext{
+				Instance: &osbv1alpha1.SFServiceInstance{},
+				Requests: _getResources(1, 0),
+				Topology: tt.topology,
+			}
+			got, err := f.Schedule(sctx, tt.clusters)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Schedule() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil && !IsResolvable(err) {
+				t.Errorf("Schedule() error = %v, want resolvable error", err)
+			}
+			if got != tt.want {
+				t.Errorf("Schedule() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schedulercache
+
+import (
+	"sync"
+	"time"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/utils"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var log = logf.Log.WithName("scheduler.cache")
+
+// Cache keeps track of the instances assumed to be scheduled on a cluster
+// before the scheduling is reflected in the SFCluster status. The plan
+// requests of an assumed instance are added to the Requests of the cluster,
+// its storage requests to the Requests of the storage classes of the cluster
+// and the instance is added to the ServiceInstanceCount of the cluster till
+// they are observed in the SFCluster status.
+type Cache interface {
+	// AssumeInstance reserves the requests and the storage requests
+	// of the instance on the cluster
+	AssumeInstance(key, clusterID string, requests corev1.ResourceList,
+		storageRequests map[string]resource.Quantity)
+
+	// ForgetInstance removes the reservation of the instance
+	ForgetInstance(key string)
+
+	// ObserveInstance updates the reservation of the instance from
+	// its current state
+	ObserveInstance(key string, instance *osbv1alpha1.SFServiceInstance)
+
+	// UpdateClusters adds the reservations to the status of the clusters
+	UpdateClusters(clusters []resourcev1alpha1.SFCluster)
+}
+
+type assumedInstance struct {
+	clusterID       string
+	requests        corev1.ResourceList
+	storageRequests map[string]resource.Quantity
+	assumedAt       time.Time
+
+	// counted is set when the instance is added to the
+	// ServiceInstanceCount of the cluster
+	counted bool
+
+	// finished is set when the operation on the instance is completed
+	finished   bool
+	finishedAt time.Time
+
+	// observed is the usage of the cluster seen first after the instance
+	// is finished. The reservation of the requests is dropped when the
+	// Requests of the cluster changes from this and the reservation of the
+	// storage requests of a storage class when its Requests changes.
+	observed *clusterUsage
+}
+
+// clusterUsage is the Requests of a cluster and of its storage classes
+type clusterUsage struct {
+	requests corev1.ResourceList
+	storage  map[string]resource.Quantity
+}
+
+// getClusterUsage returns a copy of the usage of the cluster
+func getClusterUsage(cluster *resourcev1alpha1.SFCluster) *clusterUsage {
+	usage := &clusterUsage{
+		requests: cluster.Status.Requests.DeepCopy(),
+		storage:  make(map[string]resource.Quantity),
+	}
+	for _, storage := range cluster.Status.Storage {
+		usage.storage[storage.StorageClassName] = storage.Requests.DeepCopy()
+	}
+	return usage
+}
+
+type cache struct {
+	mu sync.Mutex
+
+	// ttl is the duration for which the requests are reserved
+	// after the instance is finished
+	ttl time.Duration
+
+	// maxAge is the maximum duration for which an instance is assumed
+	maxAge time.Duration
+
+	assumed map[string]*assumedInstance
+	now     func() time.Time
+}
+
+// New returns a new Cache
+func New(ttl, maxAge time.Duration) Cache {
+	return &cache{
+		ttl:     ttl,
+		maxAge:  maxAge,
+		assumed: make(map[string]*assumedInstance),
+		now:     time.Now,
+	}
+}
+
+func (c *cache) AssumeInstance(key, clusterID string, requests corev1.ResourceList,
+	storageRequests map[string]resource.Quantity) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	assumed := &assumedInstance{
+		clusterID:       clusterID,
+		requests:        requests.DeepCopy(),
+		storageRequests: make(map[string]resource.Quantity),
+		assumedAt:       c.now(),
+	}
+	for storageClassName, request := range storageRequests {
+		assumed.storageRequests[storageClassName] = request.DeepCopy()
+	}
+	c.assumed[key] = assumed
+	log.V(1).Info("Assumed instance", "instance", key, "clusterID", clusterID, "requests", requests,
+		"storageRequests", storageRequests)
+}
+
+func (c *cache) ForgetInstance(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.assumed[key]; ok {
+		delete(c.assumed, key)
+		log.V(1).Info("Forgot instance", "instance", key)
+	}
+}
+
+func (c *cache) ObserveInstance(key string, instance *osbv1alpha1.SFServiceInstance) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	assumed, ok := c.assumed[key]
+	if !ok {
+		return
+	}
+
+	if instance == nil || !instance.GetDeletionTimestamp().IsZero() ||
+		(getClusterID(instance) != "" && getClusterID(instance) != assumed.clusterID) {
+		delete(c.assumed, key)
+		log.V(1).Info("Forgot instance", "instance", key)
+		return
+	}
+
+	if !assumed.counted && utils.ContainsString(instance.GetFinalizers(), constants.SFServiceInstanceCounterFinalizerName) {
+		assumed.counted = true
+	}
+
+	state := instance.GetState()
+	if !assumed.finished && (state == "succeeded" || state == "failed") {
+		assumed.finished = true
+		assumed.finishedAt = c.now()
+	}
+}
+
+func (c *cache) UpdateClusters(clusters []resourcev1alpha1.SFCluster) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	index := make(map[string]*resourcev1alpha1.SFCluster)
+	observed := make(map[string]*clusterUsage)
+	for i := range clusters {
+		index[clusters[i].GetName()] = &clusters[i]
+		observed[clusters[i].GetName()] = getClusterUsage(&clusters[i])
+	}
+
+	// The expiry is evaluated against the usage of the clusters as read,
+	// before any reservation is added to them
+	now := c.now()
+	for key, assumed := range c.assumed {
+		usage, ok := observed[assumed.clusterID]
+		if !ok {
+			continue
+		}
+		if c.isExpired(assumed, usage, now) {
+			delete(c.assumed, key)
+			log.V(1).Info("Assumed instance expired", "instance", key, "clusterID", assumed.clusterID)
+		}
+	}
+
+	for _, assumed := range c.assumed {
+		cluster, ok := index[assumed.clusterID]
+		if !ok {
+			continue
+		}
+		if !assumed.counted {
+			cluster.Status.ServiceInstanceCount++
+		}
+		if len(assumed.requests) != 0 {
+			if cluster.Status.Requests == nil {
+				cluster.Status.Requests = make(corev1.ResourceList)
+			}
+			resourcev1alpha1.ResourceListAdd(cluster.Status.Requests, assumed.requests)
+		}
+		for storageClassName, request := range assumed.storageRequests {
+			// Clusters without the storage class are filtered out
+			if storage := cluster.Status.GetStorage(storageClassName); storage != nil {
+				storage.Requests.Add(request)
+			}
+		}
+	}
+}
+
+// getClusterID returns the cluster the instance is scheduled on. While an
+// instance is migrated, it is the target cluster of the migration.
+func getClusterID(instance *osbv1alpha1.SFServiceInstance) string {
+	migration := instance.Status.Migration
+	if migration.IsActive() {
+		if migration.Phase == osbv1alpha1.MigrationPhasePending {
+			// target cluster not yet selected
+			return ""
+		}
+		return migration.TargetClusterID
+	}
+	return instance.Spec.ClusterID
+}
+
+// isExpired returns true if the reservations of the instance are reflected
+// in the usage of the cluster or if the instance is assumed for too long
+func (c *cache) isExpired(assumed *assumedInstance, usage *clusterUsage, now time.Time) bool {
+	if c.maxAge > 0 && now.Sub(assumed.assumedAt) > c.maxAge {
+		return true
+	}
+	if len(assumed.requests) == 0 && len(assumed.storageRequests) == 0 {
+		// only the count is reserved
+		return assumed.counted
+	}
+	if !assumed.finished {
+		return false
+	}
+	if c.ttl > 0 && now.Sub(assumed.finishedAt) > c.ttl {
+		return true
+	}
+	if assumed.observed == nil {
+		assumed.observed = usage
+		return false
+	}
+	if !assumed.counted {
+		return false
+	}
+	if len(assumed.requests) != 0 && !resourcev1alpha1.ResourceListEqual(assumed.observed.requests, usage.requests) {
+		assumed.requests = nil
+	}
+	for storageClassName := range assumed.storageRequests {
+		observed := assumed.observed.storage[storageClassName]
+		current, ok := usage.storage[storageClassName]
+		if !ok || observed.Cmp(current) != 0 {
+			// Storage classes not in the cluster are never reserved
+			delete(assumed.storageRequests, storageClassName)
+		}
+	}
+	return len(assumed.requests) == 0 && len(assumed.storageRequests) == 0
+}
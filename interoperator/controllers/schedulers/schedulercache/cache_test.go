@@ -0,0 +1,265 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schedulercache
+
+import (
+	"testing"
+	"time"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func _getClusters() []resourcev1alpha1.SFCluster {
+	return []resourcev1alpha1.SFCluster{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "1"},
+			Status: resourcev1alpha1.SFClusterStatus{
+				ServiceInstanceCount: 2,
+				Requests: corev1.ResourceList{
+					corev1.ResourceCPU: *resource.NewQuantity(2, resource.DecimalSI),
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "2"},
+		},
+	}
+}
+
+func _getInstance(clusterID, state string, counted bool) *osbv1alpha1.SFServiceInstance {
+	instance := &osbv1alpha1.SFServiceInstance{
+		Spec: osbv1alpha1.SFServiceInstanceSpec{
+			ClusterID: clusterID,
+		},
+		Status: osbv1alpha1.SFServiceInstanceStatus{
+			State: state,
+		},
+	}
+	if counted {
+		instance.SetFinalizers([]string{constants.SFServiceInstanceCounterFinalizerName})
+	}
+	return instance
+}
+
+func Test_cache(t *testing.T) {
+	now := time.Now()
+	c := New(time.Minute, time.Hour).(*cache)
+	c.now = func() time.Time { return now }
+
+	requests := corev1.ResourceList{
+		corev1.ResourceCPU: *resource.NewQuantity(1, resource.DecimalSI),
+	}
+	c.AssumeInstance("ns/foo", "1", requests, nil)
+	c.AssumeInstance("ns/bar", "2", nil, nil)
+
+	clusters := _getClusters()
+	c.UpdateClusters(clusters)
+	if clusters[0].Status.ServiceInstanceCount != 3 || clusters[1].Status.ServiceInstanceCount != 1 {
+		t.Errorf("UpdateClusters() counts = %d, %d, want 3, 1", clusters[0].Status.ServiceInstanceCount,
+			clusters[1].Status.ServiceInstanceCount)
+	}
+	if cpu := clusters[0].Status.Requests[corev1.ResourceCPU]; cpu.Value() != 3 {
+		t.Errorf("UpdateClusters() cpu requests = %s, want 3", cpu.String())
+	}
+
+	// count only reservation is dropped when the instance is counted
+	c.ObserveInstance("ns/bar", _getInstance("2", "in progress", true))
+	clusters = _getClusters()
+	c.UpdateClusters(clusters)
+	if clusters[1].Status.ServiceInstanceCount != 0 {
+		t.Errorf("UpdateClusters() count = %d, want 0", clusters[1].Status.ServiceInstanceCount)
+	}
+
+	// requests are reserved till the cluster requests change after the instance is finished
+	c.ObserveInstance("ns/foo", _getInstance("1", "succeeded", true))
+	clusters = _getClusters()
+	c.UpdateClusters(clusters)
+	if cpu := clusters[0].Status.Requests[corev1.ResourceCPU]; cpu.Value() != 3 || clusters[0].Status.ServiceInstanceCount != 2 {
+		t.Errorf("UpdateClusters() cpu requests = %s, count = %d, want 3, 2", cpu.String(), clusters[0].Status.ServiceInstanceCount)
+	}
+	clusters = _getClusters()
+	clusters[0].Status.Requests[corev1.ResourceCPU] = *resource.NewQuantity(3, resource.DecimalSI)
+	c.UpdateClusters(clusters)
+	if cpu := clusters[0].Status.Requests[corev1.ResourceCPU]; cpu.Value() != 3 {
+		t.Errorf("UpdateClusters() cpu requests = %s, want 3", cpu.String())
+	}
+	if len(c.assumed) != 0 {
+		t.Errorf("UpdateClusters() assumed = %d, want 0", len(c.assumed))
+	}
+}
+
+func Test_cache_multipleFinished(t *testing.T) {
+	now := time.Now()
+	c := New(time.Hour, 2*time.Hour).(*cache)
+	c.now = func() time.Time { return now }
+
+	requests := corev1.ResourceList{
+		corev1.ResourceCPU: *resource.NewQuantity(1, resource.DecimalSI),
+	}
+	for _, key := range []string{"ns/foo", "ns/bar", "ns/baz"} {
+		c.AssumeInstance(key, "1", requests, nil)
+		c.ObserveInstance(key, _getInstance("1", "succeeded", true))
+	}
+
+	// the reservations are kept while the cluster status is unchanged
+	for i := 0; i < 3; i++ {
+		clusters := _getClusters()
+		c.UpdateClusters(clusters)
+		if cpu := clusters[0].Status.Requests[corev1.ResourceCPU]; cpu.Value() != 5 {
+			t.Errorf("UpdateClusters() cpu requests = %s, want 5", cpu.String())
+		}
+		if len(c.assumed) != 3 {
+			t.Errorf("UpdateClusters() assumed = %d, want 3", len(c.assumed))
+		}
+	}
+
+	// and are all dropped once the cluster status changes
+	clusters := _getClusters()
+	clusters[0].Status.Requests[corev1.ResourceCPU] = *resource.NewQuantity(5, resource.DecimalSI)
+	c.UpdateClusters(clusters)
+	if cpu := clusters[0].Status.Requests[corev1.ResourceCPU]; cpu.Value() != 5 {
+		t.Errorf("UpdateClusters() cpu requests = %s, want 5", cpu.String())
+	}
+	if len(c.assumed) != 0 {
+		t.Errorf("UpdateClusters() assumed = %d, want 0", len(c.assumed))
+	}
+}
+
+func Test_cache_expiry(t *testing.T) {
+	now := time.Now()
+	c := New(time.Minute, time.Hour).(*cache)
+	c.now = func() time.Time { return now }
+
+	requests := corev1.ResourceList{
+		corev1.ResourceCPU: *resource.NewQuantity(1, resource.DecimalSI),
+	}
+
+	// expire after ttl once finished
+	c.AssumeInstance("ns/foo", "1", requests, nil)
+	c.ObserveInstance("ns/foo", _getInstance("1", "failed", true))
+	now = now.Add(2 * time.Minute)
+	c.UpdateClusters(_getClusters())
+	if len(c.assumed) != 0 {
+		t.Errorf("UpdateClusters() assumed = %d, want 0 after ttl", len(c.assumed))
+	}
+
+	// expire after max age
+	c.AssumeInstance("ns/foo", "1", requests, nil)
+	now = now.Add(2 * time.Hour)
+	c.UpdateClusters(_getClusters())
+	if len(c.assumed) != 0 {
+		t.Errorf("UpdateClusters() assumed = %d, want 0 after max age", len(c.assumed))
+	}
+
+	// forget when scheduled on another cluster
+	c.AssumeInstance("ns/foo", "1", requests, nil)
+	c.ObserveInstance("ns/foo", _getInstance("2", "in_queue", false))
+	if len(c.assumed) != 0 {
+		t.Errorf("ObserveInstance() assumed = %d, want 0", len(c.assumed))
+	}
+
+	// keep while migrated to the assumed cluster and forget if the migration fails
+	c.AssumeInstance("ns/foo", "2", requests, nil)
+	instance := _getInstance("1", "migrate", true)
+	instance.Status.Migration = &osbv1alpha1.MigrationStatus{
+		Phase: osbv1alpha1.MigrationPhasePending,
+	}
+	c.ObserveInstance("ns/foo", instance)
+	instance.Status.Migration.Phase = osbv1alpha1.MigrationPhaseProvisioning
+	instance.Status.Migration.TargetClusterID = "2"
+	c.ObserveInstance("ns/foo", instance)
+	if len(c.assumed) != 1 {
+		t.Errorf("ObserveInstance() assumed = %d, want 1 while migrating", len(c.assumed))
+	}
+	instance.Status.Migration.Phase = osbv1alpha1.MigrationPhaseFailed
+	c.ObserveInstance("ns/foo", instance)
+	if len(c.assumed) != 0 {
+		t.Errorf("ObserveInstance() assumed = %d, want 0 after failed migration", len(c.assumed))
+	}
+
+	// forget
+	c.AssumeInstance("ns/foo", "1", requests, nil)
+	c.ForgetInstance("ns/foo")
+	if len(c.assumed) != 0 {
+		t.Errorf("ForgetInstance() assumed = %d, want 0", len(c.assumed))
+	}
+}
+
+func Test_cache_storage(t *testing.T) {
+	now := time.Now()
+	c := New(time.Minute, time.Hour).(*cache)
+	c.now = func() time.Time { return now }
+
+	getClusters := func() []resourcev1alpha1.SFCluster {
+		clusters := _getClusters()
+		clusters[0].Status.Storage = []resourcev1alpha1.StorageClassUsage{
+			{
+				StorageClassName: "default",
+				Requests:         resource.MustParse("10Gi"),
+			},
+		}
+		return clusters
+	}
+
+	requests := corev1.ResourceList{
+		corev1.ResourceCPU: *resource.NewQuantity(1, resource.DecimalSI),
+	}
+	c.AssumeInstance("ns/foo", "1", requests, map[string]resource.Quantity{
+		"default": resource.MustParse("5Gi"),
+		"missing": resource.MustParse("5Gi"),
+	})
+	c.ObserveInstance("ns/foo", _getInstance("1", "succeeded", true))
+
+	clusters := getClusters()
+	c.UpdateClusters(clusters)
+	if storage := clusters[0].Status.GetStorage("default"); storage.Requests.Cmp(resource.MustParse("15Gi")) != 0 {
+		t.Errorf("UpdateClusters() storage requests = %s, want 15Gi", storage.Requests.String())
+	}
+	if len(clusters[0].Status.Storage) != 1 {
+		t.Errorf("UpdateClusters() storage classes = %d, want 1", len(clusters[0].Status.Storage))
+	}
+
+	// the storage is reserved till the storage class requests change
+	clusters = getClusters()
+	clusters[0].Status.Requests[corev1.ResourceCPU] = *resource.NewQuantity(3, resource.DecimalSI)
+	c.UpdateClusters(clusters)
+	if storage := clusters[0].Status.GetStorage("default"); storage.Requests.Cmp(resource.MustParse("15Gi")) != 0 {
+		t.Errorf("UpdateClusters() storage requests = %s, want 15Gi", storage.Requests.String())
+	}
+	if cpu := clusters[0].Status.Requests[corev1.ResourceCPU]; cpu.Value() != 3 {
+		t.Errorf("UpdateClusters() cpu requests = %s, want 3", cpu.String())
+	}
+	if len(c.assumed) != 1 {
+		t.Errorf("UpdateClusters() assumed = %d, want 1", len(c.assumed))
+	}
+
+	clusters = getClusters()
+	clusters[0].Status.Storage[0].Requests = resource.MustParse("15Gi")
+	c.UpdateClusters(clusters)
+	if storage := clusters[0].Status.GetStorage("default"); storage.Requests.Cmp(resource.MustParse("15Gi")) != 0 {
+		t.Errorf("UpdateClusters() storage requests = %s, want 15Gi", storage.Requests.String())
+	}
+	if len(c.assumed) != 0 {
+		t.Errorf("UpdateClusters() assumed = %d, want 0", len(c.assumed))
+	}
+}
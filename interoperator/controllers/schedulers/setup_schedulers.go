@@ -22,6 +22,7 @@ import (
 	"context"
 
 	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/schedulers/sfclusterdrain"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/schedulers/sflabelselectorscheduler"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/schedulers/sfserviceinstancecounter"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/schedulers/sfserviceinstanceupdater"
@@ -42,6 +43,14 @@ func SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 
+	if err = (&sfserviceinstancecounter.SFClusterRecounter{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("scheduler-helper").WithName("sfcluster-recounter"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create sfcluster-recounter", "scheduler-helper", "SFClusterRecounter")
+		return err
+	}
+
 	_ = mgr.GetFieldIndexer().IndexField(context.Background(), &osbv1alpha1.SFServiceInstance{}, "spec.planId", func(o runtime.Object) []string {
 		planID := o.(*osbv1alpha1.SFServiceInstance).Spec.PlanID
 		return []string{planID}
@@ -55,6 +64,19 @@ func SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 
+	_ = mgr.GetFieldIndexer().IndexField(context.Background(), &osbv1alpha1.SFServiceInstance{}, "spec.clusterId", func(o runtime.Object) []string {
+		clusterID := o.(*osbv1alpha1.SFServiceInstance).Spec.ClusterID
+		return []string{clusterID}
+	})
+
+	if err = (&sfclusterdrain.SFClusterDrain{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("scheduler-helper").WithName("sfcluster-drain"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create sfcluster-drain", "scheduler-helper", "SFClusterDrain")
+		return err
+	}
+
 	if err = (&sflabelselectorscheduler.SFLabelSelectorScheduler{
 		Client: mgr.GetClient(),
 		Log:    ctrl.Log.WithName("schedulers").WithName("labelselector"),
@@ -0,0 +1,360 @@
+/*
+Copyright 2018 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfclusterdrain
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/watches"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// SFClusterDrain migrates the service instances of a drained SFCluster
+// to other clusters
+type SFClusterDrain struct {
+	client.Client
+	Log        logr.Logger
+	cfgManager config.Config
+	recorder   record.EventRecorder
+}
+
+// Reconcile starts the migration of the service instances on the SFCluster if
+// the cluster is unschedulable and drain is set. At most DrainConcurrency
+// instances of the cluster are migrated at a time. The target clusters are
+// chosen by the scheduler. The instances of plans which can not move the data
+// of the instance, i.e. which do not provide the backup and restore
+// templates, are left on the cluster and are reported in the MigrationSkipped
+// condition of the cluster. The primary cluster and clusters in pull mode are
+// not drained.
+func (r *SFClusterDrain) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("sfcluster", req.NamespacedName)
+
+	cluster := &resourcev1alpha1.SFCluster{}
+	err := r.Get(ctx, req.NamespacedName, cluster)
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	if !cluster.Spec.Unschedulable || !cluster.Spec.Drain {
+		if cluster.Status.GetCondition(resourcev1alpha1.ClusterMigrationSkipped) != nil {
+			return ctrl.Result{}, r.updateMigrationSkipped(cluster, nil)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	clusterID := cluster.GetName()
+	interoperatorCfg := r.cfgManager.GetConfig()
+	if clusterID == interoperatorCfg.PrimaryClusterID {
+		log.Info("Drain of primary cluster is not supported. Ignoring")
+		return ctrl.Result{}, nil
+	}
+	if cluster.IsPullMode() {
+		log.Info("Drain of cluster in pull mode is not supported. Ignoring")
+		return ctrl.Result{}, nil
+	}
+
+	instances := &osbv1alpha1.SFServiceInstanceList{}
+	err = r.List(ctx, instances, client.MatchingFields{"spec.clusterId": clusterID})
+	if err != nil {
+		log.Error(err, "Failed to list instances of cluster")
+		return ctrl.Result{}, err
+	}
+
+	now := time.Now()
+	migrating := 0
+	skipped := make(map[string]int)
+	var requeueAfter time.Duration
+	migratable := make(map[string]bool)
+	candidates := make([]osbv1alpha1.SFServiceInstance, 0)
+	for _, instance := range instances.Items {
+		if instance.Spec.ClusterID != clusterID {
+			continue
+		}
+		if isMigrating(&instance) {
+			migrating++
+			continue
+		}
+		// Only the instances without an ongoing operation are migrated
+		if !instance.GetDeletionTimestamp().IsZero() || instance.GetState() != "succeeded" {
+			continue
+		}
+		// Failed migrations are retried after DrainRetryInterval
+		if retryAfter := getRetryAfter(&instance, clusterID, now); retryAfter > 0 {
+			if requeueAfter == 0 || retryAfter < requeueAfter {
+				requeueAfter = retryAfter
+			}
+			continue
+		}
+		planID := instance.Spec.PlanID
+		if _, ok := migratable[planID]; !ok {
+			migratable[planID], err = r.isMigratable(planID)
+			if err != nil {
+				log.Error(err, "Failed to get SFPlan", "planID", planID)
+				return ctrl.Result{}, err
+			}
+		}
+		if !migratable[planID] {
+			skipped[planID]++
+			continue
+		}
+		candidates = append(candidates, instance)
+	}
+
+	err = r.updateMigrationSkipped(cluster, skipped)
+	if err != nil {
+		log.Error(err, "Failed to update MigrationSkipped condition of cluster")
+		return ctrl.Result{}, err
+	}
+
+	started := 0
+	for _, instance := range candidates {
+		if migrating >= interoperatorCfg.DrainConcurrency {
+			break
+		}
+		ok, err := r.startMigration(types.NamespacedName{
+			Name:      instance.GetName(),
+			Namespace: instance.GetNamespace(),
+		}, clusterID)
+		if err != nil {
+			log.Error(err, "Failed to start migration", "instance", instance.GetName())
+			return ctrl.Result{}, err
+		}
+		if ok {
+			migrating++
+			started++
+		}
+	}
+
+	log.Info("Draining cluster", "instances", len(instances.Items), "migrating", migrating,
+		"started", started, "skipped", len(skipped), "requeueAfter", requeueAfter)
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// startMigration sets the state of the instance to migrate. It returns
+// false if the instance is no longer a candidate for migration.
+func (r *SFClusterDrain) startMigration(namespacedName types.NamespacedName, clusterID string) (bool, error) {
+	ctx := context.Background()
+	started := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		instance := &osbv1alpha1.SFServiceInstance{}
+		err := r.Get(ctx, namespacedName, instance)
+		if err != nil {
+			return err
+		}
+		if instance.Spec.ClusterID != clusterID || instance.GetState() != "succeeded" ||
+			!instance.GetDeletionTimestamp().IsZero() {
+			return nil
+		}
+		now := metav1.Now()
+		instance.SetState("migrate")
+		instance.Status.Migration = &osbv1alpha1.MigrationStatus{
+			SourceClusterID: clusterID,
+			Phase:           osbv1alpha1.MigrationPhasePending,
+			StartTime:       &now,
+		}
+		err = r.Update(ctx, instance)
+		if err != nil {
+			return err
+		}
+		started = true
+		return nil
+	})
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if started {
+		r.Log.Info("Started migration", "instance", namespacedName, "sourceClusterID", clusterID)
+	}
+	return started, nil
+}
+
+// isMigratable returns true if the instances of the plan can be migrated
+// without losing their data
+func (r *SFClusterDrain) isMigratable(planID string) (bool, error) {
+	plan := &osbv1alpha1.SFPlan{}
+	err := r.Get(context.Background(), types.NamespacedName{
+		Name:      planID,
+		Namespace: constants.InteroperatorNamespace,
+	}, plan)
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return plan.IsMigratable(), nil
+}
+
+// updateMigrationSkipped sets the MigrationSkipped condition of the cluster
+// from the number of instances not migrated per plan. The condition is
+// removed if no instance is skipped. A warning event is recorded for the
+// cluster only when the condition changes.
+func (r *SFClusterDrain) updateMigrationSkipped(cluster *resourcev1alpha1.SFCluster, skipped map[string]int) error {
+	var condition *resourcev1alpha1.SFClusterCondition
+	if len(skipped) > 0 {
+		planIDs := make([]string, 0, len(skipped))
+		count := 0
+		for planID, n := range skipped {
+			planIDs = append(planIDs, planID)
+			count += n
+		}
+		sort.Strings(planIDs)
+		condition = &resourcev1alpha1.SFClusterCondition{
+			Type:               resourcev1alpha1.ClusterMigrationSkipped,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: cluster.GetGeneration(),
+			Reason:             "BackupAndRestoreNotSupported",
+			Message: fmt.Sprintf("%d instance(s) are not migrated as plan(s) %s do not provide "+
+				"backup and restore templates", count, strings.Join(planIDs, ", ")),
+		}
+	}
+
+	changed := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		err := r.Get(context.Background(), types.NamespacedName{
+			Name:      cluster.GetName(),
+			Namespace: cluster.GetNamespace(),
+		}, cluster)
+		if err != nil {
+			return err
+		}
+		if condition != nil {
+			changed = cluster.Status.SetCondition(*condition)
+		} else {
+			changed = cluster.Status.RemoveCondition(resourcev1alpha1.ClusterMigrationSkipped)
+		}
+		if !changed {
+			return nil
+		}
+		return r.Status().Update(context.Background(), cluster)
+	})
+	if err != nil {
+		return err
+	}
+	if changed && condition != nil {
+		r.recordEvent(cluster, corev1.EventTypeWarning, "MigrationSkipped", condition.Message)
+	}
+	return nil
+}
+
+// recordEvent records an event for the cluster if a recorder is set
+func (r *SFClusterDrain) recordEvent(cluster *resourcev1alpha1.SFCluster, eventType, reason, msg string) {
+	if r.recorder == nil {
+		return
+	}
+	r.recorder.Event(cluster, eventType, reason, msg)
+}
+
+// isMigrating returns true if the instance is being migrated
+func isMigrating(instance *osbv1alpha1.SFServiceInstance) bool {
+	state := instance.GetState()
+	if state == "migrate" {
+		return true
+	}
+	return state == "in progress" && instance.GetLabels()[constants.LastOperationKey] == "migrate"
+}
+
+// getRetryAfter returns the time left before a failed migration of the
+// instance from the cluster can be retried
+func getRetryAfter(instance *osbv1alpha1.SFServiceInstance, clusterID string, now time.Time) time.Duration {
+	migration := instance.Status.Migration
+	if migration == nil || migration.Phase != osbv1alpha1.MigrationPhaseFailed ||
+		migration.SourceClusterID != clusterID || migration.CompletionTime == nil {
+		return 0
+	}
+	retryAfter := migration.CompletionTime.Add(constants.DrainRetryInterval).Sub(now)
+	if retryAfter < 0 {
+		return 0
+	}
+	return retryAfter
+}
+
+// instanceClusters returns the requests for the clusters of the instance,
+// so that the next instances are migrated when a migration completes
+func (r *SFClusterDrain) instanceClusters(a handler.MapObject) []reconcile.Request {
+	instance, ok := a.Object.(*osbv1alpha1.SFServiceInstance)
+	if !ok {
+		return nil
+	}
+	clusterIDs := []string{instance.Spec.ClusterID}
+	if instance.Status.Migration != nil {
+		clusterIDs = append(clusterIDs, instance.Status.Migration.SourceClusterID)
+	}
+
+	requests := make([]reconcile.Request, 0, len(clusterIDs))
+	for _, clusterID := range clusterIDs {
+		if clusterID == "" {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      clusterID,
+				Namespace: constants.InteroperatorNamespace,
+			},
+		})
+	}
+	return requests
+}
+
+// SetupWithManager registers the SFClusterDrain controller with manager
+// and setups the watches.
+func (r *SFClusterDrain) SetupWithManager(mgr ctrl.Manager) error {
+	if r.cfgManager == nil {
+		cfgManager, err := config.New(mgr.GetConfig(), mgr.GetScheme(), mgr.GetRESTMapper())
+		if err != nil {
+			return err
+		}
+		r.cfgManager = cfgManager
+	}
+	r.recorder = mgr.GetEventRecorderFor("scheduler_helper_sfcluster_drain")
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("scheduler_helper_sfcluster_drain").
+		For(&resourcev1alpha1.SFCluster{}).
+		Watches(&source.Kind{Type: &osbv1alpha1.SFServiceInstance{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.instanceClusters),
+		}).
+		WithEventFilter(watches.NamespaceLabelFilter()).
+		Complete(r)
+}
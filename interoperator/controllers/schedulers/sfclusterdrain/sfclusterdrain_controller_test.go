@@ -0,0 +1,229 @@
+/*
+Copyright 2018 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfclusterdrain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+
+	"github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type fakeConfig struct {
+	cfg *config.InteroperatorConfig
+}
+
+func (f *fakeConfig) GetConfig() *config.InteroperatorConfig {
+	return f.cfg
+}
+
+func (f *fakeConfig) UpdateConfig(cfg *config.InteroperatorConfig) error {
+	f.cfg = cfg
+	return nil
+}
+
+func _getPlan(name string, actions ...string) *osbv1alpha1.SFPlan {
+	plan := &osbv1alpha1.SFPlan{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: constants.InteroperatorNamespace,
+		},
+		Spec: osbv1alpha1.SFPlanSpec{
+			ID: name,
+		},
+	}
+	for _, action := range actions {
+		plan.Spec.Templates = append(plan.Spec.Templates, osbv1alpha1.TemplateSpec{
+			Action:  action,
+			Type:    "gotemplate",
+			Content: action,
+		})
+	}
+	return plan
+}
+
+func _getInstance(name, clusterID, state string) *osbv1alpha1.SFServiceInstance {
+	return &osbv1alpha1.SFServiceInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "sf-" + name,
+		},
+		Spec: osbv1alpha1.SFServiceInstanceSpec{
+			ClusterID: clusterID,
+			PlanID:    "plan-id",
+		},
+		Status: osbv1alpha1.SFServiceInstanceStatus{
+			State: state,
+		},
+	}
+}
+
+func TestSFClusterDrain_Reconcile(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(osbv1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+	g.Expect(resourcev1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	drained := &resourcev1alpha1.SFCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "2", Namespace: constants.InteroperatorNamespace},
+		Spec: resourcev1alpha1.SFClusterSpec{
+			Unschedulable: true,
+			Drain:         true,
+		},
+	}
+	pullMode := &resourcev1alpha1.SFCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "4", Namespace: constants.InteroperatorNamespace},
+		Spec: resourcev1alpha1.SFClusterSpec{
+			Mode:          resourcev1alpha1.ClusterModePull,
+			Unschedulable: true,
+			Drain:         true,
+		},
+	}
+	cordoned := &resourcev1alpha1.SFCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "3", Namespace: constants.InteroperatorNamespace},
+		Spec: resourcev1alpha1.SFClusterSpec{
+			Unschedulable: true,
+		},
+	}
+
+	completionTime := metav1.NewTime(time.Now().Add(-time.Minute))
+	recentlyFailed := _getInstance("recently-failed", "2", "succeeded")
+	recentlyFailed.Status.Migration = &osbv1alpha1.MigrationStatus{
+		SourceClusterID: "2",
+		Phase:           osbv1alpha1.MigrationPhaseFailed,
+		CompletionTime:  &completionTime,
+	}
+
+	noBackup := _getInstance("no-backup", "2", "succeeded")
+	noBackup.Spec.PlanID = "plan-id-no-backup"
+
+	c := fake.NewFakeClientWithScheme(scheme, drained, cordoned, pullMode,
+		_getPlan("plan-id", osbv1alpha1.BackupAction, osbv1alpha1.RestoreAction),
+		_getPlan("plan-id-no-backup", osbv1alpha1.RestoreAction),
+		noBackup,
+		_getInstance("a", "2", "succeeded"),
+		_getInstance("b", "2", "succeeded"),
+		_getInstance("c", "2", "succeeded"),
+		_getInstance("d", "2", "in progress"),
+		_getInstance("e", "3", "succeeded"),
+		_getInstance("f", "4", "succeeded"),
+		recentlyFailed,
+	)
+
+	recorder := record.NewFakeRecorder(10)
+	r := &SFClusterDrain{
+		Client:   c,
+		recorder: recorder,
+		Log:      ctrl.Log.WithName("scheduler-helper").WithName("sfcluster-drain"),
+		cfgManager: &fakeConfig{
+			cfg: &config.InteroperatorConfig{
+				PrimaryClusterID: "1",
+				DrainConcurrency: 2,
+			},
+		},
+	}
+
+	getMigrating := func() []string {
+		instances := &osbv1alpha1.SFServiceInstanceList{}
+		g.Expect(c.List(context.TODO(), instances)).To(gomega.Succeed())
+		migrating := make([]string, 0)
+		for _, instance := range instances.Items {
+			if instance.GetState() == "migrate" {
+				g.Expect(instance.Status.Migration.Phase).To(gomega.Equal(osbv1alpha1.MigrationPhasePending))
+				g.Expect(instance.Status.Migration.SourceClusterID).To(gomega.Equal(instance.Spec.ClusterID))
+				migrating = append(migrating, instance.GetName())
+			}
+		}
+		return migrating
+	}
+
+	// Only DrainConcurrency instances are migrated at a time
+	result, err := r.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{
+		Name:      "2",
+		Namespace: constants.InteroperatorNamespace,
+	}})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result.RequeueAfter).To(gomega.BeNumerically(">", 0))
+	g.Expect(getMigrating()).To(gomega.ConsistOf("a", "b"))
+	// Instances of plans without backup and restore templates are not migrated
+	g.Expect(recorder.Events).To(gomega.Receive(gomega.ContainSubstring("MigrationSkipped")))
+	getCondition := func() *resourcev1alpha1.SFClusterCondition {
+		cluster := &resourcev1alpha1.SFCluster{}
+		g.Expect(c.Get(context.TODO(), types.NamespacedName{
+			Name:      "2",
+			Namespace: constants.InteroperatorNamespace,
+		}, cluster)).To(gomega.Succeed())
+		return cluster.Status.GetCondition(resourcev1alpha1.ClusterMigrationSkipped)
+	}
+	condition := getCondition()
+	g.Expect(condition).NotTo(gomega.BeNil())
+	g.Expect(condition.Status).To(gomega.Equal(metav1.ConditionTrue))
+	g.Expect(condition.Message).To(gomega.ContainSubstring("plan-id-no-backup"))
+
+	// The skipped instances are reported only once
+	_, err = r.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{
+		Name:      "2",
+		Namespace: constants.InteroperatorNamespace,
+	}})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(getMigrating()).To(gomega.ConsistOf("a", "b"))
+	g.Expect(recorder.Events).NotTo(gomega.Receive())
+
+	// Cordoned cluster is not drained
+	_, err = r.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{
+		Name:      "3",
+		Namespace: constants.InteroperatorNamespace,
+	}})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(getMigrating()).To(gomega.ConsistOf("a", "b"))
+
+	// Cluster in pull mode is not drained
+	_, err = r.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{
+		Name:      "4",
+		Namespace: constants.InteroperatorNamespace,
+	}})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(getMigrating()).To(gomega.ConsistOf("a", "b"))
+
+	// The condition is removed once the drain is stopped
+	cluster := &resourcev1alpha1.SFCluster{}
+	g.Expect(c.Get(context.TODO(), types.NamespacedName{
+		Name:      "2",
+		Namespace: constants.InteroperatorNamespace,
+	}, cluster)).To(gomega.Succeed())
+	cluster.Spec.Drain = false
+	g.Expect(c.Update(context.TODO(), cluster)).To(gomega.Succeed())
+	_, err = r.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{
+		Name:      "2",
+		Namespace: constants.InteroperatorNamespace,
+	}})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(getCondition()).To(gomega.BeNil())
+}
@@ -20,12 +20,14 @@ import (
 	"context"
 
 	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/watches"
 
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -56,6 +58,23 @@ func (r *SFDefaultScheduler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		return ctrl.Result{}, err
 	}
 	if instance.Spec.ClusterID == "" {
+		unschedulable, err := r.isUnschedulable(constants.OwnClusterID)
+		if err != nil {
+			log.Error(err, "failed to get cluster", "clusterID", constants.OwnClusterID)
+			return ctrl.Result{}, err
+		}
+		if unschedulable && instance.GetState() != "delete" {
+			msg := "Cluster " + constants.OwnClusterID + " is unschedulable"
+			log.Info("Setting State to failed", "reason", msg)
+			instance.SetState("failed")
+			instance.Status.Error = msg
+			instance.Status.Description = msg
+			if err := r.Update(context.Background(), instance); err != nil {
+				log.Error(err, "failed to set state as failed")
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{}, nil
+		}
 		instance.Spec.ClusterID = constants.OwnClusterID
 		if err := r.Update(context.Background(), instance); err != nil {
 			log.Error(err, "failed to set cluster id")
@@ -65,6 +84,23 @@ func (r *SFDefaultScheduler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	return ctrl.Result{}, nil
 }
 
+// isUnschedulable returns true if the SFCluster is marked unschedulable.
+// A cluster without SFCluster is schedulable.
+func (r *SFDefaultScheduler) isUnschedulable(clusterID string) (bool, error) {
+	cluster := &resourcev1alpha1.SFCluster{}
+	err := r.Get(context.Background(), types.NamespacedName{
+		Name:      clusterID,
+		Namespace: constants.InteroperatorNamespace,
+	}, cluster)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return cluster.Spec.Unschedulable, nil
+}
+
 // SetupWithManager registers the default scheduler with manager
 // add setups the watches.
 func (r *SFDefaultScheduler) SetupWithManager(mgr ctrl.Manager) error {
@@ -28,9 +28,11 @@ import (
 	"github.com/onsi/gomega"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
@@ -106,3 +108,65 @@ func TestReconcile(t *testing.T) {
 	defer c.Delete(context.TODO(), instance)
 
 }
+
+func TestReconcile_unschedulable(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(osbv1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+	g.Expect(resourcev1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	cluster := &resourcev1alpha1.SFCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      constants.OwnClusterID,
+			Namespace: constants.InteroperatorNamespace,
+		},
+		Spec: resourcev1alpha1.SFClusterSpec{
+			Unschedulable: true,
+		},
+	}
+	newInstance := &osbv1alpha1.SFServiceInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: constants.InteroperatorNamespace},
+		Status:     osbv1alpha1.SFServiceInstanceStatus{State: "in_queue"},
+	}
+	deletedInstance := &osbv1alpha1.SFServiceInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "deleted", Namespace: constants.InteroperatorNamespace},
+		Status:     osbv1alpha1.SFServiceInstanceStatus{State: "delete"},
+	}
+	fakeClient := fake.NewFakeClientWithScheme(scheme, cluster, newInstance, deletedInstance)
+
+	r := &SFDefaultScheduler{
+		Client: fakeClient,
+		Log:    ctrl.Log.WithName("schedulers").WithName("default"),
+		scheme: scheme,
+	}
+
+	// New instances are failed
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{
+		Name:      "new",
+		Namespace: constants.InteroperatorNamespace,
+	}})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	instance := &osbv1alpha1.SFServiceInstance{}
+	g.Expect(fakeClient.Get(context.TODO(), types.NamespacedName{
+		Name:      "new",
+		Namespace: constants.InteroperatorNamespace,
+	}, instance)).To(gomega.Succeed())
+	g.Expect(instance.GetState()).To(gomega.Equal("failed"))
+	g.Expect(instance.Spec.ClusterID).To(gomega.BeEmpty())
+	g.Expect(instance.Status.Error).To(gomega.ContainSubstring("unschedulable"))
+
+	// Deleted instances are still scheduled to be cleaned up
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{
+		Name:      "deleted",
+		Namespace: constants.InteroperatorNamespace,
+	}})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	instance = &osbv1alpha1.SFServiceInstance{}
+	g.Expect(fakeClient.Get(context.TODO(), types.NamespacedName{
+		Name:      "deleted",
+		Namespace: constants.InteroperatorNamespace,
+	}, instance)).To(gomega.Succeed())
+	g.Expect(instance.GetState()).To(gomega.Equal("delete"))
+	g.Expect(instance.Spec.ClusterID).To(gomega.Equal(constants.OwnClusterID))
+}
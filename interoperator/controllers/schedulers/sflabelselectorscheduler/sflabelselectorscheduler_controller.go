@@ -19,11 +19,14 @@ package sflabelselectorscheduler
 import (
 	"context"
 	"fmt"
-	"math"
 	"strings"
+	"sync"
+	"time"
 
 	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
 	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/schedulers/framework"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/schedulers/schedulercache"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
 	rendererFactory "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/factory"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/cluster/registry"
@@ -34,27 +37,46 @@ import (
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	apiErrors "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 	"sigs.k8s.io/yaml"
 )
 
+var log = logf.Log.WithName("schedulers.labelselector")
+
 // SFLabelSelectorScheduler reconciles a SFLabelSelectorScheduler object
 type SFLabelSelectorScheduler struct {
 	client.Client
 	Log             logr.Logger
 	scheme          *runtime.Scheme
 	clusterRegistry registry.ClusterRegistry
+	cfgManager      config.Config
+
+	// cache holds the instances scheduled but not yet reflected in the
+	// SFCluster status. mu serializes the scheduling decisions so that
+	// every decision sees the instances assumed before it.
+	cache schedulercache.Cache
+	mu    sync.Mutex
+
+	recorder record.EventRecorder
 }
 
 // Reconcile schedules the SFServiceInstance to one SFCluster and sets the ClusterID in
 // SFServiceInstance.Spec.ClusterID. It chooses the destination cluster based on clusterSelector
-// template provided in the plan.
+// template provided in the plan. The scheduling decision is recorded in
+// SFServiceInstance.Status.Scheduling and as an event.
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 func (r *SFLabelSelectorScheduler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
 	log := r.Log.WithValues("sfserviceinstance", req.NamespacedName)
@@ -65,26 +87,44 @@ func (r *SFLabelSelectorScheduler) Reconcile(req ctrl.Request) (ctrl.Result, err
 		if apiErrors.IsNotFound(err) {
 			// Object not found, return.  Created objects are automatically garbage collected.
 			// For additional cleanup logic use finalizers.
+			r.cache.ForgetInstance(req.NamespacedName.String())
 			return ctrl.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
 		return ctrl.Result{}, err
 	}
+	r.cache.ObserveInstance(req.NamespacedName.String(), instance)
 
 	state := instance.GetState()
 	if instance.Spec.ClusterID == "" && (state == "in_queue" || state == "update") {
-		labelSelector, requests, err := r.getSchedulingInfo(instance)
+		sctx, schedulerContext, err := r.getSchedulingInfo(instance)
 		if err != nil {
-			log.Error(err, "Failed to get scheduling info", "labelSelector", labelSelector, "requests", requests)
+			log.Error(err, "Failed to get scheduling info")
 			return ctrl.Result{}, err
 		}
 
-		clusterID, err := r.schedule(instance, labelSelector, requests)
+		clusterID, err := r.schedule(sctx, schedulerContext.SchedulerProfile, "")
 		if err != nil {
-			log.Error(err, "Failed to schedule ", "labelSelector", labelSelector, "clusterID", clusterID)
+			log.Error(err, "Failed to schedule ", "labelSelector", sctx.LabelSelector, "clusterID", clusterID)
 			if errors.SchedulerFailed(err) {
-				log.Info("Setting State to failed")
 				msg := err.Error()
+				schedulingTimeout := schedulerContext.getSchedulingTimeout()
+				if schedulingTimeout > 0 && framework.IsResolvable(err) {
+					r.recordEvent(instance, corev1.EventTypeWarning, "SchedulingPending", getDecisionMessage(sctx, msg))
+					requeueAfter, err := r.setSchedulingPending(req.NamespacedName, msg, schedulingTimeout, sctx.Decision)
+					if err != nil {
+						log.Error(err, "Failed to set scheduling pending")
+						return ctrl.Result{}, err
+					}
+					if requeueAfter > 0 {
+						log.Info("Scheduling pending", "requeueAfter", requeueAfter)
+						return ctrl.Result{RequeueAfter: requeueAfter}, nil
+					}
+					msg = fmt.Sprintf("%s Scheduling timed out after %s.", msg, schedulingTimeout)
+				}
+
+				log.Info("Setting State to failed")
+				r.recordEvent(instance, corev1.EventTypeWarning, "FailedScheduling", getDecisionMessage(sctx, msg))
 				err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
 					err = r.Get(ctx, req.NamespacedName, instance)
 					if err != nil {
@@ -93,6 +133,12 @@ func (r *SFLabelSelectorScheduler) Reconcile(req ctrl.Request) (ctrl.Result, err
 					instance.Status.State = "failed"
 					instance.Status.Error = msg
 					instance.Status.Description = msg
+					instance.Status.Scheduling = sctx.Decision
+					annotations := instance.GetAnnotations()
+					if _, ok := annotations[constants.SchedulingPendingSinceKey]; ok {
+						delete(annotations, constants.SchedulingPendingSinceKey)
+						instance.SetAnnotations(annotations)
+					}
 					return r.Update(ctx, instance)
 				})
 				if err != nil {
@@ -112,13 +158,25 @@ func (r *SFLabelSelectorScheduler) Reconcile(req ctrl.Request) (ctrl.Result, err
 					return err
 				}
 				instance.Spec.ClusterID = clusterID
+				instance.Status.Scheduling = sctx.Decision
+				annotations := instance.GetAnnotations()
+				if _, ok := annotations[constants.SchedulingPendingSinceKey]; ok {
+					delete(annotations, constants.SchedulingPendingSinceKey)
+					instance.SetAnnotations(annotations)
+					instance.Status.Description = ""
+				}
 				return r.Update(ctx, instance)
 			})
 			if err != nil {
 				log.Error(err, "Failed to set cluster id", "clusterID", clusterID)
+				r.cache.ForgetInstance(req.NamespacedName.String())
 				return ctrl.Result{}, err
 			}
+			r.recordEvent(instance, corev1.EventTypeNormal, "Scheduled", getDecisionMessage(sctx, ""))
 		}
+	} else if state == "migrate" && instance.Status.Migration != nil &&
+		instance.Status.Migration.Phase == osbv1alpha1.MigrationPhasePending {
+		return r.scheduleMigration(req.NamespacedName, instance)
 	} else if instance.Spec.ClusterID == "" && state == "delete" {
 		// Process delete request for unscheduled instances
 		err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
@@ -139,11 +197,219 @@ func (r *SFLabelSelectorScheduler) Reconcile(req ctrl.Request) (ctrl.Result, err
 	return ctrl.Result{}, nil
 }
 
+// scheduleMigration selects the target cluster of an instance being migrated.
+// The current cluster of the instance and the primary cluster are excluded.
+// If the target cluster is already set in the migration status, the filters
+// of the scheduler profile are run only on that cluster. If no cluster is
+// found, the migration is failed and the instance is left on its current
+// cluster.
+func (r *SFLabelSelectorScheduler) scheduleMigration(namespacedName types.NamespacedName,
+	instance *osbv1alpha1.SFServiceInstance) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("sfserviceinstance", namespacedName, "sourceClusterID", instance.Spec.ClusterID)
+
+	sctx, schedulerContext, err := r.getSchedulingInfo(instance)
+	if err != nil {
+		log.Error(err, "Failed to get scheduling info for migration")
+		return ctrl.Result{}, err
+	}
+	primaryClusterID := r.cfgManager.GetConfig().PrimaryClusterID
+	sctx.ExcludeClusters = []string{instance.Spec.ClusterID, primaryClusterID}
+	// The replicator can not access clusters in pull mode
+	sctx.ExcludePullMode = true
+
+	var targetClusterID string
+	var schedulingErr error
+	if instance.Spec.ClusterID == primaryClusterID {
+		schedulingErr = errors.NewSchedulerFailed("Migration", "Migration of instances on the primary cluster "+
+			primaryClusterID+" is not supported", nil)
+	} else {
+		targetClusterID, schedulingErr = r.schedule(sctx, schedulerContext.SchedulerProfile,
+			instance.Status.Migration.TargetClusterID)
+	}
+	var eventMsg string
+	if schedulingErr != nil {
+		log.Error(schedulingErr, "Failed to schedule migration", "labelSelector", sctx.LabelSelector)
+		if !errors.SchedulerFailed(schedulingErr) {
+			return ctrl.Result{}, schedulingErr
+		}
+		eventMsg = getDecisionMessage(sctx, schedulingErr.Error())
+	} else {
+		eventMsg = getDecisionMessage(sctx, fmt.Sprintf("Migrating from cluster %s to cluster %s.",
+			instance.Spec.ClusterID, targetClusterID))
+		sctx.Decision.SelectedCluster = targetClusterID
+	}
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		err := r.Get(ctx, namespacedName, instance)
+		if err != nil {
+			return err
+		}
+		migration := instance.Status.Migration
+		if instance.GetState() != "migrate" || migration == nil ||
+			migration.Phase != osbv1alpha1.MigrationPhasePending {
+			return nil
+		}
+		instance.Status.Scheduling = sctx.Decision
+		if schedulingErr != nil {
+			now := metav1.Now()
+			migration.Phase = osbv1alpha1.MigrationPhaseFailed
+			migration.Error = schedulingErr.Error()
+			migration.CompletionTime = &now
+			instance.SetState("succeeded")
+		} else {
+			migration.SourceClusterID = instance.Spec.ClusterID
+			migration.TargetClusterID = targetClusterID
+			migration.Phase = osbv1alpha1.MigrationPhaseBackup
+		}
+		return r.Update(ctx, instance)
+	})
+	if err != nil {
+		log.Error(err, "Failed to set migration target", "targetClusterID", targetClusterID)
+		r.cache.ForgetInstance(namespacedName.String())
+		return ctrl.Result{}, err
+	}
+	if schedulingErr != nil {
+		r.recordEvent(instance, corev1.EventTypeWarning, "FailedMigrationScheduling", eventMsg)
+	} else {
+		log.Info("Set migration target", "targetClusterID", targetClusterID)
+		r.recordEvent(instance, corev1.EventTypeNormal, "MigrationScheduled", eventMsg)
+	}
+	return ctrl.Result{}, nil
+}
+
+// getDecisionMessage returns the message for the events of the scheduling
+// decision. The decision is created if the framework did not run.
+func getDecisionMessage(sctx *framework.SchedulingContext, msg string) string {
+	if sctx.Decision == nil {
+		now := metav1.Now()
+		sctx.Decision = &osbv1alpha1.SchedulingStatus{
+			LabelSelector: sctx.LabelSelector,
+			Time:          &now,
+		}
+	}
+	if sctx.Decision.Message == "" {
+		sctx.Decision.Message = msg
+	}
+	if msg == "" || msg == sctx.Decision.Message {
+		return sctx.Decision.Message
+	}
+	return msg + " " + sctx.Decision.Message
+}
+
+// recordEvent records an event for the instance if a recorder is set
+func (r *SFLabelSelectorScheduler) recordEvent(instance *osbv1alpha1.SFServiceInstance, eventType, reason, message string) {
+	if r.recorder == nil {
+		return
+	}
+	r.recorder.Event(instance, eventType, reason, message)
+}
+
 type planSchedulerContext struct {
-	Requests corev1.ResourceList `yaml:"requests,omitempty" json:"requests,omitempty"`
+	Requests          corev1.ResourceList          `yaml:"requests,omitempty" json:"requests,omitempty"`
+	StorageRequests   map[string]resource.Quantity `yaml:"storageRequests,omitempty" json:"storageRequests,omitempty"`
+	SchedulerProfile  string                       `yaml:"schedulerProfile,omitempty" json:"schedulerProfile,omitempty"`
+	SchedulingTimeout string                       `yaml:"schedulingTimeout,omitempty" json:"schedulingTimeout,omitempty"`
+
+	PlacementRules []framework.PlacementRule `yaml:"placementRules,omitempty" json:"placementRules,omitempty"`
 }
 
-func (r *SFLabelSelectorScheduler) getSchedulingInfo(instance *osbv1alpha1.SFServiceInstance) (string, corev1.ResourceList, error) {
+// getSchedulingTimeout returns the duration for which an instance is kept
+// pending when no cluster has capacity for it. Zero means the instance
+// is failed immediately.
+func (schedulerContext *planSchedulerContext) getSchedulingTimeout() time.Duration {
+	if schedulerContext.SchedulingTimeout == "" {
+		return 0
+	}
+	schedulingTimeout, err := time.ParseDuration(schedulerContext.SchedulingTimeout)
+	if err != nil {
+		log.Error(err, "Ignoring invalid schedulingTimeout in plan context", "schedulingTimeout",
+			schedulerContext.SchedulingTimeout)
+		return 0
+	}
+	return schedulingTimeout
+}
+
+// setSchedulingPending keeps the instance in its current state and records
+// the reason in the status. The time when the instance first became pending
+// is stored as an annotation. It returns the time left before the scheduling
+// times out, or zero if it has already timed out.
+func (r *SFLabelSelectorScheduler) setSchedulingPending(namespacedName types.NamespacedName, msg string,
+	schedulingTimeout time.Duration, decision *osbv1alpha1.SchedulingStatus) (time.Duration, error) {
+	ctx := context.Background()
+	var requeueAfter time.Duration
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		instance := &osbv1alpha1.SFServiceInstance{}
+		err := r.Get(ctx, namespacedName, instance)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		pendingSince := now
+		annotations := instance.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		if val, ok := annotations[constants.SchedulingPendingSinceKey]; ok {
+			pendingSince, err = time.Parse(time.RFC3339, val)
+			if err != nil {
+				pendingSince = now
+			}
+		}
+
+		requeueAfter = pendingSince.Add(schedulingTimeout).Sub(now)
+		if requeueAfter <= 0 {
+			requeueAfter = 0
+			return nil
+		}
+
+		description := "Waiting for a cluster with capacity. " + msg
+		if annotations[constants.SchedulingPendingSinceKey] != "" && instance.Status.Description == description {
+			return nil
+		}
+		annotations[constants.SchedulingPendingSinceKey] = pendingSince.Format(time.RFC3339)
+		instance.SetAnnotations(annotations)
+		instance.Status.Description = description
+		instance.Status.Scheduling = decision
+		return r.Update(ctx, instance)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return requeueAfter, nil
+}
+
+// pendingInstances returns the requests for all the instances waiting for
+// a cluster with capacity
+func (r *SFLabelSelectorScheduler) pendingInstances(a handler.MapObject) []reconcile.Request {
+	instances := &osbv1alpha1.SFServiceInstanceList{}
+	err := r.List(context.Background(), instances)
+	if err != nil {
+		r.Log.Error(err, "Failed to list instances pending scheduling", "sfcluster", a.Meta.GetName())
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0)
+	for _, instance := range instances.Items {
+		if instance.Spec.ClusterID != "" {
+			continue
+		}
+		if _, ok := instance.GetAnnotations()[constants.SchedulingPendingSinceKey]; !ok {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      instance.GetName(),
+				Namespace: instance.GetNamespace(),
+			},
+		})
+	}
+	return requests
+}
+
+func (r *SFLabelSelectorScheduler) getSchedulingInfo(instance *osbv1alpha1.SFServiceInstance) (*framework.SchedulingContext, *planSchedulerContext, error) {
 	ctx := context.Background()
 
 	sfNamespace := constants.InteroperatorNamespace
@@ -154,12 +420,12 @@ func (r *SFLabelSelectorScheduler) getSchedulingInfo(instance *osbv1alpha1.SFSer
 	}
 	err := r.Get(ctx, namespacedName, plan)
 	if err != nil {
-		return "", nil, err
+		return nil, nil, err
 	}
 
 	labelSelector, err := r.getLabelSelectorString(instance, plan)
 	if err != nil {
-		return "", nil, err
+		return nil, nil, err
 	}
 
 	schedulerContext := &planSchedulerContext{}
@@ -168,11 +434,25 @@ func (r *SFLabelSelectorScheduler) getSchedulingInfo(instance *osbv1alpha1.SFSer
 		err = yaml.Unmarshal(plan.Spec.RawContext.Raw, schedulerContext)
 
 		if err != nil {
-			return labelSelector, nil, err
+			return nil, nil, err
 		}
 	}
 
-	return labelSelector, schedulerContext.Requests, nil
+	topology, err := framework.GetTopologyPreference(instance, r.cfgManager.GetConfig().Topology)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sctx := &framework.SchedulingContext{
+		Instance:        instance,
+		Plan:            plan,
+		LabelSelector:   labelSelector,
+		Requests:        schedulerContext.Requests,
+		StorageRequests: schedulerContext.StorageRequests,
+		PlacementRules:  schedulerContext.PlacementRules,
+		Topology:        topology,
+	}
+	return sctx, schedulerContext, nil
 }
 
 func (r *SFLabelSelectorScheduler) getLabelSelectorString(sfServiceInstance *osbv1alpha1.SFServiceInstance, plan *osbv1alpha1.SFPlan) (string, error) {
@@ -229,88 +509,63 @@ func (r *SFLabelSelectorScheduler) getLabelSelectorString(sfServiceInstance *osb
 	return strings.TrimSuffix(labelSelector, "\n"), nil
 }
 
-func (r *SFLabelSelectorScheduler) schedule(sfServiceInstance *osbv1alpha1.SFServiceInstance, labelSelector string,
-	requests corev1.ResourceList) (string, error) {
+func (r *SFLabelSelectorScheduler) schedule(sctx *framework.SchedulingContext, profileName, targetClusterID string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-	log := r.Log.WithValues("instance", sfServiceInstance.GetName(), "labelSelector", labelSelector, "requests", requests)
-	label, err := labels.Parse(labelSelector)
+	clusterID, err := r.selectCluster(sctx, profileName, targetClusterID)
 	if err != nil {
-		return "", errors.NewSchedulerFailed("Label Based Scheduler", "Parsing failed for labelSelector: "+labelSelector, err)
-	}
-	log.Info("Parsed Label is: ", "label", label)
-	var clusters *resourcev1alpha1.SFClusterList
-	if labelSelector == "" {
-		clusters, err = r.clusterRegistry.ListClusters(&client.ListOptions{})
-		if err != nil {
-			return "", err
-		}
-	} else {
-		clusters, err = r.clusterRegistry.ListClusters(&client.ListOptions{
-			LabelSelector: label,
-		})
-		if err != nil {
-			return "", err
-		}
+		return "", err
 	}
 
-	log.Info("Cluster size is", "length", len(clusters.Items))
-	if len(clusters.Items) == 0 {
-		log.Info("No cluster matching the criteria, returning failure")
-		return "", errors.NewSchedulerFailed("Label Based Scheduler", "No clusters found with matching criteria: "+labelSelector, nil)
+	key := types.NamespacedName{
+		Name:      sctx.Instance.GetName(),
+		Namespace: sctx.Instance.GetNamespace(),
 	}
+	r.cache.AssumeInstance(key.String(), clusterID, sctx.Requests, sctx.StorageRequests)
+	return clusterID, nil
+}
 
-	// Requested resources for the plan not provided.
-	// Schedule on the cluster with least number of service instances
-	if requests == nil || len(requests) == 0 {
-		if len(clusters.Items) == 1 {
-			log.Info("Only one cluster matching the criteria", "cluster name", clusters.Items[0].GetName())
-			return clusters.Items[0].GetName(), nil
-		}
+// selectCluster runs the scheduler profile on the clusters and returns the
+// selected cluster without assuming the instance on it. If targetClusterID
+// is set, the profile is run only on that cluster. It must be called with
+// r.mu held.
+func (r *SFLabelSelectorScheduler) selectCluster(sctx *framework.SchedulingContext, profileName, targetClusterID string) (string, error) {
+	log := r.Log.WithValues("instance", sctx.Instance.GetName(), "labelSelector", sctx.LabelSelector,
+		"requests", sctx.Requests, "profile", profileName)
+
+	interoperatorCfg := r.cfgManager.GetConfig()
+	if profileName == "" {
+		profileName = interoperatorCfg.DefaultSchedulerProfile
+	}
+	profile, err := framework.GetProfile(profileName, sctx.Requests, interoperatorCfg.SchedulerProfiles)
+	if err != nil {
+		return "", err
+	}
+	fwk, err := framework.New(profile, r)
+	if err != nil {
+		return "", err
+	}
 
-		leastCount := int(math.MaxInt64)
-		var clusterID string
-		for _, cluster := range clusters.Items {
-			log.Info("Cluster Info", "cluster name", cluster.GetName(), "cluster filled", cluster.Status.ServiceInstanceCount)
-			count := cluster.Status.ServiceInstanceCount
-			if count < leastCount {
-				leastCount = count
-				clusterID = cluster.GetName()
-				if count == 0 {
-					break
-				}
-			}
-		}
-		return clusterID, nil
+	clusters, err := r.clusterRegistry.ListClusters(&client.ListOptions{})
+	if err != nil {
+		return "", err
 	}
+	log.Info("Cluster size is", "length", len(clusters.Items), "profile", fwk.ProfileName())
 
-	// Requested Resource are provided for the plan.
-	// Schedule on the cluster with maximum allocatable resources
-	var clusterID string
-	maxAllocatable := make(corev1.ResourceList)
-	for _, cluster := range clusters.Items {
-		allocatable := cluster.Status.TotalCapacity.DeepCopy()
-		if allocatable == nil || len(allocatable) == 0 {
-			allocatable = cluster.Status.CurrentCapacity.DeepCopy()
-		}
-		resourcev1alpha1.ResourceListSub(allocatable, cluster.Status.Requests)
-		log.Info("Cluster Info", "cluster name", cluster.GetName(), "allocatable", allocatable, "maxAllocatable", maxAllocatable)
-		if !resourcev1alpha1.ResourceListLess(requests, allocatable) {
-			continue
-		}
-		if resourcev1alpha1.ResourceListLess(maxAllocatable, allocatable) {
-			// Copy only fields mentioned in requests
-			for key := range requests {
-				maxAllocatable[key] = allocatable[key]
+	// Account for the instances already scheduled but
+	// not yet reflected in the cluster status
+	r.cache.UpdateClusters(clusters.Items)
+
+	if targetClusterID != "" {
+		for i := range clusters.Items {
+			if clusters.Items[i].GetName() == targetClusterID {
+				return fwk.Schedule(sctx, clusters.Items[i:i+1])
 			}
-			clusterID = cluster.GetName()
 		}
+		return "", errors.NewSchedulerFailed(fwk.ProfileName(), "Target cluster "+targetClusterID+" not found", nil)
 	}
-	if clusterID == "" {
-		msg := fmt.Sprintf("No clusters found with required resources. cpu : %s, memory %s.", requests.Cpu().String(), requests.Memory().String())
-		err = errors.NewSchedulerFailed("Label Based Scheduler", msg, nil)
-		return "", err
-	}
-	return clusterID, nil
+	return fwk.Schedule(sctx, clusters.Items)
 }
 
 // SetupWithManager registers the least utilized scheduler with manager
@@ -326,9 +581,16 @@ func (r *SFLabelSelectorScheduler) SetupWithManager(mgr ctrl.Manager) error {
 	if err != nil {
 		return err
 	}
+	r.cfgManager = cfgManager
+	if r.cache == nil {
+		r.cache = schedulercache.New(constants.AssumedInstanceTTL, constants.AssumedInstanceMaxAge)
+	}
 	interoperatorCfg := cfgManager.GetConfig()
 
 	r.scheme = mgr.GetScheme()
+	if r.recorder == nil {
+		r.recorder = mgr.GetEventRecorderFor("scheduler_labelselector")
+	}
 
 	return ctrl.NewControllerManagedBy(mgr).
 		Named("scheduler_labelselector").
@@ -336,6 +598,9 @@ func (r *SFLabelSelectorScheduler) SetupWithManager(mgr ctrl.Manager) error {
 			MaxConcurrentReconciles: interoperatorCfg.InstanceWorkerCount,
 		}).
 		For(&osbv1alpha1.SFServiceInstance{}).
+		Watches(&source.Kind{Type: &resourcev1alpha1.SFCluster{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.pendingInstances),
+		}).
 		WithEventFilter(watches.NamespaceLabelFilter()).
 		Complete(r)
 }
@@ -24,7 +24,11 @@ import (
 
 	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
 	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/schedulers/framework"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/schedulers/schedulercache"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/schedulers/sfserviceinstancecounter"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	mock_clusterRegistry "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/cluster/registry/mock_registry"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -37,6 +41,8 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	ctrlrun "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
@@ -298,6 +304,184 @@ func TestReconcile(t *testing.T) {
 		return nil
 	}, timeout).Should(gomega.Succeed())
 	g.Expect(instance6.Spec.ClusterID).To(gomega.Equal(sfcluster3.GetName()))
+
+	// Do not schedule on cluster filled beyond scheduling limit
+	g.Expect(c.Get(context.TODO(), _getKey(sfcluster3), sfcluster3)).NotTo(gomega.HaveOccurred())
+	sfcluster3.Spec.SchedulingLimitPercentage = 10
+	g.Expect(c.Update(context.TODO(), sfcluster3)).NotTo(gomega.HaveOccurred())
+	instance7 := _getDummySFServiceInstance("foo7", "plan-id-5")
+	g.Expect(c.Create(context.TODO(), instance7)).NotTo(gomega.HaveOccurred())
+	defer c.Delete(context.TODO(), instance7)
+	g.Eventually(func() error {
+		err := c.Get(context.TODO(), _getKey(instance7), instance7)
+		if err != nil {
+			return err
+		}
+		_, err = instance7.GetClusterID()
+		if err == nil {
+			return errors.New("instance got scheduled")
+		}
+		state := instance7.GetState()
+		if state != "failed" {
+			return errors.New("service instance state is not failed")
+		}
+		return nil
+	}, timeout).Should(gomega.Succeed())
+
+	// Keep instance pending when schedulingTimeout is set in plan context
+	plan6 := _getDummySFPlan("plan-id-6", "")
+	plan6.Spec.Templates = []osbv1alpha1.TemplateSpec{}
+	plan6.Spec.RawContext = &runtime.RawExtension{
+		Raw: []byte(`{ "requests": { "cpu": "1", "memory": "1024Mi" }, "schedulingTimeout": "1h"}`),
+	}
+	g.Expect(c.Create(context.TODO(), plan6)).NotTo(gomega.HaveOccurred())
+	defer c.Delete(context.TODO(), plan6)
+	instance8 := _getDummySFServiceInstance("foo8", "plan-id-6")
+	g.Expect(c.Create(context.TODO(), instance8)).NotTo(gomega.HaveOccurred())
+	defer c.Delete(context.TODO(), instance8)
+	g.Eventually(func() error {
+		err := c.Get(context.TODO(), _getKey(instance8), instance8)
+		if err != nil {
+			return err
+		}
+		if _, ok := instance8.GetAnnotations()[constants.SchedulingPendingSinceKey]; !ok {
+			return errors.New("instance is not pending")
+		}
+		return nil
+	}, timeout).Should(gomega.Succeed())
+	g.Expect(instance8.GetState()).To(gomega.Equal("in_queue"))
+	g.Expect(instance8.Spec.ClusterID).To(gomega.Equal(""))
+	g.Expect(instance8.Status.Description).NotTo(gomega.BeEmpty())
+
+	// Schedule pending instance when capacity is available
+	g.Expect(c.Get(context.TODO(), _getKey(sfcluster3), sfcluster3)).NotTo(gomega.HaveOccurred())
+	sfcluster3.Spec.SchedulingLimitPercentage = 0
+	g.Expect(c.Update(context.TODO(), sfcluster3)).NotTo(gomega.HaveOccurred())
+	g.Eventually(func() error {
+		err := c.Get(context.TODO(), _getKey(instance8), instance8)
+		if err != nil {
+			return err
+		}
+		_, err = instance8.GetClusterID()
+		return err
+	}, timeout).Should(gomega.Succeed())
+	g.Expect(instance8.Spec.ClusterID).To(gomega.Equal(sfcluster3.GetName()))
+	g.Expect(instance8.GetAnnotations()).NotTo(gomega.HaveKey(constants.SchedulingPendingSinceKey))
+}
+
+func TestReconcile_schedulingTimeout(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	scheme := runtime.NewScheme()
+	g.Expect(osbv1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+	g.Expect(resourcev1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	plan := _getDummySFPlan("plan-id-1", "plan={{ .instance.spec.planId }}\n")
+	plan.Spec.RawContext = &runtime.RawExtension{
+		Raw: []byte(`{"requests": {"cpu": "4"}, "schedulingTimeout": "1m"}`),
+	}
+	instance := _getDummySFServiceInstance("instance-id", "plan-id-1")
+	instance.SetAnnotations(map[string]string{
+		constants.SchedulingPendingSinceKey: time.Now().Add(-2 * time.Minute).Format(time.RFC3339),
+	})
+	c := fake.NewFakeClientWithScheme(scheme, plan, instance, _getDummySFService("service-id"))
+
+	cluster := _getDummySFCLuster("1", map[string]string{"plan": "plan-id-1"})
+	cluster.Status.TotalCapacity = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2")}
+	mockClusterRegistry := mock_clusterRegistry.NewMockClusterRegistry(ctrl)
+	mockClusterRegistry.EXPECT().ListClusters(gomock.Any()).Return(&resourcev1alpha1.SFClusterList{
+		Items: []resourcev1alpha1.SFCluster{*cluster},
+	}, nil).AnyTimes()
+
+	r := &SFLabelSelectorScheduler{
+		Client:          c,
+		Log:             ctrlrun.Log.WithName("schedulers").WithName("labelselector"),
+		scheme:          scheme,
+		clusterRegistry: mockClusterRegistry,
+		cfgManager:      &fakeConfig{cfg: &config.InteroperatorConfig{}},
+		cache:           schedulercache.New(constants.AssumedInstanceTTL, constants.AssumedInstanceMaxAge),
+	}
+
+	result, err := r.Reconcile(ctrlrun.Request{NamespacedName: _getKey(instance)})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result.RequeueAfter).To(gomega.BeZero())
+
+	failed := &osbv1alpha1.SFServiceInstance{}
+	g.Expect(c.Get(context.TODO(), _getKey(instance), failed)).To(gomega.Succeed())
+	g.Expect(failed.GetState()).To(gomega.Equal("failed"))
+	g.Expect(failed.Status.Description).To(gomega.ContainSubstring("Scheduling timed out"))
+	g.Expect(failed.GetAnnotations()).NotTo(gomega.HaveKey(constants.SchedulingPendingSinceKey))
+
+	// Timed out instances are not requeued on cluster events
+	g.Expect(r.pendingInstances(handler.MapObject{Meta: cluster, Object: cluster})).To(gomega.BeEmpty())
+}
+
+func TestReconcile_migrationTarget(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	scheme := runtime.NewScheme()
+	g.Expect(osbv1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+	g.Expect(resourcev1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	plan := _getDummySFPlan("plan-id-1", "plan={{ .instance.spec.planId }}\n")
+	getInstance := func(name, targetClusterID string) *osbv1alpha1.SFServiceInstance {
+		instance := _getDummySFServiceInstance(name, "plan-id-1")
+		instance.Spec.ClusterID = "2"
+		instance.SetState("migrate")
+		instance.Status.Migration = &osbv1alpha1.MigrationStatus{
+			SourceClusterID: "2",
+			TargetClusterID: targetClusterID,
+			Phase:           osbv1alpha1.MigrationPhasePending,
+		}
+		return instance
+	}
+	mismatched := getInstance("mismatched-target", "3")
+	matched := getInstance("matched-target", "4")
+	c := fake.NewFakeClientWithScheme(scheme, plan, mismatched, matched, _getDummySFService("service-id"))
+
+	mockClusterRegistry := mock_clusterRegistry.NewMockClusterRegistry(ctrl)
+	mockClusterRegistry.EXPECT().ListClusters(gomock.Any()).Return(&resourcev1alpha1.SFClusterList{
+		Items: []resourcev1alpha1.SFCluster{
+			*_getDummySFCLuster("1", map[string]string{"plan": "plan-id-1"}),
+			*_getDummySFCLuster("2", map[string]string{"plan": "plan-id-1"}),
+			*_getDummySFCLuster("3", map[string]string{"plan": "plan-id-2"}),
+			*_getDummySFCLuster("4", map[string]string{"plan": "plan-id-1"}),
+		},
+	}, nil).AnyTimes()
+
+	r := &SFLabelSelectorScheduler{
+		Client:          c,
+		Log:             ctrlrun.Log.WithName("schedulers").WithName("labelselector"),
+		scheme:          scheme,
+		clusterRegistry: mockClusterRegistry,
+		cfgManager:      &fakeConfig{cfg: &config.InteroperatorConfig{PrimaryClusterID: "1"}},
+		cache:           schedulercache.New(constants.AssumedInstanceTTL, constants.AssumedInstanceMaxAge),
+	}
+
+	// Target cluster is filtered out by the label selector of the plan
+	_, err := r.Reconcile(ctrlrun.Request{NamespacedName: _getKey(mismatched)})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	instance := &osbv1alpha1.SFServiceInstance{}
+	g.Expect(c.Get(context.TODO(), _getKey(mismatched), instance)).To(gomega.Succeed())
+	g.Expect(instance.GetState()).To(gomega.Equal("succeeded"))
+	g.Expect(instance.Status.Migration.Phase).To(gomega.Equal(osbv1alpha1.MigrationPhaseFailed))
+	g.Expect(instance.Status.Scheduling.Clusters).To(gomega.HaveLen(1))
+	g.Expect(instance.Status.Scheduling.Clusters[0].ClusterID).To(gomega.Equal("3"))
+	g.Expect(instance.Status.Scheduling.Clusters[0].Plugin).To(gomega.Equal(framework.LabelSelectorName))
+
+	// Target cluster passing the filters is used
+	_, err = r.Reconcile(ctrlrun.Request{NamespacedName: _getKey(matched)})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	instance = &osbv1alpha1.SFServiceInstance{}
+	g.Expect(c.Get(context.TODO(), _getKey(matched), instance)).To(gomega.Succeed())
+	g.Expect(instance.GetState()).To(gomega.Equal("migrate"))
+	g.Expect(instance.Status.Migration.Phase).To(gomega.Equal(osbv1alpha1.MigrationPhaseBackup))
+	g.Expect(instance.Status.Migration.TargetClusterID).To(gomega.Equal("4"))
+	g.Expect(instance.Status.Scheduling.SelectedCluster).To(gomega.Equal("4"))
 }
 
 func _getDummyConfigMap() *corev1.ConfigMap {
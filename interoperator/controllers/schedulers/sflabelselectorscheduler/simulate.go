@@ -0,0 +1,115 @@
+/*
+Copyright 2018 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sflabelselectorscheduler
+
+import (
+	"context"
+	"fmt"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/schedulers/schedulercache"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/cluster/registry"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// NewSimulator returns a SFLabelSelectorScheduler which is not registered
+// with a manager. It can only be used to Simulate scheduling decisions.
+func NewSimulator(kubeConfig *rest.Config, scheme *runtime.Scheme, mapper meta.RESTMapper) (*SFLabelSelectorScheduler, error) {
+	if kubeConfig == nil {
+		return nil, errors.NewInputError("NewSimulator", "kubeConfig", nil)
+	}
+	if scheme == nil {
+		return nil, errors.NewInputError("NewSimulator", "scheme", nil)
+	}
+
+	c, err := client.New(kubeConfig, client.Options{
+		Scheme: scheme,
+		Mapper: mapper,
+	})
+	if err != nil {
+		return nil, err
+	}
+	clusterRegistry, err := registry.New(kubeConfig, scheme, mapper)
+	if err != nil {
+		return nil, err
+	}
+	cfgManager, err := config.New(kubeConfig, scheme, mapper)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SFLabelSelectorScheduler{
+		Client:          c,
+		Log:             ctrl.Log.WithName("schedulers").WithName("labelselector").WithName("simulator"),
+		scheme:          scheme,
+		clusterRegistry: clusterRegistry,
+		cfgManager:      cfgManager,
+		cache:           schedulercache.New(constants.AssumedInstanceTTL, constants.AssumedInstanceMaxAge),
+	}, nil
+}
+
+// Simulate evaluates the clusters for the instance as Reconcile would and
+// returns the scheduling decision. The instance is neither created nor
+// assumed on the selected cluster. Only the instances already assumed by
+// this scheduler are accounted for, so the decision may differ from the
+// one of the running scheduler while its instances are not yet reflected
+// in the cluster status. If the ServiceID of the instance is not set, it
+// is read from the plan. If no cluster is feasible, the decision is
+// returned without an error and SelectedCluster is empty.
+func (r *SFLabelSelectorScheduler) Simulate(instance *osbv1alpha1.SFServiceInstance) (*osbv1alpha1.SchedulingStatus, error) {
+	plan := &osbv1alpha1.SFPlan{}
+	err := r.Get(context.Background(), types.NamespacedName{
+		Name:      instance.Spec.PlanID,
+		Namespace: constants.InteroperatorNamespace,
+	}, plan)
+	if err != nil {
+		return nil, err
+	}
+	if instance.Spec.ServiceID == "" {
+		instance.Spec.ServiceID = plan.Spec.ServiceID
+	} else if instance.Spec.ServiceID != plan.Spec.ServiceID {
+		return nil, errors.NewInputError("Simulate", "serviceId", fmt.Errorf("service %s does not match service %s of plan %s",
+			instance.Spec.ServiceID, plan.Spec.ServiceID, instance.Spec.PlanID))
+	}
+
+	sctx, schedulerContext, err := r.getSchedulingInfo(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, err = r.selectCluster(sctx, schedulerContext.SchedulerProfile, "")
+	if err != nil {
+		if sctx.Decision == nil || !errors.SchedulerFailed(err) {
+			return nil, err
+		}
+		r.Log.Info("No cluster is feasible for the simulated instance", "instance", instance.GetName(),
+			"reason", err.Error())
+	}
+	return sctx.Decision, nil
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2018 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sflabelselectorscheduler
+
+import (
+	"context"
+	"testing"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/schedulers/framework"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/schedulers/schedulercache"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	mock_clusterRegistry "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/cluster/registry/mock_registry"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	"github.com/golang/mock/gomock"
+	"github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrlrun "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type fakeConfig struct {
+	cfg *config.InteroperatorConfig
+}
+
+func (f *fakeConfig) GetConfig() *config.InteroperatorConfig {
+	return f.cfg
+}
+
+func (f *fakeConfig) UpdateConfig(cfg *config.InteroperatorConfig) error {
+	f.cfg = cfg
+	return nil
+}
+
+func TestSFLabelSelectorScheduler_Simulate(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	scheme := runtime.NewScheme()
+	g.Expect(osbv1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+	g.Expect(resourcev1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	plan := _getDummySFPlan("plan-id-1", "plan={{ .instance.spec.planId }}\n")
+	plan.Spec.ServiceID = "service-id"
+	unmatched := _getDummySFPlan("plan-id-2", "plan=none\n")
+	unmatched.Spec.ServiceID = "service-id"
+	c := fake.NewFakeClientWithScheme(scheme, plan, unmatched, _getDummySFService("service-id"))
+
+	clusters := &resourcev1alpha1.SFClusterList{
+		Items: []resourcev1alpha1.SFCluster{
+			*_getDummySFCLuster("1", map[string]string{"plan": "plan-id-2"}),
+			*_getDummySFCLuster("2", map[string]string{"plan": "plan-id-1"}),
+		},
+	}
+	mockClusterRegistry := mock_clusterRegistry.NewMockClusterRegistry(ctrl)
+	mockClusterRegistry.EXPECT().ListClusters(gomock.Any()).Return(clusters, nil).AnyTimes()
+
+	r := &SFLabelSelectorScheduler{
+		Client:          c,
+		Log:             ctrlrun.Log.WithName("schedulers").WithName("labelselector").WithName("simulator"),
+		scheme:          scheme,
+		clusterRegistry: mockClusterRegistry,
+		cfgManager:      &fakeConfig{cfg: &config.InteroperatorConfig{}},
+		cache:           schedulercache.New(constants.AssumedInstanceTTL, constants.AssumedInstanceMaxAge),
+	}
+
+	instance := &osbv1alpha1.SFServiceInstance{}
+	instance.SetName("simulated-instance")
+	instance.SetNamespace("sf-simulated-instance")
+	instance.Spec.PlanID = "plan-id-1"
+
+	// ServiceID is read from the plan
+	decision, err := r.Simulate(instance)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(instance.Spec.ServiceID).To(gomega.Equal("service-id"))
+	g.Expect(decision.SelectedCluster).To(gomega.Equal("2"))
+	g.Expect(decision.LabelSelector).To(gomega.Equal("plan=plan-id-1"))
+	g.Expect(decision.Clusters).To(gomega.HaveLen(2))
+	g.Expect(decision.Clusters[0].Feasible).To(gomega.BeFalse())
+	g.Expect(decision.Clusters[0].Plugin).To(gomega.Equal(framework.LabelSelectorName))
+	g.Expect(decision.Clusters[1].Feasible).To(gomega.BeTrue())
+
+	// The instance is neither created nor assumed
+	instances := &osbv1alpha1.SFServiceInstanceList{}
+	g.Expect(c.List(context.TODO(), instances)).To(gomega.Succeed())
+	g.Expect(instances.Items).To(gomega.BeEmpty())
+	observed := clusters.DeepCopy()
+	r.cache.UpdateClusters(observed.Items)
+	g.Expect(observed.Items[1].Status.ServiceInstanceCount).To(gomega.Equal(0))
+
+	// No cluster is feasible
+	instance.Spec.PlanID = "plan-id-2"
+	decision, err = r.Simulate(instance)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(decision.SelectedCluster).To(gomega.BeEmpty())
+	g.Expect(decision.Message).NotTo(gomega.BeEmpty())
+
+	// ServiceID must match the plan
+	instance.Spec.PlanID = "plan-id-1"
+	instance.Spec.ServiceID = "other-service-id"
+	_, err = r.Simulate(instance)
+	g.Expect(errors.InputError(err)).To(gomega.BeTrue())
+}
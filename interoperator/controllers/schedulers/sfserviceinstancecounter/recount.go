@@ -0,0 +1,318 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfserviceinstancecounter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/utils"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/watches"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlbuilder "sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+var (
+	countCorrectionsMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "instance_count_corrections_total",
+			Namespace: "interoperator",
+			Subsystem: "cluster",
+			Help:      "Number of corrections of the service instance count partitioned by cluster",
+		},
+		[]string{
+			// Which cluster?
+			"cluster",
+		},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(countCorrectionsMetric)
+}
+
+// recountRequest is the request of a recount of all the clusters
+var recountRequest = reconcile.Request{
+	NamespacedName: types.NamespacedName{
+		Name:      "recount",
+		Namespace: constants.InteroperatorNamespace,
+	},
+}
+
+// SFClusterRecounter periodically recounts the service instances of the
+// SFClusters and corrects the ServiceInstanceCount maintained by the
+// SFServiceInstanceCounter if it has drifted, for example because of a
+// missed event or a crash between updating the finalizer and the count.
+type SFClusterRecounter struct {
+	client.Client
+	Log logr.Logger
+
+	// apiReader reads the clusters and instances without the cache, so
+	// that the instances are not older than the count of the cluster
+	apiReader  client.Reader
+	cfgManager config.Config
+	recorder   record.EventRecorder
+}
+
+// instanceCounts are the service instances counted per cluster
+type instanceCounts struct {
+	counts map[string]int
+	// pending are the clusters with instances whose counter finalizer is
+	// yet to be added or removed by the SFServiceInstanceCounter
+	pending map[string]bool
+}
+
+// Reconcile recounts all the clusters in one pass. The instances are
+// listed once for the pass after the clusters are read, so that a count
+// updated meanwhile by the SFServiceInstanceCounter causes a conflict.
+// The clusters are recounted every ClusterReconcileInterval.
+func (r *SFClusterRecounter) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	requeueAfter := r.getRecountInterval()
+
+	clusters := &resourcev1alpha1.SFClusterList{}
+	err := r.apiReader.List(ctx, clusters, client.InNamespace(constants.InteroperatorNamespace))
+	if err != nil {
+		r.Log.Error(err, "Failed to list clusters")
+		return ctrl.Result{}, err
+	}
+	if len(clusters.Items) == 0 {
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+
+	counts, err := r.countInstances(ctx)
+	if err != nil {
+		r.Log.Error(err, "Failed to count instances")
+		return ctrl.Result{}, err
+	}
+
+	var lastErr error
+	for i := range clusters.Items {
+		err = r.correctCount(ctx, &clusters.Items[i], counts)
+		if err != nil {
+			lastErr = err
+		}
+	}
+	if lastErr != nil {
+		return ctrl.Result{}, lastErr
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// correctCount updates the ServiceInstanceCount of the cluster if it differs
+// from counts. On conflict the cluster is read again and the instances are
+// recounted. The count is not corrected while the counter finalizer of an
+// instance of the cluster is being added or removed.
+func (r *SFClusterRecounter) correctCount(ctx context.Context, cluster *resourcev1alpha1.SFCluster,
+	counts *instanceCounts) error {
+	clusterID := cluster.GetName()
+	log := r.Log.WithValues("sfcluster", clusterID)
+	namespacedName := types.NamespacedName{
+		Name:      clusterID,
+		Namespace: cluster.GetNamespace(),
+	}
+
+	var previous, count int
+	corrected := false
+	reread := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if reread {
+			err := r.apiReader.Get(ctx, namespacedName, cluster)
+			if err != nil {
+				return err
+			}
+			recounted, err := r.countInstances(ctx)
+			if err != nil {
+				return err
+			}
+			*counts = *recounted
+		}
+		reread = true
+
+		if counts.pending[clusterID] {
+			log.V(1).Info("Instance count is being updated. Skipping correction")
+			return nil
+		}
+		previous = cluster.Status.ServiceInstanceCount
+		count = counts.counts[clusterID]
+		if previous == count {
+			return nil
+		}
+		cluster.Status.ServiceInstanceCount = count
+		err := r.Status().Update(ctx, cluster)
+		if err != nil {
+			return err
+		}
+		corrected = true
+		return nil
+	})
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			return nil
+		}
+		log.Error(err, "Failed to correct service instance count", "count", count)
+		return err
+	}
+
+	if corrected {
+		log.Info("Corrected service instance count", "previous", previous, "count", count)
+		countCorrectionsMetric.WithLabelValues(clusterID).Inc()
+		if r.recorder != nil {
+			r.recorder.Event(cluster, corev1.EventTypeWarning, "InstanceCountCorrected",
+				fmt.Sprintf("Service instance count corrected from %d to %d", previous, count))
+		}
+	}
+	return nil
+}
+
+// countInstances returns the number of service instances counted on each
+// cluster. An instance is counted once the counter finalizer is set on it.
+// The instance of a migration stays counted on the source cluster till its
+// count is moved to the target cluster.
+func (r *SFClusterRecounter) countInstances(ctx context.Context) (*instanceCounts, error) {
+	counts := &instanceCounts{
+		counts:  make(map[string]int),
+		pending: make(map[string]bool),
+	}
+	instances := &osbv1alpha1.SFServiceInstanceList{}
+	for more := true; more; more = (instances.Continue != "") {
+		err := r.apiReader.List(ctx, instances, client.Limit(constants.ListPaginationLimit),
+			client.Continue(instances.Continue))
+		if err != nil {
+			return nil, err
+		}
+		for _, instance := range instances.Items {
+			clusterID := instance.Spec.ClusterID
+			if clusterID == "" {
+				continue
+			}
+			finalizers := instance.GetFinalizers()
+			counted := utils.ContainsString(finalizers, constants.SFServiceInstanceCounterFinalizerName)
+			if instance.GetDeletionTimestamp().IsZero() {
+				if !counted {
+					counts.pending[clusterID] = true
+				}
+			} else if counted && !utils.ContainsString(finalizers, constants.FinalizerName) {
+				counts.pending[clusterID] = true
+			}
+			if counted {
+				counts.counts[countedClusterID(&instance)]++
+			}
+		}
+	}
+	return counts, nil
+}
+
+// countedClusterID returns the cluster the instance is counted on
+func countedClusterID(instance *osbv1alpha1.SFServiceInstance) string {
+	migration := instance.Status.Migration
+	if migration != nil && !migration.InstanceCountMoved && migration.SourceClusterID != "" &&
+		instance.Spec.ClusterID == migration.TargetClusterID {
+		return migration.SourceClusterID
+	}
+	return instance.Spec.ClusterID
+}
+
+// getRecountInterval returns the ClusterReconcileInterval of the config
+func (r *SFClusterRecounter) getRecountInterval() time.Duration {
+	interval := constants.DefaultClusterReconcileInterval
+	if r.cfgManager != nil {
+		interval = r.cfgManager.GetConfig().ClusterReconcileInterval
+	}
+	requeueAfter, err := time.ParseDuration(interval)
+	if err != nil {
+		r.Log.Error(err, "Failed to parse ClusterReconcileInterval",
+			"ClusterReconcileInterval", interval)
+		requeueAfter, _ = time.ParseDuration(constants.DefaultClusterReconcileInterval)
+	}
+	return requeueAfter
+}
+
+// SetupWithManager registers the SFCluster recounter with manager
+// and setups the watches.
+func (r *SFClusterRecounter) SetupWithManager(mgr ctrl.Manager) error {
+	if r.cfgManager == nil {
+		cfgManager, err := config.New(mgr.GetConfig(), mgr.GetScheme(), mgr.GetRESTMapper())
+		if err != nil {
+			return err
+		}
+		r.cfgManager = cfgManager
+	}
+	if r.apiReader == nil {
+		r.apiReader = mgr.GetAPIReader()
+	}
+	r.recorder = mgr.GetEventRecorderFor("scheduler_helper_sfcluster_recounter")
+
+	// The clusters are recounted periodically in one pass, so the creation
+	// of any cluster is mapped to the same request. The status updates of
+	// the clusters need not trigger a recount.
+	recountMapper := &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
+			return []reconcile.Request{recountRequest}
+		}),
+	}
+	createOnly := predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return false
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return false
+		},
+	}
+	ignoreAll := predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return false
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return false
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return false
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return false
+		},
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("scheduler_helper_sfcluster_recounter").
+		For(&resourcev1alpha1.SFCluster{}, ctrlbuilder.WithPredicates(ignoreAll)).
+		Watches(&source.Kind{Type: &resourcev1alpha1.SFCluster{}}, recountMapper).
+		WithEventFilter(watches.NamespaceFilter()).
+		WithEventFilter(createOnly).
+		Complete(r)
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2019 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfserviceinstancecounter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrlrun "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type fakeConfig struct {
+	cfg *config.InteroperatorConfig
+}
+
+func (f *fakeConfig) GetConfig() *config.InteroperatorConfig {
+	return f.cfg
+}
+
+func (f *fakeConfig) UpdateConfig(cfg *config.InteroperatorConfig) error {
+	f.cfg = cfg
+	return nil
+}
+
+func _getCountedInstance(name, clusterID string, counted bool) *osbv1alpha1.SFServiceInstance {
+	instance := _getDummySFServiceInstance(name, "plan-id")
+	instance.Spec.ClusterID = clusterID
+	if counted {
+		instance.SetFinalizers([]string{constants.SFServiceInstanceCounterFinalizerName})
+	}
+	return instance
+}
+
+func _getCountedCluster(name string, count int) *resourcev1alpha1.SFCluster {
+	return &resourcev1alpha1.SFCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: constants.InteroperatorNamespace,
+		},
+		Status: resourcev1alpha1.SFClusterStatus{
+			ServiceInstanceCount: count,
+		},
+	}
+}
+
+func TestSFClusterRecounter_Reconcile(t *testing.T) {
+	migrating := _getCountedInstance("migrating", "2", true)
+	migrating.Status.Migration = &osbv1alpha1.MigrationStatus{
+		SourceClusterID: "1",
+		TargetClusterID: "2",
+		Phase:           "Cleanup",
+	}
+	migrated := _getCountedInstance("migrated", "2", true)
+	migrated.Status.Migration = &osbv1alpha1.MigrationStatus{
+		SourceClusterID:    "1",
+		TargetClusterID:    "2",
+		Phase:              "Succeeded",
+		InstanceCountMoved: true,
+	}
+
+	// Deprovisioned before it was counted
+	deleted := _getCountedInstance("i3", "1", false)
+	now := metav1.Now()
+	deleted.SetDeletionTimestamp(&now)
+	deleted.SetFinalizers([]string{constants.FinalizerName})
+
+	tests := []struct {
+		name       string
+		count      int
+		pending    *osbv1alpha1.SFServiceInstance
+		want       int
+		wantEvents int
+	}{
+		{
+			name:       "correct drifted count",
+			count:      7,
+			want:       3,
+			wantEvents: 2,
+		},
+		{
+			name:       "keep correct count",
+			count:      3,
+			want:       3,
+			wantEvents: 1,
+		},
+		{
+			name:       "skip correction while instance is not yet counted",
+			count:      7,
+			pending:    _getCountedInstance("i5", "1", false),
+			want:       7,
+			wantEvents: 1,
+		},
+		{
+			name:  "skip correction while instance is being uncounted",
+			count: 7,
+			pending: func() *osbv1alpha1.SFServiceInstance {
+				instance := _getCountedInstance("i5", "1", true)
+				instance.SetDeletionTimestamp(&now)
+				return instance
+			}(),
+			want:       7,
+			wantEvents: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			if err := osbv1alpha1.AddToScheme(scheme); err != nil {
+				t.Fatal(err)
+			}
+			if err := resourcev1alpha1.AddToScheme(scheme); err != nil {
+				t.Fatal(err)
+			}
+			objects := []runtime.Object{
+				_getCountedCluster("1", tt.count),
+				_getCountedCluster("2", 5),
+				_getCountedInstance("i1", "1", true),
+				_getCountedInstance("i2", "1", true),
+				deleted.DeepCopy(),
+				_getCountedInstance("i4", "2", true),
+				migrating.DeepCopy(),
+				migrated.DeepCopy(),
+			}
+			if tt.pending != nil {
+				objects = append(objects, tt.pending.DeepCopy())
+			}
+			c := fake.NewFakeClientWithScheme(scheme, objects...)
+			recorder := record.NewFakeRecorder(10)
+			r := &SFClusterRecounter{
+				Client:     c,
+				Log:        ctrlrun.Log.WithName("scheduler-helper").WithName("sfcluster-recounter"),
+				apiReader:  c,
+				cfgManager: &fakeConfig{cfg: &config.InteroperatorConfig{ClusterReconcileInterval: "5m"}},
+				recorder:   recorder,
+			}
+			key := types.NamespacedName{
+				Name:      "1",
+				Namespace: constants.InteroperatorNamespace,
+			}
+			result, err := r.Reconcile(recountRequest)
+			if err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if result.RequeueAfter != 5*time.Minute {
+				t.Errorf("Reconcile() RequeueAfter = %v, want %v", result.RequeueAfter, 5*time.Minute)
+			}
+
+			cluster := &resourcev1alpha1.SFCluster{}
+			if err := c.Get(context.TODO(), key, cluster); err != nil {
+				t.Fatal(err)
+			}
+			if cluster.Status.ServiceInstanceCount != tt.want {
+				t.Errorf("ServiceInstanceCount = %d, want %d", cluster.Status.ServiceInstanceCount, tt.want)
+			}
+			// All clusters are recounted in the same pass
+			key.Name = "2"
+			if err := c.Get(context.TODO(), key, cluster); err != nil {
+				t.Fatal(err)
+			}
+			if cluster.Status.ServiceInstanceCount != 2 {
+				t.Errorf("ServiceInstanceCount of cluster 2 = %d, want %d", cluster.Status.ServiceInstanceCount, 2)
+			}
+			if len(recorder.Events) != tt.wantEvents {
+				t.Errorf("recorded %d events, want %d", len(recorder.Events), tt.wantEvents)
+			}
+		})
+	}
+}
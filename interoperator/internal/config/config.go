@@ -29,9 +29,67 @@ type InteroperatorConfig struct {
 	ProvisionerWorkerCount   int    `yaml:"provisionerWorkerCount,omitempty"`
 	PrimaryClusterID         string `yaml:"primaryClusterId,omitempty"`
 	ClusterReconcileInterval string `yaml:"clusterReconcileInterval,omitempty"`
+	DrainConcurrency         int    `yaml:"drainConcurrency,omitempty"`
+
+	// ClusterHealthCheckInterval is the interval at which the api server of
+	// each cluster is probed
+	ClusterHealthCheckInterval string `yaml:"clusterHealthCheckInterval,omitempty"`
+	// ClusterHealthCheckTimeout is the time after which a probe fails
+	ClusterHealthCheckTimeout string `yaml:"clusterHealthCheckTimeout,omitempty"`
+	// ClusterHealthFailureThreshold is the number of consecutive failed
+	// probes after which a cluster is marked not ready
+	ClusterHealthFailureThreshold int `yaml:"clusterHealthFailureThreshold,omitempty"`
+
+	// MinKubernetesVersion is the oldest version of the api server of a
+	// cluster which can be onboarded
+	MinKubernetesVersion string `yaml:"minKubernetesVersion,omitempty"`
+	// RequiredStorageClasses must exist in a cluster before it is onboarded
+	RequiredStorageClasses []string `yaml:"requiredStorageClasses,omitempty"`
+
+	// ReplicaAuditInterval is the interval at which the replicas in each
+	// member cluster are compared with the master cluster
+	ReplicaAuditInterval string `yaml:"replicaAuditInterval,omitempty"`
+	// ReplicaAuditRepair enables the repair of the missing and outdated
+	// replicas found by the audit
+	ReplicaAuditRepair bool `yaml:"replicaAuditRepair,omitempty"`
 
 	InstanceContollerWatchList []osbv1alpha1.APIVersionKind `yaml:"instanceContollerWatchList,omitempty"`
 	BindingContollerWatchList  []osbv1alpha1.APIVersionKind `yaml:"bindingContollerWatchList,omitempty"`
+
+	SchedulerProfiles []SchedulerProfile `yaml:"schedulerProfiles,omitempty"`
+	// DefaultSchedulerProfile is used for the plans which do not set a
+	// schedulerProfile. If empty, the built-in default is chosen based on
+	// whether the plan has requests.
+	DefaultSchedulerProfile string `yaml:"defaultSchedulerProfile,omitempty"`
+	// Topology configures where the preferred region and zone of an
+	// instance are read from its context
+	Topology *TopologyConfig `yaml:"topology,omitempty"`
+}
+
+// TopologyConfig maps the context of a service instance to the topology
+// labels of the clusters. The keys are dot separated paths into the context,
+// for example "region" or "landscape.zone".
+type TopologyConfig struct {
+	RegionContextKey string `yaml:"regionContextKey,omitempty"`
+	ZoneContextKey   string `yaml:"zoneContextKey,omitempty"`
+	// Fallback is the constraint which is relaxed when no cluster in the
+	// preferred location is feasible. One of None, OtherZones or
+	// OtherRegions. Defaults to None.
+	Fallback string `yaml:"fallback,omitempty"`
+}
+
+// SchedulerProfile is a named set of filter and score plugins used by the
+// scheduler to place service instances on clusters
+type SchedulerProfile struct {
+	Name    string                  `yaml:"name"`
+	Filters []string                `yaml:"filters,omitempty"`
+	Scores  []SchedulerPluginWeight `yaml:"scores,omitempty"`
+}
+
+// SchedulerPluginWeight is a score plugin along with the weight of its score
+type SchedulerPluginWeight struct {
+	Name   string `yaml:"name"`
+	Weight int64  `yaml:"weight,omitempty"`
 }
 
 // setConfigDefaults assigns default values to config
@@ -54,6 +112,24 @@ func setConfigDefaults(interoperatorConfig *InteroperatorConfig) *InteroperatorC
 	if interoperatorConfig.ClusterReconcileInterval == "" {
 		interoperatorConfig.ClusterReconcileInterval = constants.DefaultClusterReconcileInterval
 	}
+	if interoperatorConfig.DrainConcurrency == 0 {
+		interoperatorConfig.DrainConcurrency = constants.DefaultDrainConcurrency
+	}
+	if interoperatorConfig.ClusterHealthCheckInterval == "" {
+		interoperatorConfig.ClusterHealthCheckInterval = constants.DefaultClusterHealthCheckInterval
+	}
+	if interoperatorConfig.ClusterHealthCheckTimeout == "" {
+		interoperatorConfig.ClusterHealthCheckTimeout = constants.DefaultClusterHealthCheckTimeout
+	}
+	if interoperatorConfig.ClusterHealthFailureThreshold == 0 {
+		interoperatorConfig.ClusterHealthFailureThreshold = constants.DefaultClusterHealthFailureThreshold
+	}
+	if interoperatorConfig.MinKubernetesVersion == "" {
+		interoperatorConfig.MinKubernetesVersion = constants.DefaultMinKubernetesVersion
+	}
+	if interoperatorConfig.ReplicaAuditInterval == "" {
+		interoperatorConfig.ReplicaAuditInterval = constants.DefaultReplicaAuditInterval
+	}
 
 	return interoperatorConfig
 }
@@ -65,7 +141,9 @@ type Config interface {
 }
 
 type config struct {
-	c         client.Client
+	c client.Client
+	// reader reads the config map for GetConfig
+	reader    client.Reader
 	configMap *corev1.ConfigMap
 	namespace string
 }
@@ -91,17 +169,35 @@ func New(kubeConfig *rest.Config, scheme *runtime.Scheme, mapper meta.RESTMapper
 
 	return &config{
 		c:         c,
+		reader:    c,
 		namespace: configMapNamespace,
 	}, nil
 }
 
-func (cfg *config) fetchConfig() error {
+// NewWithReader returns a new Config which reads the config map from reader,
+// for example an informer cache. The config map is still fetched from the
+// api server for UpdateConfig.
+func NewWithReader(kubeConfig *rest.Config, scheme *runtime.Scheme, mapper meta.RESTMapper,
+	reader client.Reader) (Config, error) {
+	if reader == nil {
+		return nil, errors.NewInputError("New config", "reader", nil)
+	}
+	cfgManager, err := New(kubeConfig, scheme, mapper)
+	if err != nil {
+		return nil, err
+	}
+	cfg := cfgManager.(*config)
+	cfg.reader = reader
+	return cfg, nil
+}
+
+func (cfg *config) fetchConfig(reader client.Reader) error {
 	configMap := &corev1.ConfigMap{}
 	var configMapKey = types.NamespacedName{
 		Name:      constants.ConfigMapName,
 		Namespace: cfg.namespace,
 	}
-	err := cfg.c.Get(context.TODO(), configMapKey, configMap)
+	err := reader.Get(context.TODO(), configMapKey, configMap)
 	if err != nil {
 		return err
 	}
@@ -113,7 +209,7 @@ func (cfg *config) fetchConfig() error {
 
 func (cfg *config) GetConfig() *InteroperatorConfig {
 	interoperatorConfig := &InteroperatorConfig{}
-	err := cfg.fetchConfig()
+	err := cfg.fetchConfig(cfg.reader)
 	if err != nil {
 		log.Error(err, "failed to read interoperator config. using defaults.")
 		return setConfigDefaults(interoperatorConfig)
@@ -130,7 +226,7 @@ func (cfg *config) UpdateConfig(interoperatorConfig *InteroperatorConfig) error
 	if interoperatorConfig == nil {
 		return errors.NewInputError("UpdateConfig", "interoperatorConfig", nil)
 	}
-	err := cfg.fetchConfig()
+	err := cfg.fetchConfig(cfg.c)
 	if err != nil && !apiErrors.IsNotFound(err) {
 		log.Error(err, "failed to fetch interoperator config for update")
 		return err
@@ -24,6 +24,7 @@ import (
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 )
 
@@ -150,6 +151,13 @@ instanceContollerWatchList:
 		ProvisionerWorkerCount:   constants.DefaultProvisionerWorkerCount,
 		PrimaryClusterID:         "1",
 		ClusterReconcileInterval: "17m",
+		DrainConcurrency:         constants.DefaultDrainConcurrency,
+
+		ClusterHealthCheckInterval:    constants.DefaultClusterHealthCheckInterval,
+		ClusterHealthCheckTimeout:     constants.DefaultClusterHealthCheckTimeout,
+		ClusterHealthFailureThreshold: constants.DefaultClusterHealthFailureThreshold,
+		MinKubernetesVersion:          constants.DefaultMinKubernetesVersion,
+		ReplicaAuditInterval:          constants.DefaultReplicaAuditInterval,
 		InstanceContollerWatchList: []osbv1alpha1.APIVersionKind{
 			{
 				APIVersion: "kubedb.com/v1alpha1",
@@ -238,6 +246,27 @@ instanceContollerWatchList:
 	}
 }
 
+func TestNewWithReader(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	_, err := NewWithReader(kubeConfig, sch, nil, nil)
+	g.Expect(err).To(gomega.HaveOccurred())
+
+	// The config map is read only from the reader
+	reader := fake.NewFakeClientWithScheme(sch, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      constants.ConfigMapName,
+			Namespace: constants.InteroperatorNamespace,
+		},
+		Data: map[string]string{
+			constants.ConfigMapKey: "primaryClusterId: cached",
+		},
+	})
+	cfg, err := NewWithReader(kubeConfig, sch, nil, reader)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(cfg.GetConfig().PrimaryClusterID).To(gomega.Equal("cached"))
+}
+
 func Test_config_UpdateConfig(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
 	cfg, _ := New(kubeConfig, sch, nil)
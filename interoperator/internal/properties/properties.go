@@ -34,6 +34,9 @@ type Status struct {
 	Bind        GenericStatus  `yaml:"bind" json:"bind"`
 	Unbind      GenericStatus  `yaml:"unbind" json:"unbind"`
 	Deprovision InstanceStatus `yaml:"deprovision" json:"deprovision"`
+	Backup      GenericStatus  `yaml:"backup,omitempty" json:"backup,omitempty"`
+	Restore     GenericStatus  `yaml:"restore,omitempty" json:"restore,omitempty"`
+	Migrate     GenericStatus  `yaml:"migrate,omitempty" json:"migrate,omitempty"`
 }
 
 // ParseSources decodes sources yaml into a map
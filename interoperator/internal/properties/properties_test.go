@@ -104,6 +104,28 @@ deprovision:
 			},
 			wantErr: false,
 		},
+		{
+			name: "parse migration actions",
+			args: args{
+				propertiesString: `provision:
+  state: state
+backup:
+  state: state
+restore:
+  state: state
+migrate:
+  state: state`,
+			},
+			want: &Status{
+				Provision: InstanceStatus{
+					State: "state",
+				},
+				Backup:  status,
+				Restore: status,
+				Migrate: status,
+			},
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -22,6 +22,7 @@ import (
 
 	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
 	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/agent"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/multiclusterdeploy"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/provisioners"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/schedulers"
@@ -87,6 +88,11 @@ func main() {
 		setupLog.Error(err, "unable to create schedulers")
 		os.Exit(1)
 	}
+
+	if err = agent.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create agent")
+		os.Exit(1)
+	}
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")
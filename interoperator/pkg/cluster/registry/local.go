@@ -0,0 +1,97 @@
+package registry
+
+import (
+	"context"
+
+	resourceV1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	kubernetes "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// localRegistry is the ClusterRegistry of the agent of a member cluster in
+// pull mode. Only the own cluster can be accessed from the agent.
+type localRegistry struct {
+	c          kubernetes.Client
+	kubeConfig *rest.Config
+	namespace  string
+}
+
+// NewLocal returns a ClusterRegistry which only returns the own cluster,
+// accessed with the client c and the config kubeConfig
+func NewLocal(c kubernetes.Client, kubeConfig *rest.Config) (ClusterRegistry, error) {
+	if c == nil {
+		return nil, errors.NewInputError("NewLocal ClusterRegistry", "c", nil)
+	}
+	if kubeConfig == nil {
+		return nil, errors.NewInputError("NewLocal ClusterRegistry", "kubeConfig", nil)
+	}
+	return &localRegistry{
+		c:          c,
+		kubeConfig: kubeConfig,
+		namespace:  constants.InteroperatorNamespace,
+	}, nil
+}
+
+func (r *localRegistry) checkOwnCluster(clusterID string) error {
+	if clusterID != constants.OwnClusterID {
+		return errors.NewClusterNotManaged(clusterID, "only the own cluster is managed by the agent", nil)
+	}
+	return nil
+}
+
+// GetClient returns the client of the own cluster
+func (r *localRegistry) GetClient(clusterID string) (kubernetes.Client, error) {
+	err := r.checkOwnCluster(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	return r.c, nil
+}
+
+// GetConfig returns the rest config of the own cluster
+func (r *localRegistry) GetConfig(clusterID string) (*rest.Config, error) {
+	err := r.checkOwnCluster(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	return rest.CopyConfig(r.kubeConfig), nil
+}
+
+// GetCluster returns the SFCluster of the own cluster
+func (r *localRegistry) GetCluster(clusterID string) (resourceV1alpha1.SFClusterInterface, error) {
+	err := r.checkOwnCluster(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	cluster := &resourceV1alpha1.SFCluster{}
+	err = r.c.Get(context.TODO(), types.NamespacedName{
+		Name:      clusterID,
+		Namespace: r.namespace,
+	}, cluster)
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			return nil, errors.NewSFClusterNotFound(clusterID, err)
+		}
+		return nil, err
+	}
+	return cluster, nil
+}
+
+// ListClusters returns the SFCluster of the own cluster
+func (r *localRegistry) ListClusters(options *kubernetes.ListOptions) (*resourceV1alpha1.SFClusterList, error) {
+	clusters := &resourceV1alpha1.SFClusterList{}
+	cluster, err := r.GetCluster(constants.OwnClusterID)
+	if err != nil {
+		if errors.SFClusterNotFound(err) {
+			return clusters, nil
+		}
+		return nil, err
+	}
+	clusters.Items = append(clusters.Items, *cluster.(*resourceV1alpha1.SFCluster))
+	return clusters, nil
+}
@@ -0,0 +1,64 @@
+package registry
+
+import (
+	"testing"
+
+	resourceV1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	"github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_localRegistry(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	scheme := runtime.NewScheme()
+	g.Expect(resourceV1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	_, err := NewLocal(nil, &rest.Config{})
+	g.Expect(errors.InputError(err)).To(gomega.BeTrue())
+
+	c := fake.NewFakeClientWithScheme(scheme)
+	r, err := NewLocal(c, &rest.Config{Host: "https://10.0.0.1"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	clusters, err := r.ListClusters(nil)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(clusters.Items).To(gomega.BeEmpty())
+	_, err = r.GetCluster(constants.OwnClusterID)
+	g.Expect(errors.SFClusterNotFound(err)).To(gomega.BeTrue())
+
+	c = fake.NewFakeClientWithScheme(scheme, &resourceV1alpha1.SFCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      constants.OwnClusterID,
+			Namespace: constants.InteroperatorNamespace,
+		},
+	})
+	r, err = NewLocal(c, &rest.Config{Host: "https://10.0.0.1"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	got, err := r.GetClient(constants.OwnClusterID)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(got).To(gomega.BeIdenticalTo(c))
+	cfg, err := r.GetConfig(constants.OwnClusterID)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(cfg.Host).To(gomega.Equal("https://10.0.0.1"))
+	cluster, err := r.GetCluster(constants.OwnClusterID)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(cluster.GetName()).To(gomega.Equal(constants.OwnClusterID))
+	clusters, err = r.ListClusters(nil)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(clusters.Items).To(gomega.HaveLen(1))
+
+	// Other clusters are not accessible from the agent
+	_, err = r.GetClient("other")
+	g.Expect(errors.ClusterNotManaged(err)).To(gomega.BeTrue())
+	_, err = r.GetConfig("other")
+	g.Expect(errors.ClusterNotManaged(err)).To(gomega.BeTrue())
+	_, err = r.GetCluster("other")
+	g.Expect(errors.ClusterNotManaged(err)).To(gomega.BeTrue())
+}
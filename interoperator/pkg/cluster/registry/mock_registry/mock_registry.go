@@ -7,6 +7,7 @@ package mock_registry
 import (
 	v1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
 	gomock "github.com/golang/mock/gomock"
+	rest "k8s.io/client-go/rest"
 	reflect "reflect"
 	client "sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -49,6 +50,21 @@ func (mr *MockClusterRegistryMockRecorder) GetClient(clusterID interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetClient", reflect.TypeOf((*MockClusterRegistry)(nil).GetClient), clusterID)
 }
 
+// GetConfig mocks base method
+func (m *MockClusterRegistry) GetConfig(clusterID string) (*rest.Config, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetConfig", clusterID)
+	ret0, _ := ret[0].(*rest.Config)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetConfig indicates an expected call of GetConfig
+func (mr *MockClusterRegistryMockRecorder) GetConfig(clusterID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetConfig", reflect.TypeOf((*MockClusterRegistry)(nil).GetConfig), clusterID)
+}
+
 // GetCluster mocks base method
 func (m *MockClusterRegistry) GetCluster(clusterID string) (v1alpha1.SFClusterInterface, error) {
 	m.ctrl.T.Helper()
@@ -2,18 +2,21 @@ package registry
 
 import (
 	"context"
+	"sync"
 
 	resourceV1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
 
+	corev1 "k8s.io/api/core/v1"
 	apiErrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	kubernetes "sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
@@ -24,6 +27,7 @@ var log = logf.Log.WithName("cluster.registry")
 //go:generate mockgen -source registry.go -destination ./mock_registry/mock_registry.go
 type ClusterRegistry interface {
 	GetClient(clusterID string) (kubernetes.Client, error)
+	GetConfig(clusterID string) (*rest.Config, error)
 	GetCluster(clusterID string) (resourceV1alpha1.SFClusterInterface, error)
 	ListClusters(options *kubernetes.ListOptions) (*resourceV1alpha1.SFClusterList, error)
 }
@@ -33,7 +37,58 @@ type clusterRegistry struct {
 	mapper     meta.RESTMapper
 	kubeConfig *rest.Config
 	c          kubernetes.Client
+	// reader reads the clusters and kubeconfig secrets from the informer
+	// cache to check whether a cached client is still valid
+	reader     kubernetes.Reader
 	namespace  string
+	cfgManager config.Config
+
+	mu      sync.Mutex
+	clients map[string]*cachedClient
+}
+
+// cachedClient is a client of a cluster along with the version of the
+// kubeconfig it was created from
+type cachedClient struct {
+	client  kubernetes.Client
+	cfg     *rest.Config
+	version string
+}
+
+var (
+	sharedCacheOnce sync.Once
+	sharedCache     cache.Cache
+	sharedCacheErr  error
+)
+
+// getSharedCache returns the informer cache of the interoperator namespace
+// shared by the registries of the process. The cache is started on first use
+// and runs till the process exits.
+func getSharedCache(kubeConfig *rest.Config, scheme *runtime.Scheme, mapper meta.RESTMapper) (cache.Cache, error) {
+	sharedCacheOnce.Do(func() {
+		c, err := cache.New(kubeConfig, cache.Options{
+			Scheme:    scheme,
+			Mapper:    mapper,
+			Namespace: constants.InteroperatorNamespace,
+		})
+		if err != nil {
+			sharedCacheErr = err
+			return
+		}
+		stop := make(chan struct{})
+		go func() {
+			err := c.Start(stop)
+			if err != nil {
+				log.Error(err, "informer cache of cluster registry stopped")
+			}
+		}()
+		if !c.WaitForCacheSync(stop) {
+			sharedCacheErr = errors.NewPreconditionError("New ClusterRegistry", "informer cache not started", nil)
+			return
+		}
+		sharedCache = c
+	})
+	return sharedCache, sharedCacheErr
 }
 
 // New returns a new ClusterRegistry using the provided manager
@@ -54,6 +109,16 @@ func New(kubeConfig *rest.Config, scheme *runtime.Scheme, mapper meta.RESTMapper
 		return nil, err
 	}
 
+	reader, err := getSharedCache(kubeConfig, scheme, mapper)
+	if err != nil {
+		return nil, err
+	}
+
+	cfgManager, err := config.NewWithReader(kubeConfig, scheme, mapper, reader)
+	if err != nil {
+		return nil, err
+	}
+
 	sfNamespace := constants.InteroperatorNamespace
 
 	r := &clusterRegistry{
@@ -61,7 +126,10 @@ func New(kubeConfig *rest.Config, scheme *runtime.Scheme, mapper meta.RESTMapper
 		mapper:     mapper,
 		kubeConfig: kubeConfig,
 		c:          c,
+		reader:     reader,
 		namespace:  sfNamespace,
+		cfgManager: cfgManager,
+		clients:    make(map[string]*cachedClient),
 	}
 	return r, nil
 }
@@ -77,22 +145,69 @@ func (r *clusterRegistry) createClient(cfg *rest.Config) (kubernetes.Client, err
 	return c, nil
 }
 
-// GetClient returns a kubernetes client for a cluster
+// GetClient returns a kubernetes client for a cluster. The client is cached
+// till the kubeconfig secret of the cluster or the primary cluster changes.
 func (r *clusterRegistry) GetClient(clusterID string) (kubernetes.Client, error) {
-	cluster, err := r.GetCluster(clusterID)
+	entry, err := r.getCachedClient(clusterID)
 	if err != nil {
 		return nil, err
 	}
-	var cfg *rest.Config
+	return entry.client, nil
+}
 
-	cfgManager, err := config.New(r.kubeConfig, r.scheme, r.mapper)
+// GetConfig returns the rest config for a cluster. The in cluster config is
+// used for the own cluster and the primary cluster.
+func (r *clusterRegistry) GetConfig(clusterID string) (*rest.Config, error) {
+	entry, err := r.getCachedClient(clusterID)
 	if err != nil {
 		return nil, err
 	}
-	interoperatorCfg := cfgManager.GetConfig()
-	currPrimaryClusterID := interoperatorCfg.PrimaryClusterID
+	return rest.CopyConfig(entry.cfg), nil
+}
+
+// getCachedClient returns the cached client of the cluster if the cluster
+// and its kubeconfig secret in the informer cache still match it. Otherwise
+// the cluster and the secret are read from the api server and the client is
+// created again if the kubeconfig has changed.
+func (r *clusterRegistry) getCachedClient(clusterID string) (*cachedClient, error) {
+	r.mu.Lock()
+	entry, ok := r.clients[clusterID]
+	r.mu.Unlock()
+	if ok && r.reader != nil {
+		cluster, err := r.readCluster(r.reader, clusterID)
+		if err == nil {
+			inCluster, managed := r.isManaged(cluster)
+			if managed {
+				version, err := r.getKubeConfigVersion(r.reader, cluster, inCluster)
+				if err == nil && entry.version == version {
+					return entry, nil
+				}
+			}
+		}
+	}
+
+	cluster, err := r.getCluster(clusterID)
+	if err != nil {
+		r.invalidate(clusterID)
+		return nil, err
+	}
 
-	if clusterID == constants.OwnClusterID || clusterID == currPrimaryClusterID {
+	inCluster, managed := r.isManaged(cluster)
+	if !managed {
+		r.invalidate(clusterID)
+		return nil, errors.NewClusterNotManaged(clusterID, "cluster is in pull mode and is managed by its agent", nil)
+	}
+
+	// If the version can not be determined, the client is created again
+	// which reports the actual error
+	version, versionErr := r.getKubeConfigVersion(r.c, cluster, inCluster)
+	if versionErr == nil && ok && entry.version == version {
+		// The informer cache is not yet updated
+		return entry, nil
+	}
+
+	var cfg *rest.Config
+	if inCluster {
 		// Use in cluster config
 		cfg, err = ctrl.GetConfig()
 	} else {
@@ -101,25 +216,89 @@ func (r *clusterRegistry) GetClient(clusterID string) (kubernetes.Client, error)
 	}
 	if err != nil {
 		log.Error(err, "unable to get kubeconfig", "clusterID", clusterID)
+		r.invalidate(clusterID)
 		return nil, err
 	}
 
 	c, err := r.createClient(cfg)
 	if err != nil {
 		log.Error(err, "unable to create k8s client", "clusterID", clusterID)
+		r.invalidate(clusterID)
 		return nil, err
 	}
-	return c, nil
+
+	entry = &cachedClient{
+		client:  c,
+		cfg:     cfg,
+		version: version,
+	}
+	if versionErr != nil {
+		r.invalidate(clusterID)
+	} else {
+		r.mu.Lock()
+		r.clients[clusterID] = entry
+		r.mu.Unlock()
+		log.V(1).Info("created client for cluster", "clusterID", clusterID, "version", version)
+	}
+	return entry, nil
+}
+
+// isManaged returns whether the in cluster config is used for the cluster
+// and whether the cluster can be accessed by this interoperator. The own
+// cluster and the primary cluster are accessed with the in cluster config.
+func (r *clusterRegistry) isManaged(cluster *resourceV1alpha1.SFCluster) (bool, bool) {
+	clusterID := cluster.GetName()
+	interoperatorCfg := r.cfgManager.GetConfig()
+	currPrimaryClusterID := interoperatorCfg.PrimaryClusterID
+	inCluster := clusterID == constants.OwnClusterID || clusterID == currPrimaryClusterID
+	return inCluster, inCluster || !cluster.IsPullMode()
+}
+
+// getKubeConfigVersion returns the version of the kubeconfig of the cluster.
+// It changes when the kubeconfig secret is updated or replaced or when the
+// cluster starts or stops using the in cluster config.
+func (r *clusterRegistry) getKubeConfigVersion(reader kubernetes.Reader, cluster *resourceV1alpha1.SFCluster,
+	inCluster bool) (string, error) {
+	if inCluster {
+		return "in-cluster", nil
+	}
+	secret := &corev1.Secret{}
+	err := reader.Get(context.TODO(), types.NamespacedName{
+		Name:      cluster.Spec.SecretRef,
+		Namespace: cluster.GetNamespace(),
+	}, secret)
+	if err != nil {
+		return "", err
+	}
+	return secret.GetName() + "/" + secret.GetResourceVersion(), nil
+}
+
+func (r *clusterRegistry) invalidate(clusterID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.clients, clusterID)
 }
 
 // GetCluster returns a cluster detail
 func (r *clusterRegistry) GetCluster(clusterID string) (resourceV1alpha1.SFClusterInterface, error) {
+	cluster, err := r.getCluster(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	return cluster, nil
+}
+
+func (r *clusterRegistry) getCluster(clusterID string) (*resourceV1alpha1.SFCluster, error) {
+	return r.readCluster(r.c, clusterID)
+}
+
+func (r *clusterRegistry) readCluster(reader kubernetes.Reader, clusterID string) (*resourceV1alpha1.SFCluster, error) {
 	cluster := &resourceV1alpha1.SFCluster{}
 	var clusterKey = types.NamespacedName{
 		Name:      clusterID,
 		Namespace: r.namespace,
 	}
-	err := r.c.Get(context.TODO(), clusterKey, cluster)
+	err := reader.Get(context.TODO(), clusterKey, cluster)
 	if err != nil {
 		if apiErrors.IsNotFound(err) {
 			return nil, errors.NewSFClusterNotFound(clusterID, err)
@@ -3,20 +3,26 @@ package registry
 import (
 	"bytes"
 	"context"
+	"io/ioutil"
+	"os"
 	"reflect"
 	"testing"
 	"text/template"
 
 	resourceV1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
 
 	"github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
 	kubernetes "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestNew(t *testing.T) {
@@ -150,6 +156,33 @@ func Test_clusterRegistry_GetClient(t *testing.T) {
 	}
 }
 
+func Test_clusterRegistry_GetConfig(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	cluster := _getDummyCluster()
+	secret := _getDummySecret()
+	cluster.Spec.SecretRef = secret.GetName()
+	r, err := New(kubeConfig, sch, mapper)
+	if err != nil {
+		t.Errorf("Failed to create ClusterRegistry %v", err)
+		return
+	}
+
+	_, err = r.GetConfig("cluster-id")
+	g.Expect(err).To(gomega.HaveOccurred())
+
+	g.Expect(c.Create(context.TODO(), cluster)).NotTo(gomega.HaveOccurred())
+	g.Expect(c.Create(context.TODO(), secret)).NotTo(gomega.HaveOccurred())
+	defer func() {
+		g.Expect(c.Delete(context.TODO(), cluster)).NotTo(gomega.HaveOccurred())
+		cluster.SetResourceVersion("")
+		g.Expect(c.Delete(context.TODO(), secret)).NotTo(gomega.HaveOccurred())
+		secret.SetResourceVersion("")
+	}()
+	cfg, err := r.GetConfig("cluster-id")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(cfg).NotTo(gomega.BeNil())
+}
+
 func Test_clusterRegistry_GetCluster(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
 	cluster := _getDummyCluster()
@@ -294,3 +327,144 @@ current-context: test`
 	}
 	return buf.Bytes()
 }
+
+type fakeConfig struct {
+	cfg *config.InteroperatorConfig
+}
+
+func (f *fakeConfig) GetConfig() *config.InteroperatorConfig {
+	return f.cfg
+}
+
+func (f *fakeConfig) UpdateConfig(cfg *config.InteroperatorConfig) error {
+	f.cfg = cfg
+	return nil
+}
+
+// countingClient counts the reads from the api server
+type countingClient struct {
+	kubernetes.Client
+	reads int
+}
+
+func (c *countingClient) Get(ctx context.Context, key kubernetes.ObjectKey, obj runtime.Object) error {
+	c.reads++
+	return c.Client.Get(ctx, key, obj)
+}
+
+func Test_clusterRegistry_getCachedClient(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(gomega.Succeed())
+	g.Expect(resourceV1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	cluster := &resourceV1alpha1.SFCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cluster-id",
+			Namespace: constants.InteroperatorNamespace,
+		},
+		Spec: resourceV1alpha1.SFClusterSpec{
+			SecretRef: "cluster-id",
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cluster-id",
+			Namespace: constants.InteroperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"kubeconfig": _getDummyKubeConfig("https://10.0.0.1"),
+		},
+	}
+	c := fake.NewFakeClientWithScheme(scheme, cluster, secret)
+	apiServer := &countingClient{Client: c}
+	r := &clusterRegistry{
+		scheme:     scheme,
+		mapper:     meta.NewDefaultRESTMapper(nil),
+		c:          apiServer,
+		reader:     c,
+		namespace:  constants.InteroperatorNamespace,
+		cfgManager: &fakeConfig{cfg: &config.InteroperatorConfig{PrimaryClusterID: "1"}},
+		clients:    make(map[string]*cachedClient),
+	}
+
+	client1, err := r.GetClient("cluster-id")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	reads := apiServer.reads
+	client2, err := r.GetClient("cluster-id")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(client2).To(gomega.BeIdenticalTo(client1))
+	// Cached client is returned without reading from the api server
+	g.Expect(apiServer.reads).To(gomega.Equal(reads))
+
+	// Client is created again when the kubeconfig is rotated
+	secret.Data["kubeconfig"] = _getDummyKubeConfig("https://10.0.0.2")
+	g.Expect(c.Update(context.TODO(), secret)).To(gomega.Succeed())
+	client3, err := r.GetClient("cluster-id")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(client3).NotTo(gomega.BeIdenticalTo(client1))
+	cfg, err := r.GetConfig("cluster-id")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(cfg.Host).To(gomega.Equal("https://10.0.0.2"))
+
+	// Cached client is dropped when the secret is removed
+	g.Expect(c.Delete(context.TODO(), secret)).To(gomega.Succeed())
+	_, err = r.GetClient("cluster-id")
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(r.clients).NotTo(gomega.HaveKey("cluster-id"))
+
+	// Cached client is dropped when the cluster is removed
+	secret.SetResourceVersion("")
+	g.Expect(c.Create(context.TODO(), secret)).To(gomega.Succeed())
+	_, err = r.GetClient("cluster-id")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(r.clients).To(gomega.HaveKey("cluster-id"))
+
+	// Clusters in pull mode are not accessed from the master cluster
+	pullCluster := &resourceV1alpha1.SFCluster{}
+	g.Expect(c.Get(context.TODO(), types.NamespacedName{
+		Name:      "cluster-id",
+		Namespace: constants.InteroperatorNamespace,
+	}, pullCluster)).To(gomega.Succeed())
+	pullCluster.Spec.Mode = resourceV1alpha1.ClusterModePull
+	g.Expect(c.Update(context.TODO(), pullCluster)).To(gomega.Succeed())
+	_, err = r.GetClient("cluster-id")
+	g.Expect(errors.ClusterNotManaged(err)).To(gomega.BeTrue())
+	g.Expect(r.clients).NotTo(gomega.HaveKey("cluster-id"))
+	pullCluster.Spec.Mode = resourceV1alpha1.ClusterModePush
+	g.Expect(c.Update(context.TODO(), pullCluster)).To(gomega.Succeed())
+	_, err = r.GetClient("cluster-id")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	// The in cluster config is used once the cluster becomes the primary
+	// cluster and the kubeconfig secret again after it stops being primary
+	kubeconfigFile, err := ioutil.TempFile("", "kubeconfig")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	defer os.Remove(kubeconfigFile.Name())
+	_, err = kubeconfigFile.Write(_getDummyKubeConfig("https://10.0.0.3"))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(kubeconfigFile.Close()).To(gomega.Succeed())
+	_kubeconfig, ok := os.LookupEnv("KUBECONFIG")
+	defer func() {
+		if ok {
+			os.Setenv("KUBECONFIG", _kubeconfig)
+		} else {
+			os.Unsetenv("KUBECONFIG")
+		}
+	}()
+	g.Expect(os.Setenv("KUBECONFIG", kubeconfigFile.Name())).To(gomega.Succeed())
+
+	r.cfgManager = &fakeConfig{cfg: &config.InteroperatorConfig{PrimaryClusterID: "cluster-id"}}
+	cfg, err = r.GetConfig("cluster-id")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(cfg.Host).To(gomega.Equal("https://10.0.0.3"))
+	r.cfgManager = &fakeConfig{cfg: &config.InteroperatorConfig{PrimaryClusterID: "1"}}
+	cfg, err = r.GetConfig("cluster-id")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(cfg.Host).To(gomega.Equal("https://10.0.0.2"))
+
+	g.Expect(c.Delete(context.TODO(), cluster)).To(gomega.Succeed())
+	_, err = r.GetClient("cluster-id")
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(r.clients).NotTo(gomega.HaveKey("cluster-id"))
+}
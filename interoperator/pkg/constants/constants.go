@@ -15,6 +15,13 @@ const (
 	ErrorCountKey                         = "interoperator.servicefabrik.io/error"
 	LastOperationKey                      = "interoperator.servicefabrik.io/lastoperation"
 	PrimaryClusterKey                     = "interoperator.servicefabrik.io/primarycluster"
+	ClusterCostKey                        = "interoperator.servicefabrik.io/cost"
+	TopologyRegionKey                     = "topology.kubernetes.io/region"
+	TopologyZoneKey                       = "topology.kubernetes.io/zone"
+	SchedulingPendingSinceKey             = "interoperator.servicefabrik.io/schedulingpendingsince"
+	MigrationSourceKey                    = "interoperator.servicefabrik.io/migrationsource"
+	LastHeartbeatKey                      = "interoperator.servicefabrik.io/lastheartbeat"
+	ReplicaGenerationKey                  = "interoperator.servicefabrik.io/replicageneration"
 	ErrorThreshold                        = 10
 
 	ConfigMapName           = "interoperator-config"
@@ -22,23 +29,43 @@ const (
 	ProvisionerName         = "provisioner"
 	ProvisionerTemplateName = "provisioner-template"
 
+	// MasterKubeconfigSecretName is the secret with the kubeconfig used by
+	// the agent of a member cluster in pull mode to access the master cluster
+	MasterKubeconfigSecretName = "master-kubeconfig"
+
 	NamespaceEnvKey    = "POD_NAMESPACE"
 	OwnClusterIDEnvKey = "CLUSTER_ID"
 
 	NamespaceLabelKey = "OWNER_INTEROPERATOR_NAMESPACE"
 
-	MultiClusterWatchTimeout = 28800 // 8 hours in seconds
+	MultiClusterWatchTimeout      = 28800 // 8 hours in seconds
+	MultiClusterWatchResyncPeriod = time.Minute * 30
 
 	DefaultInstanceWorkerCount    = 10
 	DefaultBindingWorkerCount     = 20
 	DefaultSchedulerWorkerCount   = 10
 	DefaultProvisionerWorkerCount = 10
 	DefaultPrimaryClusterID       = "1"
+	DefaultDrainConcurrency       = 2
+
+	DefaultClusterHealthCheckInterval    = "1m"
+	DefaultClusterHealthCheckTimeout     = "10s"
+	DefaultClusterHealthFailureThreshold = 3
+
+	// DefaultMinKubernetesVersion is the first version serving v1 CRDs
+	DefaultMinKubernetesVersion = "v1.16.0"
+
+	DefaultReplicaAuditInterval = "10m"
 
 	GoTemplateType = "gotemplate"
 
 	PlanWatchDrainTimeout           = time.Second * 2
+	AssumedInstanceTTL              = time.Minute * 5
+	AssumedInstanceMaxAge           = time.Minute * 30
 	DefaultClusterReconcileInterval = "20m"
+	DrainRetryInterval              = time.Minute * 10
+	ClusterUsageUpdateInterval      = time.Second * 10
+	InstanceUsageUpdateInterval     = time.Minute
 
 	ListPaginationLimit = 50
 )
@@ -1,4 +1,4 @@
-// +build !provisioners,!schedulers,!multiclusterdeploy
+// +build !provisioners,!schedulers,!multiclusterdeploy,!agent
 
 /*
 Copyright 2018 The Service Fabrik Authors.
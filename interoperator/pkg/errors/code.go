@@ -16,6 +16,7 @@ const (
 
 	CodeClusterRegistryError = "ClusterRegistryError"
 	CodeClusterIDNotSet      = "ClusterIDNotSet"
+	CodeClusterNotManaged    = "ClusterNotManaged"
 
 	CodeInputError        = "CodeInputError"
 	CodeMarshalError      = "CodeMarshalError"
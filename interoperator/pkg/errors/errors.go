@@ -45,6 +45,21 @@ func ClusterIDNotSet(err error) bool {
 	return ErrorCode(err) == CodeClusterIDNotSet
 }
 
+// NewClusterNotManaged returns new error indicating the cluster can not be
+// accessed by this interoperator, for example because it is in pull mode
+func NewClusterNotManaged(clusterID, reason string, err error) *InteroperatorError {
+	return &InteroperatorError{
+		Err:     err,
+		Code:    CodeClusterNotManaged,
+		Message: fmt.Sprintf("SFCluster %s is not managed by this interoperator: %s", clusterID, reason),
+	}
+}
+
+// ClusterNotManaged checks whether error is of CodeClusterNotManaged type
+func ClusterNotManaged(err error) bool {
+	return ErrorCode(err) == CodeClusterNotManaged
+}
+
 // NewMarshalError returns new error indicating marshalling to specific format failed.
 func NewMarshalError(message string, err error) *InteroperatorError {
 	return &InteroperatorError{
@@ -117,6 +117,81 @@ func TestClusterRegistryError(t *testing.T) {
 	}
 }
 
+func TestNewClusterNotManaged(t *testing.T) {
+	type args struct {
+		clusterID string
+		reason    string
+		err       error
+	}
+	tests := []struct {
+		name string
+		args args
+		want *InteroperatorError
+	}{
+		{
+			name: "return ClusterNotManaged",
+			args: args{
+				clusterID: "2",
+				reason:    "cluster is in pull mode",
+				err:       nil,
+			},
+			want: &InteroperatorError{
+				Err:     nil,
+				Code:    CodeClusterNotManaged,
+				Message: "SFCluster 2 is not managed by this interoperator: cluster is in pull mode",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewClusterNotManaged(tt.args.clusterID, tt.args.reason, tt.args.err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewClusterNotManaged() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClusterNotManaged(t *testing.T) {
+	type args struct {
+		err error
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			name: "return true if ClusterNotManaged",
+			args: args{
+				err: &InteroperatorError{
+					Err:     nil,
+					Code:    CodeClusterNotManaged,
+					Message: message,
+				},
+			},
+			want: true,
+		},
+		{
+			name: "return false if not ClusterNotManaged",
+			args: args{
+				err: &InteroperatorError{
+					Err:     nil,
+					Code:    CodeUnknown,
+					Message: message,
+				},
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClusterNotManaged(tt.args.err); got != tt.want {
+				t.Errorf("ClusterNotManaged() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestNewMarshalError(t *testing.T) {
 	type args struct {
 		message string
@@ -11,6 +11,7 @@ const (
 	PasswordConfigKey        = "OPERATOR_APIS_APP_PASSWORD"
 	PageSizeKey              = "OPERATOR_APIS_APP_PAGE_SIZE"
 	DefaultPageSize          = 5
+	SimulatedInstanceID      = "simulated-instance"
 )
 
 // SupportedQueryKeysToLabels holds supported query keys for get and patch APIs and it's mapping
@@ -11,9 +11,14 @@ import (
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/operator-apis/internal/config"
 
 	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/multiclusterdeploy/replicaauditor"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/schedulers/sflabelselectorscheduler"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/client/clientset/versioned"
+	interoperatorConstants "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	interoperatorErrors "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/operator-apis/internal/constants"
 	"github.com/gorilla/mux"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
@@ -23,6 +28,8 @@ var log = ctrl.Log.WithName("handler")
 // OperatorApisHandler represents a set of functions to handle Operator APIs
 type OperatorApisHandler struct {
 	appConfig *config.OperatorApisConfig
+	simulator *sflabelselectorscheduler.SFLabelSelectorScheduler
+	auditor   *replicaauditor.ReplicaAuditor
 }
 
 // NewOperatorApisHandler returns OperatorApisHandler using given configuration
@@ -30,8 +37,14 @@ func NewOperatorApisHandler(appConfig *config.OperatorApisConfig) (*OperatorApis
 	if appConfig == nil {
 		return nil, errors.New("configuration was not passed while initializing handler")
 	}
+	simulator, auditor, err := initClusterTools(appConfig.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
 	return &OperatorApisHandler{
 		appConfig: appConfig,
+		simulator: simulator,
+		auditor:   auditor,
 	}, nil
 }
 
@@ -134,6 +147,7 @@ func (h *OperatorApisHandler) GetDeployment(w http.ResponseWriter, r *http.Reque
 	deployment := deploymentInfo{}
 	deployment.DeploymentStatus = &deploymentStatus{}
 	populateDeploymentInfo(instance, &deployment)
+	deployment.Usage = instance.Status.Usage
 	respJSON, err := json.Marshal(deployment)
 	if err != nil {
 		log.Error(err, "Error in json marshalling")
@@ -180,6 +194,191 @@ func (h *OperatorApisHandler) UpdateDeployment(w http.ResponseWriter, r *http.Re
 	fmt.Fprintf(w, "Update for %s was successfully triggered", deploymentID)
 }
 
+// MigrateDeployment triggers migration of a single deployment to another cluster.
+// The target cluster is selected by the scheduler if not provided in the request.
+func (h *OperatorApisHandler) MigrateDeployment(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	vars := mux.Vars(r)
+	instanceID := vars["deploymentID"]
+	deploymentID := GetKubernetesName(instanceID)
+	log.Info("Trying to trigger migration for: ", "instanceID", instanceID, "deployment", deploymentID)
+
+	migrateReq := migrateDeploymentRequest{}
+	if r.Body != nil && r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&migrateReq)
+		if err != nil {
+			log.Error(err, "Error while decoding request body")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	clientset, err := initInteroperatorClientset(h.appConfig.Kubeconfig)
+	if err != nil {
+		log.Error(err, "Error while initializing clients")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	instanceNamespace := "sf-" + deploymentID
+	sfserviceinstanceClient := clientset.OsbV1alpha1().SFServiceInstances(instanceNamespace)
+	instance, err := sfserviceinstanceClient.Get(ctx, deploymentID, metav1.GetOptions{})
+	if err != nil {
+		log.Error(err, "Error while getting service instance from apiserver")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if instance.GetState() != "succeeded" || instance.Spec.ClusterID == "" {
+		msg := fmt.Sprintf("Deployment %s can not be migrated in state %s", deploymentID, instance.GetState())
+		log.Info(msg, "clusterID", instance.Spec.ClusterID)
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
+	if migrateReq.TargetClusterID == instance.Spec.ClusterID {
+		msg := fmt.Sprintf("Deployment %s is already on cluster %s", deploymentID, instance.Spec.ClusterID)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	plan, err := clientset.OsbV1alpha1().SFPlans(interoperatorConstants.InteroperatorNamespace).Get(ctx,
+		instance.Spec.PlanID, metav1.GetOptions{})
+	if err != nil {
+		log.Error(err, "Error while getting plan from apiserver", "planID", instance.Spec.PlanID)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !plan.IsMigratable() {
+		msg := fmt.Sprintf("Deployment %s can not be migrated as plan %s does not provide backup and restore templates",
+			deploymentID, instance.Spec.PlanID)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	now := metav1.Now()
+	instance.SetState("migrate")
+	instance.Status.Migration = &osbv1alpha1.MigrationStatus{
+		SourceClusterID: instance.Spec.ClusterID,
+		TargetClusterID: migrateReq.TargetClusterID,
+		Phase:           osbv1alpha1.MigrationPhasePending,
+		StartTime:       &now,
+	}
+	_, err = sfserviceinstanceClient.Update(ctx, instance, metav1.UpdateOptions{})
+	if err != nil {
+		log.Error(err, "Error while updating instance")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Info("Triggered migration for: ", "instanceID", instanceID, "deployment", deploymentID,
+		"targetClusterID", migrateReq.TargetClusterID)
+	fmt.Fprintf(w, "Migration for %s was successfully triggered", deploymentID)
+}
+
+// SimulateScheduling returns the cluster which the scheduler would choose for a
+// deployment of the given plan, along with the evaluation of all the clusters.
+// No deployment is created.
+func (h *OperatorApisHandler) SimulateScheduling(w http.ResponseWriter, r *http.Request) {
+	simulateReq := simulateSchedulingRequest{}
+	if r.Body == nil || r.ContentLength == 0 {
+		http.Error(w, "planId is required", http.StatusBadRequest)
+		return
+	}
+	err := json.NewDecoder(r.Body).Decode(&simulateReq)
+	if err != nil {
+		log.Error(err, "Error while decoding request body")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if simulateReq.PlanID == "" {
+		http.Error(w, "planId is required", http.StatusBadRequest)
+		return
+	}
+	instanceID := simulateReq.InstanceID
+	if instanceID == "" {
+		instanceID = constants.SimulatedInstanceID
+	}
+	deploymentID := GetKubernetesName(instanceID)
+	log.Info("Trying to simulate scheduling for: ", "instanceID", instanceID, "planID", simulateReq.PlanID)
+
+	instance := &osbv1alpha1.SFServiceInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deploymentID,
+			Namespace: "sf-" + deploymentID,
+		},
+		Spec: osbv1alpha1.SFServiceInstanceSpec{
+			InstanceID:    instanceID,
+			ServiceID:     simulateReq.ServiceID,
+			PlanID:        simulateReq.PlanID,
+			RawContext:    simulateReq.Context,
+			RawParameters: simulateReq.Parameters,
+		},
+	}
+	decision, err := h.simulator.Simulate(instance)
+	if err != nil {
+		log.Error(err, "Error while simulating scheduling", "planID", simulateReq.PlanID)
+		if apiErrors.IsNotFound(err) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if interoperatorErrors.InputError(err) || interoperatorErrors.RendererError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := schedulingSimulationResponse{
+		ClusterID:  decision.SelectedCluster,
+		Scheduling: decision,
+	}
+	respJSON, err := json.Marshal(resp)
+	if err != nil {
+		log.Error(err, "Error in json marshalling")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err = w.Write(respJSON); err != nil {
+		log.Error(err, "could not write response.")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// AuditClusterReplicas compares the deployments and bindings assigned to the
+// cluster in the master cluster with their replicas in the cluster and
+// returns the divergences found. Nothing is repaired.
+func (h *OperatorApisHandler) AuditClusterReplicas(w http.ResponseWriter, r *http.Request) {
+	clusterID := mux.Vars(r)["clusterID"]
+	log.Info("Trying to audit replicas of cluster", "clusterID", clusterID)
+
+	report, err := h.auditor.Audit(clusterID)
+	if err != nil {
+		log.Error(err, "Error while auditing replicas of cluster", "clusterID", clusterID)
+		if interoperatorErrors.NotFound(err) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if interoperatorErrors.PreconditionError(err) || interoperatorErrors.ClusterNotManaged(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respJSON, err := json.Marshal(report)
+	if err != nil {
+		log.Error(err, "Error in json marshalling")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err = w.Write(respJSON); err != nil {
+		log.Error(err, "could not write response.")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
 // UpdateDeploymentsInBatch triggers update of all deployments in given batch
 func (h *OperatorApisHandler) UpdateDeploymentsInBatch(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
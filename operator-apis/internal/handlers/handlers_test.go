@@ -6,19 +6,25 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/operator-apis/internal/config"
 
 	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/multiclusterdeploy/replicaauditor"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/operator-apis/internal/constants"
 	"github.com/gorilla/mux"
 	corev1 "k8s.io/api/core/v1"
 	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/onsi/gomega"
@@ -157,6 +163,11 @@ func Test_handler_GetDeployment(t *testing.T) {
 					t.Errorf("handler returned wrong deployment response: got %v want %v",
 						deploymentResp, *instance)
 				}
+				g.Expect(deploymentResp.Usage).To(gomega.HaveLen(len(instance.Status.Usage)))
+				for name, quantity := range instance.Status.Usage {
+					got := deploymentResp.Usage[name]
+					g.Expect(got.Cmp(quantity)).To(gomega.Equal(0))
+				}
 			}
 			if tt.wantErr {
 				if status := rr.Code; status == http.StatusOK {
@@ -519,6 +530,413 @@ func Test_handler_UpdateDeployment(t *testing.T) {
 	}
 }
 
+func Test_handler_MigrateDeployment(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	migrationPlan := &osbv1alpha1.SFPlan{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "plan-id",
+			Namespace: "default",
+		},
+		Spec: osbv1alpha1.SFPlanSpec{
+			Name:        "plan-name",
+			ID:          "plan-id",
+			Description: "description",
+			ServiceID:   "service-id",
+			Free:        true,
+			Bindable:    true,
+			Templates: []osbv1alpha1.TemplateSpec{
+				{
+					Action:  osbv1alpha1.BackupAction,
+					Type:    "gotemplate",
+					Content: "backup",
+				},
+				{
+					Action:  osbv1alpha1.RestoreAction,
+					Type:    "gotemplate",
+					Content: "restore",
+				},
+			},
+		},
+	}
+	tests := []struct {
+		name            string
+		args            testArgs
+		body            string
+		targetClusterID string
+		wantCode        int
+		setup           func(*testArgs)
+		cleanup         func(*testArgs)
+	}{
+		{
+			name: "migrate deployment to the given cluster",
+			args: testArgs{
+				appConfig: &config.OperatorApisConfig{
+					Kubeconfig: kubeConfig,
+				},
+				totalDeployments: 1,
+				deploymentIDs:    []string{"instance-id"},
+				serviceIDs:       []string{"service-id"},
+				planIDs:          []string{"plan-id"},
+			},
+			body:            `{"targetClusterId": "2"}`,
+			targetClusterID: "2",
+			wantCode:        http.StatusOK,
+			setup: func(args *testArgs) {
+				g.Expect(deployTestResources(c, args)).NotTo(gomega.HaveOccurred())
+				g.Expect(c.Create(context.TODO(), migrationPlan.DeepCopy())).NotTo(gomega.HaveOccurred())
+			},
+			cleanup: func(args *testArgs) {
+				g.Expect(cleanupTestResources(c, args)).NotTo(gomega.HaveOccurred())
+				g.Expect(c.Delete(context.TODO(), migrationPlan.DeepCopy())).NotTo(gomega.HaveOccurred())
+			},
+		},
+		{
+			name: "migrate deployment to the cluster selected by scheduler",
+			args: testArgs{
+				appConfig: &config.OperatorApisConfig{
+					Kubeconfig: kubeConfig,
+				},
+				totalDeployments: 1,
+				deploymentIDs:    []string{"instance-id"},
+				serviceIDs:       []string{"service-id"},
+				planIDs:          []string{"plan-id"},
+			},
+			wantCode: http.StatusOK,
+			setup: func(args *testArgs) {
+				g.Expect(deployTestResources(c, args)).NotTo(gomega.HaveOccurred())
+				g.Expect(c.Create(context.TODO(), migrationPlan.DeepCopy())).NotTo(gomega.HaveOccurred())
+			},
+			cleanup: func(args *testArgs) {
+				g.Expect(cleanupTestResources(c, args)).NotTo(gomega.HaveOccurred())
+				g.Expect(c.Delete(context.TODO(), migrationPlan.DeepCopy())).NotTo(gomega.HaveOccurred())
+			},
+		},
+		{
+			name: "fail if plan does not provide backup and restore templates",
+			args: testArgs{
+				appConfig: &config.OperatorApisConfig{
+					Kubeconfig: kubeConfig,
+				},
+				totalDeployments: 1,
+				deploymentIDs:    []string{"instance-id"},
+				serviceIDs:       []string{"service-id"},
+				planIDs:          []string{"plan-id"},
+			},
+			body:     `{"targetClusterId": "2"}`,
+			wantCode: http.StatusBadRequest,
+			setup: func(args *testArgs) {
+				g.Expect(deployTestResources(c, args)).NotTo(gomega.HaveOccurred())
+				plan := migrationPlan.DeepCopy()
+				plan.Spec.Templates = plan.Spec.Templates[:1]
+				g.Expect(c.Create(context.TODO(), plan)).NotTo(gomega.HaveOccurred())
+			},
+			cleanup: func(args *testArgs) {
+				g.Expect(cleanupTestResources(c, args)).NotTo(gomega.HaveOccurred())
+				g.Expect(c.Delete(context.TODO(), migrationPlan.DeepCopy())).NotTo(gomega.HaveOccurred())
+			},
+		},
+		{
+			name: "fail if deployment is already on the target cluster",
+			args: testArgs{
+				appConfig: &config.OperatorApisConfig{
+					Kubeconfig: kubeConfig,
+				},
+				totalDeployments: 1,
+				deploymentIDs:    []string{"instance-id"},
+				serviceIDs:       []string{"service-id"},
+				planIDs:          []string{"plan-id"},
+			},
+			body:     `{"targetClusterId": "1"}`,
+			wantCode: http.StatusBadRequest,
+			setup: func(args *testArgs) {
+				g.Expect(deployTestResources(c, args)).NotTo(gomega.HaveOccurred())
+			},
+			cleanup: func(args *testArgs) {
+				g.Expect(cleanupTestResources(c, args)).NotTo(gomega.HaveOccurred())
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.setup != nil {
+				tt.setup(&tt.args)
+			}
+			if tt.cleanup != nil {
+				defer tt.cleanup(&tt.args)
+			}
+			h, _ := NewOperatorApisHandler(tt.args.appConfig)
+			router := mux.NewRouter()
+			router.HandleFunc("/operator/deployments/{deploymentID}/migrate", h.MigrateDeployment).Methods("POST")
+			req, err := http.NewRequest("POST", "/operator/deployments/"+tt.args.deploymentIDs[0]+"/migrate",
+				strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if status := rr.Code; status != tt.wantCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantCode)
+			}
+			if tt.wantCode == http.StatusOK {
+				instance := &osbv1alpha1.SFServiceInstance{}
+				key := types.NamespacedName{
+					Name:      tt.args.deploymentIDs[0],
+					Namespace: "sf-" + tt.args.deploymentIDs[0],
+				}
+				g.Expect(c.Get(context.TODO(), key, instance)).NotTo(gomega.HaveOccurred())
+				g.Expect(instance.GetState()).To(gomega.Equal("migrate"))
+				g.Expect(instance.Status.Migration).NotTo(gomega.BeNil())
+				g.Expect(instance.Status.Migration.SourceClusterID).To(gomega.Equal("1"))
+				g.Expect(instance.Status.Migration.TargetClusterID).To(gomega.Equal(tt.targetClusterID))
+				g.Expect(instance.Status.Migration.Phase).To(gomega.Equal(osbv1alpha1.MigrationPhasePending))
+			}
+		})
+	}
+}
+
+func Test_handler_SimulateScheduling(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	plan := &osbv1alpha1.SFPlan{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "simulate-plan-id",
+			Namespace: "default",
+		},
+		Spec: osbv1alpha1.SFPlanSpec{
+			Name:        "simulate-plan",
+			ID:          "simulate-plan-id",
+			Description: "description",
+			ServiceID:   "simulate-service-id",
+			Free:        true,
+			Bindable:    true,
+			Templates: []osbv1alpha1.TemplateSpec{
+				{
+					Action:  osbv1alpha1.ClusterLabelSelectorAction,
+					Type:    "gotemplate",
+					Content: "plan={{ .instance.spec.planId }}\n",
+				},
+			},
+		},
+	}
+	service := &osbv1alpha1.SFService{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "simulate-service-id",
+			Namespace: "default",
+		},
+		Spec: osbv1alpha1.SFServiceSpec{
+			Name:        "simulate-service",
+			ID:          "simulate-service-id",
+			Description: "description",
+			Bindable:    true,
+		},
+	}
+	clusters := []*resourcev1alpha1.SFCluster{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "1",
+				Namespace: "default",
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "2",
+				Namespace: "default",
+				Labels:    map[string]string{"plan": "simulate-plan-id"},
+			},
+		},
+	}
+	g.Expect(c.Create(context.TODO(), plan)).NotTo(gomega.HaveOccurred())
+	defer c.Delete(context.TODO(), plan)
+	g.Expect(c.Create(context.TODO(), service)).NotTo(gomega.HaveOccurred())
+	defer c.Delete(context.TODO(), service)
+	for _, cluster := range clusters {
+		g.Expect(c.Create(context.TODO(), cluster)).NotTo(gomega.HaveOccurred())
+		defer c.Delete(context.TODO(), cluster)
+	}
+
+	tests := []struct {
+		name          string
+		body          string
+		wantCode      int
+		wantClusterID string
+	}{
+		{
+			name:          "return the cluster selected by the scheduler",
+			body:          `{"planId": "simulate-plan-id"}`,
+			wantCode:      http.StatusOK,
+			wantClusterID: "2",
+		},
+		{
+			name:     "fail if planId is not provided",
+			body:     `{"serviceId": "simulate-service-id"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "fail if serviceId does not match the plan",
+			body:     `{"planId": "simulate-plan-id", "serviceId": "service-id"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "fail if plan is not found",
+			body:     `{"planId": "unknown-plan-id"}`,
+			wantCode: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := NewOperatorApisHandler(&config.OperatorApisConfig{
+				Kubeconfig: kubeConfig,
+			})
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+			router := mux.NewRouter()
+			router.HandleFunc("/operator/scheduler/simulate", h.SimulateScheduling).Methods("POST")
+			req, err := http.NewRequest("POST", "/operator/scheduler/simulate", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if status := rr.Code; status != tt.wantCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantCode)
+			}
+			if tt.wantCode == http.StatusOK {
+				resp := schedulingSimulationResponse{}
+				g.Expect(json.Unmarshal(rr.Body.Bytes(), &resp)).NotTo(gomega.HaveOccurred())
+				g.Expect(resp.ClusterID).To(gomega.Equal(tt.wantClusterID))
+				g.Expect(resp.Scheduling).NotTo(gomega.BeNil())
+				g.Expect(resp.Scheduling.Clusters).To(gomega.HaveLen(len(clusters)))
+
+				instance := &osbv1alpha1.SFServiceInstance{}
+				err = c.Get(context.TODO(), types.NamespacedName{
+					Name:      constants.SimulatedInstanceID,
+					Namespace: "sf-" + constants.SimulatedInstanceID,
+				}, instance)
+				g.Expect(apiErrors.IsNotFound(err)).To(gomega.BeTrue())
+			}
+		})
+	}
+}
+
+func Test_handler_AuditClusterReplicas(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	// Cluster 2 uses the test cluster itself, so each object is its own
+	// replica
+	kubeconfigBytes, err := clientcmd.Write(clientcmdapi.Config{
+		Clusters: map[string]*clientcmdapi.Cluster{
+			"test": {Server: kubeConfig.Host},
+		},
+		Contexts: map[string]*clientcmdapi.Context{
+			"test": {Cluster: "test"},
+		},
+		CurrentContext: "test",
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "audit-cluster-secret",
+			Namespace: "default",
+		},
+		Data: map[string][]byte{
+			"kubeconfig": kubeconfigBytes,
+		},
+	}
+	clusters := []*resourcev1alpha1.SFCluster{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "1",
+				Namespace: "default",
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "2",
+				Namespace: "default",
+			},
+			Spec: resourcev1alpha1.SFClusterSpec{
+				SecretRef: "audit-cluster-secret",
+			},
+		},
+	}
+	instance := &osbv1alpha1.SFServiceInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "audit-instance-id",
+			Namespace:  "default",
+			Finalizers: []string{"interoperator.servicefabrik.io"},
+		},
+		Spec: osbv1alpha1.SFServiceInstanceSpec{
+			InstanceID: "audit-instance-id",
+			ServiceID:  "service-id",
+			PlanID:     "plan-id",
+			ClusterID:  "2",
+		},
+	}
+	g.Expect(c.Create(context.TODO(), secret)).NotTo(gomega.HaveOccurred())
+	defer c.Delete(context.TODO(), secret)
+	for _, cluster := range clusters {
+		g.Expect(c.Create(context.TODO(), cluster)).NotTo(gomega.HaveOccurred())
+		defer c.Delete(context.TODO(), cluster)
+	}
+	g.Expect(c.Create(context.TODO(), instance)).NotTo(gomega.HaveOccurred())
+	instance.Status.State = "succeeded"
+	g.Expect(c.Update(context.TODO(), instance)).NotTo(gomega.HaveOccurred())
+	defer func() {
+		instance.SetFinalizers(nil)
+		c.Update(context.TODO(), instance)
+		c.Delete(context.TODO(), instance)
+	}()
+
+	tests := []struct {
+		name      string
+		clusterID string
+		wantCode  int
+	}{
+		{
+			name:      "return the audit report of the cluster",
+			clusterID: "2",
+			wantCode:  http.StatusOK,
+		},
+		{
+			name:      "fail for the primary cluster",
+			clusterID: "1",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "fail if cluster is not found",
+			clusterID: "unknown-cluster",
+			wantCode:  http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := NewOperatorApisHandler(&config.OperatorApisConfig{
+				Kubeconfig: kubeConfig,
+			})
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+			router := mux.NewRouter()
+			router.HandleFunc("/operator/clusters/{clusterID}/replicas/audit", h.AuditClusterReplicas).Methods("GET")
+			req, err := http.NewRequest("GET", "/operator/clusters/"+tt.clusterID+"/replicas/audit", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if status := rr.Code; status != tt.wantCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantCode)
+			}
+			if tt.wantCode == http.StatusOK {
+				report := replicaauditor.Report{}
+				g.Expect(json.Unmarshal(rr.Body.Bytes(), &report)).NotTo(gomega.HaveOccurred())
+				g.Expect(report.ClusterID).To(gomega.Equal(tt.clusterID))
+				g.Expect(report.Instances).To(gomega.Equal(1))
+				for _, d := range report.Divergences {
+					g.Expect(d.Name).NotTo(gomega.Equal(instance.GetName()))
+				}
+			}
+		})
+	}
+}
+
 func Test_handler_UpdateDeploymentsInBatch(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
 	tests := []struct {
@@ -727,6 +1145,10 @@ func deployTestResources(c client.Client, args *testArgs) error {
 			Status: osbv1alpha1.SFServiceInstanceStatus{
 				State:       "succeeded",
 				Description: "Deployment succeeded",
+				Usage: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("1"),
+					corev1.ResourceMemory: resource.MustParse("2Gi"),
+				},
 			},
 		}
 		ns := &corev1.Namespace{
@@ -0,0 +1,15 @@
+package handlers
+
+import "k8s.io/apimachinery/pkg/runtime"
+
+type migrateDeploymentRequest struct {
+	TargetClusterID string `json:"targetClusterId,omitempty"`
+}
+
+type simulateSchedulingRequest struct {
+	InstanceID string                `json:"instanceId,omitempty"`
+	ServiceID  string                `json:"serviceId,omitempty"`
+	PlanID     string                `json:"planId"`
+	Context    *runtime.RawExtension `json:"context,omitempty"`
+	Parameters *runtime.RawExtension `json:"parameters,omitempty"`
+}
@@ -1,6 +1,11 @@
 package handlers
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
 
 type deploymentsSummaryResponse struct {
 	TotalDeployments       int              `json:"totalDeployments"`
@@ -17,9 +22,16 @@ type deploymentInfo struct {
 	Context          json.RawMessage   `json:"context,omitempty"`
 	ClusterID        string            `json:"clusterId"`
 	DeploymentStatus *deploymentStatus `json:"status,omitempty"`
+	// Usage is reported only for a single deployment
+	Usage corev1.ResourceList `json:"usage,omitempty"`
 }
 
 type deploymentStatus struct {
 	State       string `json:"state"`
 	Description string `json:"description"`
 }
+
+type schedulingSimulationResponse struct {
+	ClusterID  string                        `json:"clusterId"`
+	Scheduling *osbv1alpha1.SchedulingStatus `json:"scheduling"`
+}
@@ -13,9 +13,16 @@ import (
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/operator-apis/internal/config"
 
 	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/multiclusterdeploy/replicaauditor"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/schedulers/sflabelselectorscheduler"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/client/clientset/versioned"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/operator-apis/internal/constants"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 )
 
 func initInteroperatorClientset(kubeconfig *rest.Config) (*versioned.Clientset, error) {
@@ -27,6 +34,37 @@ func initInteroperatorClientset(kubeconfig *rest.Config) (*versioned.Clientset,
 	return clientset, nil
 }
 
+// initClusterTools returns the scheduler simulator and the replica auditor.
+// Both share the scheme and the lazily discovered rest mapper.
+func initClusterTools(kubeconfig *rest.Config) (*sflabelselectorscheduler.SFLabelSelectorScheduler, *replicaauditor.ReplicaAuditor, error) {
+	scheme := runtime.NewScheme()
+	for _, addToScheme := range []func(*runtime.Scheme) error{
+		clientgoscheme.AddToScheme,
+		osbv1alpha1.AddToScheme,
+		resourcev1alpha1.AddToScheme,
+	} {
+		if err := addToScheme(scheme); err != nil {
+			log.Error(err, "Error while creating scheme")
+			return nil, nil, err
+		}
+	}
+	// Discovery is deferred till the first simulation or audit
+	mapper := meta.NewLazyRESTMapperLoader(func() (meta.RESTMapper, error) {
+		return apiutil.NewDynamicRESTMapper(kubeconfig)
+	})
+	simulator, err := sflabelselectorscheduler.NewSimulator(kubeconfig, scheme, mapper)
+	if err != nil {
+		log.Error(err, "Error while creating scheduler simulator")
+		return nil, nil, err
+	}
+	auditor, err := replicaauditor.NewAuditor(kubeconfig, scheme, mapper)
+	if err != nil {
+		log.Error(err, "Error while creating replica auditor")
+		return nil, nil, err
+	}
+	return simulator, auditor, nil
+}
+
 func createLabelSelectorFromQueryParams(r *http.Request) string {
 	var labelSelectors []string
 	for queryKey, label := range constants.SupportedQueryKeysToLabels {
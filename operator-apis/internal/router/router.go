@@ -25,5 +25,8 @@ func GetOperatorApisRouter(appConfig *config.OperatorApisConfig) (*mux.Router, e
 	operatorApisRouter.HandleFunc("/deployments/{deploymentID}", h.GetDeployment).Methods("GET")
 	operatorApisRouter.HandleFunc("/deployments/{deploymentID}", h.UpdateDeployment).Methods("PATCH")
 	operatorApisRouter.HandleFunc("/deployments", h.UpdateDeploymentsInBatch).Methods("PATCH")
+	operatorApisRouter.HandleFunc("/deployments/{deploymentID}/migrate", h.MigrateDeployment).Methods("POST")
+	operatorApisRouter.HandleFunc("/scheduler/simulate", h.SimulateScheduling).Methods("POST")
+	operatorApisRouter.HandleFunc("/clusters/{clusterID}/replicas/audit", h.AuditClusterReplicas).Methods("GET")
 	return r, nil
 }
@@ -60,6 +60,18 @@ func TestGetOperatorApisRouter(t *testing.T) {
 						path:   "/operator/deployments/{deploymentID}",
 						method: "PATCH",
 					},
+					routeInfo{
+						path:   "/operator/deployments/{deploymentID}/migrate",
+						method: "POST",
+					},
+					routeInfo{
+						path:   "/operator/scheduler/simulate",
+						method: "POST",
+					},
+					routeInfo{
+						path:   "/operator/clusters/{clusterID}/replicas/audit",
+						method: "GET",
+					},
 				},
 			},
 			want:    true,